@@ -0,0 +1,245 @@
+// Package backup reads and writes the stream format of BackupRead and
+// BackupWrite, a sequence of WIN32_STREAM_ID headers each followed by data of
+// the stream, so that a file with all of its streams can be moved as a single
+// blob on any platform.
+package backup
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/Snshadow/ntfs-ads/internal/winfmt"
+)
+
+// stream IDs of WIN32_STREAM_ID
+const (
+	BackupData               = 1  // unnamed data stream
+	BackupEAData             = 2  // extended attributes
+	BackupSecurityData       = 3  // security descriptor
+	BackupAlternateData      = 4  // named data stream
+	BackupLink               = 5  // hard link information
+	BackupPropertyData       = 6  // property data
+	BackupObjectID           = 7  // object ID
+	BackupReparseData        = 8  // reparse point data
+	BackupSparseBlock        = 9  // block of sparse data stream
+	BackupTxfsData           = 10 // transactional NTFS data
+	BackupGhostedFileExtents = 11 // ghosted file extents
+)
+
+// attributes of WIN32_STREAM_ID
+const (
+	StreamNormalAttribute    = 0x00
+	StreamModifiedWhenRead   = 0x01
+	StreamContainsSecurity   = 0x02
+	StreamContainsProperties = 0x04
+	StreamSparseAttribute    = 0x08
+)
+
+const (
+	headerSize      = 20 // WIN32_STREAM_ID without cStreamName
+	sparseOffSize   = 8  // offset at the start of BACKUP_SPARSE_BLOCK
+	maxNameSize     = 0x10000
+	dataStreamType  = "$DATA"
+	streamSeparator = ":"
+)
+
+var (
+	ErrInvalidHeader = errors.New("invalid WIN32_STREAM_ID")
+	ErrWriteTooLong  = errors.New("write exceeds size of stream")
+	ErrIncomplete    = errors.New("stream is not completely written")
+	ErrSparse        = errors.New("sparse block needs io.WriterAt to be restored")
+	ErrInvalidName   = errors.New("invalid name of named data stream")
+)
+
+// Header is WIN32_STREAM_ID of a stream.
+type Header struct {
+	ID         uint32
+	Attributes uint32
+	Size       int64  // size of data, without offset of BACKUP_SPARSE_BLOCK
+	Name       string // name of the stream as ":name:$DATA", only for BACKUP_ALTERNATE_DATA
+	Offset     int64  // offset of data in the stream, only for BACKUP_SPARSE_BLOCK
+}
+
+// StreamName returns name of the named data stream without ":" and ":$DATA".
+func (h *Header) StreamName() string {
+	name := strings.TrimPrefix(h.Name, streamSeparator)
+	if i := strings.LastIndex(name, streamSeparator); i >= 0 && strings.EqualFold(name[i+1:], dataStreamType) {
+		name = name[:i]
+	}
+
+	return name
+}
+
+// AlternateDataHeader returns header of the named data stream with size.
+func AlternateDataHeader(name string, size int64) *Header {
+	return &Header{
+		ID:   BackupAlternateData,
+		Size: size,
+		Name: streamSeparator + name + streamSeparator + dataStreamType,
+	}
+}
+
+// Reader reads streams in format of BackupRead.
+type Reader struct {
+	r    io.Reader
+	left int64 // bytes left in current stream
+}
+
+// NewReader returns Reader reading streams from r.
+func NewReader(r io.Reader) *Reader {
+	return &Reader{r: r}
+}
+
+// Next skips the rest of current stream and returns the header of the next
+// stream, or io.EOF if there is no more stream.
+func (r *Reader) Next() (*Header, error) {
+	if r.left > 0 {
+		if _, err := io.CopyN(io.Discard, r.r, r.left); err != nil {
+			return nil, unexpectedEOF(err)
+		}
+		r.left = 0
+	}
+
+	b := make([]byte, headerSize)
+	if _, err := io.ReadFull(r.r, b); err != nil {
+		// io.EOF only if no byte of header was read
+		return nil, err
+	}
+
+	hdr := &Header{
+		ID:         binary.LittleEndian.Uint32(b),
+		Attributes: binary.LittleEndian.Uint32(b[4:]),
+		Size:       int64(binary.LittleEndian.Uint64(b[8:])),
+	}
+	nameSize := binary.LittleEndian.Uint32(b[16:])
+
+	if hdr.Size < 0 || nameSize%2 != 0 || nameSize > maxNameSize {
+		return nil, fmt.Errorf("%w: stream %d with size %d and name size %d", ErrInvalidHeader, hdr.ID, hdr.Size, nameSize)
+	}
+
+	if nameSize > 0 {
+		name := make([]byte, nameSize)
+		if _, err := io.ReadFull(r.r, name); err != nil {
+			return nil, unexpectedEOF(err)
+		}
+		hdr.Name = winfmt.DecodeUTF16(name)
+	}
+
+	if hdr.ID == BackupSparseBlock {
+		if hdr.Size < sparseOffSize {
+			return nil, fmt.Errorf("%w: sparse block with size %d", ErrInvalidHeader, hdr.Size)
+		}
+
+		off := make([]byte, sparseOffSize)
+		if _, err := io.ReadFull(r.r, off); err != nil {
+			return nil, unexpectedEOF(err)
+		}
+		hdr.Offset = int64(binary.LittleEndian.Uint64(off))
+		hdr.Size -= sparseOffSize
+	}
+
+	r.left = hdr.Size
+
+	return hdr, nil
+}
+
+// Read reads data of current stream.
+func (r *Reader) Read(b []byte) (int, error) {
+	if r.left == 0 {
+		return 0, io.EOF
+	}
+
+	if int64(len(b)) > r.left {
+		b = b[:r.left]
+	}
+
+	n, err := r.r.Read(b)
+	r.left -= int64(n)
+	if err == io.EOF && r.left > 0 {
+		err = io.ErrUnexpectedEOF
+	}
+
+	return n, err
+}
+
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+
+	return err
+}
+
+// Writer writes streams in format of BackupRead, which can be passed to BackupWrite.
+type Writer struct {
+	w    io.Writer
+	left int64 // bytes left in current stream
+}
+
+// NewWriter returns Writer writing streams into w.
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{w: w}
+}
+
+// WriteHeader writes header of the next stream, whose data of hdr.Size bytes
+// should be written with Write.
+func (w *Writer) WriteHeader(hdr *Header) error {
+	if w.left > 0 {
+		return fmt.Errorf("%w: %d bytes left", ErrIncomplete, w.left)
+	}
+	if hdr.Size < 0 {
+		return fmt.Errorf("%w: negative size %d", ErrInvalidHeader, hdr.Size)
+	}
+
+	name := winfmt.EncodeUTF16(hdr.Name)
+	if len(name) > maxNameSize {
+		return fmt.Errorf("%w: name \"%s\" is too long", ErrInvalidHeader, hdr.Name)
+	}
+
+	size := hdr.Size
+	if hdr.ID == BackupSparseBlock {
+		size += sparseOffSize
+	}
+
+	b := make([]byte, headerSize, headerSize+len(name)+sparseOffSize)
+	binary.LittleEndian.PutUint32(b, hdr.ID)
+	binary.LittleEndian.PutUint32(b[4:], hdr.Attributes)
+	binary.LittleEndian.PutUint64(b[8:], uint64(size))
+	binary.LittleEndian.PutUint32(b[16:], uint32(len(name)))
+	b = append(b, name...)
+	if hdr.ID == BackupSparseBlock {
+		b = binary.LittleEndian.AppendUint64(b, uint64(hdr.Offset))
+	}
+
+	if _, err := w.w.Write(b); err != nil {
+		return err
+	}
+	w.left = hdr.Size
+
+	return nil
+}
+
+// Write writes data of current stream.
+func (w *Writer) Write(b []byte) (int, error) {
+	if int64(len(b)) > w.left {
+		return 0, ErrWriteTooLong
+	}
+
+	n, err := w.w.Write(b)
+	w.left -= int64(n)
+
+	return n, err
+}
+
+// Close checks that data of the last stream was completely written, the
+// underlying writer is not closed.
+func (w *Writer) Close() error {
+	if w.left > 0 {
+		return fmt.Errorf("%w: %d bytes left", ErrIncomplete, w.left)
+	}
+
+	return nil
+}
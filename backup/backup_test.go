@@ -0,0 +1,242 @@
+package backup
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/Snshadow/ntfs-ads"
+	"github.com/Snshadow/ntfs-ads/internal/winfmt"
+)
+
+// newTestADS returns ADS of file in MemFS having streams of contents.
+func newTestADS(t *testing.T, m *ntfs_ads.MemFS, path string, contents map[string]string) *ntfs_ads.FileADS {
+	t.Helper()
+
+	if err := m.WriteFile(path, []byte("unnamed")); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, content := range contents {
+		strm, err := m.OpenStream(path, name, os.O_WRONLY|os.O_CREATE)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = io.WriteString(strm, content)
+		strm.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ads, err := ntfs_ads.NewFileADS(m, path)
+	if err != nil && !errors.Is(err, ntfs_ads.ErrNoADS) {
+		t.Fatal(err)
+	}
+
+	return &ads
+}
+
+// rawHeader returns WIN32_STREAM_ID with name of nameSize bytes.
+func rawHeader(id uint32, size uint64, nameSize uint32, name string) []byte {
+	b := binary.LittleEndian.AppendUint32(nil, id)
+	b = binary.LittleEndian.AppendUint32(b, 0)
+	b = binary.LittleEndian.AppendUint64(b, size)
+	b = binary.LittleEndian.AppendUint32(b, nameSize)
+
+	return append(b, winfmt.EncodeUTF16(name)...)
+}
+
+// bufferAt is a buffer written at offsets.
+type bufferAt struct {
+	b []byte
+}
+
+func (w *bufferAt) Write(b []byte) (int, error) {
+	w.b = append(w.b, b...)
+	return len(b), nil
+}
+
+func (w *bufferAt) WriteAt(b []byte, off int64) (int, error) {
+	if end := int(off) + len(b); end > len(w.b) {
+		w.b = append(w.b, make([]byte, end-len(w.b))...)
+	}
+
+	return copy(w.b[off:], b), nil
+}
+
+func TestFileADSRoundTrip(t *testing.T) {
+	streams := map[string]string{"Zone.Identifier": "[ZoneTransfer]\r\nZoneId=3\r\n", "notes": "some notes"}
+
+	m := ntfs_ads.NewMemFS()
+	src := newTestADS(t, m, "file.txt", streams)
+
+	var buf bytes.Buffer
+	if err := WriteFileADS(&buf, src, strings.NewReader("unnamed"), 7); err != nil {
+		t.Fatalf("WriteFileADS: %v", err)
+	}
+
+	// streams follow the unnamed data stream in order of their names
+	var names []string
+	br := NewReader(bytes.NewReader(buf.Bytes()))
+	for {
+		hdr, err := br.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Next: %v", err)
+		}
+		names = append(names, hdr.Name)
+	}
+	if want := []string{"", ":Zone.Identifier:$DATA", ":notes:$DATA"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("got streams %q, want %q", names, want)
+	}
+
+	dst := newTestADS(t, m, "copy.txt", map[string]string{"notes": "replaced"})
+
+	var data bytes.Buffer
+	if err := RestoreFileADS(&buf, dst, &data); err != nil {
+		t.Fatalf("RestoreFileADS: %v", err)
+	}
+
+	if data.String() != "unnamed" {
+		t.Errorf("got unnamed stream %q", data.String())
+	}
+	if want := map[string]int64{"Zone.Identifier": 26, "notes": 10}; !reflect.DeepEqual(dst.StreamInfoMap, want) {
+		t.Errorf("got streams %v, want %v", dst.StreamInfoMap, want)
+	}
+
+	for name, content := range streams {
+		strm, err := dst.OpenADS(name, os.O_RDONLY)
+		if err != nil {
+			t.Fatalf("OpenADS: %v", err)
+		}
+		b, _ := io.ReadAll(strm)
+		strm.Close()
+
+		if string(b) != content {
+			t.Errorf("got stream %q of %q, want %q", name, b, content)
+		}
+	}
+}
+
+func TestSparseBlock(t *testing.T) {
+	var buf bytes.Buffer
+	bw := NewWriter(&buf)
+	if err := bw.WriteHeader(&Header{ID: BackupSparseBlock, Size: 3, Offset: 4}); err != nil {
+		t.Fatalf("WriteHeader: %v", err)
+	}
+	if _, err := bw.Write([]byte("abc")); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	if err := bw.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	// size in the header includes the offset of 8 bytes
+	want := rawHeader(BackupSparseBlock, 11, 0, "")
+	want = binary.LittleEndian.AppendUint64(want, 4)
+	want = append(want, "abc"...)
+	if !bytes.Equal(buf.Bytes(), want) {
+		t.Fatalf("got % X, want % X", buf.Bytes(), want)
+	}
+
+	hdr, err := NewReader(bytes.NewReader(want)).Next()
+	if err != nil {
+		t.Fatalf("Next: %v", err)
+	}
+	if hdr.Size != 3 || hdr.Offset != 4 {
+		t.Errorf("got size %d at offset %d, want 3 at 4", hdr.Size, hdr.Offset)
+	}
+
+	m := ntfs_ads.NewMemFS()
+	ads := newTestADS(t, m, "file.txt", nil)
+
+	data := &bufferAt{b: []byte("0123456789")}
+	if err = RestoreFileADS(bytes.NewReader(want), ads, data); err != nil {
+		t.Fatalf("RestoreFileADS: %v", err)
+	}
+	if string(data.b) != "0123abc789" {
+		t.Errorf("got %q, want %q", data.b, "0123abc789")
+	}
+
+	if err = RestoreFileADS(bytes.NewReader(want), ads, &bytes.Buffer{}); !errors.Is(err, ErrSparse) {
+		t.Errorf("RestoreFileADS without io.WriterAt: got %v, want %v", err, ErrSparse)
+	}
+}
+
+func TestReaderInvalidHeader(t *testing.T) {
+	tests := []struct {
+		name string
+		b    []byte
+		want error
+	}{
+		{"odd name size", rawHeader(BackupAlternateData, 0, 3, "abc"), ErrInvalidHeader},
+		{"name too long", rawHeader(BackupAlternateData, 0, maxNameSize+2, ""), ErrInvalidHeader},
+		{"negative size", rawHeader(BackupData, 1<<63, 0, ""), ErrInvalidHeader},
+		{"sparse block without offset", rawHeader(BackupSparseBlock, 7, 0, ""), ErrInvalidHeader},
+		{"truncated name", rawHeader(BackupAlternateData, 0, 8, "a"), io.ErrUnexpectedEOF},
+		{"truncated header", rawHeader(BackupData, 0, 0, "")[:headerSize-1], io.ErrUnexpectedEOF},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewReader(bytes.NewReader(tt.b)).Next(); !errors.Is(err, tt.want) {
+				t.Errorf("got %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestRestoreInvalidName(t *testing.T) {
+	tests := []string{
+		"::$DATA",
+		":a/b:$DATA",
+		":x:$INDEX_ALLOCATION",
+		":" + strings.Repeat("a", 256) + ":$DATA",
+	}
+
+	for _, name := range tests {
+		t.Run(name, func(t *testing.T) {
+			b := rawHeader(BackupAlternateData, 4, uint32(len(winfmt.EncodeUTF16(name))), name)
+			b = append(b, "data"...)
+
+			m := ntfs_ads.NewMemFS()
+			ads := newTestADS(t, m, "file.txt", nil)
+
+			if err := RestoreFileADS(bytes.NewReader(b), ads, nil); !errors.Is(err, ErrInvalidName) {
+				t.Errorf("got %v, want %v", err, ErrInvalidName)
+			}
+			if len(ads.StreamInfoMap) != 0 {
+				t.Errorf("got streams %v", ads.StreamInfoMap)
+			}
+		})
+	}
+}
+
+func TestWriter(t *testing.T) {
+	bw := NewWriter(io.Discard)
+	if err := bw.WriteHeader(AlternateDataHeader("notes", 4)); err != nil {
+		t.Fatalf("WriteHeader: %v", err)
+	}
+
+	if _, err := bw.Write([]byte("too long")); !errors.Is(err, ErrWriteTooLong) {
+		t.Errorf("Write: got %v, want %v", err, ErrWriteTooLong)
+	}
+	if _, err := bw.Write([]byte("ab")); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+
+	if err := bw.WriteHeader(AlternateDataHeader("other", 0)); !errors.Is(err, ErrIncomplete) {
+		t.Errorf("WriteHeader: got %v, want %v", err, ErrIncomplete)
+	}
+	if err := bw.Close(); !errors.Is(err, ErrIncomplete) {
+		t.Errorf("Close: got %v, want %v", err, ErrIncomplete)
+	}
+}
@@ -0,0 +1,64 @@
+//go:build linux
+// +build linux
+
+package backup
+
+import (
+	"errors"
+	"io"
+	"os"
+
+	"github.com/Snshadow/ntfs-ads"
+)
+
+// BackupFile writes the unnamed data stream and named streams in DefaultFS of
+// the file into w, as BackupRead does on Windows. Security descriptor is not
+// available, so processSecurity is ignored.
+func BackupFile(w io.Writer, path string, processSecurity bool) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	ads, err := ntfs_ads.GetFileADS(path)
+	if err != nil && !errors.Is(err, ntfs_ads.ErrNoADS) {
+		return err
+	}
+
+	if info.IsDir() {
+		return WriteFileADS(w, &ads, nil, 0)
+	}
+
+	return WriteFileADS(w, &ads, f, info.Size())
+}
+
+// RestoreFile creates or overwrites the file with streams from r, named
+// streams are written into DefaultFS. Security descriptor is not restored,
+// so processSecurity is ignored.
+func RestoreFile(r io.Reader, path string, processSecurity bool) error {
+	var data io.Writer
+
+	// directories only have named streams
+	if info, err := os.Stat(path); err != nil || !info.IsDir() {
+		f, err := os.OpenFile(path, restoreFlag, 0644)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		data = f
+	}
+
+	ads, err := ntfs_ads.GetFileADS(path)
+	if err != nil && !errors.Is(err, ntfs_ads.ErrNoADS) {
+		return err
+	}
+
+	return RestoreFileADS(r, &ads, data)
+}
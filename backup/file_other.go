@@ -0,0 +1,20 @@
+//go:build !windows && !linux
+// +build !windows,!linux
+
+package backup
+
+import (
+	"io"
+
+	"github.com/Snshadow/ntfs-ads"
+)
+
+// BackupFile is not supported on this platform, use WriteFileADS with a StreamFS.
+func BackupFile(w io.Writer, path string, processSecurity bool) error {
+	return ntfs_ads.ErrUnsupported
+}
+
+// RestoreFile is not supported on this platform, use RestoreFileADS with a StreamFS.
+func RestoreFile(r io.Reader, path string, processSecurity bool) error {
+	return ntfs_ads.ErrUnsupported
+}
@@ -0,0 +1,101 @@
+//go:build windows
+// +build windows
+
+package backup
+
+import (
+	"io"
+	"os"
+
+	"golang.org/x/sys/windows"
+
+	"github.com/Snshadow/ntfs-ads/internal/w32api"
+)
+
+const bufSize = 0x10000
+
+// BackupFile writes all streams of the file into w with BackupRead, security
+// descriptor is included if processSecurity is true.
+func BackupFile(w io.Writer, path string, processSecurity bool) error {
+	pathPtr, err := windows.UTF16PtrFromString(path)
+	if err != nil {
+		return err
+	}
+
+	hnd, err := windows.CreateFile(pathPtr, windows.GENERIC_READ|windows.READ_CONTROL, windows.FILE_SHARE_READ, nil,
+		windows.OPEN_EXISTING, windows.FILE_FLAG_BACKUP_SEMANTICS, 0)
+	if err != nil {
+		return &os.PathError{Op: "open", Path: path, Err: err}
+	}
+	defer windows.CloseHandle(hnd)
+
+	var context uintptr
+	defer w32api.BackupRead(hnd, nil, true, processSecurity, &context)
+
+	buf := make([]byte, bufSize)
+	for {
+		n, err := w32api.BackupRead(hnd, buf, false, processSecurity, &context)
+		if err != nil {
+			return &os.PathError{Op: "BackupRead", Path: path, Err: err}
+		}
+		if n == 0 {
+			return nil
+		}
+
+		if _, err = w.Write(buf[:n]); err != nil {
+			return err
+		}
+	}
+}
+
+// RestoreFile creates or overwrites the file with streams from r with
+// BackupWrite, security descriptor is restored if processSecurity is true.
+func RestoreFile(r io.Reader, path string, processSecurity bool) error {
+	pathPtr, err := windows.UTF16PtrFromString(path)
+	if err != nil {
+		return err
+	}
+
+	var access uint32 = windows.GENERIC_WRITE
+	if processSecurity {
+		access |= windows.WRITE_DAC | windows.WRITE_OWNER
+	}
+
+	// directories cannot be overwritten
+	disposition := uint32(windows.CREATE_ALWAYS)
+	if info, err := os.Stat(path); err == nil && info.IsDir() {
+		disposition = windows.OPEN_EXISTING
+	}
+
+	hnd, err := windows.CreateFile(pathPtr, access, 0, nil, disposition, windows.FILE_FLAG_BACKUP_SEMANTICS, 0)
+	if err != nil {
+		return &os.PathError{Op: "open", Path: path, Err: err}
+	}
+	defer windows.CloseHandle(hnd)
+
+	var context uintptr
+	defer w32api.BackupWrite(hnd, nil, true, processSecurity, &context)
+
+	buf := make([]byte, bufSize)
+	for {
+		n, rErr := r.Read(buf)
+
+		for written := 0; written < n; {
+			wn, err := w32api.BackupWrite(hnd, buf[written:n], false, processSecurity, &context)
+			if err != nil {
+				return &os.PathError{Op: "BackupWrite", Path: path, Err: err}
+			}
+			if wn == 0 {
+				return &os.PathError{Op: "BackupWrite", Path: path, Err: io.ErrShortWrite}
+			}
+			written += int(wn)
+		}
+
+		if rErr == io.EOF {
+			return nil
+		}
+		if rErr != nil {
+			return rErr
+		}
+	}
+}
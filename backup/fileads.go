@@ -0,0 +1,141 @@
+package backup
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+
+	"github.com/Snshadow/ntfs-ads"
+)
+
+// restoreFlag opens streams of the file for restoring.
+const restoreFlag = os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+
+// WriteFileADS writes data of size bytes as the unnamed data stream followed
+// by all named streams of ads into w, in the order of BackupRead. The unnamed
+// data stream is omitted if data is nil, e.g. for directories.
+func WriteFileADS(w io.Writer, ads *ntfs_ads.FileADS, data io.Reader, size int64) error {
+	bw := NewWriter(w)
+
+	if data != nil {
+		if err := bw.WriteHeader(&Header{ID: BackupData, Size: size}); err != nil {
+			return err
+		}
+		if _, err := io.CopyN(bw, data, size); err != nil {
+			return fmt.Errorf("could not write unnamed data stream of \"%s\": %w", ads.Path, err)
+		}
+	}
+
+	names := make([]string, 0, len(ads.StreamInfoMap))
+	for name := range ads.StreamInfoMap {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if err := writeStream(bw, ads, name); err != nil {
+			return fmt.Errorf("could not write stream \"%s\" of \"%s\": %w", name, ads.Path, err)
+		}
+	}
+
+	return bw.Close()
+}
+
+func writeStream(bw *Writer, ads *ntfs_ads.FileADS, name string) error {
+	strm, err := ads.OpenADS(name, os.O_RDONLY)
+	if err != nil {
+		return err
+	}
+	defer strm.Close()
+
+	// size in StreamInfoMap may be outdated
+	size, err := strm.Seek(0, io.SeekEnd)
+	if err != nil {
+		return err
+	}
+	if _, err = strm.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	if err = bw.WriteHeader(AlternateDataHeader(name, size)); err != nil {
+		return err
+	}
+
+	_, err = io.CopyN(bw, strm, size)
+
+	return err
+}
+
+// RestoreFileADS restores streams from r in format of BackupRead, the unnamed
+// data stream is written into data and named streams into ads, replacing
+// streams with the same name. BACKUP_SPARSE_BLOCK is written with data as
+// io.WriterAt, other streams such as security descriptor are skipped. Named
+// streams with invalid names return ErrInvalidName.
+func RestoreFileADS(r io.Reader, ads *ntfs_ads.FileADS, data io.Writer) error {
+	br := NewReader(r)
+
+	for {
+		hdr, err := br.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		switch hdr.ID {
+		case BackupData:
+			if data == nil {
+				continue
+			}
+
+			if _, err = io.Copy(data, br); err != nil {
+				return fmt.Errorf("could not restore unnamed data stream of \"%s\": %w", ads.Path, err)
+			}
+		case BackupSparseBlock:
+			if data == nil {
+				continue
+			}
+
+			wa, ok := data.(io.WriterAt)
+			if !ok {
+				return ErrSparse
+			}
+
+			if _, err = io.Copy(io.NewOffsetWriter(wa, hdr.Offset), br); err != nil {
+				return fmt.Errorf("could not restore sparse block of \"%s\": %w", ads.Path, err)
+			}
+		case BackupAlternateData:
+			name := hdr.StreamName()
+			if !ntfs_ads.ValidStreamName(name) {
+				return fmt.Errorf("%w: \"%s\" of \"%s\"", ErrInvalidName, hdr.Name, ads.Path)
+			}
+
+			if err = restoreStream(br, ads, name); err != nil {
+				return fmt.Errorf("could not restore stream \"%s\" of \"%s\": %w", name, ads.Path, err)
+			}
+		}
+	}
+
+	if err := ads.CollectADS(); err != nil && !errors.Is(err, ntfs_ads.ErrNoADS) {
+		return err
+	}
+
+	return nil
+}
+
+func restoreStream(br *Reader, ads *ntfs_ads.FileADS, name string) error {
+	strm, err := ads.OpenADS(name, restoreFlag)
+	if err != nil {
+		return err
+	}
+
+	if _, err = io.Copy(strm, br); err != nil {
+		strm.Close()
+		return err
+	}
+
+	return strm.Close()
+}
@@ -0,0 +1,220 @@
+// Package bodyfile writes alternate data streams as lines of bodyfile(3.x
+// format of The Sleuth Kit), which can be merged into timelines with mactime.
+package bodyfile
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Snshadow/ntfs-ads"
+	"github.com/Snshadow/ntfs-ads/ntfsimage"
+)
+
+const (
+	modeFile = "r/rrwxrwxrwx"
+	modeDir  = "d/drwxrwxrwx"
+
+	fileNameSuffix = " ($FILE_NAME)" // name suffix of lines with $FILE_NAME timestamps
+	deletedSuffix  = " (deleted)"
+)
+
+// Entry is a line of bodyfile.
+type Entry struct {
+	MD5      string // hex digest, "0" if not computed
+	Name     string // "path:stream"
+	Inode    string // "record-128-id" for streams in NTFS image
+	Mode     string
+	UID      int
+	GID      int
+	Size     int64
+	Accessed time.Time
+	Modified time.Time
+	Changed  time.Time // MFT entry changed
+	Created  time.Time
+}
+
+func unixTime(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+
+	return t.Unix()
+}
+
+// String formats the entry as
+// "MD5|name|inode|mode|UID|GID|size|atime|mtime|ctime|crtime".
+func (e *Entry) String() string {
+	return fmt.Sprintf("%s|%s|%s|%s|%d|%d|%d|%d|%d|%d|%d",
+		e.MD5, e.Name, e.Inode, e.Mode, e.UID, e.GID, e.Size,
+		unixTime(e.Accessed), unixTime(e.Modified), unixTime(e.Changed), unixTime(e.Created))
+}
+
+// Writer writes entries as lines of bodyfile.
+type Writer struct {
+	w io.Writer
+}
+
+// NewWriter returns Writer writing into w.
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{w: w}
+}
+
+// Write writes entries each in a line.
+func (bw *Writer) Write(entries ...Entry) error {
+	for i := range entries {
+		if _, err := fmt.Fprintln(bw.w, entries[i].String()); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Options controls how entries are made.
+type Options struct {
+	MountPoint string // prefix of paths, e.g. "C:" for paths in the image
+	MD5        bool   // compute MD5 of stream data, which reads all data
+}
+
+// hashMD5 returns hex MD5 of data read from r.
+func hashMD5(r io.Reader) (string, error) {
+	h := md5.New()
+	if _, err := io.Copy(h, r); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func sortedNames(m map[string]int64) []string {
+	names := make([]string, 0, len(m))
+	for name := range m {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// ImageEntries returns entries of streams of the file in NTFS image, a line
+// with $STANDARD_INFORMATION timestamps and a line with $FILE_NAME timestamps
+// for each stream as fls of The Sleuth Kit does.
+func ImageEntries(vol *ntfsimage.Volume, f *ntfsimage.FileStreams, opts Options) ([]Entry, error) {
+	mode := modeFile
+	if f.IsDir {
+		mode = modeDir
+	}
+
+	var entries []Entry
+
+	for _, name := range sortedNames(f.StreamInfoMap) {
+		entry := Entry{
+			MD5:   "0",
+			Name:  opts.MountPoint + f.Path + ":" + name,
+			Inode: fmt.Sprintf("%d-%d-%d", f.Record, uint32(ntfsimage.AttrData), f.StreamIDs[name]),
+			Mode:  mode,
+			Size:  f.StreamInfoMap[name],
+		}
+		if f.Deleted {
+			entry.Name += deletedSuffix
+		}
+
+		if opts.MD5 {
+			strm, err := vol.OpenStream(f.Record, name)
+			if err != nil {
+				return entries, fmt.Errorf("could not open stream \"%s\" of \"%s\": %w", name, f.Path, err)
+			}
+
+			if entry.MD5, err = hashMD5(io.NewSectionReader(strm, 0, strm.Size())); err != nil {
+				return entries, fmt.Errorf("could not read stream \"%s\" of \"%s\": %w", name, f.Path, err)
+			}
+		}
+
+		if si := f.StandardInformation; si != nil {
+			entry.Accessed, entry.Modified, entry.Changed, entry.Created = si.Accessed, si.Modified, si.MFTModified, si.Created
+		}
+		entries = append(entries, entry)
+
+		if fn := f.FileName; fn != nil {
+			entry.Name = strings.TrimSuffix(entry.Name, deletedSuffix) + fileNameSuffix
+			if f.Deleted {
+				entry.Name += deletedSuffix
+			}
+
+			entry.Accessed, entry.Modified, entry.Changed, entry.Created = fn.Accessed, fn.Modified, fn.MFTModified, fn.Created
+			entries = append(entries, entry)
+		}
+	}
+
+	return entries, nil
+}
+
+// FileADSEntries returns entries of streams of the file on a mounted volume,
+// with timestamps of the file. $FILE_NAME timestamps are not available on a
+// mounted volume.
+func FileADSEntries(ads *ntfs_ads.FileADS, opts Options) ([]Entry, error) {
+	info, err := os.Stat(ads.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	st, err := statFile(ads.Path, info)
+	if err != nil {
+		return nil, err
+	}
+
+	mode := modeFile
+	if info.IsDir() {
+		mode = modeDir
+	}
+
+	var entries []Entry
+
+	for _, name := range sortedNames(ads.StreamInfoMap) {
+		entry := Entry{
+			MD5:      "0",
+			Name:     opts.MountPoint + filepath.ToSlash(ads.Path) + ":" + name,
+			Inode:    st.inode,
+			Mode:     mode,
+			UID:      st.uid,
+			GID:      st.gid,
+			Size:     ads.StreamInfoMap[name],
+			Accessed: st.accessed,
+			Modified: st.modified,
+			Changed:  st.changed,
+			Created:  st.created,
+		}
+
+		if opts.MD5 {
+			strm, err := ads.OpenADS(name, os.O_RDONLY)
+			if err != nil {
+				return entries, fmt.Errorf("could not open stream \"%s\" of \"%s\": %w", name, ads.Path, err)
+			}
+
+			entry.MD5, err = hashMD5(strm)
+			strm.Close()
+			if err != nil {
+				return entries, fmt.Errorf("could not read stream \"%s\" of \"%s\": %w", name, ads.Path, err)
+			}
+		}
+
+		entries = append(entries, entry)
+	}
+
+	return entries, nil
+}
+
+// fileStat has attributes of a file on a mounted volume.
+type fileStat struct {
+	inode    string
+	uid, gid int
+
+	accessed, modified, changed, created time.Time
+}
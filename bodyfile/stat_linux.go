@@ -0,0 +1,36 @@
+//go:build linux
+// +build linux
+
+package bodyfile
+
+import (
+	"os"
+	"strconv"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// statFile returns inode number, which is MFT record number on ntfs-3g, and
+// timestamps of the file. Creation time is read with statx if available.
+func statFile(path string, info os.FileInfo) (*fileStat, error) {
+	var stx unix.Statx_t
+	if err := unix.Statx(unix.AT_FDCWD, path, 0, unix.STATX_BASIC_STATS|unix.STATX_BTIME, &stx); err != nil {
+		return nil, &os.PathError{Op: "statx", Path: path, Err: err}
+	}
+
+	st := &fileStat{
+		inode:    strconv.FormatUint(stx.Ino, 10),
+		uid:      int(stx.Uid),
+		gid:      int(stx.Gid),
+		accessed: time.Unix(stx.Atime.Sec, int64(stx.Atime.Nsec)),
+		modified: time.Unix(stx.Mtime.Sec, int64(stx.Mtime.Nsec)),
+		changed:  time.Unix(stx.Ctime.Sec, int64(stx.Ctime.Nsec)),
+	}
+
+	if stx.Mask&unix.STATX_BTIME != 0 {
+		st.created = time.Unix(stx.Btime.Sec, int64(stx.Btime.Nsec))
+	}
+
+	return st, nil
+}
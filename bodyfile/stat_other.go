@@ -0,0 +1,16 @@
+//go:build !windows && !linux
+// +build !windows,!linux
+
+package bodyfile
+
+import (
+	"os"
+)
+
+// statFile returns modification time of the file, other attributes are not available.
+func statFile(_ string, info os.FileInfo) (*fileStat, error) {
+	return &fileStat{
+		inode:    "0",
+		modified: info.ModTime(),
+	}, nil
+}
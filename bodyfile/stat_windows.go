@@ -0,0 +1,52 @@
+//go:build windows
+// +build windows
+
+package bodyfile
+
+import (
+	"os"
+	"strconv"
+
+	"golang.org/x/sys/windows"
+
+	"github.com/Snshadow/ntfs-ads/internal/w32api"
+	"github.com/Snshadow/ntfs-ads/internal/winfmt"
+)
+
+// statFile returns MFT record number as inode and timestamps of the file,
+// including time of MFT entry change.
+func statFile(path string, _ os.FileInfo) (*fileStat, error) {
+	u16Path, err := windows.UTF16PtrFromString(path)
+	if err != nil {
+		return nil, err
+	}
+
+	hnd, err := windows.CreateFile(u16Path, windows.FILE_READ_ATTRIBUTES,
+		windows.FILE_SHARE_READ|windows.FILE_SHARE_WRITE|windows.FILE_SHARE_DELETE, nil,
+		windows.OPEN_EXISTING, windows.FILE_FLAG_BACKUP_SEMANTICS, 0)
+	if err != nil {
+		return nil, &os.PathError{Op: "open", Path: path, Err: err}
+	}
+	defer windows.CloseHandle(hnd)
+
+	var fileInfo windows.ByHandleFileInformation
+	if err = windows.GetFileInformationByHandle(hnd, &fileInfo); err != nil {
+		return nil, &os.PathError{Op: "stat", Path: path, Err: err}
+	}
+
+	basicInfo, err := w32api.GetFileBasicInfo(hnd)
+	if err != nil {
+		return nil, &os.PathError{Op: "stat", Path: path, Err: err}
+	}
+
+	// lower 48 bits of file index is MFT record number in NTFS
+	index := uint64(fileInfo.FileIndexHigh)<<32 | uint64(fileInfo.FileIndexLow)
+
+	return &fileStat{
+		inode:    strconv.FormatUint(index&0xFFFFFFFFFFFF, 10),
+		accessed: winfmt.FiletimeToTime(uint64(basicInfo.LastAccessTime)),
+		modified: winfmt.FiletimeToTime(uint64(basicInfo.LastWriteTime)),
+		changed:  winfmt.FiletimeToTime(uint64(basicInfo.ChangeTime)),
+		created:  winfmt.FiletimeToTime(uint64(basicInfo.CreationTime)),
+	}, nil
+}
@@ -0,0 +1,89 @@
+// Package catalog describes well-known names of alternate data streams, with
+// the application which writes them and decoders of their content.
+package catalog
+
+import (
+	"strings"
+)
+
+// MaxDecodeSize is the limit of size of streams to be decoded.
+const MaxDecodeSize = 0x10000
+
+// Field is a decoded field of stream content.
+type Field struct {
+	Key   string
+	Value string
+}
+
+// Entry is a well-known stream name.
+type Entry struct {
+	Name        string
+	Application string // application or component which writes the stream
+	Description string
+
+	// Decode decodes content of the stream into fields, nil if the content is not decoded
+	Decode func(data []byte) ([]Field, error)
+}
+
+var entries = []Entry{
+	{
+		Name:        "Zone.Identifier",
+		Application: "Windows Attachment Manager",
+		Description: "Mark-of-the-Web, security zone and URLs of a downloaded file",
+		Decode:      decodeZone,
+	},
+	{
+		Name:        "SmartScreen",
+		Application: "Microsoft Defender SmartScreen",
+		Description: "result of reputation check of a downloaded file",
+		Decode:      decodeText,
+	},
+	{
+		Name:        "Win32App_1",
+		Application: "Windows",
+		Description: "undocumented stream written on executables, related to app reputation checks",
+	},
+	{
+		Name:        "AFP_AfpInfo",
+		Application: "macOS SMB client, Services for Macintosh",
+		Description: "Finder info(type, creator, flags) of a file on SMB share",
+		Decode:      decodeAfpInfo,
+	},
+	{
+		Name:        "AFP_Resource",
+		Application: "macOS SMB client, Services for Macintosh",
+		Description: "resource fork of a file on SMB share",
+		Decode:      decodeResourceFork,
+	},
+	{
+		Name:        "com.dropbox.attrs",
+		Application: "Dropbox",
+		Description: "attributes of a file synced by Dropbox",
+	},
+	{
+		Name:        "encryptable",
+		Application: "Windows Explorer",
+		Description: "empty stream marking Thumbs.db as allowed to be encrypted",
+	},
+	{
+		Name:        "WofCompressedData",
+		Application: "Windows Overlay Filter",
+		Description: "compressed content of a file compacted by compact /exe, decompressed with wof package",
+	},
+}
+
+// Lookup returns the entry of the stream name, compared case-insensitively as in NTFS.
+func Lookup(name string) (*Entry, bool) {
+	for i := range entries {
+		if strings.EqualFold(entries[i].Name, name) {
+			return &entries[i], true
+		}
+	}
+
+	return nil, false
+}
+
+// Entries returns all entries of the catalog.
+func Entries() []Entry {
+	return append([]Entry(nil), entries...)
+}
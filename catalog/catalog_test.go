@@ -0,0 +1,209 @@
+package catalog
+
+import (
+	"encoding/binary"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// restoreDecoders restores registered decoders after the test.
+func restoreDecoders(t *testing.T) {
+	saved := append([]StreamDecoder(nil), decoders...)
+	t.Cleanup(func() {
+		decoders = saved
+	})
+}
+
+func constDecoder(name, magic, value string) *Decoder {
+	return &Decoder{
+		Name:  name,
+		Magic: []byte(magic),
+		Func: func(data []byte) (any, error) {
+			return value, nil
+		},
+	}
+}
+
+func TestFindDecoder(t *testing.T) {
+	restoreDecoders(t)
+
+	zone := []byte("[ZoneTransfer]\r\nZoneId=3\r\n")
+
+	got, err := Decode("ZONE.IDENTIFIER", zone)
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	if want := (Fields{{"ZoneId", "3(Internet)"}}); !reflect.DeepEqual(got, want) {
+		t.Errorf("built-in decoder: got %v, want %v", got, want)
+	}
+
+	Register(constDecoder("Zone.*", "", "by name"))
+	Register(constDecoder("", "MAGIC", "by magic"))
+
+	tests := []struct {
+		name string
+		data string
+		want any
+		err  error
+	}{
+		{"zone.identifier", string(zone), "by name", nil},
+		{"Zone.Identifier", "MAGIC" + string(zone), "by magic", nil},
+		{"other", "MAGIC", "by magic", nil},
+		{"other", "content", nil, ErrNoDecoder},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name+" "+tt.data, func(t *testing.T) {
+			got, err := Decode(tt.name, []byte(tt.data))
+			if !errors.Is(err, tt.err) || got != tt.want {
+				t.Errorf("got %v with %v, want %v with %v", got, err, tt.want, tt.err)
+			}
+		})
+	}
+}
+
+func TestRegisterPanic(t *testing.T) {
+	tests := []struct {
+		name string
+		d    StreamDecoder
+	}{
+		{"nil", nil},
+		{"nil Decoder", (*Decoder)(nil)},
+		{"no Func", &Decoder{Name: "a"}},
+		{"malformed Name", constDecoder("[a-", "", "")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			restoreDecoders(t)
+
+			defer func() {
+				if recover() == nil {
+					t.Errorf("Register did not panic")
+				}
+			}()
+
+			Register(tt.d)
+		})
+	}
+}
+
+// afpInfo returns AfpInfo with Finder info of type, creator and flags.
+func afpInfo(typ, creator string, flags uint16, backup uint32) []byte {
+	b := make([]byte, afpInfoSize)
+	copy(b, afpSignature)
+	binary.BigEndian.PutUint32(b[4:], afpVersion)
+	binary.BigEndian.PutUint32(b[12:], backup)
+	copy(b[16:], typ)
+	copy(b[20:], creator)
+	binary.BigEndian.PutUint16(b[24:], flags)
+
+	return b
+}
+
+func TestDecodeAfpInfo(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		want []Field
+	}{
+		{"no backup time", afpInfo("TEXT", "ttxt", 0x0100, afpNoBackupTime), []Field{
+			{"Type", "'TEXT'"}, {"Creator", "'ttxt'"}, {"FinderFlags", "0x0100"},
+		}},
+		{"backup time", afpInfo("APPL", "\x00\x00\x00\x01", 0, 86400), []Field{
+			{"Type", "'APPL'"}, {"Creator", "0x00000001"}, {"FinderFlags", "0x0000"}, {"BackupTime", "2000-01-02T00:00:00Z"},
+		}},
+		{"backup time before 2000", afpInfo("TEXT", "ttxt", 0, 0xFFFFFFFF), []Field{
+			{"Type", "'TEXT'"}, {"Creator", "'ttxt'"}, {"FinderFlags", "0x0000"}, {"BackupTime", "1999-12-31T23:59:59Z"},
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := decodeAfpInfo(tt.data)
+			if err != nil {
+				t.Fatalf("decodeAfpInfo: %v", err)
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecodeAfpInfoInvalid(t *testing.T) {
+	valid := afpInfo("TEXT", "ttxt", 0, afpNoBackupTime)
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"short", valid[:afpInfoSize-1]},
+		{"signature", append([]byte("XFP\x00"), valid[4:]...)},
+		{"version", append(append([]byte(nil), valid[:4]...), append([]byte{0, 2, 0, 0}, valid[8:]...)...)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := decodeAfpInfo(tt.data); !errors.Is(err, ErrInvalidContent) {
+				t.Errorf("got %v, want %v", err, ErrInvalidContent)
+			}
+		})
+	}
+}
+
+func resourceFork(dataOff, mapOff, dataLen, mapLen uint32) []byte {
+	b := binary.BigEndian.AppendUint32(nil, dataOff)
+	b = binary.BigEndian.AppendUint32(b, mapOff)
+	b = binary.BigEndian.AppendUint32(b, dataLen)
+
+	return binary.BigEndian.AppendUint32(b, mapLen)
+}
+
+func TestDecodeResourceFork(t *testing.T) {
+	got, err := Decode("AFP_Resource", resourceFork(256, 356, 100, 50))
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+
+	want := Fields{{"DataOffset", "256"}, {"DataLength", "100"}, {"MapOffset", "356"}, {"MapLength", "50"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"short", resourceFork(256, 356, 100, 50)[:resForkHdrSize-1]},
+		{"data offset in header", resourceFork(8, 356, 100, 50)},
+		{"map offset in header", resourceFork(256, 8, 100, 50)},
+		{"map too short", resourceFork(256, 356, 100, resMapHdrSize-1)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := decodeResourceFork(tt.data); !errors.Is(err, ErrInvalidContent) {
+				t.Errorf("got %v, want %v", err, ErrInvalidContent)
+			}
+		})
+	}
+}
+
+func TestRenderFields(t *testing.T) {
+	fields := Fields{{"Type", "'TEXT'"}, {"Creator", "'ttxt'"}}
+
+	if got, want := RenderText(fields), "Type = 'TEXT'\nCreator = 'ttxt'"; got != want {
+		t.Errorf("RenderText: got %q, want %q", got, want)
+	}
+
+	b, err := RenderJSON(fields)
+	if err != nil {
+		t.Fatalf("RenderJSON: %v", err)
+	}
+	if got, want := string(b), "{\n  \"Type\": \"'TEXT'\",\n  \"Creator\": \"'ttxt'\"\n}"; got != want {
+		t.Errorf("RenderJSON: got %q, want %q", got, want)
+	}
+}
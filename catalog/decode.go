@@ -0,0 +1,122 @@
+package catalog
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Snshadow/ntfs-ads/internal/winfmt"
+	"github.com/Snshadow/ntfs-ads/motw"
+)
+
+const (
+	afpInfoSize     = 60 // AfpInfo of Services for Macintosh
+	afpSignature    = "AFP\x00"
+	afpVersion      = 0x00010000
+	afpNoBackupTime = 0x80000000
+	resForkHdrSize  = 16
+	resMapHdrSize   = 28 // minimum size of resource map
+)
+
+var ErrInvalidContent = errors.New("content does not match the stream format")
+
+// afpEpoch is the base of backup time in AfpInfo.
+var afpEpoch = time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func decodeZone(data []byte) ([]Field, error) {
+	info, err := motw.Parse(data)
+	if err != nil {
+		return nil, err
+	}
+
+	fields := []Field{{"ZoneId", fmt.Sprintf("%d(%s)", info.ZoneID, info.ZoneID)}}
+	for _, f := range append([]motw.Field{
+		{Key: "ReferrerUrl", Value: info.ReferrerURL},
+		{Key: "HostUrl", Value: info.HostURL},
+		{Key: "LastWriterPackageFamilyName", Value: info.LastWriterPackageFamilyName},
+		{Key: "AppZoneId", Value: info.AppZoneID},
+	}, info.Extra...) {
+		if f.Value != "" {
+			fields = append(fields, Field{f.Key, f.Value})
+		}
+	}
+
+	return fields, nil
+}
+
+// decodeText decodes content as UTF-16 with BOM or null bytes, or as UTF-8.
+func decodeText(data []byte) ([]Field, error) {
+	var s string
+	switch {
+	case bytes.HasPrefix(data, []byte{0xFF, 0xFE}):
+		s = winfmt.DecodeUTF16(data[2:])
+	case len(data) >= 2 && data[1] == 0:
+		s = winfmt.DecodeUTF16(data)
+	default:
+		s = string(bytes.TrimPrefix(data, []byte{0xEF, 0xBB, 0xBF}))
+	}
+
+	return []Field{{"Value", strings.TrimSpace(strings.Trim(s, "\x00"))}}, nil
+}
+
+// decodeAfpInfo decodes AfpInfo, whose integers are big endian:
+// signature(4), version(4), reserved(4), backup time(4), Finder info(32),
+// ProDOS info(6), reserved(6).
+func decodeAfpInfo(data []byte) ([]Field, error) {
+	if len(data) < afpInfoSize || string(data[:4]) != afpSignature || binary.BigEndian.Uint32(data[4:]) != afpVersion {
+		return nil, ErrInvalidContent
+	}
+
+	finderInfo := data[16:48]
+	fields := []Field{
+		{"Type", fourCC(finderInfo[0:4])},
+		{"Creator", fourCC(finderInfo[4:8])},
+		{"FinderFlags", fmt.Sprintf("0x%04X", binary.BigEndian.Uint16(finderInfo[8:]))},
+	}
+
+	if backup := binary.BigEndian.Uint32(data[12:]); backup != afpNoBackupTime {
+		t := afpEpoch.Add(time.Duration(int32(backup)) * time.Second)
+		fields = append(fields, Field{"BackupTime", t.Format(time.RFC3339)})
+	}
+
+	return fields, nil
+}
+
+// fourCC formats type or creator code, non-printable codes are shown in hex.
+func fourCC(b []byte) string {
+	for _, c := range b {
+		if c < 0x20 || c > 0x7E {
+			return fmt.Sprintf("0x%08X", binary.BigEndian.Uint32(b))
+		}
+	}
+
+	return "'" + string(b) + "'"
+}
+
+// decodeResourceFork decodes header of resource fork, offsets and lengths of
+// resource data and resource map in big endian.
+func decodeResourceFork(data []byte) ([]Field, error) {
+	if len(data) < resForkHdrSize {
+		return nil, ErrInvalidContent
+	}
+
+	dataOff := binary.BigEndian.Uint32(data)
+	mapOff := binary.BigEndian.Uint32(data[4:])
+	dataLen := binary.BigEndian.Uint32(data[8:])
+	mapLen := binary.BigEndian.Uint32(data[12:])
+
+	// data may be truncated to MaxDecodeSize, only header is checked
+	if dataOff < resForkHdrSize || mapOff < resForkHdrSize || mapLen < resMapHdrSize {
+		return nil, ErrInvalidContent
+	}
+
+	return []Field{
+		{"DataOffset", fmt.Sprint(dataOff)},
+		{"DataLength", fmt.Sprint(dataLen)},
+		{"MapOffset", fmt.Sprint(mapOff)},
+		{"MapLength", fmt.Sprint(mapLen)},
+	}, nil
+}
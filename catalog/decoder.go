@@ -0,0 +1,203 @@
+package catalog
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/Snshadow/ntfs-ads"
+)
+
+var ErrNoDecoder = errors.New("no decoder for the stream")
+
+// StreamDecoder decodes content of streams in a format.
+//
+// Match reports whether the stream with the name and content starting with
+// head, up to MaxDecodeSize bytes, is in the format.
+//
+// Decode decodes content of the stream into a value, which is rendered with
+// RenderText and RenderJSON. The value should implement fmt.Stringer to be
+// rendered as text, otherwise it is formatted with "%+v", and is encoded with
+// encoding/json, so it should have exported fields or implement
+// json.Marshaler, as Fields of built-in decoders does.
+type StreamDecoder interface {
+	Match(name string, head []byte) bool
+	Decode(data []byte) (any, error)
+}
+
+// Decoder is a StreamDecoder matching streams by name pattern and content magic.
+type Decoder struct {
+	Name  string // pattern of stream names compared case-insensitively with path.Match, any name if empty
+	Magic []byte // prefix of content, any content if empty
+	Func  func(data []byte) (any, error)
+}
+
+func (d *Decoder) Match(name string, head []byte) bool {
+	if d.Name != "" {
+		if ok, _ := path.Match(strings.ToLower(d.Name), strings.ToLower(name)); !ok {
+			return false
+		}
+	}
+
+	return bytes.HasPrefix(head, d.Magic)
+}
+
+func (d *Decoder) Decode(data []byte) (any, error) {
+	if d.Func == nil {
+		return nil, ErrNoDecoder
+	}
+
+	return d.Func(data)
+}
+
+var (
+	decoders   []StreamDecoder
+	decodersMu sync.RWMutex
+)
+
+func init() {
+	for i := range entries {
+		if e := &entries[i]; e.Decode != nil {
+			decoders = append(decoders, &Decoder{
+				Name: e.Name,
+				Func: func(data []byte) (any, error) {
+					fields, err := e.Decode(data)
+					if err != nil {
+						return nil, err
+					}
+
+					return Fields(fields), nil
+				},
+			})
+		}
+	}
+}
+
+// Register registers the decoder, which takes precedence over decoders
+// registered before and built-in decoders. It panics if d is nil or is a
+// Decoder without Func or with malformed Name pattern.
+func Register(d StreamDecoder) {
+	if d == nil {
+		panic("catalog: Register decoder is nil")
+	}
+	if dec, ok := d.(*Decoder); ok {
+		if dec == nil || dec.Func == nil {
+			panic("catalog: Register decoder has no Func")
+		}
+		if _, err := path.Match(dec.Name, ""); err != nil {
+			panic(fmt.Sprintf("catalog: Register decoder has malformed Name \"%s\"", dec.Name))
+		}
+	}
+
+	decodersMu.Lock()
+	defer decodersMu.Unlock()
+
+	decoders = append(decoders, d)
+}
+
+// FindDecoder returns the last registered decoder matching the stream, or nil.
+func FindDecoder(name string, head []byte) StreamDecoder {
+	decodersMu.RLock()
+	defer decodersMu.RUnlock()
+
+	for i := len(decoders) - 1; i >= 0; i-- {
+		if decoders[i].Match(name, head) {
+			return decoders[i]
+		}
+	}
+
+	return nil
+}
+
+// Decode decodes content of the stream with the matching decoder, or returns
+// ErrNoDecoder if there is none.
+func Decode(name string, data []byte) (any, error) {
+	d := FindDecoder(name, data)
+	if d == nil {
+		return nil, ErrNoDecoder
+	}
+
+	return d.Decode(data)
+}
+
+// DecodeStream decodes up to MaxDecodeSize bytes of the stream read from r.
+func DecodeStream(name string, r io.Reader) (any, error) {
+	data, err := io.ReadAll(io.LimitReader(r, MaxDecodeSize))
+	if err != nil {
+		return nil, err
+	}
+
+	return Decode(name, data)
+}
+
+// DecodeADS decodes the named stream of the file.
+func DecodeADS(ads *ntfs_ads.FileADS, name string) (any, error) {
+	strm, err := ads.OpenADS(name, os.O_RDONLY)
+	if err != nil {
+		return nil, err
+	}
+	defer strm.Close()
+
+	return DecodeStream(name, strm)
+}
+
+// Fields is decoded value of built-in decoders.
+type Fields []Field
+
+// String returns fields as "key = value" lines.
+func (f Fields) String() string {
+	lines := make([]string, len(f))
+	for i, field := range f {
+		lines[i] = field.Key + " = " + field.Value
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// MarshalJSON returns fields as a JSON object in order.
+func (f Fields) MarshalJSON() ([]byte, error) {
+	var b bytes.Buffer
+
+	b.WriteByte('{')
+	for i, field := range f {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+
+		key, err := json.Marshal(field.Key)
+		if err != nil {
+			return nil, err
+		}
+		value, err := json.Marshal(field.Value)
+		if err != nil {
+			return nil, err
+		}
+
+		b.Write(key)
+		b.WriteByte(':')
+		b.Write(value)
+	}
+	b.WriteByte('}')
+
+	return b.Bytes(), nil
+}
+
+// RenderText renders decoded value as text, with String method if v has one.
+func RenderText(v any) string {
+	if s, ok := v.(fmt.Stringer); ok {
+		return s.String()
+	}
+
+	return fmt.Sprintf("%+v", v)
+}
+
+// RenderJSON renders decoded value as indented JSON.
+func RenderJSON(v any) ([]byte, error) {
+	return json.MarshalIndent(v, "", "  ")
+}
@@ -1,20 +1,34 @@
 //go:generate goversioninfo query_ads.json
 
-//go:build windows
-// +build windows
+//go:build windows || linux
+// +build windows linux
 
 package main
 
 import (
+	"errors"
 	"flag"
 	"fmt"
 	"io"
+	"io/fs"
 	"os"
 	"path/filepath"
+	"sort"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/Snshadow/ntfs-ads"
+	"github.com/Snshadow/ntfs-ads/bodyfile"
+	"github.com/Snshadow/ntfs-ads/catalog"
 	"github.com/Snshadow/ntfs-ads/cmd/utils"
+	"github.com/Snshadow/ntfs-ads/motw"
+	"github.com/Snshadow/ntfs-ads/mtf"
+	"github.com/Snshadow/ntfs-ads/ntfsimage"
+	"github.com/Snshadow/ntfs-ads/usn"
+	"github.com/Snshadow/ntfs-ads/vdisk"
+	"github.com/Snshadow/ntfs-ads/wim"
+	"github.com/Snshadow/ntfs-ads/wof"
 )
 
 var (
@@ -33,19 +47,39 @@ var (
 )
 
 func main() {
-	var flagStdout bool
-	var flagFileName, flagTargetAds, flagOutFileName string
+	var flagStdout, flagUsn, flagBodyfile, flagWof, flagZone, flagAllTypes bool
+	var bodyOpts bodyfile.Options
+	var flagFileName, flagTargetAds, flagOutFileName, flagImage, flagWim, flagBkf, flagRestore string
+	var flagWimIndex int
+	var imgOpts imageOptions
 
 	flag.BoolVar(&flagStdout, "stdout", false, "write ads content to stdout")
+	flag.BoolVar(&imgOpts.deleted, "deleted", false, "query ADS of deleted files in NTFS volume image")
+	flag.BoolVar(&imgOpts.logFile, "logfile", false, "query history of ADS from $LogFile of NTFS volume image")
+	flag.BoolVar(&flagBodyfile, "bodyfile", false, "write all ADS in NTFS volume image or under filename as bodyfile lines for mactime")
+	flag.BoolVar(&bodyOpts.MD5, "md5", false, "compute MD5 of ADS data for bodyfile lines")
+	flag.StringVar(&bodyOpts.MountPoint, "mount-point", "", "prefix of paths in bodyfile lines, e.g. C:")
+	flag.BoolVar(&flagUsn, "usn", false, "query changes of ADS from USN journal of NTFS volume image, or of the volume whose root is filename")
+	flag.BoolVar(&flagWof, "wof", false, "write content of WOF compressed file decompressed from WofCompressedData stream")
+	flag.BoolVar(&flagZone, "zone", false, "print Mark-of-the-Web in Zone.Identifier stream of filename")
+	flag.BoolVar(&flagAllTypes, "all-types", false, "query streams of every attribute type as \":name:$TYPE\", including the unnamed data stream")
 
 	flag.StringVar(&flagFileName, "filename", "", "name of a file to query ADS")
 	flag.StringVar(&flagTargetAds, "ads-name", "", "name of a ADS to read data")
 	flag.StringVar(&flagOutFileName, "out-file", "", "name of a file to output ADS data, default to ADS name")
+	flag.StringVar(&flagImage, "image", "", "NTFS volume or disk image(raw, VHD or VHDX) to query ADS from, filename is a path in the volume")
+	flag.IntVar(&imgOpts.partition, "partition", 0, "number of partition in disk image to query, default to the first NTFS partition")
+	flag.StringVar(&flagWim, "wim", "", "WIM or ESD file to query ADS from, filename is a path in the image")
+	flag.IntVar(&flagWimIndex, "wim-index", 0, "index of image in WIM file starting from 1, default to all images or the first image for filename")
+	flag.StringVar(&flagBkf, "bkf", "", "NTBackup(MTF) backup file to query ADS from, filename is a path in the backed up volume")
+	flag.StringVar(&flagRestore, "restore", "", "file to restore all ADS of filename in the backup into")
+
+	setBackend := utils.BackendFlags()
 
 	progName := filepath.Base(os.Args[0])
 
 	flag.Usage = func() {
-		fmt.Fprintf(flag.CommandLine.Output(), "%s queries ADS(Alternate Data Stream) from the named file, reads and writes its content if requested.\nUsage:\nQuery all ADS name from file: %s [filename]\nWrite ADS content to file: %s -filename [filename] -ads-name [ADS name] -out-file [outfile name]\n or\n %s [filename] [ADS name] [outfile name]\nWrite ADS content to stdout(for piping output): %s -filename [filename] -ads-name [ADS name] -stdout | (process output)\n or\n %s -stdout [filename] [ADS name] | (process output)\n\n", progName, progName, progName, progName, progName, progName)
+		fmt.Fprintf(flag.CommandLine.Output(), "%s queries ADS(Alternate Data Stream) from the named file, reads and writes its content if requested.\nUsage:\nQuery all ADS name from file: %s [filename]\nWrite ADS content to file: %s -filename [filename] -ads-name [ADS name] -out-file [outfile name]\n or\n %s [filename] [ADS name] [outfile name]\nWrite ADS content to stdout(for piping output): %s -filename [filename] -ads-name [ADS name] -stdout | (process output)\n or\n %s -stdout [filename] [ADS name] | (process output)\nQuery all ADS from NTFS volume image: %s -image [image file]\nQuery from file in NTFS volume image: %s -image [image file] [path in volume] [ADS name] [outfile name]\nQuery ADS of deleted files from NTFS volume image: %s -image [image file] -deleted\nQuery from NTFS partition in disk image: %s -image [VHD, VHDX or disk image] -partition [partition number]\nQuery changes of ADS from USN journal: %s -usn [volume root] or %s -usn -image [image file]\nQuery history of ADS from $LogFile of NTFS volume image: %s -image [image file] -logfile\nWrite ADS as bodyfile for mactime: %s -bodyfile [directory] or %s -bodyfile -image [image file]\nDecompress WOF compressed file: %s -wof [filename] or %s -wof -image [image file] [path in volume]\nQuery ADS from WIM file: %s -wim [WIM file] or %s -wim [WIM file] -wim-index [index] [path in image] [ADS name] [outfile name]\nQuery ADS from NTBackup file: %s -bkf [bkf file] [path in volume] [ADS name] [outfile name]\nRestore ADS from NTBackup file: %s -bkf [bkf file] -restore [target file] [path in volume]\nPrint Mark-of-the-Web of file: %s -zone [filename]\nQuery streams of every type from file: %s -all-types [filename]\n\n", progName, progName, progName, progName, progName, progName, progName, progName, progName, progName, progName, progName, progName, progName, progName, progName, progName, progName, progName, progName, progName, progName, progName)
 		flag.PrintDefaults()
 
 		// prevent window from closing immediately if the console was created for this process
@@ -57,8 +91,13 @@ func main() {
 
 	flag.Parse()
 
+	if err := setBackend(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
 	if flagFileName == "" {
-		if flagFileName = flag.Arg(0); flagFileName == "" {
+		if flagFileName = flag.Arg(0); flagFileName == "" && flagImage == "" && flagWim == "" && flagBkf == "" {
 			flag.Usage()
 			os.Exit(1)
 		}
@@ -66,29 +105,85 @@ func main() {
 	if flagTargetAds == "" {
 		flagTargetAds = flag.Arg(1)
 	}
+	if flagWof {
+		// decompressed content is read from this stream
+		flagTargetAds = wof.StreamName
+	}
 	if flagOutFileName == "" && !flagStdout {
 		flagOutFileName = flag.Arg(2)
 	}
 
+	if flagBkf != "" {
+		queryBKF(flagBkf, flagFileName, flagTargetAds, flagOutFileName, flagRestore, flagStdout)
+
+		return
+	}
+
+	if flagWim != "" {
+		queryWIM(flagWim, flagWimIndex, flagFileName, flagTargetAds, flagOutFileName, flagStdout)
+
+		return
+	}
+
+	if flagImage != "" {
+		imgOpts.usn = flagUsn
+		imgOpts.wof = flagWof
+		if flagBodyfile {
+			imgOpts.bodyfile = &bodyOpts
+		}
+		queryImage(flagImage, imgOpts, flagFileName, flagTargetAds, flagOutFileName, flagStdout)
+
+		return
+	}
+
+	if flagUsn {
+		queryUsnJournal(flagFileName)
+
+		return
+	}
+
+	if flagBodyfile {
+		writeBodyfile(flagFileName, bodyOpts)
+
+		return
+	}
+
+	if flagZone {
+		queryZone(flagFileName)
+
+		return
+	}
+
 	if flagTargetAds == "" {
 		// query all ADS name(s) and size(s)
 		ads, err := ntfs_ads.GetFileADS(flagFileName)
+		if flagAllTypes && (err == nil || errors.Is(err, ntfs_ads.ErrNoADS)) {
+			// the file may have other streams without any named data stream
+			err = ads.CollectADS(ntfs_ads.CollectAllTypes)
+		}
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "Could not query ADS from file \"%s\": %v\n", flagFileName, err)
 
 			return
 		}
 
-		namePad, sizePad := getNameSizePad(ads.StreamInfoMap)
+		streamInfoMap := ads.StreamInfoMap
+		if flagAllTypes {
+			// listed as ":name:$TYPE"
+			streamInfoMap = make(map[string]int64, len(ads.StreamSpecMap))
+			for spec, size := range ads.StreamSpecMap {
+				streamInfoMap[spec.String()] = size
+			}
+		}
 
 		fmt.Printf("ADS of %s:\n(name : byte size)\n", flagFileName)
-		for name, size := range ads.StreamInfoMap {
-			fmt.Printf("%*s : %*d\n", namePad, name, sizePad, size)
-		}
+		printStreams(streamInfoMap, func(name string) (io.ReadCloser, error) {
+			return ads.OpenADS(name, os.O_RDONLY)
+		})
 	} else {
 		var err error
 
-		strmHnd, sErr := ntfs_ads.OpenFileADS(flagFileName, flagTargetAds, os.O_RDONLY)
+		strmHnd, sErr := openStream(flagFileName, flagTargetAds, flagWof)
 		if sErr != nil {
 			fmt.Fprintf(os.Stderr, "Could not open ADS with name \"%s\" from file \"%s\": %v\n", flagTargetAds, flagFileName, sErr)
 			os.Exit(2)
@@ -129,3 +224,671 @@ func main() {
 		}
 	}
 }
+
+// printStreams prints name and size of streams, with description of
+// well-known streams in the catalog and content decoded by registered
+// decoders, which is read with open.
+func printStreams(streamInfoMap map[string]int64, open func(name string) (io.ReadCloser, error)) {
+	namePad, sizePad := getNameSizePad(streamInfoMap)
+
+	names := make([]string, 0, len(streamInfoMap))
+	for name := range streamInfoMap {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		// ":name:$TYPE" is listed with -all-types
+		strmName := name
+		if spec, err := ntfs_ads.ParseStreamSpec(name); err == nil {
+			if !spec.IsData() || spec.IsDefault() {
+				fmt.Printf("%*s : %*d\n", namePad, name, sizePad, streamInfoMap[name])
+				continue
+			}
+			strmName = spec.Name
+		}
+
+		if entry, known := catalog.Lookup(strmName); known {
+			fmt.Printf("%*s : %*d (%s: %s)\n", namePad, name, sizePad, streamInfoMap[name], entry.Application, entry.Description)
+		} else {
+			fmt.Printf("%*s : %*d\n", namePad, name, sizePad, streamInfoMap[name])
+		}
+
+		if streamInfoMap[name] == 0 {
+			continue
+		}
+
+		v, err := decodeStream(strmName, open)
+		if errors.Is(err, catalog.ErrNoDecoder) {
+			continue
+		}
+		if err != nil {
+			fmt.Printf("%*s   could not decode: %v\n", namePad, "", err)
+			continue
+		}
+		for _, line := range strings.Split(catalog.RenderText(v), "\n") {
+			fmt.Printf("%*s   %s\n", namePad, "", line)
+		}
+	}
+}
+
+// decodeStream decodes the stream with the registered decoder.
+func decodeStream(name string, open func(name string) (io.ReadCloser, error)) (any, error) {
+	strm, err := open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer strm.Close()
+
+	return catalog.DecodeStream(name, strm)
+}
+
+// openStream opens the stream of the file, or decompressed content of WOF
+// compressed file if decompress is true.
+func openStream(fileName, targetAds string, decompress bool) (io.ReadCloser, error) {
+	if decompress {
+		f, err := wof.OpenFile(fileName)
+		if err != nil {
+			return nil, err
+		}
+
+		return struct {
+			io.Reader
+			io.Closer
+		}{io.NewSectionReader(f, 0, f.Size()), f}, nil
+	}
+
+	strm, err := ntfs_ads.OpenFileADS(fileName, targetAds, os.O_RDONLY)
+	if err != nil {
+		return nil, err
+	}
+
+	return strm, nil
+}
+
+// queryZone prints Mark-of-the-Web in Zone.Identifier stream of the file.
+func queryZone(fileName string) {
+	info, err := motw.GetZoneInfo(fileName)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Could not read %s of file \"%s\": %v\n", motw.StreamName, fileName, err)
+		os.Exit(2)
+	}
+
+	fmt.Printf("Mark-of-the-Web of %s:\n", fileName)
+	fmt.Printf("ZoneId : %d(%s)\n", info.ZoneID, info.ZoneID)
+	for _, f := range []motw.Field{
+		{Key: "ReferrerUrl", Value: info.ReferrerURL},
+		{Key: "HostUrl", Value: info.HostURL},
+		{Key: "LastWriterPackageFamilyName", Value: info.LastWriterPackageFamilyName},
+		{Key: "AppZoneId", Value: info.AppZoneID},
+	} {
+		if f.Value != "" {
+			fmt.Printf("%s : %s\n", f.Key, f.Value)
+		}
+	}
+	for _, f := range info.Extra {
+		fmt.Printf("%s : %s\n", f.Key, f.Value)
+	}
+}
+
+// openImagePartition opens the NTFS partition of the number from the image, or
+// the first NTFS partition if partNum is 0.
+func openImagePartition(img *os.File, partNum int) (io.ReaderAt, error) {
+	info, err := img.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	disk, err := vdisk.Open(img, info.Size())
+	if err != nil {
+		return nil, err
+	}
+
+	parts, err := disk.Partitions()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, p := range parts {
+		if (partNum == 0 && p.NTFS) || (partNum != 0 && p.Number == partNum) {
+			return disk.OpenPartition(p), nil
+		}
+	}
+
+	if len(parts) > 0 {
+		fmt.Fprintf(os.Stderr, "Partitions in %s disk image:\n", disk.Format)
+		for _, p := range parts {
+			fmt.Fprintln(os.Stderr, p)
+		}
+	}
+
+	if partNum != 0 {
+		return nil, fmt.Errorf("no partition %d in the image", partNum)
+	}
+
+	return nil, fmt.Errorf("no NTFS partition in the image")
+}
+
+// imageOptions selects partition and what to query from NTFS volume image.
+type imageOptions struct {
+	partition int
+	deleted   bool
+	usn       bool
+	logFile   bool
+	wof       bool // decompress WofCompressedData of the file
+
+	bodyfile *bodyfile.Options // write bodyfile lines if not nil
+}
+
+// queryImage queries ADS from the file in NTFS volume image, or from all files if filename is empty.
+func queryImage(imagePath string, opts imageOptions, fileName, targetAds, outFileName string, toStdout bool) {
+	img, err := os.Open(imagePath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Could not open image \"%s\": %v\n", imagePath, err)
+		os.Exit(2)
+	}
+	defer img.Close()
+
+	part, err := openImagePartition(img, opts.partition)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Could not open partition from image \"%s\": %v\n", imagePath, err)
+		os.Exit(2)
+	}
+
+	vol, err := ntfsimage.Open(part)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Could not read NTFS volume from image \"%s\": %v\n", imagePath, err)
+		os.Exit(2)
+	}
+
+	if opts.usn {
+		journal, err := vol.OpenUsnJournal()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Could not open USN journal in image \"%s\": %v\n", imagePath, err)
+			os.Exit(2)
+		}
+
+		printUsnEvents(journal, journal.Size(), func(rec *usn.Record) string {
+			if rec.FileName == "" {
+				return rec.FileReference.String()
+			}
+
+			parent, err := vol.Path(rec.ParentReference.Record())
+			if err != nil {
+				return rec.ParentReference.String() + "/" + rec.FileName
+			}
+
+			return strings.TrimSuffix(parent, "/") + "/" + rec.FileName
+		})
+
+		return
+	}
+
+	if opts.logFile {
+		queryLogFile(vol)
+
+		return
+	}
+
+	if opts.bodyfile != nil {
+		writeImageBodyfile(vol, *opts.bodyfile)
+
+		return
+	}
+
+	if opts.deleted {
+		// query ADS left in records of deleted files
+		fmt.Printf("ADS of deleted files in %s:\n(MFT record : path:name : byte size : recoverability)\n", imagePath)
+		err = vol.WalkDeletedStreams(func(f *ntfsimage.FileStreams) error {
+			for name, size := range f.StreamInfoMap {
+				fmt.Printf("%d : %s:%s : %d : %s\n", f.Record, f.Path, name, size, f.Recovery[name])
+			}
+
+			return nil
+		})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Could not query ADS of deleted files: %v\n", err)
+			os.Exit(2)
+		}
+
+		return
+	}
+
+	if fileName == "" {
+		// query all ADS in the volume
+		fmt.Printf("ADS in %s:\n(MFT record : path:name : byte size)\n", imagePath)
+		err = vol.WalkStreams(func(f *ntfsimage.FileStreams) error {
+			for name, size := range f.StreamInfoMap {
+				fmt.Printf("%d : %s:%s : %d\n", f.Record, f.Path, name, size)
+			}
+
+			return nil
+		})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Could not query ADS in image: %v\n", err)
+			os.Exit(2)
+		}
+
+		return
+	}
+
+	recNum, err := vol.Lookup(fileName)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Could not find file \"%s\" in image: %v\n", fileName, err)
+		os.Exit(2)
+	}
+
+	if targetAds == "" {
+		strms, err := vol.FileStreams(recNum)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Could not query ADS from file \"%s\" in image: %v\n", fileName, err)
+			os.Exit(2)
+		}
+
+		fmt.Printf("ADS of %s(MFT record %d):\n(name : byte size)\n", strms.Path, recNum)
+		printStreams(strms.StreamInfoMap, func(name string) (io.ReadCloser, error) {
+			strm, err := vol.OpenStream(recNum, name)
+			if err != nil {
+				return nil, err
+			}
+
+			return io.NopCloser(io.NewSectionReader(strm, 0, strm.Size())), nil
+		})
+
+		return
+	}
+
+	var strm interface {
+		io.ReaderAt
+		Size() int64
+	}
+	if opts.wof {
+		strm, err = wof.OpenImageFile(vol, recNum)
+	} else {
+		strm, err = vol.OpenStream(recNum, targetAds)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Could not open ADS with name \"%s\" from file \"%s\" in image: %v\n", targetAds, fileName, err)
+		os.Exit(2)
+	}
+
+	out := os.Stdout
+	if !toStdout {
+		if outFileName == "" {
+			outFileName = targetAds
+		}
+
+		out, err = os.Create(outFileName)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "could not prepare file for writing ADS data: %v", err)
+			os.Exit(2)
+		}
+		defer out.Close()
+	}
+
+	if _, err = io.Copy(out, io.NewSectionReader(strm, 0, strm.Size())); err != nil {
+		fmt.Fprintf(os.Stderr, "Error while reading data from ADS: %v", err)
+		os.Exit(2)
+	}
+
+	if !toStdout {
+		fmt.Printf("Wrote ADS data into file \"%s\"\n", outFileName)
+	}
+}
+
+// queryWIM queries ADS from the file in the image of WIM file, or from all
+// files in the image or in all images if index is 0.
+func queryWIM(wimPath string, index int, fileName, targetAds, outFileName string, toStdout bool) {
+	f, err := os.Open(wimPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Could not open WIM file \"%s\": %v\n", wimPath, err)
+		os.Exit(2)
+	}
+	defer f.Close()
+
+	w, err := wim.Open(f)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Could not read WIM file \"%s\": %v\n", wimPath, err)
+		os.Exit(2)
+	}
+
+	if fileName == "" {
+		// query all ADS in the images
+		first, last := index, index
+		if index == 0 {
+			first, last = 1, int(w.ImageCount)
+		}
+
+		fmt.Printf("ADS in %s:\n(image : path:name : byte size)\n", wimPath)
+		for i := first; i <= last; i++ {
+			img, err := w.Image(i)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(2)
+			}
+
+			err = img.WalkStreams(func(d *wim.Dentry) error {
+				for _, strm := range d.Streams {
+					fmt.Printf("%d : %s:%s : %d\n", i, d.Path(), strm.Name, strm.Size)
+				}
+
+				return nil
+			})
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error while reading image %d: %v\n", i, err)
+				os.Exit(2)
+			}
+		}
+
+		return
+	}
+
+	if index == 0 {
+		index = 1
+	}
+
+	img, err := w.Image(index)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	ads, err := ntfs_ads.NewFileADS(img, fileName)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Could not query ADS from file \"%s\" in image %d: %v\n", fileName, index, err)
+		os.Exit(2)
+	}
+
+	if targetAds == "" {
+		fmt.Printf("ADS of %s(image %d):\n(name : byte size)\n", fileName, index)
+		printStreams(ads.StreamInfoMap, func(name string) (io.ReadCloser, error) {
+			return ads.OpenADS(name, os.O_RDONLY)
+		})
+
+		return
+	}
+
+	strm, err := ads.OpenADS(targetAds, os.O_RDONLY)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Could not open ADS with name \"%s\" from file \"%s\" in image %d: %v\n", targetAds, fileName, index, err)
+		os.Exit(2)
+	}
+	defer strm.Close()
+
+	out := os.Stdout
+	if !toStdout {
+		if outFileName == "" {
+			outFileName = targetAds
+		}
+
+		out, err = os.Create(outFileName)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "could not prepare file for writing ADS data: %v", err)
+			os.Exit(2)
+		}
+		defer out.Close()
+	}
+
+	if _, err = io.Copy(out, strm); err != nil {
+		fmt.Fprintf(os.Stderr, "Error while reading data from ADS: %v", err)
+		os.Exit(2)
+	}
+
+	if !toStdout {
+		fmt.Printf("Wrote ADS data into file \"%s\"\n", outFileName)
+	}
+}
+
+// queryBKF queries ADS from the file in NTBackup file, or from all files if
+// fileName is empty, and restores them into restoreTo if not empty.
+func queryBKF(bkfPath, fileName, targetAds, outFileName, restoreTo string, toStdout bool) {
+	f, err := os.Open(bkfPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Could not open backup file \"%s\": %v\n", bkfPath, err)
+		os.Exit(2)
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Could not open backup file \"%s\": %v\n", bkfPath, err)
+		os.Exit(2)
+	}
+
+	rd, err := mtf.NewReader(f, info.Size())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Could not read backup file \"%s\": %v\n", bkfPath, err)
+		os.Exit(2)
+	}
+
+	if fileName == "" {
+		// query all ADS in the backup
+		fmt.Printf("ADS in %s:\n(data set : volume : path:name : byte size)\n", bkfPath)
+		err = rd.WalkStreams(func(file *mtf.File) error {
+			var setNum uint16
+			if file.Set != nil {
+				setNum = file.Set.Number
+			}
+
+			for _, strm := range file.Streams {
+				fmt.Printf("%d : %s : %s:%s : %d\n", setNum, file.Volume, file.Path, strm.Name, strm.Size)
+			}
+
+			return nil
+		})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error while reading backup file: %v\n", err)
+			os.Exit(2)
+		}
+
+		return
+	}
+
+	file, err := rd.Lookup("", fileName)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Could not find file \"%s\" in backup: %v\n", fileName, err)
+		os.Exit(2)
+	}
+
+	if restoreTo != "" {
+		restored, err := mtf.Restore(file, restoreTo)
+		if err != nil && !errors.Is(err, mtf.ErrUnsupported) {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+
+		if err != nil {
+			// encrypted or compressed streams were skipped
+			fmt.Fprintln(os.Stderr, err)
+		}
+
+		fmt.Printf("Restored %d ADS of %s into \"%s\"\n", restored, file.Path, restoreTo)
+
+		return
+	}
+
+	if targetAds == "" {
+		fmt.Printf("ADS of %s%s:\n(name : byte size)\n", file.Volume, file.Path)
+		printStreams(file.StreamInfoMap(), func(name string) (io.ReadCloser, error) {
+			strm, ok := file.Stream(name)
+			if !ok {
+				return nil, fs.ErrNotExist
+			}
+
+			r, err := strm.Open()
+			if err != nil {
+				return nil, err
+			}
+
+			return io.NopCloser(r), nil
+		})
+
+		return
+	}
+
+	strm, ok := file.Stream(targetAds)
+	if !ok {
+		fmt.Fprintf(os.Stderr, "Could not find ADS with name \"%s\" from file \"%s\" in backup\n", targetAds, fileName)
+		os.Exit(2)
+	}
+
+	r, err := strm.Open()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Could not open ADS with name \"%s\" from file \"%s\" in backup: %v\n", targetAds, fileName, err)
+		os.Exit(2)
+	}
+
+	out := os.Stdout
+	if !toStdout {
+		if outFileName == "" {
+			outFileName = targetAds
+		}
+
+		out, err = os.Create(outFileName)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "could not prepare file for writing ADS data: %v", err)
+			os.Exit(2)
+		}
+		defer out.Close()
+	}
+
+	if _, err = io.Copy(out, r); err != nil {
+		fmt.Fprintf(os.Stderr, "Error while reading data from ADS: %v", err)
+		os.Exit(2)
+	}
+
+	if !toStdout {
+		fmt.Printf("Wrote ADS data into file \"%s\"\n", outFileName)
+	}
+}
+
+// queryUsnJournal queries changes of ADS from USN journal of the volume whose root is volumeRoot.
+func queryUsnJournal(volumeRoot string) {
+	journalPath := filepath.Join(volumeRoot, usn.JournalPath)
+
+	ads, err := ntfs_ads.GetFileADS(journalPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Could not query USN journal \"%s\": %v\n", journalPath, err)
+		os.Exit(2)
+	}
+
+	journal, err := ntfs_ads.OpenFileADS(journalPath, usn.JournalStream, os.O_RDONLY)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Could not open USN journal \"%s\": %v\n", journalPath, err)
+		os.Exit(2)
+	}
+	defer journal.Close()
+
+	printUsnEvents(journal, ads.StreamInfoMap[usn.JournalStream], func(rec *usn.Record) string {
+		if rec.FileName == "" {
+			return rec.FileReference.String()
+		}
+
+		return rec.FileName
+	})
+}
+
+// printUsnEvents prints records of changes to named streams from the journal.
+func printUsnEvents(journal io.ReaderAt, size int64, nameOf func(*usn.Record) string) {
+	fmt.Println("Changes of ADS in USN journal:\n(USN : time : file reference : name : reason)")
+
+	err := usn.WalkStreamEvents(journal, size, func(rec *usn.Record) error {
+		timestamp := "-"
+		if !rec.Timestamp.IsZero() {
+			timestamp = rec.Timestamp.Format(time.RFC3339Nano)
+		}
+
+		fmt.Printf("%d : %s : %s : %s : %s\n", rec.USN, timestamp, rec.FileReference, nameOf(rec), rec.Reason)
+
+		return nil
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error while reading USN journal: %v\n", err)
+		os.Exit(2)
+	}
+}
+
+// queryLogFile queries history of ADS in each MFT record from $LogFile of the volume.
+func queryLogFile(vol *ntfsimage.Volume) {
+	history, err := vol.StreamHistory()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Could not read $LogFile: %v\n", err)
+		os.Exit(2)
+	}
+
+	nums := make([]uint64, 0, len(history))
+	for num := range history {
+		nums = append(nums, num)
+	}
+	sort.Slice(nums, func(i, j int) bool { return nums[i] < nums[j] })
+
+	fmt.Println("History of ADS in $LogFile:\n(LSN : operation : name : byte size : offset)")
+	for _, num := range nums {
+		path, err := vol.Path(num)
+		if err != nil {
+			path = "?"
+		}
+
+		fmt.Printf("MFT record %d(%s):\n", num, path)
+		for _, event := range history[num] {
+			fmt.Printf("%d : %s : %s : %d : %d\n", event.LSN, event.Operation, event.Name, event.Size, event.Offset)
+		}
+	}
+}
+
+// writeImageBodyfile writes bodyfile lines of ADS of all files in the volume, including deleted files.
+func writeImageBodyfile(vol *ntfsimage.Volume, opts bodyfile.Options) {
+	w := bodyfile.NewWriter(os.Stdout)
+
+	writeEntries := func(f *ntfsimage.FileStreams) error {
+		entries, err := bodyfile.ImageEntries(vol, f, opts)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+		}
+
+		return w.Write(entries...)
+	}
+
+	if err := vol.WalkStreams(writeEntries); err != nil {
+		fmt.Fprintf(os.Stderr, "Error while writing bodyfile: %v\n", err)
+		os.Exit(2)
+	}
+
+	if err := vol.WalkDeletedStreams(writeEntries); err != nil {
+		fmt.Fprintf(os.Stderr, "Error while writing bodyfile of deleted files: %v\n", err)
+		os.Exit(2)
+	}
+}
+
+// writeBodyfile writes bodyfile lines of ADS of the file, or of all files under the directory.
+func writeBodyfile(root string, opts bodyfile.Options) {
+	w := bodyfile.NewWriter(os.Stdout)
+
+	err := filepath.WalkDir(root, func(path string, _ fs.DirEntry, err error) error {
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+
+			return nil
+		}
+
+		ads, err := ntfs_ads.GetFileADS(path)
+		if err != nil {
+			if !errors.Is(err, ntfs_ads.ErrNoADS) {
+				fmt.Fprintf(os.Stderr, "Could not query ADS from file \"%s\": %v\n", path, err)
+			}
+
+			return nil
+		}
+
+		entries, err := bodyfile.FileADSEntries(&ads, opts)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+		}
+
+		return w.Write(entries...)
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error while writing bodyfile: %v\n", err)
+		os.Exit(2)
+	}
+}
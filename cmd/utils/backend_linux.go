@@ -0,0 +1,68 @@
+//go:build linux
+// +build linux
+
+package utils
+
+import (
+	"flag"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/Snshadow/ntfs-ads"
+)
+
+// backends maps name of backend into function returning StreamFS which stores streams.
+var backends = map[string]func(opts backendOptions) ntfs_ads.StreamFS{
+	"auto": func(backendOptions) ntfs_ads.StreamFS {
+		return ntfs_ads.DetectFS{Default: ntfs_ads.XattrFS{Prefix: ntfs_ads.DefaultXattrPrefix}}
+	},
+	"xattr": func(backendOptions) ntfs_ads.StreamFS {
+		return ntfs_ads.XattrFS{Prefix: ntfs_ads.DefaultXattrPrefix}
+	},
+	"samba-xattr": func(backendOptions) ntfs_ads.StreamFS {
+		return ntfs_ads.SambaXattrFS
+	},
+	"samba-depot": func(opts backendOptions) ntfs_ads.StreamFS {
+		return ntfs_ads.StreamsDepotFS{Dir: opts.depotDir}
+	},
+	"ntfs-3g": func(backendOptions) ntfs_ads.StreamFS {
+		return ntfs_ads.NTFS3GFS{}
+	},
+}
+
+// backendOptions are flags used by backends.
+type backendOptions struct {
+	depotDir string
+}
+
+func backendNames() string {
+	names := make([]string, 0, len(backends))
+	for name := range backends {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return strings.Join(names, ", ")
+}
+
+// BackendFlags defines flags for choosing where streams are stored. Returned
+// function sets DefaultFS of ntfs_ads with the flags, should be called after flag.Parse().
+func BackendFlags() func() error {
+	var name string
+	var opts backendOptions
+
+	flag.StringVar(&name, "backend", "auto", "storage of streams, one of: "+backendNames()+"\n\"auto\" uses ntfs-3g streams interface for files in ntfs-3g mounts, xattr for others")
+	flag.StringVar(&opts.depotDir, "depot-dir", ".", "directory with \".streams\" depot for samba-depot backend, path of the share by default in Samba")
+
+	return func() error {
+		newFS, ok := backends[name]
+		if !ok {
+			return fmt.Errorf("unknown backend \"%s\", should be one of: %s", name, backendNames())
+		}
+
+		ntfs_ads.DefaultFS = newFS(opts)
+
+		return nil
+	}
+}
@@ -0,0 +1,11 @@
+//go:build !linux
+// +build !linux
+
+package utils
+
+// BackendFlags does not define any flag, as streams are natively supported on Windows.
+func BackendFlags() func() error {
+	return func() error {
+		return nil
+	}
+}
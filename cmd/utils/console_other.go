@@ -0,0 +1,9 @@
+//go:build !windows
+// +build !windows
+
+package utils
+
+// IsFromOwnConsole checks if the console was created solely for this process, which only happens on Windows.
+func IsFromOwnConsole() bool {
+	return false
+}
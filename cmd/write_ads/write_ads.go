@@ -1,7 +1,7 @@
 //go:generate goversioninfo write_ads.json
 
-//go:build windows
-// +build windows
+//go:build windows || linux
+// +build windows linux
 
 package main
 
@@ -11,30 +11,39 @@ import (
 	"io"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
 
 	"github.com/Snshadow/ntfs-ads"
 	"github.com/Snshadow/ntfs-ads/cmd/utils"
+	"github.com/Snshadow/ntfs-ads/motw"
 )
 
 func main() {
-	var flagStdin, flagAppend, flagRemove, flagRemoveAll, flagRename bool
-	var flagSourceFile, flagTargetFile, flagADSName, flagNewADSName string
+	var flagStdin, flagAppend, flagRemove, flagRemoveAll, flagRename, flagUnblock, flagDryRun bool
+	var flagSourceFile, flagTargetFile, flagADSName, flagNewADSName, flagZoneIDs, flagHostURL string
 
 	flag.BoolVar(&flagStdin, "stdin", false, "read data from standard input")
 	flag.BoolVar(&flagAppend, "append", false, "append data into specified stream")
 	flag.BoolVar(&flagRemove, "remove", false, "remove specified ADS")
 	flag.BoolVar(&flagRemoveAll, "remove-all", false, "remove all ADS from specified file")
 	flag.BoolVar(&flagRename, "rename", false, "rename specified ADS")
+	flag.BoolVar(&flagUnblock, "unblock", false, "remove Mark-of-the-Web(Zone.Identifier) from files under target directory")
+	flag.BoolVar(&flagDryRun, "dry-run", false, "only list files to be unblocked")
 
 	flag.StringVar(&flagSourceFile, "source-file", "", "source file of data being written")
 	flag.StringVar(&flagTargetFile, "target-file", "", "target path for writing ADS")
 	flag.StringVar(&flagADSName, "ads-name", "", "name of the ADS to write data or remove")
 	flag.StringVar(&flagNewADSName, "new-ads-name", "", "new name for the ADS")
+	flag.StringVar(&flagZoneIDs, "zone-ids", "", "comma separated ZoneId of files to be unblocked, default to any zone")
+	flag.StringVar(&flagHostURL, "host-url", "", "pattern of HostUrl of files to be unblocked with * and ?, default to any URL")
+
+	setBackend := utils.BackendFlags()
 
 	progName := filepath.Base(os.Args[0])
 
 	flag.Usage = func() {
-		fmt.Fprintf(flag.CommandLine.Output(), "%s writes data info the specified ADS(Alternate Data Stream). Can read data from file or standard input.\nUsage:\nWrite data from file: %s [target file] [source file] [ADS name]\n or\n %s -source-file [source-file] -target-file [target file] -ads-name [ADS name]\nWrite data from stdin: echo \"[data]\" | %s --stdin [target file] [ADS name]\nRemove ADS from file: %s -remove -target-file [target file] -ads-name [ADS name]\nRemove all ADS from file: %s -remove-all [target-file]\nRename ADS from file: %s -rename [target name] [ADS name] [new ADS name]\n\n", progName, progName, progName, progName, progName, progName, progName)
+		fmt.Fprintf(flag.CommandLine.Output(), "%s writes data info the specified ADS(Alternate Data Stream). Can read data from file or standard input.\nUsage:\nWrite data from file: %s [target file] [source file] [ADS name]\n or\n %s -source-file [source-file] -target-file [target file] -ads-name [ADS name]\nWrite data from stdin: echo \"[data]\" | %s --stdin [target file] [ADS name]\nRemove ADS from file: %s -remove -target-file [target file] -ads-name [ADS name]\nRemove all ADS from file: %s -remove-all [target-file]\nRename ADS from file: %s -rename [target name] [ADS name] [new ADS name]\nRemove Mark-of-the-Web from files under directory: %s -unblock [-dry-run] [-zone-ids 3,4] [-host-url https://example.com/*] [target directory]\n\n", progName, progName, progName, progName, progName, progName, progName, progName)
 
 		flag.PrintDefaults()
 
@@ -47,6 +56,11 @@ func main() {
 
 	flag.Parse()
 
+	if err := setBackend(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
 	if flagTargetFile == "" {
 		if flagTargetFile = flag.Arg(0); flagTargetFile == "" {
 			flag.Usage()
@@ -54,6 +68,12 @@ func main() {
 		}
 	}
 
+	if flagUnblock {
+		unblock(flagTargetFile, flagZoneIDs, flagHostURL, flagDryRun)
+
+		return
+	}
+
 	var src *os.File
 
 	if flagStdin {
@@ -94,7 +114,10 @@ func main() {
 	}
 
 	if flagRemove {
-		err := os.Remove(flagTargetFile + ":" + flagADSName)
+		ads, err := ntfs_ads.GetFileADS(flagTargetFile)
+		if err == nil {
+			err = ads.RemoveADS(flagADSName)
+		}
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "Could not remove ADS from \"%s\" with name \"%s\": %v\n", flagTargetFile, flagADSName, err)
 			os.Exit(2)
@@ -142,17 +165,63 @@ func main() {
 		fmt.Fprintf(os.Stderr, "Could not open ADS for writing: %v\n", err)
 		os.Exit(2)
 	}
-	defer strmHnd.Close()
 
 	_, err = io.Copy(strmHnd, src)
 	if err != nil {
+		strmHnd.Close()
 		fmt.Fprintf(os.Stderr, "Error while writing data into ADS: %v\n", err)
 		os.Exit(2)
+	}
+
+	// data may only be stored on close, e.g. as xattr on Linux
+	if err = strmHnd.Close(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error while writing data into ADS: %v\n", err)
+		os.Exit(2)
+	}
+
+	if flagAppend {
+		fmt.Printf("Appended data into ADS \"%s:%s\"\n", flagTargetFile, flagADSName)
 	} else {
-		if flagAppend {
-			fmt.Printf("Appended data into ADS \"%s:%s\"\n", flagTargetFile, flagADSName)
+		fmt.Printf("Wrote data into ADS \"%s:%s\"\n", flagTargetFile, flagADSName)
+	}
+}
+
+// unblock removes Zone.Identifier from files under root selected by zone IDs and HostUrl pattern.
+func unblock(root, zoneIDs, hostURL string, dryRun bool) {
+	filter := &motw.UnblockFilter{HostURL: hostURL}
+	if zoneIDs != "" {
+		for _, s := range strings.Split(zoneIDs, ",") {
+			id, err := strconv.Atoi(strings.TrimSpace(s))
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Invalid ZoneId \"%s\": %v\n", s, err)
+				os.Exit(1)
+			}
+			filter.Zones = append(filter.Zones, motw.Zone(id))
+		}
+	}
+
+	unblocked, err := motw.Unblock(root, filter, dryRun)
+
+	action := "Unblocked"
+	if dryRun {
+		action = "Would unblock"
+	}
+	for _, u := range unblocked {
+		if u.Info == nil {
+			fmt.Printf("%s \"%s\" (invalid %s)\n", action, u.Path, u.Stream)
 		} else {
-			fmt.Printf("Wrote data into ADS \"%s:%s\"\n", flagTargetFile, flagADSName)
+			fmt.Printf("%s \"%s\" (ZoneId=%d, HostUrl=%s)\n", action, u.Path, u.Info.ZoneID, u.Info.HostURL)
 		}
 	}
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Could not unblock files under \"%s\": %v\n", root, err)
+		os.Exit(2)
+	}
+
+	if dryRun {
+		fmt.Printf("%d file(s) would be unblocked\n", len(unblocked))
+	} else {
+		fmt.Printf("Unblocked %d file(s)\n", len(unblocked))
+	}
 }
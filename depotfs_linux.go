@@ -0,0 +1,256 @@
+//go:build linux
+// +build linux
+
+package ntfs_ads
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+const (
+	streamsDepotDir    = ".streams"           // STREAMS_DEPOT_DIR
+	streamsDepotMarker = "user.SAMBA_STREAMS" // SAMBA_XATTR_MARKER, set to "1" on files with valid depot
+	streamsDepotType   = ":$DATA"
+)
+
+// StreamsDepotFS is a StreamFS for files in Samba shares using vfs_streams_depot
+// module, which stores each stream as a regular file named ":[stream name]:$DATA"
+// in a directory of the depot hashed with device and inode number of the file.
+type StreamsDepotFS struct {
+	Dir string // streams_depot:directory, which is the path of the share by default
+
+	IgnoreMarker bool // streams_depot:check_valid = no, use depot of files not marked by Samba
+}
+
+// depotHash is hash_fn from vfs_streams_depot.c.
+func depotHash(key []byte) uint32 {
+	value := uint32(0x238F13AF) * uint32(len(key))
+	for i, b := range key {
+		value += uint32(b) << (uint32(i) * 5 % 24)
+	}
+
+	return 1103515243*value + 12345
+}
+
+// Root returns the root directory of the depot.
+func (d StreamsDepotFS) Root() string {
+	return filepath.Join(d.Dir, streamsDepotDir)
+}
+
+// StreamDir returns the directory of the depot which has streams of the file.
+func (d StreamsDepotFS) StreamDir(path string) (string, error) {
+	var st unix.Stat_t
+	if err := unix.Stat(path, &st); err != nil {
+		return "", &fs.PathError{Op: "stat", Path: path, Err: err}
+	}
+
+	// file_id pushed with push_file_id_16()
+	var id [16]byte
+	binary.LittleEndian.PutUint64(id[0:], uint64(st.Dev))
+	binary.LittleEndian.PutUint64(id[8:], uint64(st.Ino))
+
+	hash := depotHash(id[:])
+
+	return filepath.Join(
+		d.Root(),
+		fmt.Sprintf("%02X", hash&0xff),
+		fmt.Sprintf("%02X", (hash>>8)&0xff),
+		strings.ToUpper(hex.EncodeToString(id[:])),
+	), nil
+}
+
+// isValid checks if the depot of the file was created by Samba for the file, not
+// left from a deleted file which had the same inode number.
+func (d StreamsDepotFS) isValid(path string) bool {
+	if d.IgnoreMarker {
+		return true
+	}
+
+	var buf [1]byte
+	n, err := unix.Getxattr(path, streamsDepotMarker, buf[:])
+
+	return err == nil && n == 1 && buf[0] == '1'
+}
+
+// streamDir returns the directory with streams of the file, which is created if create is true.
+// It returns fs.ErrNotExist if the file has no valid depot and create is false.
+func (d StreamsDepotFS) streamDir(path string, create bool) (string, error) {
+	dir, err := d.StreamDir(path)
+	if err != nil {
+		return "", err
+	}
+
+	_, err = os.Stat(dir)
+	if err != nil && !os.IsNotExist(err) {
+		return "", err
+	}
+	exists := err == nil
+
+	if exists && d.isValid(path) {
+		return dir, nil
+	}
+
+	if !create {
+		return "", &fs.PathError{Op: "open", Path: dir, Err: fs.ErrNotExist}
+	}
+
+	if exists {
+		// move away streams of a file which had the same inode, as Samba does
+		lost := filepath.Join(d.Root(), fmt.Sprintf("lost-%d", rand.Uint32()))
+		if err = os.Rename(dir, lost); err != nil {
+			return "", err
+		}
+	}
+
+	if err = os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+
+	if !d.IgnoreMarker {
+		if err = unix.Setxattr(path, streamsDepotMarker, []byte{'1'}, 0); err != nil {
+			return "", xattrErr("setxattr", path, err)
+		}
+	}
+
+	return dir, nil
+}
+
+// depotFileName returns name of the file storing the stream in the depot.
+func depotFileName(name string) (string, bool) {
+	if len(name) > len(streamsDepotType) && strings.EqualFold(name[len(name)-len(streamsDepotType):], streamsDepotType) {
+		name = name[:len(name)-len(streamsDepotType)]
+	}
+
+	if name == "" || strings.ContainsAny(name, "\x00/:") {
+		return "", false
+	}
+
+	return ":" + name + streamsDepotType, true
+}
+
+// ListStreams returns name and size of streams in the depot of the file.
+func (d StreamsDepotFS) ListStreams(path string) (map[string]int64, error) {
+	streamInfoMap := make(map[string]int64)
+
+	dir, err := d.streamDir(path, false)
+	if os.IsNotExist(err) {
+		return streamInfoMap, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, entry := range entries {
+		fileName := entry.Name()
+		if !strings.HasPrefix(fileName, ":") || !strings.HasSuffix(fileName, streamsDepotType) || !entry.Type().IsRegular() {
+			continue
+		}
+
+		name := fileName[1 : len(fileName)-len(streamsDepotType)]
+		if name == "" {
+			continue
+		}
+
+		info, err := entry.Info()
+		if os.IsNotExist(err) {
+			// removed in between
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+
+		streamInfoMap[name] = info.Size()
+	}
+
+	return streamInfoMap, nil
+}
+
+// depotStream is a file in the depot, named after the stream.
+type depotStream struct {
+	*os.File
+
+	name string
+}
+
+func (s depotStream) Name() string {
+	return s.name
+}
+
+// OpenStream opens the file of the stream in the depot with flag used in os.OpenFile(),
+// the depot of the file is created with os.O_CREATE.
+func (d StreamsDepotFS) OpenStream(path, name string, flag int) (Stream, error) {
+	strmPath := path + ":" + name
+
+	fileName, ok := depotFileName(name)
+	if !ok {
+		return nil, &fs.PathError{Op: "open", Path: strmPath, Err: fs.ErrInvalid}
+	}
+
+	dir, err := d.streamDir(path, flag&os.O_CREATE != 0)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.OpenFile(filepath.Join(dir, fileName), flag, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	return depotStream{File: f, name: strmPath}, nil
+}
+
+// RenameStream renames the file of the stream in the depot.
+func (d StreamsDepotFS) RenameStream(path, oldName, newName string, overwrite bool) error {
+	oldPath, newPath := path+":"+oldName, path+":"+newName
+
+	oldFile, okOld := depotFileName(oldName)
+	newFile, okNew := depotFileName(newName)
+	if !okOld || !okNew {
+		return &os.LinkError{Op: "rename", Old: oldPath, New: newPath, Err: fs.ErrInvalid}
+	}
+
+	dir, err := d.streamDir(path, false)
+	if err != nil {
+		return err
+	}
+
+	oldFile, newFile = filepath.Join(dir, oldFile), filepath.Join(dir, newFile)
+
+	if !overwrite && oldFile != newFile {
+		if _, err = os.Lstat(newFile); err == nil {
+			return &os.LinkError{Op: "rename", Old: oldPath, New: newPath, Err: fs.ErrExist}
+		}
+	}
+
+	return os.Rename(oldFile, newFile)
+}
+
+// RemoveStream removes the file of the stream from the depot.
+func (d StreamsDepotFS) RemoveStream(path, name string) error {
+	strmPath := path + ":" + name
+
+	fileName, ok := depotFileName(name)
+	if !ok {
+		return &fs.PathError{Op: "remove", Path: strmPath, Err: fs.ErrInvalid}
+	}
+
+	dir, err := d.streamDir(path, false)
+	if err != nil {
+		return err
+	}
+
+	return os.Remove(filepath.Join(dir, fileName))
+}
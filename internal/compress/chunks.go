@@ -0,0 +1,170 @@
+package compress
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// ReadChunkTable reads table of chunk offsets at the start of compressed
+// data of size bytes, used in WOF and WIM. The table has offsets of chunks
+// except the first, relative to the end of the table, 8 bytes each for data
+// larger than 4GiB. Returned offsets are from the start of compressed data,
+// with end of the last chunk.
+func ReadChunkTable(r io.ReaderAt, compressedSize, size, chunkSize int64) ([]int64, error) {
+	if size < 0 || compressedSize < 0 {
+		return nil, fmt.Errorf("%w: negative size", ErrCorrupted)
+	}
+
+	numChunks := (size + chunkSize - 1) / chunkSize
+
+	entrySize := int64(4)
+	if size > 0xFFFFFFFF {
+		entrySize = 8
+	}
+
+	tableSize := int64(0)
+	if numChunks > 0 {
+		tableSize = (numChunks - 1) * entrySize
+	}
+	if tableSize > compressedSize {
+		return nil, fmt.Errorf("%w: chunk table exceeds compressed data", ErrCorrupted)
+	}
+
+	table := make([]byte, tableSize)
+	if n, err := r.ReadAt(table, 0); n < len(table) {
+		return nil, fmt.Errorf("could not read chunk table: %w", err)
+	}
+
+	offsets := make([]int64, numChunks+1)
+	offsets[0] = tableSize
+	for i := int64(1); i < numChunks; i++ {
+		var off int64
+		if entrySize == 8 {
+			off = int64(binary.LittleEndian.Uint64(table[(i-1)*8:]))
+		} else {
+			off = int64(binary.LittleEndian.Uint32(table[(i-1)*4:]))
+		}
+
+		offsets[i] = tableSize + off
+		if offsets[i] < offsets[i-1] || offsets[i] > compressedSize {
+			return nil, fmt.Errorf("%w: invalid offset of chunk %d", ErrCorrupted, i)
+		}
+	}
+	offsets[numChunks] = compressedSize
+
+	return offsets, nil
+}
+
+// ChunkReader reads data compressed in chunks, each of which is decompressed
+// independently into chunkSize bytes except the last one.
+type ChunkReader struct {
+	r          io.ReaderAt
+	offsets    []int64
+	size       int64
+	chunkSize  int64
+	decompress Func
+
+	mut     sync.Mutex
+	cached  int64 // index of chunk in buf, -1 if none
+	buf     []byte
+	compBuf []byte
+}
+
+// NewChunkReader returns ChunkReader reading chunks at offsets of r, with end
+// of the last chunk, which are decompressed with decompress into size bytes.
+// Chunks not smaller than chunkSize are stored uncompressed.
+func NewChunkReader(r io.ReaderAt, offsets []int64, size, chunkSize int64, decompress Func) *ChunkReader {
+	return &ChunkReader{
+		r:          r,
+		offsets:    offsets,
+		size:       size,
+		chunkSize:  chunkSize,
+		decompress: decompress,
+		cached:     -1,
+	}
+}
+
+// Size returns size of decompressed data.
+func (c *ChunkReader) Size() int64 {
+	return c.size
+}
+
+// loadChunk decompresses the chunk of index into c.buf.
+func (c *ChunkReader) loadChunk(index int64) error {
+	if c.cached == index {
+		return nil
+	}
+	c.cached = -1
+
+	if index+1 >= int64(len(c.offsets)) {
+		return fmt.Errorf("%w: chunk %d is missing", ErrCorrupted, index)
+	}
+
+	outSize := c.chunkSize
+	if rest := c.size - index*c.chunkSize; rest < outSize {
+		outSize = rest
+	}
+
+	start, end := c.offsets[index], c.offsets[index+1]
+	compSize := end - start
+	if compSize <= 0 || compSize > outSize {
+		return fmt.Errorf("%w: chunk %d has size %d", ErrCorrupted, index, compSize)
+	}
+
+	if int64(cap(c.compBuf)) < compSize {
+		c.compBuf = make([]byte, compSize)
+	}
+	comp := c.compBuf[:compSize]
+	if n, err := c.r.ReadAt(comp, start); n < len(comp) {
+		return fmt.Errorf("could not read chunk %d: %w", index, err)
+	}
+
+	if int64(cap(c.buf)) < outSize {
+		c.buf = make([]byte, outSize)
+	}
+	c.buf = c.buf[:outSize]
+
+	// chunk not smaller when compressed is stored as is
+	if compSize == outSize {
+		copy(c.buf, comp)
+	} else if err := c.decompress(c.buf, comp); err != nil {
+		return fmt.Errorf("%w: chunk %d", err, index)
+	}
+
+	c.cached = index
+
+	return nil
+}
+
+// ReadAt reads decompressed data at off.
+func (c *ChunkReader) ReadAt(b []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, fmt.Errorf("compress: negative offset %d", off)
+	}
+	if off >= c.size {
+		return 0, io.EOF
+	}
+
+	c.mut.Lock()
+	defer c.mut.Unlock()
+
+	n := 0
+	for n < len(b) && off < c.size {
+		index := off / c.chunkSize
+		if err := c.loadChunk(index); err != nil {
+			return n, err
+		}
+
+		copied := copy(b[n:], c.buf[off-index*c.chunkSize:])
+		n += copied
+		off += int64(copied)
+	}
+
+	if n < len(b) {
+		return n, io.EOF
+	}
+
+	return n, nil
+}
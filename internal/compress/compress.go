@@ -0,0 +1,15 @@
+// Package compress decompresses data compressed with formats of Windows,
+// XPRESS(LZ77+Huffman), LZX and LZMS, used by WOF and WIM.
+package compress
+
+import (
+	"errors"
+)
+
+var (
+	ErrCorrupted = errors.New("corrupted compressed data")
+)
+
+// Func decompresses src into dst, which has the exact size of decompressed
+// data.
+type Func func(dst, src []byte) error
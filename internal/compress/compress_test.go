@@ -0,0 +1,207 @@
+package compress
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// samples in testdata are written by testdata/gen*.go, except msxca_*.bin
+func readTestdata(t *testing.T, name string) []byte {
+	t.Helper()
+
+	b, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return b
+}
+
+func TestDecompress(t *testing.T) {
+	plain := readTestdata(t, "plain.bin")
+	e8 := readTestdata(t, "e8.bin")
+	lzmsPlain := readTestdata(t, "lzms_plain.bin")
+
+	tests := []struct {
+		name       string
+		file       string
+		decompress Func
+		want       []byte
+	}{
+		{"XPRESS4K", "xpress4k.bin", Xpress, plain[:4096]},
+		{"XPRESS8K", "xpress8k.bin", Xpress, plain[:8192]},
+		{"XPRESS16K", "xpress16k.bin", Xpress, plain[:16384]},
+		{"LZX", "lzx.bin", LZX(32768), plain},
+		{"LZX E8", "lzx_e8.bin", LZX(32768), e8},
+		{"LZMS", "lzms.bin", LZMS, lzmsPlain},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dst := make([]byte, len(tt.want))
+			if err := tt.decompress(dst, readTestdata(t, tt.file)); err != nil {
+				t.Fatalf("decompress: %v", err)
+			}
+
+			if !bytes.Equal(dst, tt.want) {
+				t.Errorf("decompressed data differs from plaintext")
+			}
+		})
+	}
+}
+
+// TestXpressMSXCA decompresses the examples of LZ77+Huffman compression in
+// MS-XCA, stored as msxca_*.bin.
+func TestXpressMSXCA(t *testing.T) {
+	tests := []struct {
+		file string
+		want []byte
+	}{
+		{"msxca_alphabet.bin", []byte("abcdefghijklmnopqrstuvwxyz")},
+		{"msxca_abc.bin", bytes.Repeat([]byte("abc"), 100)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			dst := make([]byte, len(tt.want))
+			if err := Xpress(dst, readTestdata(t, tt.file)); err != nil {
+				t.Fatalf("decompress: %v", err)
+			}
+
+			if !bytes.Equal(dst, tt.want) {
+				t.Errorf("got %q, want %q", dst, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecompressCorrupted(t *testing.T) {
+	tests := []struct {
+		name       string
+		file       string
+		size       int
+		decompress Func
+	}{
+		{"XPRESS truncated", "xpress4k.bin", 4096, Xpress},
+		{"LZX truncated", "lzx.bin", 32768, LZX(32768)},
+		{"LZX larger than window", "lzx.bin", 65536, LZX(32768)},
+		{"LZMS truncated", "lzms.bin", 3420, LZMS},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src := readTestdata(t, tt.file)
+
+			err := tt.decompress(make([]byte, tt.size), src[:len(src)/2])
+			if !errors.Is(err, ErrCorrupted) {
+				t.Errorf("got %v, want %v", err, ErrCorrupted)
+			}
+		})
+	}
+}
+
+func TestLzxUndoE8(t *testing.T) {
+	call := func(pos int, target int32) []byte {
+		b := make([]byte, 32)
+		b[pos] = 0xE8
+		binary.LittleEndian.PutUint32(b[pos+1:], uint32(target))
+		return b
+	}
+
+	tests := []struct {
+		name     string
+		in, want []byte
+	}{
+		// absolute target 0x100 of CALL at 4 is relative 0xFC
+		{"translated", call(4, 0x100), call(4, 0xFC)},
+		// negative absolute target within the position compensates file size
+		{"compensating", call(8, -4), call(8, lzxE8FileSize-4)},
+		{"beyond file size", call(4, lzxE8FileSize), call(4, lzxE8FileSize)},
+		{"before the start", call(4, -5), call(4, -5)},
+		// the last 10 bytes are not translated
+		{"tail", call(22, 0x100), call(22, 0x100)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lzxUndoE8(tt.in)
+
+			if !bytes.Equal(tt.in, tt.want) {
+				t.Errorf("got % X, want % X", tt.in, tt.want)
+			}
+		})
+	}
+}
+
+func TestLzmsUndoX86(t *testing.T) {
+	type call struct {
+		pos    int
+		target uint32
+	}
+
+	// FF 15 is a call with 32-bit target, which is translated only within
+	// 1023 bytes after an instruction whose target was seen before
+	data := func(calls ...call) []byte {
+		b := make([]byte, 32)
+		for _, c := range calls {
+			b[c.pos], b[c.pos+1] = 0xFF, 0x15
+			binary.LittleEndian.PutUint32(b[c.pos+2:], c.target)
+		}
+		return b
+	}
+
+	tests := []struct {
+		name     string
+		in, want []byte
+	}{
+		// low 16 bits of targets at 0 and 6 are the same 0x1000 with positions
+		{"translated", data(call{0, 0x1000}, call{6, 0x0FFA}, call{12, 0x2000}),
+			data(call{0, 0x1000}, call{6, 0x0FFA}, call{12, 0x2000 - 12})},
+		{"different targets", data(call{0, 0x1000}, call{6, 0x3000}, call{12, 0x2000}),
+			data(call{0, 0x1000}, call{6, 0x3000}, call{12, 0x2000})},
+		// the last 16 bytes are not translated
+		{"tail", data(call{0, 0x1000}, call{6, 0x0FFA}, call{20, 0x2000}),
+			data(call{0, 0x1000}, call{6, 0x0FFA}, call{20, 0x2000})},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lzmsUndoX86(tt.in)
+
+			if !bytes.Equal(tt.in, tt.want) {
+				t.Errorf("got % X, want % X", tt.in, tt.want)
+			}
+		})
+	}
+}
+
+func TestLzxUncompressedBlock(t *testing.T) {
+	data := []byte("uncompressed block of odd size")
+	if len(data)%2 == 0 {
+		data = append(data, '.')
+	}
+
+	// block type 3 and size in 16 bits after the default size bit, padded to
+	// 16 bits and followed by recent offsets
+	header := uint32(3)<<17 | uint32(len(data))
+	src := binary.LittleEndian.AppendUint16(nil, uint16(header>>4))
+	src = binary.LittleEndian.AppendUint16(src, uint16(header<<12))
+	for i := 0; i < lzxNumRecent; i++ {
+		src = binary.LittleEndian.AppendUint32(src, 1)
+	}
+	src = append(src, data...)
+	src = append(src, 0)
+
+	dst := make([]byte, len(data))
+	if err := LZX(32768)(dst, src); err != nil {
+		t.Fatalf("decompress: %v", err)
+	}
+
+	if !bytes.Equal(dst, data) {
+		t.Errorf("got %q, want %q", dst, data)
+	}
+}
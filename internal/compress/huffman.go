@@ -0,0 +1,79 @@
+package compress
+
+import (
+	"errors"
+)
+
+const invalidSymbol = 0xFFFF
+
+var errBadHuffman = errors.New("invalid Huffman code lengths")
+
+// huffman is a decoding table of canonical Huffman code, looked up with
+// maxBits bits of input.
+type huffman struct {
+	table   []uint16 // symbol for each maxBits bit prefix
+	lengths []uint8  // code length of each symbol
+	maxBits uint
+}
+
+// build builds the table from code lengths, where 0 is unused symbol. Codes
+// are assigned in order of length and then symbol, as in both XPRESS and LZX.
+func (h *huffman) build(lengths []uint8, maxBits uint) error {
+	size := 1 << maxBits
+	if len(h.table) != size {
+		h.table = make([]uint16, size)
+	}
+	for i := range h.table {
+		h.table[i] = invalidSymbol
+	}
+
+	h.lengths = lengths
+	h.maxBits = maxBits
+
+	var count [33]int
+	for _, l := range lengths {
+		if uint(l) > maxBits {
+			return errBadHuffman
+		}
+		count[l]++
+	}
+	count[0] = 0
+
+	var nextCode [33]int
+	code := 0
+	for l := uint(1); l <= maxBits; l++ {
+		code = (code + count[l-1]) << 1
+		nextCode[l] = code
+	}
+
+	for sym, l := range lengths {
+		if l == 0 {
+			continue
+		}
+
+		code := nextCode[l]
+		nextCode[l]++
+		if code >= 1<<l {
+			// over-subscribed
+			return errBadHuffman
+		}
+
+		start := code << (maxBits - uint(l))
+		end := start + 1<<(maxBits-uint(l))
+		for i := start; i < end; i++ {
+			h.table[i] = uint16(sym)
+		}
+	}
+
+	return nil
+}
+
+// decode returns symbol and its code length for maxBits bits of input.
+func (h *huffman) decode(bits uint32) (uint16, uint, error) {
+	sym := h.table[bits]
+	if sym == invalidSymbol {
+		return 0, 0, errBadHuffman
+	}
+
+	return sym, uint(h.lengths[sym]), nil
+}
@@ -0,0 +1,609 @@
+package compress
+
+import (
+	"encoding/binary"
+	"math/bits"
+	"sort"
+)
+
+// LZMS of WIM, with adaptive Huffman codes read from the end of input and
+// range coded bits read from the start of input.
+const (
+	lzmsNumLZReps    = 3
+	lzmsNumDeltaReps = 3
+
+	lzmsNumMainProbs     = 16
+	lzmsNumMatchProbs    = 32
+	lzmsNumLZProbs       = 64
+	lzmsNumLZRepProbs    = 64
+	lzmsNumDeltaProbs    = 64
+	lzmsNumDeltaRepProbs = 64
+
+	lzmsProbabilityBits    = 6
+	lzmsProbabilityDenom   = 1 << lzmsProbabilityBits
+	lzmsInitialProbability = 48
+	lzmsInitialRecentBits  = 0x0000000055555555
+
+	lzmsNumLiteralSyms    = 256
+	lzmsNumLengthSyms     = 54
+	lzmsNumDeltaPowerSyms = 8
+	lzmsMaxCodeLen        = 15
+
+	lzmsLiteralRebuildFreq     = 1024
+	lzmsLZOffsetRebuildFreq    = 1024
+	lzmsLengthRebuildFreq      = 512
+	lzmsDeltaOffsetRebuildFreq = 1024
+	lzmsDeltaPowerRebuildFreq  = 512
+
+	lzmsX86MaxTranslationOffset = 1023
+	lzmsX86IDWindowSize         = 65535
+)
+
+var (
+	lzmsOffsetSlotBase, lzmsExtraOffsetBits = lzmsSlotBases([]int{
+		9, 0, 9, 7, 10, 15, 15, 20, 20, 30, 33, 40, 42, 45, 60, 73, 80, 85, 95, 105, 6,
+	}, 0x7FFFFFFF)
+	lzmsLengthSlotBase, lzmsExtraLengthBits = lzmsSlotBases([]int{
+		27, 4, 6, 4, 5, 2, 1, 1, 1, 1, 1, 0, 0, 0, 0, 0, 1,
+	}, 0x400108AB)
+)
+
+// lzmsSlotBases returns bases and numbers of extra bits of slots, from run
+// lengths of slots whose size is each power of 2 and the end of last slot.
+func lzmsSlotBases(runLens []int, final uint32) ([]uint32, []uint) {
+	var base []uint32
+	var extra []uint
+
+	b := uint32(0)
+	for order, runLen := range runLens {
+		for ; runLen > 0; runLen-- {
+			b += 1 << order
+			if len(base) > 0 {
+				extra = append(extra, uint(order))
+			}
+			base = append(base, b)
+		}
+	}
+
+	extra = append(extra, uint(bits.Len32(final-base[len(base)-1])-1))
+	base = append(base, final)
+
+	return base, extra
+}
+
+// lzmsSlot returns slot of the value from bases of slots.
+func lzmsSlot(base []uint32, v uint32) int {
+	return sort.Search(len(base)-1, func(i int) bool { return base[i+1] > v })
+}
+
+// lzmsProb is an adaptive probability of 0 bit, from the last 64 bits.
+type lzmsProb struct {
+	zeros  uint32
+	recent uint64
+}
+
+func (p *lzmsProb) probability() uint32 {
+	prob := p.zeros
+	// 0% and 100% are not allowed
+	if prob == 0 {
+		prob = 1
+	} else if prob == lzmsProbabilityDenom {
+		prob--
+	}
+
+	return prob
+}
+
+func (p *lzmsProb) update(bit uint32) {
+	p.zeros += uint32(p.recent>>(lzmsProbabilityDenom-1)) - bit
+	p.recent = p.recent<<1 | uint64(bit)
+}
+
+// lzmsRangeDecoder decodes bits from 16-bit words from the start of input.
+type lzmsRangeDecoder struct {
+	src  []byte
+	pos  int
+	rng  uint32
+	code uint32
+}
+
+// decodeBit decodes a bit with the probability of state, and updates state.
+func (rd *lzmsRangeDecoder) decodeBit(state *uint32, probs []lzmsProb) uint32 {
+	p := &probs[*state]
+	*state = (*state << 1) & uint32(len(probs)-1)
+
+	prob := p.probability()
+
+	if rd.rng&0xFFFF0000 == 0 {
+		rd.rng <<= 16
+		rd.code <<= 16
+		if rd.pos+2 <= len(rd.src) {
+			rd.code |= uint32(binary.LittleEndian.Uint16(rd.src[rd.pos:]))
+			rd.pos += 2
+		}
+	}
+
+	bound := (rd.rng >> lzmsProbabilityBits) * prob
+	if rd.code < bound {
+		rd.rng = bound
+		p.update(0)
+		return 0
+	}
+
+	rd.rng -= bound
+	rd.code -= bound
+	p.update(1)
+	*state |= 1
+
+	return 1
+}
+
+// lzmsBits reads bits from 16-bit words backwards from the end of input,
+// most significant bit first.
+type lzmsBits struct {
+	src  []byte
+	pos  int // end of unread words
+	buf  uint64
+	left uint
+}
+
+func (b *lzmsBits) ensure(n uint) {
+	for b.left < n {
+		var w uint64
+		if b.pos >= 2 {
+			b.pos -= 2
+			w = uint64(binary.LittleEndian.Uint16(b.src[b.pos:]))
+		}
+		b.buf |= w << (48 - b.left)
+		b.left += 16
+	}
+}
+
+func (b *lzmsBits) read(n uint) uint32 {
+	if n == 0 {
+		return 0
+	}
+
+	b.ensure(n)
+	v := uint32(b.buf >> (64 - n))
+	b.buf <<= n
+	b.left -= n
+
+	return v
+}
+
+// lzmsHuffman is a Huffman code rebuilt from frequencies of decoded symbols
+// after every rebuildFreq symbols. Symbols are decoded by comparing with the
+// first code of each length instead of a table, as the code is rebuilt often.
+type lzmsHuffman struct {
+	freqs       []uint32
+	lens        []uint8
+	count       [lzmsMaxCodeLen + 1]uint32 // number of codes of each length
+	sorted      []uint16                   // symbols sorted by code
+	rebuildFreq int
+	untilBuild  int
+}
+
+func newLzmsHuffman(numSyms, rebuildFreq int) *lzmsHuffman {
+	h := &lzmsHuffman{
+		freqs:       make([]uint32, numSyms),
+		lens:        make([]uint8, numSyms),
+		sorted:      make([]uint16, 0, numSyms),
+		rebuildFreq: rebuildFreq,
+	}
+	for i := range h.freqs {
+		h.freqs[i] = 1
+	}
+	h.rebuild()
+
+	return h
+}
+
+func (h *lzmsHuffman) rebuild() {
+	lzmsCodeLens(h.freqs, h.lens, lzmsMaxCodeLen)
+
+	h.count = [lzmsMaxCodeLen + 1]uint32{}
+	for _, l := range h.lens {
+		h.count[l]++
+	}
+	h.sorted = h.sorted[:0]
+	for l := uint8(1); l <= lzmsMaxCodeLen; l++ {
+		for sym, symLen := range h.lens {
+			if symLen == l {
+				h.sorted = append(h.sorted, uint16(sym))
+			}
+		}
+	}
+
+	for i := range h.freqs {
+		h.freqs[i] = h.freqs[i]>>1 + 1
+	}
+	h.untilBuild = h.rebuildFreq
+}
+
+func (h *lzmsHuffman) decode(b *lzmsBits) (int, error) {
+	b.ensure(lzmsMaxCodeLen)
+	bits := uint32(b.buf >> (64 - lzmsMaxCodeLen))
+
+	var first, index uint32
+	for l := uint(1); l <= lzmsMaxCodeLen; l++ {
+		code := bits >> (lzmsMaxCodeLen - l)
+		if code-first < h.count[l] {
+			sym := h.sorted[index+code-first]
+			b.buf <<= l
+			b.left -= l
+
+			h.freqs[sym]++
+			if h.untilBuild--; h.untilBuild == 0 {
+				h.rebuild()
+			}
+
+			return int(sym), nil
+		}
+
+		index += h.count[l]
+		first = (first + h.count[l]) << 1
+	}
+
+	return 0, errBadHuffman
+}
+
+// lzmsCodeLens computes length-limited Huffman code lengths from frequencies,
+// as the compressor does. Symbols are sorted by frequency and then by symbol,
+// leaves are preferred over internal nodes of the same frequency, and too
+// long codes are shortened by moving leaves up to the deepest level which
+// still has one.
+func lzmsCodeLens(freqs []uint32, lens []uint8, maxLen int) {
+	n := len(freqs)
+
+	syms := make([]int, n)
+	for i := range syms {
+		syms[i] = i
+	}
+	sort.SliceStable(syms, func(i, j int) bool {
+		return freqs[syms[i]] < freqs[syms[j]]
+	})
+
+	// val is frequency of leaves and internal nodes, then index of the
+	// parent, then depth
+	val := make([]uint32, n)
+	for i, sym := range syms {
+		val[i] = freqs[sym]
+	}
+
+	i, b, e := 0, 0, 0
+	next := func() int {
+		if i != n && (b == e || val[i] <= val[b]) {
+			i++
+			return i - 1
+		}
+		b++
+		return b - 1
+	}
+	for n-e > 1 {
+		m := next()
+		k := next()
+
+		freq := val[m] + val[k]
+		val[m] = uint32(e)
+		val[k] = uint32(e)
+		val[e] = freq
+		e++
+	}
+
+	lenCounts := make([]int, maxLen+2)
+	lenCounts[1] = 2
+
+	root := n - 2
+	val[root] = 0
+	for node := root - 1; node >= 0; node-- {
+		depth := val[val[node]] + 1
+		val[node] = depth
+
+		l := int(depth)
+		if l >= maxLen {
+			l = maxLen
+			for {
+				l--
+				if lenCounts[l] != 0 {
+					break
+				}
+			}
+		}
+
+		lenCounts[l]--
+		lenCounts[l+1] += 2
+	}
+
+	// longer codes go to symbols of lower frequency
+	k := 0
+	for l := maxLen; l >= 1; l-- {
+		for c := lenCounts[l]; c > 0; c-- {
+			lens[syms[k]] = uint8(l)
+			k++
+		}
+	}
+}
+
+type lzmsDecoder struct {
+	rd   lzmsRangeDecoder
+	bits lzmsBits
+
+	mainProbs     [lzmsNumMainProbs]lzmsProb
+	matchProbs    [lzmsNumMatchProbs]lzmsProb
+	lzProbs       [lzmsNumLZProbs]lzmsProb
+	lzRepProbs    [lzmsNumLZReps - 1][lzmsNumLZRepProbs]lzmsProb
+	deltaProbs    [lzmsNumDeltaProbs]lzmsProb
+	deltaRepProbs [lzmsNumDeltaReps - 1][lzmsNumDeltaRepProbs]lzmsProb
+
+	literal, lzOffset, length, deltaOffset, deltaPower *lzmsHuffman
+}
+
+func (d *lzmsDecoder) initProbs() {
+	probs := [][]lzmsProb{d.mainProbs[:], d.matchProbs[:], d.lzProbs[:], d.deltaProbs[:]}
+	for i := range d.lzRepProbs {
+		probs = append(probs, d.lzRepProbs[i][:])
+	}
+	for i := range d.deltaRepProbs {
+		probs = append(probs, d.deltaRepProbs[i][:])
+	}
+
+	for _, ps := range probs {
+		for i := range ps {
+			ps[i] = lzmsProb{zeros: lzmsInitialProbability, recent: lzmsInitialRecentBits}
+		}
+	}
+}
+
+// readSlot decodes slot with h and returns base of it with extra bits.
+func (d *lzmsDecoder) readSlot(h *lzmsHuffman, base []uint32, extra []uint) (uint32, error) {
+	slot, err := h.decode(&d.bits)
+	if err != nil {
+		return 0, err
+	}
+
+	return base[slot] + d.bits.read(extra[slot]), nil
+}
+
+// LZMS decompresses src compressed with LZMS into dst, which has the exact
+// size of decompressed data.
+func LZMS(dst, src []byte) error {
+	if len(src) < 4 || len(src)%2 != 0 {
+		return ErrCorrupted
+	}
+
+	d := &lzmsDecoder{
+		rd: lzmsRangeDecoder{
+			src:  src,
+			pos:  4,
+			rng:  0xFFFFFFFF,
+			code: uint32(binary.LittleEndian.Uint16(src))<<16 | uint32(binary.LittleEndian.Uint16(src[2:])),
+		},
+		bits: lzmsBits{src: src, pos: len(src)},
+	}
+	d.initProbs()
+
+	numOffsetSlots := 0
+	if len(dst) >= 2 {
+		numOffsetSlots = 1 + lzmsSlot(lzmsOffsetSlotBase, uint32(len(dst)-1))
+	}
+	if numOffsetSlots < 2 {
+		// codes need two symbols at least
+		numOffsetSlots = 2
+	}
+
+	d.literal = newLzmsHuffman(lzmsNumLiteralSyms, lzmsLiteralRebuildFreq)
+	d.lzOffset = newLzmsHuffman(numOffsetSlots, lzmsLZOffsetRebuildFreq)
+	d.length = newLzmsHuffman(lzmsNumLengthSyms, lzmsLengthRebuildFreq)
+	d.deltaOffset = newLzmsHuffman(numOffsetSlots, lzmsDeltaOffsetRebuildFreq)
+	d.deltaPower = newLzmsHuffman(lzmsNumDeltaPowerSyms, lzmsDeltaPowerRebuildFreq)
+
+	var recentLZ [lzmsNumLZReps + 1]uint32
+	var recentDelta [lzmsNumDeltaReps + 1]uint64
+	for i := range recentLZ {
+		recentLZ[i] = uint32(i + 1)
+		recentDelta[i] = uint64(i + 1)
+	}
+
+	var mainState, matchState, lzState, deltaState uint32
+	var lzRepStates [lzmsNumLZReps - 1]uint32
+	var deltaRepStates [lzmsNumDeltaReps - 1]uint32
+
+	// type of the previous item, 0: literal, 1: LZ match, 2: delta match.
+	// updates of recent offsets are delayed by an item, so a repeated match
+	// right after a match of same type takes the source from the next slot.
+	prevType := 0
+
+	out := 0
+	for out < len(dst) {
+		if d.rd.decodeBit(&mainState, d.mainProbs[:]) == 0 {
+			sym, err := d.literal.decode(&d.bits)
+			if err != nil {
+				return ErrCorrupted
+			}
+			dst[out] = byte(sym)
+			out++
+			prevType = 0
+			continue
+		}
+
+		if d.rd.decodeBit(&matchState, d.matchProbs[:]) == 0 {
+			// LZ match
+			var offset uint32
+
+			if d.rd.decodeBit(&lzState, d.lzProbs[:]) == 0 {
+				off, err := d.readSlot(d.lzOffset, lzmsOffsetSlotBase, lzmsExtraOffsetBits)
+				if err != nil {
+					return ErrCorrupted
+				}
+				offset = off
+
+				recentLZ[3] = recentLZ[2]
+				recentLZ[2] = recentLZ[1]
+				recentLZ[1] = recentLZ[0]
+			} else {
+				rep := 0
+				for rep < lzmsNumLZReps-1 && d.rd.decodeBit(&lzRepStates[rep], d.lzRepProbs[rep][:]) == 1 {
+					rep++
+				}
+
+				idx := rep + prevType&1
+				offset = recentLZ[idx]
+				recentLZ[idx] = recentLZ[rep]
+				for i := rep; i > 0; i-- {
+					recentLZ[i] = recentLZ[i-1]
+				}
+			}
+			recentLZ[0] = offset
+			prevType = 1
+
+			length, err := d.readSlot(d.length, lzmsLengthSlotBase, lzmsExtraLengthBits)
+			if err != nil {
+				return ErrCorrupted
+			}
+
+			if int64(offset) > int64(out) || int64(length) > int64(len(dst)-out) {
+				return ErrCorrupted
+			}
+
+			src := out - int(offset)
+			for i := 0; i < int(length); i++ {
+				dst[out+i] = dst[src+i]
+			}
+			out += int(length)
+
+			continue
+		}
+
+		// delta match, which adds difference of bytes span apart
+		var power, rawOffset uint32
+
+		if d.rd.decodeBit(&deltaState, d.deltaProbs[:]) == 0 {
+			p, err := d.deltaPower.decode(&d.bits)
+			if err != nil {
+				return ErrCorrupted
+			}
+			power = uint32(p)
+
+			if rawOffset, err = d.readSlot(d.deltaOffset, lzmsOffsetSlotBase, lzmsExtraOffsetBits); err != nil {
+				return ErrCorrupted
+			}
+
+			recentDelta[3] = recentDelta[2]
+			recentDelta[2] = recentDelta[1]
+			recentDelta[1] = recentDelta[0]
+		} else {
+			rep := 0
+			for rep < lzmsNumDeltaReps-1 && d.rd.decodeBit(&deltaRepStates[rep], d.deltaRepProbs[rep][:]) == 1 {
+				rep++
+			}
+
+			idx := rep + prevType>>1
+			pair := recentDelta[idx]
+			recentDelta[idx] = recentDelta[rep]
+			for i := rep; i > 0; i-- {
+				recentDelta[i] = recentDelta[i-1]
+			}
+
+			power = uint32(pair >> 32)
+			rawOffset = uint32(pair)
+		}
+		recentDelta[0] = uint64(power)<<32 | uint64(rawOffset)
+		prevType = 2
+
+		length, err := d.readSlot(d.length, lzmsLengthSlotBase, lzmsExtraLengthBits)
+		if err != nil {
+			return ErrCorrupted
+		}
+
+		if power > 31 || uint64(rawOffset)<<power > uint64(out) {
+			return ErrCorrupted
+		}
+		span := int64(1) << power
+		offset := int64(rawOffset) << power
+		if offset+span > int64(out) || int64(length) > int64(len(dst)-out) {
+			return ErrCorrupted
+		}
+
+		src := out - int(offset)
+		s := int(span)
+		for i := 0; i < int(length); i++ {
+			p := out + i
+			dst[p] = dst[src+i] + dst[p-s] - dst[src+i-s]
+		}
+		out += int(length)
+	}
+
+	lzmsUndoX86(dst)
+
+	return nil
+}
+
+// lzmsUndoX86 converts absolute targets of x86 instructions translated by
+// compressor back to relative ones.
+func lzmsUndoX86(data []byte) {
+	size := len(data)
+	if size <= 17 {
+		return
+	}
+
+	lastTargetUsages := make([]int32, 65536)
+	for i := range lastTargetUsages {
+		lastTargetUsages[i] = -lzmsX86IDWindowSize - 1
+	}
+	lastX86Pos := int32(-lzmsX86MaxTranslationOffset - 1)
+
+	tail := size - 16
+	for p := 0; p < tail; {
+		opcodeLen := 0
+		maxTransOffset := int32(lzmsX86MaxTranslationOffset)
+
+		switch data[p] {
+		case 0xFF:
+			// call indirect relative
+			if data[p+1] == 0x15 {
+				opcodeLen = 2
+			}
+		case 0xF0:
+			// lock add relative
+			if data[p+1] == 0x83 && data[p+2] == 0x05 {
+				opcodeLen = 3
+			}
+		case 0x48, 0x4C:
+			// REX prefix with RIP-relative LEA or MOV
+			if data[p+2]&0x07 == 0x05 &&
+				(data[p+1] == 0x8D || (data[p+1] == 0x8B && data[p]&0x04 == 0 && data[p+2]&0xF0 == 0)) {
+				opcodeLen = 3
+			}
+		case 0xE8:
+			// call relative, translated only with more confidence
+			opcodeLen = 1
+			maxTransOffset >>= 1
+		case 0xE9:
+			// jump relative is not translated
+			p += 5
+			continue
+		}
+
+		if opcodeLen == 0 {
+			p++
+			continue
+		}
+
+		i := int32(p)
+		p += opcodeLen
+		if i-lastX86Pos <= maxTransOffset {
+			n := binary.LittleEndian.Uint32(data[p:])
+			binary.LittleEndian.PutUint32(data[p:], n-uint32(i))
+		}
+		target16 := uint16(i) + binary.LittleEndian.Uint16(data[p:])
+
+		i += int32(opcodeLen) + 4 - 1
+		if i-lastTargetUsages[target16] <= lzmsX86IDWindowSize {
+			lastX86Pos = i
+		}
+		lastTargetUsages[target16] = i
+
+		p += 4
+	}
+}
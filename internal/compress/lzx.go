@@ -0,0 +1,379 @@
+package compress
+
+import (
+	"encoding/binary"
+)
+
+// LZX of WIM and WOF, whose window is the size of chunk, without header for
+// E8 translation and with fixed translation size.
+const (
+	lzxMinWindowOrder = 15
+	lzxMaxWindowOrder = 21
+	lzxMaxOffsetSlots = 50
+	lzxNumChars       = 256
+	lzxMaxMainSymbols = lzxNumChars + 8*lzxMaxOffsetSlots
+	lzxNumLenSymbols  = 249
+	lzxNumAligned     = 8
+	lzxNumPretree     = 20
+	lzxMaxCodeLen     = 16
+	lzxMaxAlignedLen  = 8
+	lzxMaxPretreeLen  = 15
+	lzxMinMatchLen    = 2
+	lzxNumLenHeaders  = 7
+	lzxNumRecent      = 3
+	lzxDefaultBlock   = 32768
+	lzxE8FileSize     = 12000000
+
+	lzxBlockVerbatim     = 1
+	lzxBlockAligned      = 2
+	lzxBlockUncompressed = 3
+)
+
+// number of offset slots for window order from 15 to 21
+var lzxNumOffsetSlots = [...]int{30, 32, 34, 36, 38, 42, 50}
+
+var lzxExtraBits, lzxOffsetBase = func() (extra [lzxMaxOffsetSlots]uint, base [lzxMaxOffsetSlots]int) {
+	for i := range extra {
+		if i >= 4 {
+			extra[i] = uint(i/2 - 1)
+		}
+		if extra[i] > 17 {
+			extra[i] = 17
+		}
+		if i > 0 {
+			base[i] = base[i-1] + 1<<extra[i-1]
+		}
+	}
+	return
+}()
+
+// lzxBits reads bits from 16-bit little endian words, most significant bit
+// first.
+type lzxBits struct {
+	src  []byte
+	pos  int
+	buf  uint32 // buffered bits aligned to the most significant bit
+	left uint
+}
+
+// ensure buffers at least n bits, n up to 17.
+func (b *lzxBits) ensure(n uint) {
+	for b.left < n {
+		var w uint32
+		if b.pos+2 <= len(b.src) {
+			w = uint32(binary.LittleEndian.Uint16(b.src[b.pos:]))
+		}
+		b.pos += 2
+		b.buf |= w << (16 - b.left)
+		b.left += 16
+	}
+}
+
+func (b *lzxBits) peek(n uint) uint32 {
+	return b.buf >> (32 - n)
+}
+
+func (b *lzxBits) consume(n uint) {
+	b.buf <<= n
+	b.left -= n
+}
+
+func (b *lzxBits) read(n uint) uint32 {
+	if n == 0 {
+		return 0
+	}
+
+	b.ensure(n)
+	v := b.peek(n)
+	b.consume(n)
+
+	return v
+}
+
+// overrun reports whether bits past the end of input have been used.
+func (b *lzxBits) overrun() bool {
+	return b.pos > len(b.src)+2
+}
+
+func (b *lzxBits) decode(h *huffman) (uint16, error) {
+	b.ensure(h.maxBits)
+	sym, n, err := h.decode(b.peek(h.maxBits))
+	if err != nil {
+		return 0, err
+	}
+	b.consume(n)
+
+	return sym, nil
+}
+
+// align discards bits up to the next 16-bit boundary, a whole word if
+// already aligned, before an uncompressed block.
+func (b *lzxBits) align() {
+	b.ensure(1)
+	b.buf = 0
+	b.left = 0
+}
+
+type lzxDecoder struct {
+	bits        lzxBits
+	windowOrder uint
+	numMainSyms int
+
+	mainLens    [lzxMaxMainSymbols]uint8
+	lenLens     [lzxNumLenSymbols]uint8
+	alignedLens [lzxNumAligned]uint8
+
+	main, length, aligned, pretree huffman
+}
+
+// readLens reads code lengths as delta from previous lengths in lens, with
+// pretree.
+func (d *lzxDecoder) readLens(lens []uint8) error {
+	var preLens [lzxNumPretree]uint8
+	for i := range preLens {
+		preLens[i] = uint8(d.bits.read(4))
+	}
+	if err := d.pretree.build(preLens[:], lzxMaxPretreeLen); err != nil {
+		return err
+	}
+
+	for i := 0; i < len(lens); {
+		sym, err := d.bits.decode(&d.pretree)
+		if err != nil {
+			return err
+		}
+
+		var run int
+		var value uint8
+
+		switch sym {
+		case 17:
+			run = 4 + int(d.bits.read(4))
+		case 18:
+			run = 20 + int(d.bits.read(5))
+		case 19:
+			run = 4 + int(d.bits.read(1))
+
+			if sym, err = d.bits.decode(&d.pretree); err != nil {
+				return err
+			}
+			if sym > 16 {
+				return errBadHuffman
+			}
+			value = uint8((int(lens[i]) - int(sym) + 17) % 17)
+		default:
+			lens[i] = uint8((int(lens[i]) - int(sym) + 17) % 17)
+			i++
+			continue
+		}
+
+		if run > len(lens)-i {
+			return ErrCorrupted
+		}
+		for ; run > 0; run-- {
+			lens[i] = value
+			i++
+		}
+	}
+
+	return nil
+}
+
+// readBlockHeader reads type and size of a block, and the trees of it.
+func (d *lzxDecoder) readBlockHeader(recent *[lzxNumRecent]int) (int, int, error) {
+	blockType := int(d.bits.read(3))
+
+	size := lzxDefaultBlock
+	if d.bits.read(1) == 0 {
+		size = int(d.bits.read(16))
+		if d.windowOrder >= 16 {
+			size = size<<8 | int(d.bits.read(8))
+		}
+	}
+
+	switch blockType {
+	case lzxBlockAligned:
+		for i := range d.alignedLens {
+			d.alignedLens[i] = uint8(d.bits.read(3))
+		}
+		if err := d.aligned.build(d.alignedLens[:], lzxMaxAlignedLen); err != nil {
+			return 0, 0, err
+		}
+		fallthrough
+	case lzxBlockVerbatim:
+		if err := d.readLens(d.mainLens[:lzxNumChars]); err != nil {
+			return 0, 0, err
+		}
+		if err := d.readLens(d.mainLens[lzxNumChars:d.numMainSyms]); err != nil {
+			return 0, 0, err
+		}
+		if err := d.main.build(d.mainLens[:d.numMainSyms], lzxMaxCodeLen); err != nil {
+			return 0, 0, err
+		}
+
+		if err := d.readLens(d.lenLens[:]); err != nil {
+			return 0, 0, err
+		}
+		if err := d.length.build(d.lenLens[:], lzxMaxCodeLen); err != nil {
+			return 0, 0, err
+		}
+	case lzxBlockUncompressed:
+		d.bits.align()
+
+		src := d.bits.src
+		if d.bits.pos+4*lzxNumRecent > len(src) {
+			return 0, 0, ErrCorrupted
+		}
+		for i := range recent {
+			recent[i] = int(binary.LittleEndian.Uint32(src[d.bits.pos:]))
+			d.bits.pos += 4
+		}
+	default:
+		return 0, 0, ErrCorrupted
+	}
+
+	return blockType, size, nil
+}
+
+// decompressBlock decodes matches and literals of a verbatim or aligned block
+// into dst from out.
+func (d *lzxDecoder) decompressBlock(dst []byte, out, end, blockType int, recent *[lzxNumRecent]int) error {
+	for out < end {
+		sym, err := d.bits.decode(&d.main)
+		if err != nil {
+			return err
+		}
+
+		if sym < lzxNumChars {
+			dst[out] = byte(sym)
+			out++
+			continue
+		}
+
+		sym -= lzxNumChars
+		length := int(sym & 7)
+		slot := int(sym >> 3)
+
+		if length == lzxNumLenHeaders {
+			lenSym, err := d.bits.decode(&d.length)
+			if err != nil {
+				return err
+			}
+			length += int(lenSym)
+		}
+		length += lzxMinMatchLen
+
+		var offset int
+		if slot < lzxNumRecent {
+			// repeated offset, swapped with the most recent one
+			offset = recent[slot]
+			recent[slot] = recent[0]
+		} else {
+			extra := lzxExtraBits[slot]
+			if blockType == lzxBlockAligned && extra >= 3 {
+				offset = int(d.bits.read(extra-3)) << 3
+				alignedSym, err := d.bits.decode(&d.aligned)
+				if err != nil {
+					return err
+				}
+				offset += int(alignedSym)
+			} else {
+				offset = int(d.bits.read(extra))
+			}
+			offset += lzxOffsetBase[slot] - (lzxNumRecent - 1)
+
+			recent[2] = recent[1]
+			recent[1] = recent[0]
+		}
+		recent[0] = offset
+
+		if d.bits.overrun() || offset > out || length > end-out {
+			return ErrCorrupted
+		}
+
+		for i := 0; i < length; i++ {
+			dst[out+i] = dst[out-offset+i]
+		}
+		out += length
+	}
+
+	return nil
+}
+
+// LZX returns Func decompressing chunks compressed with LZX, whose window is
+// windowSize, the chunk size.
+func LZX(windowSize int) Func {
+	order := uint(lzxMinWindowOrder)
+	for 1<<order < windowSize && order < lzxMaxWindowOrder {
+		order++
+	}
+
+	return func(dst, src []byte) error {
+		return decompressLZX(dst, src, order)
+	}
+}
+
+// decompressLZX decompresses a chunk src compressed with LZX into dst, which
+// has the exact size of decompressed data.
+func decompressLZX(dst, src []byte, windowOrder uint) error {
+	if len(dst) > 1<<windowOrder {
+		return ErrCorrupted
+	}
+
+	d := &lzxDecoder{
+		bits:        lzxBits{src: src},
+		windowOrder: windowOrder,
+		numMainSyms: lzxNumChars + 8*lzxNumOffsetSlots[windowOrder-lzxMinWindowOrder],
+	}
+	recent := [lzxNumRecent]int{1, 1, 1}
+
+	for out := 0; out < len(dst); {
+		blockType, size, err := d.readBlockHeader(&recent)
+		if err != nil {
+			return ErrCorrupted
+		}
+		if size == 0 || size > len(dst)-out {
+			return ErrCorrupted
+		}
+
+		if blockType == lzxBlockUncompressed {
+			pos := d.bits.pos
+			if pos+size > len(src) {
+				return ErrCorrupted
+			}
+			copy(dst[out:], src[pos:pos+size])
+			d.bits.pos = pos + size + size&1 // padded to 16 bits
+		} else if err = d.decompressBlock(dst, out, out+size, blockType, &recent); err != nil {
+			return ErrCorrupted
+		}
+		out += size
+	}
+
+	lzxUndoE8(dst)
+
+	return nil
+}
+
+// lzxUndoE8 converts absolute targets of x86 CALL instructions translated by
+// compressor back to relative ones.
+func lzxUndoE8(b []byte) {
+	if len(b) <= 10 {
+		return
+	}
+
+	for i := 0; i < len(b)-10; i++ {
+		if b[i] != 0xE8 {
+			continue
+		}
+
+		abs := int32(binary.LittleEndian.Uint32(b[i+1:]))
+		if abs >= -int32(i) && abs < lzxE8FileSize {
+			rel := abs - int32(i)
+			if abs < 0 {
+				rel = abs + lzxE8FileSize
+			}
+			binary.LittleEndian.PutUint32(b[i+1:], uint32(rel))
+		}
+		i += 4
+	}
+}
@@ -0,0 +1,726 @@
+//go:build ignore
+// +build ignore
+
+// gen writes samples compressed with XPRESS(LZ77+Huffman), LZX and LZMS for
+// tests of internal/compress and wof, and WIM files for tests of wim, run with
+// "go run -modfile=gen.mod gen.go gen_lzms.go gen_wim.go" in this directory.
+//
+// Encoders here follow MS-XCA and the LZX and LZMS formats of WIM
+// independently from the decoders, with naive matching and without any
+// optimization. LZX samples and the non-solid WIM file are checked with the
+// decoder and WIM reader of github.com/Microsoft/go-winio before they are
+// written, LZMS has no reference decoder available.
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/Microsoft/go-winio/wim/lzx"
+)
+
+func main() {
+	plain := plaintext()
+	e8 := e8Sample()
+
+	must(os.WriteFile("plain.bin", plain[:32768], 0o644))
+	must(os.WriteFile("e8.bin", e8, 0o644))
+
+	for _, size := range []int{4096, 8192, 16384} {
+		must(os.WriteFile(filepath.Join(".", xpressName(size)), xpress(plain[:size]), 0o644))
+	}
+
+	// verbatim, uncompressed and aligned blocks in one chunk
+	must(os.WriteFile("lzx.bin", checkLZX(lzxCompress(plain[:32768], []lzxBlock{
+		{blockVerbatim, 12000},
+		{blockUncompressed, 1001},
+		{blockAligned, 32768 - 13001},
+	}), plain[:32768]), 0o644))
+	must(os.WriteFile("lzx_e8.bin", checkLZX(lzxCompress(e8, []lzxBlock{{blockVerbatim, len(e8)}}), e8), 0o644))
+
+	lzmsPlain := lzmsText(10)
+	must(os.WriteFile("lzms_plain.bin", lzmsPlain, 0o644))
+	must(os.WriteFile("lzms.bin", lzmsCompress(lzmsPlain), 0o644))
+
+	writeWIMs(filepath.Join("..", "..", "..", "wim", "testdata"), plaintext())
+
+	wofDir := filepath.Join("..", "..", "..", "wof", "testdata")
+	must(os.MkdirAll(wofDir, 0o755))
+	must(os.WriteFile(filepath.Join(wofDir, "plain.bin"), plain, 0o644))
+
+	for _, alg := range []struct {
+		name      string
+		algorithm uint32
+		chunkSize int
+	}{
+		{"xpress4k", 0, 4096},
+		{"lzx", 1, 32768},
+		{"xpress8k", 2, 8192},
+		{"xpress16k", 3, 16384},
+	} {
+		compress := xpress
+		if alg.algorithm == 1 {
+			compress = func(b []byte) []byte {
+				return checkLZX(lzxCompress(b, []lzxBlock{{blockVerbatim, len(b)}}), b)
+			}
+		}
+
+		must(os.WriteFile(filepath.Join(wofDir, alg.name+".wof"), wofStream(plain, alg.chunkSize, compress), 0o644))
+		must(os.WriteFile(filepath.Join(wofDir, alg.name+".reparse"), wofReparse(alg.algorithm), 0o644))
+	}
+}
+
+// checkLZX returns LZX compressed data after checking that the decoder of
+// go-winio decompresses it into plain.
+func checkLZX(compressed, plain []byte) []byte {
+	r, err := lzx.NewReader(bytes.NewReader(compressed), len(plain))
+	must(err)
+
+	got, err := io.ReadAll(r)
+	must(err)
+	if !bytes.Equal(got, plain) {
+		panic("LZX sample is decompressed differently by go-winio")
+	}
+
+	return compressed
+}
+
+func must(err error) {
+	if err != nil {
+		panic(err)
+	}
+}
+
+func xpressName(size int) string {
+	return map[int]string{4096: "xpress4k.bin", 8192: "xpress8k.bin", 16384: "xpress16k.bin"}[size]
+}
+
+// plaintext returns 40000 bytes of text with long runs, x86 CALL instructions
+// and a random incompressible part.
+func plaintext() []byte {
+	rnd := rand.New(rand.NewSource(1))
+	words := []string{
+		"stream", "alternate", "data", "NTFS", "file", "volume", "chunk",
+		"compressed", "overlay", "filter", "attribute", "record", "index",
+		"Zone.Identifier", "reparse", "point", "the", "of", "and", "with",
+	}
+
+	var b bytes.Buffer
+	for b.Len() < 6000 {
+		b.WriteString(words[rnd.Intn(len(words))])
+		if rnd.Intn(12) == 0 {
+			b.WriteString(".\r\n")
+		} else {
+			b.WriteByte(' ')
+		}
+	}
+
+	// long match with extended length
+	b.Write(bytes.Repeat([]byte{'A'}, 600))
+
+	// incompressible data filling the third 4K chunk
+	for b.Len() < 3*4096 {
+		b.WriteByte(byte(rnd.Intn(256)))
+	}
+
+	b.Write(e8Sample())
+
+	for b.Len() < 40000 {
+		b.WriteString(words[rnd.Intn(len(words))])
+		b.WriteByte(' ')
+	}
+
+	return b.Bytes()[:40000]
+}
+
+// e8Sample returns code with CALL(0xE8) instructions, whose targets are
+// translated to absolute ones before LZX compression.
+func e8Sample() []byte {
+	var b bytes.Buffer
+
+	rel := []int32{0x10, -0x8, 0x7FFFFFF, 12000000 - 0x20, -0x10000}
+	for i := 0; i < 64; i++ {
+		b.Write([]byte{0x55, 0x8B, 0xEC, 0xE8})
+		binary.Write(&b, binary.LittleEndian, rel[i%len(rel)])
+		b.Write([]byte{0x5D, 0xC3, 0x90, 0x90})
+	}
+
+	// not translated in the last 10 bytes
+	b.Write([]byte{0x90, 0x90, 0xE8, 0x01, 0x00, 0x00, 0x00, 0x90, 0x90, 0xC3})
+
+	return b.Bytes()
+}
+
+// wofStream returns content of WofCompressedData with chunk table, chunks
+// not smaller when compressed are stored as is.
+func wofStream(plain []byte, chunkSize int, compress func([]byte) []byte) []byte {
+	var chunks [][]byte
+	for off := 0; off < len(plain); off += chunkSize {
+		end := off + chunkSize
+		if end > len(plain) {
+			end = len(plain)
+		}
+
+		c := compress(plain[off:end])
+		if len(c) >= end-off {
+			c = plain[off:end]
+		}
+		chunks = append(chunks, c)
+	}
+
+	var table, data bytes.Buffer
+	for i, c := range chunks {
+		if i > 0 {
+			binary.Write(&table, binary.LittleEndian, uint32(data.Len()))
+		}
+		data.Write(c)
+	}
+
+	return append(table.Bytes(), data.Bytes()...)
+}
+
+// wofReparse returns REPARSE_DATA_BUFFER of IO_REPARSE_TAG_WOF with
+// WOF_EXTERNAL_INFO and FILE_PROVIDER_EXTERNAL_INFO_V1.
+func wofReparse(algorithm uint32) []byte {
+	b := make([]byte, 8+16)
+	binary.LittleEndian.PutUint32(b, 0x80000017)
+	binary.LittleEndian.PutUint16(b[4:], 16)
+	binary.LittleEndian.PutUint32(b[8:], 1)  // WOF_CURRENT_VERSION
+	binary.LittleEndian.PutUint32(b[12:], 2) // WOF_PROVIDER_FILE
+	binary.LittleEndian.PutUint32(b[16:], 1) // FILE_PROVIDER_CURRENT_VERSION
+	binary.LittleEndian.PutUint32(b[20:], algorithm)
+
+	return b
+}
+
+// codeLengths returns lengths of Huffman code for freqs limited to maxLen,
+// frequencies are flattened until the code fits.
+func codeLengths(freqs []int, maxLen int) []uint8 {
+	f := append([]int(nil), freqs...)
+
+	for {
+		lens := huffmanLengths(f)
+
+		fits := true
+		for _, l := range lens {
+			fits = fits && int(l) <= maxLen
+		}
+		if fits {
+			return lens
+		}
+
+		for i := range f {
+			if f[i] > 0 {
+				f[i] = f[i]/2 + 1
+			}
+		}
+	}
+}
+
+func huffmanLengths(freqs []int) []uint8 {
+	type node struct {
+		freq        int
+		sym         int
+		left, right *node
+	}
+
+	var nodes []*node
+	for sym, f := range freqs {
+		if f > 0 {
+			nodes = append(nodes, &node{freq: f, sym: sym})
+		}
+	}
+
+	lens := make([]uint8, len(freqs))
+	switch len(nodes) {
+	case 0:
+		return lens
+	case 1:
+		lens[nodes[0].sym] = 1
+		return lens
+	}
+
+	for len(nodes) > 1 {
+		sort.SliceStable(nodes, func(i, j int) bool { return nodes[i].freq < nodes[j].freq })
+		n := &node{freq: nodes[0].freq + nodes[1].freq, sym: -1, left: nodes[0], right: nodes[1]}
+		nodes = append([]*node{n}, nodes[2:]...)
+	}
+
+	var walk func(n *node, depth uint8)
+	walk = func(n *node, depth uint8) {
+		if n.sym >= 0 {
+			lens[n.sym] = depth
+			return
+		}
+		walk(n.left, depth+1)
+		walk(n.right, depth+1)
+	}
+	walk(nodes[0], 0)
+
+	return lens
+}
+
+// canonicalCodes assigns codes in order of length and then symbol.
+func canonicalCodes(lens []uint8) []uint32 {
+	codes := make([]uint32, len(lens))
+
+	code := uint32(0)
+	for l := uint8(1); l <= 16; l++ {
+		for sym, sl := range lens {
+			if sl == l {
+				codes[sym] = code
+				code++
+			}
+		}
+		code <<= 1
+	}
+
+	return codes
+}
+
+type match struct {
+	literal bool
+	b       byte
+	length  int
+	offset  int
+}
+
+// findMatches parses b from start to end greedily into literals and matches
+// of length from minLen to maxLen within maxOffset, matches with offsets in
+// recent are preferred, which is updated with updateRecent if not nil.
+func findMatches(b []byte, start, end, minLen, maxLen, maxOffset int, recent []int) []match {
+	var out []match
+
+	matchLen := func(pos, offset int) int {
+		n := 0
+		for pos+n < end && n < maxLen && b[pos+n] == b[pos+n-offset] {
+			n++
+		}
+		return n
+	}
+
+	// positions of 3-byte prefixes, the latest last
+	chains := make(map[[3]byte][]int)
+	insert := func(pos int) {
+		if pos+3 <= len(b) {
+			key := [3]byte{b[pos], b[pos+1], b[pos+2]}
+			chains[key] = append(chains[key], pos)
+		}
+	}
+	for pos := 0; pos < start; pos++ {
+		insert(pos)
+	}
+
+	for pos := start; pos < end; {
+		bestLen, bestOff := 0, 0
+
+		for _, off := range recent {
+			if off <= pos {
+				if n := matchLen(pos, off); n > bestLen {
+					bestLen, bestOff = n, off
+				}
+			}
+		}
+
+		if pos+3 <= len(b) {
+			chain := chains[[3]byte{b[pos], b[pos+1], b[pos+2]}]
+			for i, tries := len(chain)-1, 0; i >= 0 && tries < 256; i, tries = i-1, tries+1 {
+				off := pos - chain[i]
+				if off > maxOffset {
+					break
+				}
+				if n := matchLen(pos, off); n > bestLen+1 {
+					bestLen, bestOff = n, off
+				}
+			}
+		}
+
+		if bestLen < minLen {
+			out = append(out, match{literal: true, b: b[pos]})
+			insert(pos)
+			pos++
+			continue
+		}
+
+		out = append(out, match{length: bestLen, offset: bestOff})
+		for i := 0; i < bestLen; i++ {
+			insert(pos + i)
+		}
+		pos += bestLen
+
+		if recent != nil {
+			updateRecent(recent, bestOff)
+		}
+	}
+
+	return out
+}
+
+// updateRecent updates recent offsets of LZX as the decoder does, returns
+// index of the offset in recent or -1.
+func updateRecent(recent []int, offset int) int {
+	for i, r := range recent {
+		if r == offset {
+			recent[i] = recent[0]
+			recent[0] = offset
+			return i
+		}
+	}
+
+	recent[2] = recent[1]
+	recent[1] = recent[0]
+	recent[0] = offset
+
+	return -1
+}
+
+// xpress compresses b with LZ77+Huffman of MS-XCA, in a single block.
+func xpress(b []byte) []byte {
+	matches := findMatches(b, 0, len(b), 3, 1000, 8192, nil)
+
+	symbol := func(m match) (int, int) {
+		if m.literal {
+			return int(m.b), 0
+		}
+
+		offsetBits := 0
+		for 1<<(offsetBits+1) <= m.offset {
+			offsetBits++
+		}
+
+		length := m.length - 3
+		if length > 15 {
+			length = 15
+		}
+
+		return 256 + offsetBits<<4 + length, offsetBits
+	}
+
+	freqs := make([]int, 512)
+	for _, m := range matches {
+		sym, _ := symbol(m)
+		freqs[sym]++
+	}
+	freqs[256]++ // end of data
+
+	lens := codeLengths(freqs, 15)
+	codes := canonicalCodes(lens)
+
+	out := make([]byte, 256, 256+len(b))
+	for i := 0; i < 256; i++ {
+		out[i] = lens[2*i] | lens[2*i+1]<<4
+	}
+
+	// 16-bit words of bits are placed where the decoder reads them, between
+	// extra bytes of match length
+	var bits []bool
+	var slots []int
+	reserve := func() {
+		slots = append(slots, len(out))
+		out = append(out, 0, 0)
+	}
+	writeBits := func(v uint32, n int) {
+		for i := n - 1; i >= 0; i-- {
+			bits = append(bits, v>>uint(i)&1 != 0)
+		}
+		for len(bits) > 16*(len(slots)-1) {
+			reserve()
+		}
+	}
+
+	reserve()
+	reserve()
+
+	for _, m := range matches {
+		sym, offsetBits := symbol(m)
+		writeBits(codes[sym], int(lens[sym]))
+
+		if m.literal {
+			continue
+		}
+
+		if length := m.length - 3; length >= 15 {
+			if length-15 < 255 {
+				out = append(out, byte(length-15))
+			} else {
+				out = append(out, 255)
+				out = binary.LittleEndian.AppendUint16(out, uint16(length))
+			}
+		}
+
+		writeBits(uint32(m.offset)&(1<<uint(offsetBits)-1), offsetBits)
+	}
+
+	writeBits(codes[256], int(lens[256]))
+
+	for i, slot := range slots {
+		var w uint16
+		for j := 0; j < 16; j++ {
+			if k := 16*i + j; k < len(bits) && bits[k] {
+				w |= 1 << uint(15-j)
+			}
+		}
+		binary.LittleEndian.PutUint16(out[slot:], w)
+	}
+
+	return out
+}
+
+const (
+	blockVerbatim     = 1
+	blockAligned      = 2
+	blockUncompressed = 3
+
+	lzxWindowOrder = 15
+	lzxMainSymbols = 256 + 8*30
+	lzxE8FileSize  = 12000000
+)
+
+type lzxBlock struct {
+	blockType int
+	size      int
+}
+
+// lzxBitWriter writes bits into 16-bit little endian words, most significant
+// bit first.
+type lzxBitWriter struct {
+	out   []byte
+	word  uint32
+	count uint
+}
+
+func (w *lzxBitWriter) write(v uint32, n uint) {
+	for i := int(n) - 1; i >= 0; i-- {
+		w.word = w.word<<1 | v>>uint(i)&1
+		w.count++
+		if w.count == 16 {
+			w.out = binary.LittleEndian.AppendUint16(w.out, uint16(w.word))
+			w.word, w.count = 0, 0
+		}
+	}
+}
+
+// align pads to the next 16-bit boundary, a whole word if already aligned.
+func (w *lzxBitWriter) align() {
+	w.write(0, 16-w.count)
+}
+
+func (w *lzxBitWriter) flush() {
+	if w.count > 0 {
+		w.write(0, 16-w.count)
+	}
+}
+
+var lzxExtraBits, lzxOffsetBase = func() (extra [50]uint, base [50]int) {
+	for i := range extra {
+		if i >= 4 {
+			extra[i] = uint(i/2 - 1)
+		}
+		if extra[i] > 17 {
+			extra[i] = 17
+		}
+		if i > 0 {
+			base[i] = base[i-1] + 1<<extra[i-1]
+		}
+	}
+	return
+}()
+
+// lzxE8 translates relative targets of CALL instructions to absolute ones.
+func lzxE8(b []byte) []byte {
+	b = append([]byte(nil), b...)
+
+	for i := 0; i < len(b)-10; i++ {
+		if b[i] != 0xE8 {
+			continue
+		}
+
+		rel := int32(binary.LittleEndian.Uint32(b[i+1:]))
+		if rel >= -int32(i) && rel < lzxE8FileSize {
+			abs := rel + int32(i)
+			if rel >= lzxE8FileSize-int32(i) {
+				abs = rel - lzxE8FileSize
+			}
+			binary.LittleEndian.PutUint32(b[i+1:], uint32(abs))
+		}
+		i += 4
+	}
+
+	return b
+}
+
+// writeLens writes code lengths as delta from prev with pretree, runs of
+// zeros are written with symbol 17 and 18.
+func writeLens(w *lzxBitWriter, lens, prev []uint8) {
+	type token struct{ sym, extra, extraBits int }
+
+	var tokens []token
+	for i := 0; i < len(lens); {
+		run := 0
+		for i+run < len(lens) && lens[i+run] == 0 {
+			run++
+		}
+
+		switch {
+		case run >= 20:
+			if run > 51 {
+				run = 51
+			}
+			tokens = append(tokens, token{18, run - 20, 5})
+			i += run
+		case run >= 4:
+			if run > 19 {
+				run = 19
+			}
+			tokens = append(tokens, token{17, run - 4, 4})
+			i += run
+		default:
+			tokens = append(tokens, token{(int(prev[i]) - int(lens[i]) + 17) % 17, 0, 0})
+			i++
+		}
+	}
+
+	freqs := make([]int, 20)
+	for _, t := range tokens {
+		freqs[t.sym]++
+	}
+	preLens := codeLengths(freqs, 15)
+	preCodes := canonicalCodes(preLens)
+
+	for _, l := range preLens {
+		w.write(uint32(l), 4)
+	}
+	for _, t := range tokens {
+		w.write(preCodes[t.sym], uint(preLens[t.sym]))
+		w.write(uint32(t.extra), uint(t.extraBits))
+	}
+
+	copy(prev, lens)
+}
+
+// lzx compresses a chunk b with LZX of WIM in blocks, whose window is 32768
+// bytes.
+func lzxCompress(plain []byte, blocks []lzxBlock) []byte {
+	b := lzxE8(plain)
+
+	w := &lzxBitWriter{}
+	recent := []int{1, 1, 1}
+	mainPrev := make([]uint8, lzxMainSymbols)
+	lenPrev := make([]uint8, 249)
+
+	pos := 0
+	for _, blk := range blocks {
+		w.write(uint32(blk.blockType), 3)
+		if blk.size == 32768 {
+			w.write(1, 1)
+		} else {
+			w.write(0, 1)
+			w.write(uint32(blk.size), 16)
+		}
+
+		if blk.blockType == blockUncompressed {
+			w.align()
+			for _, r := range recent {
+				w.out = binary.LittleEndian.AppendUint32(w.out, uint32(r))
+			}
+			w.out = append(w.out, b[pos:pos+blk.size]...)
+			if blk.size&1 != 0 {
+				w.out = append(w.out, 0)
+			}
+			pos += blk.size
+			continue
+		}
+
+		type symbol struct {
+			main      int
+			length    int // -1 without length symbol
+			extra     uint32
+			extraBits uint
+			aligned   int // -1 without aligned symbol
+		}
+
+		var syms []symbol
+		mainFreqs := make([]int, lzxMainSymbols)
+		lenFreqs := make([]int, 249)
+		alignedFreqs := make([]int, 8)
+
+		for _, m := range findMatches(b, pos, pos+blk.size, 3, 257, 32767, append([]int(nil), recent...)) {
+			if m.literal {
+				syms = append(syms, symbol{main: int(m.b), length: -1, aligned: -1})
+				mainFreqs[m.b]++
+				continue
+			}
+
+			sym := symbol{length: -1, aligned: -1}
+
+			slot := updateRecent(recent, m.offset)
+			if slot < 0 {
+				formatted := m.offset + 2
+				slot = 3
+				for slot+1 < 30 && lzxOffsetBase[slot+1] <= formatted {
+					slot++
+				}
+
+				sym.extra = uint32(formatted - lzxOffsetBase[slot])
+				sym.extraBits = lzxExtraBits[slot]
+
+				if blk.blockType == blockAligned && sym.extraBits >= 3 {
+					sym.aligned = int(sym.extra & 7)
+					sym.extra >>= 3
+					sym.extraBits -= 3
+					alignedFreqs[sym.aligned]++
+				}
+			}
+
+			header := m.length - 2
+			if header >= 7 {
+				sym.length = header - 7
+				lenFreqs[sym.length]++
+				header = 7
+			}
+
+			sym.main = 256 + slot*8 + header
+			mainFreqs[sym.main]++
+
+			syms = append(syms, sym)
+		}
+
+		mainLens := codeLengths(mainFreqs, 16)
+		lenLens := codeLengths(lenFreqs, 16)
+		alignedLens := codeLengths(alignedFreqs, 7)
+		mainCodes := canonicalCodes(mainLens)
+		lenCodes := canonicalCodes(lenLens)
+		alignedCodes := canonicalCodes(alignedLens)
+
+		if blk.blockType == blockAligned {
+			for _, l := range alignedLens {
+				w.write(uint32(l), 3)
+			}
+		}
+		writeLens(w, mainLens[:256], mainPrev[:256])
+		writeLens(w, mainLens[256:], mainPrev[256:])
+		writeLens(w, lenLens, lenPrev)
+
+		for _, sym := range syms {
+			w.write(mainCodes[sym.main], uint(mainLens[sym.main]))
+			if sym.length >= 0 {
+				w.write(lenCodes[sym.length], uint(lenLens[sym.length]))
+			}
+			w.write(sym.extra, sym.extraBits)
+			if sym.aligned >= 0 {
+				w.write(alignedCodes[sym.aligned], uint(alignedLens[sym.aligned]))
+			}
+		}
+
+		pos += blk.size
+	}
+
+	w.flush()
+
+	return w.out
+}
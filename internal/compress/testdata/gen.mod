@@ -0,0 +1,10 @@
+// go.mod for "go run -modfile=gen.mod gen.go gen_lzms.go gen_wim.go", which checks LZX samples and WIM files with go-winio
+
+module github.com/Snshadow/ntfs-ads
+
+go 1.21
+
+require (
+	github.com/Microsoft/go-winio v0.6.2
+	golang.org/x/sys v0.28.0
+)
@@ -0,0 +1,211 @@
+//go:build ignore
+// +build ignore
+
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"strings"
+)
+
+// LZMS encoder with literals and repeat matches of the last offset only.
+// Huffman codes of LZMS are rebuilt from frequencies while decoding, so it
+// stays with the initial codes of all frequencies 1 by emitting less than
+// 1024 literals and 512 lengths in a chunk. The initial literal code is 8
+// bits of the byte, and the initial length code has 5 bits for the last 10
+// of 54 symbols and 6 bits for the others, as longer codes go to symbols of
+// lower frequency and then of lower value.
+const (
+	lzmsMaxLiterals = 1023
+	lzmsMaxLengths  = 511
+	lzmsMaxRunLen   = 26 // length slots without extra bits
+)
+
+type lzmsProbEntry struct {
+	zeros  uint32
+	recent uint64
+}
+
+func newLzmsProbs(n int) []lzmsProbEntry {
+	probs := make([]lzmsProbEntry, n)
+	for i := range probs {
+		// 48 zeros in the last 64 bits
+		probs[i] = lzmsProbEntry{zeros: 48, recent: 0x0000000055555555}
+	}
+
+	return probs
+}
+
+// lzmsRangeEncoder writes range coded bits as 16-bit words from the start.
+type lzmsRangeEncoder struct {
+	out       []byte
+	low       uint64
+	rng       uint32
+	cache     uint16
+	cacheSize int
+	started   bool // the first word from cache is not written
+}
+
+func (e *lzmsRangeEncoder) shiftLow() {
+	if uint32(e.low) < 0xFFFF0000 || e.low>>32 != 0 {
+		carry := uint16(e.low >> 32)
+		for ; e.cacheSize > 0; e.cacheSize-- {
+			if e.started {
+				e.out = binary.LittleEndian.AppendUint16(e.out, e.cache+carry)
+			}
+			e.started = true
+			e.cache = 0xFFFF
+		}
+		e.cache = uint16(e.low >> 16)
+	}
+	e.cacheSize++
+	e.low = (e.low & 0xFFFF) << 16
+}
+
+func (e *lzmsRangeEncoder) encode(state *uint32, probs []lzmsProbEntry, bit uint32) {
+	p := &probs[*state]
+
+	prob := p.zeros
+	if prob == 0 {
+		prob = 1
+	} else if prob == 64 {
+		prob = 63
+	}
+
+	if e.rng <= 0xFFFF {
+		e.rng <<= 16
+		e.shiftLow()
+	}
+
+	bound := (e.rng >> 6) * prob
+	if bit == 0 {
+		e.rng = bound
+	} else {
+		e.low += uint64(bound)
+		e.rng -= bound
+	}
+
+	p.zeros += uint32(p.recent>>63) - bit
+	p.recent = p.recent<<1 | uint64(bit)
+	*state = (*state<<1 | bit) & uint32(len(probs)-1)
+}
+
+func (e *lzmsRangeEncoder) flush() {
+	for i := 0; i < 4; i++ {
+		e.shiftLow()
+	}
+}
+
+// lzmsBitWriter writes bits most significant first into 16-bit words, which
+// are stored backwards from the end.
+type lzmsBitWriter struct {
+	words []uint16
+	buf   uint32
+	n     uint
+}
+
+func (w *lzmsBitWriter) write(v uint32, n uint) {
+	w.buf = w.buf<<n | v
+	w.n += n
+	for w.n >= 16 {
+		w.words = append(w.words, uint16(w.buf>>(w.n-16)))
+		w.n -= 16
+	}
+}
+
+func (w *lzmsBitWriter) bytes() []byte {
+	if w.n > 0 {
+		w.words = append(w.words, uint16(w.buf<<(16-w.n)))
+		w.n = 0
+	}
+
+	var b []byte
+	for i := len(w.words) - 1; i >= 0; i-- {
+		b = binary.LittleEndian.AppendUint16(b, w.words[i])
+	}
+
+	return b
+}
+
+// lzmsCompress compresses a chunk with LZMS, runs of a byte are encoded as a
+// literal followed by a repeat match of offset 1, which is the initial most
+// recent offset and stays so.
+func lzmsCompress(plain []byte) []byte {
+	for _, c := range []byte{0x0F, 0x48, 0x4C, 0xE8, 0xE9, 0xF0, 0xFF} {
+		// the encoder has no x86 filter
+		if bytes.IndexByte(plain, c) >= 0 {
+			panic(fmt.Sprintf("LZMS sample has byte 0x%02X", c))
+		}
+	}
+
+	lenLens := make([]uint8, 54)
+	for i := range lenLens {
+		lenLens[i] = 6
+		if i >= 44 {
+			lenLens[i] = 5
+		}
+	}
+	lenCodes := canonicalCodes(lenLens)
+
+	rc := &lzmsRangeEncoder{rng: 0xFFFFFFFF, cacheSize: 1}
+	bw := &lzmsBitWriter{}
+
+	mainProbs, matchProbs, lzProbs, lzRepProbs := newLzmsProbs(16), newLzmsProbs(32), newLzmsProbs(64), newLzmsProbs(64)
+	var mainState, matchState, lzState, lzRepState uint32
+
+	literals, lengths := 0, 0
+	afterLiteral := false
+	for p := 0; p < len(plain); {
+		run := 0
+		if afterLiteral {
+			for run < lzmsMaxRunLen && p+run < len(plain) && plain[p+run] == plain[p-1] {
+				run++
+			}
+		}
+
+		if run >= 3 {
+			// match of LZ type repeating the most recent offset
+			rc.encode(&mainState, mainProbs, 1)
+			rc.encode(&matchState, matchProbs, 0)
+			rc.encode(&lzState, lzProbs, 1)
+			rc.encode(&lzRepState, lzRepProbs, 0)
+
+			sym := run - 1
+			bw.write(lenCodes[sym], uint(lenLens[sym]))
+
+			lengths++
+			p += run
+			afterLiteral = false
+			continue
+		}
+
+		rc.encode(&mainState, mainProbs, 0)
+		bw.write(uint32(plain[p]), 8)
+
+		literals++
+		p++
+		afterLiteral = true
+	}
+
+	if literals > lzmsMaxLiterals || lengths > lzmsMaxLengths {
+		panic(fmt.Sprintf("LZMS sample has %d literals and %d matches", literals, lengths))
+	}
+
+	rc.flush()
+
+	return append(rc.out, bw.bytes()...)
+}
+
+// lzmsText returns lines of text each followed by a long run of a byte.
+func lzmsText(lines int) []byte {
+	var b bytes.Buffer
+	for i := 0; i < lines; i++ {
+		fmt.Fprintf(&b, "line %d of the stream in a solid resource ", i)
+		b.WriteString(strings.Repeat("-=."[i%3:i%3+1], 300))
+		b.WriteString("\n")
+	}
+
+	return b.Bytes()
+}
@@ -0,0 +1,350 @@
+//go:build ignore
+// +build ignore
+
+package main
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"unicode/utf16"
+
+	"github.com/Microsoft/go-winio/wim"
+)
+
+const (
+	wimHeaderSize = 208
+	wimChunkSize  = 32768
+	wimSolidChunk = 4096
+
+	wimFlagCompressed = 0x00000002
+	wimFlagLZX        = 0x00040000
+	wimFlagLZMS       = 0x00080000
+
+	wimResMetadata   = 0x02
+	wimResCompressed = 0x04
+	wimResSolid      = 0x10
+
+	// 2022-06-18 04:26:40 UTC
+	wimFiletime = 133000000000000000
+)
+
+type wimResHdr struct {
+	compressedSize int64
+	flags          byte
+	offset         int64
+	size           int64
+}
+
+func (h wimResHdr) append(b []byte) []byte {
+	b = binary.LittleEndian.AppendUint64(b, uint64(h.compressedSize)|uint64(h.flags)<<56)
+	b = binary.LittleEndian.AppendUint64(b, uint64(h.offset))
+	return binary.LittleEndian.AppendUint64(b, uint64(h.size))
+}
+
+// wimDentry is a file in an image, with hash of unnamed data stream in the
+// dentry or in the first extra stream entry of empty name.
+type wimDentry struct {
+	name     string
+	dir      bool
+	hash     [20]byte
+	streams  []wimStreamEntry
+	children []*wimDentry
+}
+
+type wimStreamEntry struct {
+	name string
+	hash [20]byte
+}
+
+// wimWriter writes resources of a WIM file after its header.
+type wimWriter struct {
+	buf   bytes.Buffer
+	table []byte
+}
+
+func newWIMWriter() *wimWriter {
+	w := &wimWriter{}
+	w.buf.Write(make([]byte, wimHeaderSize))
+
+	return w
+}
+
+// addResource writes data, compressed in chunks with compress if not nil,
+// and adds it to the lookup table.
+func (w *wimWriter) addResource(data []byte, flags byte, compress func([]byte) []byte) [20]byte {
+	stored := data
+	if compress != nil {
+		stored = wofStream(data, wimChunkSize, compress)
+		flags |= wimResCompressed
+	}
+
+	hdr := wimResHdr{compressedSize: int64(len(stored)), flags: flags, offset: int64(w.buf.Len()), size: int64(len(data))}
+	w.buf.Write(stored)
+
+	hash := sha1.Sum(data)
+	w.addEntry(hdr, hash)
+
+	return hash
+}
+
+func (w *wimWriter) addEntry(hdr wimResHdr, hash [20]byte) {
+	w.table = hdr.append(w.table)
+	w.table = binary.LittleEndian.AppendUint16(w.table, 1) // part number
+	w.table = binary.LittleEndian.AppendUint32(w.table, 1) // reference count
+	w.table = append(w.table, hash[:]...)
+}
+
+// addSolid writes streams into a solid resource compressed with LZMS, and
+// adds the resource followed by the streams to the lookup table.
+func (w *wimWriter) addSolid(streams ...[]byte) [][20]byte {
+	data := bytes.Join(streams, nil)
+
+	var sizes, chunks []byte
+	for off := 0; off < len(data); off += wimSolidChunk {
+		end := off + wimSolidChunk
+		if end > len(data) {
+			end = len(data)
+		}
+
+		c := lzmsCompress(data[off:end])
+		if len(c) >= end-off {
+			panic("solid chunk is not compressed")
+		}
+		sizes = binary.LittleEndian.AppendUint32(sizes, uint32(len(c)))
+		chunks = append(chunks, c...)
+	}
+
+	hdr := binary.LittleEndian.AppendUint64(nil, uint64(len(data)))
+	hdr = binary.LittleEndian.AppendUint32(hdr, wimSolidChunk)
+	hdr = binary.LittleEndian.AppendUint32(hdr, 3) // LZMS
+	res := append(append(hdr, sizes...), chunks...)
+
+	w.addEntry(wimResHdr{compressedSize: int64(len(res)), flags: wimResSolid | wimResCompressed, offset: int64(w.buf.Len()), size: 0x100000000}, [20]byte{})
+	w.buf.Write(res)
+
+	var hashes [][20]byte
+	off := int64(0)
+	for _, s := range streams {
+		hash := sha1.Sum(s)
+		w.addEntry(wimResHdr{compressedSize: int64(len(s)), flags: wimResSolid, offset: off, size: int64(len(s))}, hash)
+		hashes = append(hashes, hash)
+		off += int64(len(s))
+	}
+
+	return hashes
+}
+
+// finish writes the lookup table and XML data, and returns the WIM file
+// after filling its header.
+func (w *wimWriter) finish(version, flags uint32) []byte {
+	tableHdr := wimResHdr{compressedSize: int64(len(w.table)), offset: int64(w.buf.Len()), size: int64(len(w.table))}
+	w.buf.Write(w.table)
+
+	xml := utf16Bytes("\uFEFF<WIM><IMAGE INDEX=\"1\"><NAME>test</NAME></IMAGE></WIM>")
+	xmlHdr := wimResHdr{compressedSize: int64(len(xml)), offset: int64(w.buf.Len()), size: int64(len(xml))}
+	w.buf.Write(xml)
+
+	b := w.buf.Bytes()
+	copy(b, "MSWIM\x00\x00\x00")
+	binary.LittleEndian.PutUint32(b[8:], wimHeaderSize)
+	binary.LittleEndian.PutUint32(b[12:], version)
+	binary.LittleEndian.PutUint32(b[16:], flags)
+	binary.LittleEndian.PutUint32(b[20:], wimChunkSize)
+	copy(b[24:40], "ntfs-ads testwim")
+	binary.LittleEndian.PutUint16(b[40:], 1) // part number
+	binary.LittleEndian.PutUint16(b[42:], 1) // total parts
+	binary.LittleEndian.PutUint32(b[44:], 1) // image count
+	copy(b[48:], tableHdr.append(nil))
+	copy(b[72:], xmlHdr.append(nil))
+
+	return b
+}
+
+func utf16Bytes(s string) []byte {
+	var b []byte
+	for _, c := range utf16.Encode([]rune(s)) {
+		b = binary.LittleEndian.AppendUint16(b, c)
+	}
+
+	return b
+}
+
+func align8(n int) int {
+	return (n + 7) &^ 7
+}
+
+// appendDentry appends a dentry of 8-byte aligned length with its extra
+// stream entries, whose names are null terminated.
+func appendDentry(b []byte, d *wimDentry) []byte {
+	name := utf16Bytes(d.name)
+
+	e := make([]byte, align8(102+len(name)+2))
+	binary.LittleEndian.PutUint64(e, uint64(len(e)))
+	if d.dir {
+		binary.LittleEndian.PutUint32(e[8:], 0x10)
+	} else {
+		binary.LittleEndian.PutUint32(e[8:], 0x20)
+	}
+	binary.LittleEndian.PutUint32(e[12:], 0xFFFFFFFF) // no security descriptor
+	for _, off := range []int{40, 48, 56} {
+		binary.LittleEndian.PutUint64(e[off:], wimFiletime)
+	}
+	copy(e[64:84], d.hash[:])
+	binary.LittleEndian.PutUint16(e[96:], uint16(len(d.streams)))
+	binary.LittleEndian.PutUint16(e[100:], uint16(len(name)))
+	copy(e[102:], name)
+	b = append(b, e...)
+
+	for _, s := range d.streams {
+		name := utf16Bytes(s.name)
+		size := 38 + len(name)
+		if len(name) > 0 {
+			size += 2
+		}
+
+		e := make([]byte, align8(size))
+		binary.LittleEndian.PutUint64(e, uint64(len(e)))
+		copy(e[16:36], s.hash[:])
+		binary.LittleEndian.PutUint16(e[36:], uint16(len(name)))
+		copy(e[38:], name)
+		b = append(b, e...)
+	}
+
+	return b
+}
+
+// wimMetadata returns metadata resource of empty security data and the tree
+// of root, each directory is followed by its children ending with 8 zero bytes.
+func wimMetadata(root *wimDentry) []byte {
+	b := binary.LittleEndian.AppendUint32(nil, 8) // total length
+	b = binary.LittleEndian.AppendUint32(b, 0)    // number of entries
+
+	var writeChildren func(d *wimDentry, pos int)
+	writeChildren = func(d *wimDentry, pos int) {
+		binary.LittleEndian.PutUint64(b[pos+16:], uint64(len(b)))
+
+		var positions []int
+		for _, c := range d.children {
+			positions = append(positions, len(b))
+			b = appendDentry(b, c)
+		}
+		b = append(b, make([]byte, 8)...)
+
+		for i, c := range d.children {
+			if c.dir {
+				writeChildren(c, positions[i])
+			}
+		}
+	}
+
+	b = appendDentry(b, root)
+	b = append(b, make([]byte, 8)...)
+	writeChildren(root, 8)
+
+	return b
+}
+
+// writeWIMs writes lzx.wim, whose metadata and a stream are compressed with
+// LZX, and solid.wim, whose streams are in a solid resource compressed with
+// LZMS. lzx.wim is checked with the WIM reader of go-winio, which does not
+// support solid resources.
+func writeWIMs(dir string, plain []byte) {
+	must(os.MkdirAll(dir, 0o755))
+
+	lzxCompressChunk := func(b []byte) []byte {
+		return checkLZX(lzxCompress(b, []lzxBlock{{blockVerbatim, len(b)}}), b)
+	}
+
+	zoneID := []byte("[ZoneTransfer]\r\nZoneId=3\r\n")
+
+	w := newWIMWriter()
+	unnamed := w.addResource([]byte("unnamed data"), 0, nil)
+	zone := w.addResource(zoneID, 0, nil)
+	big := w.addResource(plain, 0, lzxCompressChunk)
+	root := &wimDentry{
+		dir: true,
+		children: []*wimDentry{
+			{name: "file.txt", hash: unnamed, streams: []wimStreamEntry{{"Zone.Identifier", zone}}},
+			{name: "dir", dir: true, children: []*wimDentry{
+				{name: "big.txt", streams: []wimStreamEntry{{"", unnamed}, {"big", big}, {"empty", [20]byte{}}}},
+			}},
+		},
+	}
+	w.addResource(wimMetadata(root), wimResMetadata, lzxCompressChunk)
+	lzxWIM := w.finish(0x10D00, wimFlagCompressed|wimFlagLZX)
+
+	checkWIM(lzxWIM, map[string][]byte{
+		"/file.txt":                 []byte("unnamed data"),
+		"/file.txt:Zone.Identifier": zoneID,
+		"/dir/big.txt":              []byte("unnamed data"),
+		"/dir/big.txt:big":          plain,
+		"/dir/big.txt:empty":        {},
+	})
+	must(os.WriteFile(filepath.Join(dir, "lzx.wim"), lzxWIM, 0o644))
+
+	text := lzmsText(16)
+	w = newWIMWriter()
+	hashes := w.addSolid(text[:3000], text[3000:])
+	root = &wimDentry{
+		dir: true,
+		children: []*wimDentry{
+			{name: "solid.txt", streams: []wimStreamEntry{{"", hashes[0]}, {"notes", hashes[1]}}},
+		},
+	}
+	w.addResource(wimMetadata(root), wimResMetadata, nil)
+	must(os.WriteFile(filepath.Join(dir, "solid.wim"), w.finish(0xE00, wimFlagCompressed|wimFlagLZMS), 0o644))
+}
+
+// checkWIM checks that go-winio reads the contents of files and streams in
+// the first image, keyed by path and path:name.
+func checkWIM(b []byte, want map[string][]byte) {
+	r, err := wim.NewReader(bytes.NewReader(b))
+	must(err)
+
+	root, err := r.Image[0].Open()
+	must(err)
+
+	got := make(map[string][]byte)
+
+	var walk func(f *wim.File, path string)
+	walk = func(f *wim.File, path string) {
+		if f.IsDir() {
+			children, err := f.Readdir()
+			must(err)
+			for _, c := range children {
+				walk(c, path+"/"+c.Name)
+			}
+			return
+		}
+
+		got[path] = readWIMStream(f.Open())
+		for _, s := range f.Streams {
+			got[path+":"+s.Name] = readWIMStream(s.Open())
+		}
+	}
+	walk(root, "")
+
+	if len(got) != len(want) {
+		panic(fmt.Sprintf("go-winio reads %d streams from WIM, want %d", len(got), len(want)))
+	}
+	for name, data := range want {
+		if !bytes.Equal(got[name], data) {
+			panic(fmt.Sprintf("go-winio reads %q differently from WIM", name))
+		}
+	}
+}
+
+func readWIMStream(rc io.ReadCloser, err error) []byte {
+	must(err)
+	defer rc.Close()
+
+	b, err := io.ReadAll(rc)
+	must(err)
+
+	return b
+}
@@ -0,0 +1,131 @@
+package compress
+
+import (
+	"encoding/binary"
+)
+
+const (
+	xpressNumSymbols  = 512
+	xpressMaxCodeLen  = 15
+	xpressTableSize   = xpressNumSymbols / 2
+	xpressBlockOutLen = 65536
+	xpressMinMatchLen = 3
+)
+
+// Xpress decompresses src compressed with LZ77+Huffman of MS-XCA into dst,
+// which has the exact size of decompressed data.
+func Xpress(dst, src []byte) error {
+	var h huffman
+	lengths := make([]uint8, xpressNumSymbols)
+
+	in := 0
+	out := 0
+
+	// reads 16 bits at pos, zero past the end
+	read16 := func(pos int) uint32 {
+		if pos+2 > len(src) {
+			return 0
+		}
+		return uint32(binary.LittleEndian.Uint16(src[pos:]))
+	}
+
+	for out < len(dst) {
+		if len(src)-in < xpressTableSize {
+			return ErrCorrupted
+		}
+
+		for i, b := range src[in : in+xpressTableSize] {
+			lengths[2*i] = b & 0x0F
+			lengths[2*i+1] = b >> 4
+		}
+		if err := h.build(lengths, xpressMaxCodeLen); err != nil {
+			return ErrCorrupted
+		}
+
+		pos := in + xpressTableSize
+		nextBits := read16(pos)<<16 | read16(pos+2)
+		pos += 4
+		extraBits := 16
+
+		// refills consumed bits from the input
+		consume := func(n uint) {
+			nextBits <<= n
+			extraBits -= int(n)
+			if extraBits < 0 {
+				nextBits |= read16(pos) << uint(-extraBits)
+				extraBits += 16
+				pos += 2
+			}
+		}
+
+		blockEnd := out + xpressBlockOutLen
+		for out < len(dst) && out < blockEnd {
+			if pos > len(src)+4 {
+				return ErrCorrupted
+			}
+
+			sym, n, err := h.decode(nextBits >> (32 - xpressMaxCodeLen))
+			if err != nil {
+				return ErrCorrupted
+			}
+			consume(n)
+
+			if sym < 256 {
+				dst[out] = byte(sym)
+				out++
+				continue
+			}
+
+			sym -= 256
+			length := int(sym & 0x0F)
+			offsetBits := uint(sym >> 4)
+
+			if length == 15 {
+				if pos >= len(src) {
+					return ErrCorrupted
+				}
+				length = int(src[pos])
+				pos++
+
+				if length == 255 {
+					if pos+2 > len(src) {
+						return ErrCorrupted
+					}
+					length = int(binary.LittleEndian.Uint16(src[pos:]))
+					pos += 2
+
+					if length == 0 {
+						if pos+4 > len(src) {
+							return ErrCorrupted
+						}
+						length = int(binary.LittleEndian.Uint32(src[pos:]))
+						pos += 4
+					}
+					if length < 15 {
+						return ErrCorrupted
+					}
+					length -= 15
+				}
+				length += 15
+			}
+			length += xpressMinMatchLen
+
+			offset := int(nextBits>>(32-offsetBits)) | 1<<offsetBits
+			consume(offsetBits)
+
+			if offset > out || length > len(dst)-out {
+				return ErrCorrupted
+			}
+
+			// copy byte by byte as the match may overlap
+			for i := 0; i < length; i++ {
+				dst[out+i] = dst[out-offset+i]
+			}
+			out += length
+		}
+
+		in = pos
+	}
+
+	return nil
+}
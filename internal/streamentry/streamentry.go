@@ -0,0 +1,51 @@
+// Package streamentry handles entries of named streams in archives, which
+// follow the entry of the file and are named "<file>:<stream>".
+package streamentry
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const separator = ":"
+
+// Name returns name of the entry for the stream of the file with entry name,
+// trailing "/" of directories is removed.
+func Name(name, stream string) string {
+	return strings.TrimSuffix(name, "/") + separator + stream
+}
+
+// FileName returns entry name of the file from name of the entry for the
+// stream, or false if it does not end with ":<stream>" after a file.
+func FileName(name, stream string) (string, bool) {
+	name, ok := strings.CutSuffix(name, separator+stream)
+
+	return name, ok && name != ""
+}
+
+// Symlink returns path of the file of entry name under dir or its parent
+// directory which is a symbolic link, or "" if none of them is. Missing ones
+// are not checked.
+func Symlink(dir, name string) (string, error) {
+	path := dir
+	for _, elem := range strings.Split(name, "/") {
+		path = filepath.Join(path, elem)
+
+		info, err := os.Lstat(path)
+		if errors.Is(err, fs.ErrNotExist) {
+			return "", nil
+		}
+		if err != nil {
+			return "", err
+		}
+
+		if info.Mode()&fs.ModeSymlink != 0 {
+			return path, nil
+		}
+	}
+
+	return "", nil
+}
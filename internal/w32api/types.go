@@ -12,7 +12,22 @@ const (
 	FindStreamInfoStandard = 0
 )
 
+// NtQueryInformationFile FileInformationClass constant
+const (
+	FileEaInformation = 7
+)
+
 type WIN32_FIND_STREAM_DATA struct {
 	StreamSize int64
 	StreamName [windows.MAX_PATH + 36]uint16 // ":streamname:$streamtype", possible $streamtype: $DATA, $INDEX_ALLOCATION, $BITMAP
 }
+
+// FILE_BASIC_INFO for GetFileInformationByHandleEx with FileBasicInfo
+type FILE_BASIC_INFO struct {
+	CreationTime   int64
+	LastAccessTime int64
+	LastWriteTime  int64
+	ChangeTime     int64
+	FileAttributes uint32
+	_              uint32 // padding
+}
@@ -14,6 +14,9 @@ import (
 //sys findFirstStream(fileName *uint16, infoLevel int32, findStreamData unsafe.Pointer, flags uint32) (hnd windows.Handle, err error) [failretval==windows.InvalidHandle] = kernel32.FindFirstStreamW
 //sys findNextStream(findStream windows.Handle, findStreamData unsafe.Pointer) (err error) = kernel32.FindNextStreamW
 //sys findClose(findFile windows.Handle) (err error) = kernel32.FindClose
+//sys backupRead(file windows.Handle, buffer *byte, bytesToRead uint32, bytesRead *uint32, abort bool, processSecurity bool, context *uintptr) (err error) = kernel32.BackupRead
+//sys backupWrite(file windows.Handle, buffer *byte, bytesToWrite uint32, bytesWritten *uint32, abort bool, processSecurity bool, context *uintptr) (err error) = kernel32.BackupWrite
+//sys ntQueryInformationFile(file windows.Handle, iosb *windows.IO_STATUS_BLOCK, info *byte, length uint32, class uint32) (ntstatus error) = ntdll.NtQueryInformationFile
 
 func FindFirstStream(fileName string, infoLevel int32, flags uint32) (hnd windows.Handle, data WIN32_FIND_STREAM_DATA, err error) {
 	wStr, err := windows.UTF16PtrFromString(fileName)
@@ -93,3 +96,46 @@ func NewFileRenameInfo(newName string, replace bool) ([]byte, error) {
 
 	return renameInfo.Bytes(), nil
 }
+
+// GetFileBasicInfo returns timestamps and attributes of the file with FILE_BASIC_INFO.
+func GetFileBasicInfo(hnd windows.Handle) (info FILE_BASIC_INFO, err error) {
+	err = windows.GetFileInformationByHandleEx(hnd, windows.FileBasicInfo, (*byte)(unsafe.Pointer(&info)), uint32(unsafe.Sizeof(info)))
+
+	return
+}
+
+// BackupRead reads streams of the file in format of WIN32_STREAM_ID into b,
+// context should be zero at first and passed again until abort is true.
+func BackupRead(hnd windows.Handle, b []byte, abort, processSecurity bool, context *uintptr) (n uint32, err error) {
+	var buf *byte
+	if len(b) > 0 {
+		buf = &b[0]
+	}
+
+	err = backupRead(hnd, buf, uint32(len(b)), &n, abort, processSecurity, context)
+
+	return
+}
+
+// BackupWrite writes streams of the file from b in format of WIN32_STREAM_ID,
+// context should be zero at first and passed again until abort is true.
+func BackupWrite(hnd windows.Handle, b []byte, abort, processSecurity bool, context *uintptr) (n uint32, err error) {
+	var buf *byte
+	if len(b) > 0 {
+		buf = &b[0]
+	}
+
+	err = backupWrite(hnd, buf, uint32(len(b)), &n, abort, processSecurity, context)
+
+	return
+}
+
+// GetFileEaSize returns the size of extended attributes of the file with FILE_EA_INFORMATION,
+// hnd needs FILE_READ_EA access.
+func GetFileEaSize(hnd windows.Handle) (size uint32, err error) {
+	var iosb windows.IO_STATUS_BLOCK
+
+	err = ntQueryInformationFile(hnd, &iosb, (*byte)(unsafe.Pointer(&size)), uint32(unsafe.Sizeof(size)), FileEaInformation)
+
+	return
+}
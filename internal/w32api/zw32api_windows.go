@@ -39,12 +39,48 @@ func errnoErr(e syscall.Errno) error {
 
 var (
 	modkernel32 = windows.NewLazySystemDLL("kernel32.dll")
+	modntdll    = windows.NewLazySystemDLL("ntdll.dll")
 
-	procFindClose        = modkernel32.NewProc("FindClose")
-	procFindFirstStreamW = modkernel32.NewProc("FindFirstStreamW")
-	procFindNextStreamW  = modkernel32.NewProc("FindNextStreamW")
+	procBackupRead             = modkernel32.NewProc("BackupRead")
+	procBackupWrite            = modkernel32.NewProc("BackupWrite")
+	procFindClose              = modkernel32.NewProc("FindClose")
+	procFindFirstStreamW       = modkernel32.NewProc("FindFirstStreamW")
+	procFindNextStreamW        = modkernel32.NewProc("FindNextStreamW")
+	procNtQueryInformationFile = modntdll.NewProc("NtQueryInformationFile")
 )
 
+func backupRead(file windows.Handle, buffer *byte, bytesToRead uint32, bytesRead *uint32, abort bool, processSecurity bool, context *uintptr) (err error) {
+	var _p0 uint32
+	if abort {
+		_p0 = 1
+	}
+	var _p1 uint32
+	if processSecurity {
+		_p1 = 1
+	}
+	r1, _, e1 := syscall.Syscall9(procBackupRead.Addr(), 7, uintptr(file), uintptr(unsafe.Pointer(buffer)), uintptr(bytesToRead), uintptr(unsafe.Pointer(bytesRead)), uintptr(_p0), uintptr(_p1), uintptr(unsafe.Pointer(context)), 0, 0)
+	if r1 == 0 {
+		err = errnoErr(e1)
+	}
+	return
+}
+
+func backupWrite(file windows.Handle, buffer *byte, bytesToWrite uint32, bytesWritten *uint32, abort bool, processSecurity bool, context *uintptr) (err error) {
+	var _p0 uint32
+	if abort {
+		_p0 = 1
+	}
+	var _p1 uint32
+	if processSecurity {
+		_p1 = 1
+	}
+	r1, _, e1 := syscall.Syscall9(procBackupWrite.Addr(), 7, uintptr(file), uintptr(unsafe.Pointer(buffer)), uintptr(bytesToWrite), uintptr(unsafe.Pointer(bytesWritten)), uintptr(_p0), uintptr(_p1), uintptr(unsafe.Pointer(context)), 0, 0)
+	if r1 == 0 {
+		err = errnoErr(e1)
+	}
+	return
+}
+
 func findClose(findFile windows.Handle) (err error) {
 	r1, _, e1 := syscall.Syscall(procFindClose.Addr(), 1, uintptr(findFile), 0, 0)
 	if r1 == 0 {
@@ -69,3 +105,11 @@ func findNextStream(findStream windows.Handle, findStreamData unsafe.Pointer) (e
 	}
 	return
 }
+
+func ntQueryInformationFile(file windows.Handle, iosb *windows.IO_STATUS_BLOCK, info *byte, length uint32, class uint32) (ntstatus error) {
+	r0, _, _ := syscall.Syscall6(procNtQueryInformationFile.Addr(), 5, uintptr(file), uintptr(unsafe.Pointer(iosb)), uintptr(unsafe.Pointer(info)), uintptr(length), uintptr(class), 0)
+	if r0 != 0 {
+		ntstatus = windows.NTStatus(r0)
+	}
+	return
+}
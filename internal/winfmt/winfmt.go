@@ -0,0 +1,56 @@
+// Package winfmt decodes data types of Windows found in on-disk and archive
+// formats, FILETIME and UTF-16 strings.
+package winfmt
+
+import (
+	"encoding/binary"
+	"time"
+	"unicode/utf16"
+)
+
+// filetimeEpochDiff is the number of 100-nanosecond intervals between 1601-01-01 and 1970-01-01.
+const filetimeEpochDiff = 116444736000000000
+
+// FiletimeToTime converts FILETIME into time.Time in UTC, zero FILETIME is
+// zero time.
+func FiletimeToTime(ft uint64) time.Time {
+	if ft == 0 {
+		return time.Time{}
+	}
+
+	unix100ns := int64(ft - filetimeEpochDiff)
+
+	return time.Unix(unix100ns/1e7, unix100ns%1e7*100).UTC()
+}
+
+// DecodeUTF16 decodes little endian UTF-16 bytes, a trailing odd byte is
+// ignored.
+func DecodeUTF16(b []byte) string {
+	return decodeUTF16(b, binary.LittleEndian)
+}
+
+// DecodeUTF16BE decodes big endian UTF-16 bytes.
+func DecodeUTF16BE(b []byte) string {
+	return decodeUTF16(b, binary.BigEndian)
+}
+
+func decodeUTF16(b []byte, order binary.ByteOrder) string {
+	u16 := make([]uint16, len(b)/2)
+	for i := range u16 {
+		u16[i] = order.Uint16(b[i*2:])
+	}
+
+	return string(utf16.Decode(u16))
+}
+
+// EncodeUTF16 encodes s into little endian UTF-16 bytes without NUL-termination.
+func EncodeUTF16(s string) []byte {
+	u16 := utf16.Encode([]rune(s))
+
+	b := make([]byte, len(u16)*2)
+	for i, c := range u16 {
+		binary.LittleEndian.PutUint16(b[i*2:], c)
+	}
+
+	return b
+}
@@ -0,0 +1,58 @@
+package winfmt
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestFiletimeToTime(t *testing.T) {
+	tests := []struct {
+		ft   uint64
+		want time.Time
+	}{
+		{0, time.Time{}},
+		{116444736000000000, time.Unix(0, 0).UTC()},
+		{133000000001234567, time.Date(2022, 6, 18, 4, 26, 40, 123456700, time.UTC)},
+	}
+
+	for _, tt := range tests {
+		if got := FiletimeToTime(tt.ft); !got.Equal(tt.want) || got.Location() != time.UTC {
+			t.Errorf("FiletimeToTime(%d) = %v, want %v", tt.ft, got, tt.want)
+		}
+	}
+}
+
+func TestUTF16(t *testing.T) {
+	tests := []struct {
+		s  string
+		le []byte
+	}{
+		{"", []byte{}},
+		{"ab", []byte{'a', 0, 'b', 0}},
+		{"é", []byte{0xE9, 0}},
+		{"\U0001F600", []byte{0x3D, 0xD8, 0x00, 0xDE}},
+	}
+
+	for _, tt := range tests {
+		if got := EncodeUTF16(tt.s); !bytes.Equal(got, tt.le) {
+			t.Errorf("EncodeUTF16(%q) = %v, want %v", tt.s, got, tt.le)
+		}
+		if got := DecodeUTF16(tt.le); got != tt.s {
+			t.Errorf("DecodeUTF16(%v) = %q, want %q", tt.le, got, tt.s)
+		}
+
+		be := make([]byte, len(tt.le))
+		for i := 0; i+1 < len(be); i += 2 {
+			be[i], be[i+1] = tt.le[i+1], tt.le[i]
+		}
+		if got := DecodeUTF16BE(be); got != tt.s {
+			t.Errorf("DecodeUTF16BE(%v) = %q, want %q", be, got, tt.s)
+		}
+	}
+
+	// a trailing odd byte is ignored
+	if got := DecodeUTF16([]byte{'a', 0, 'b'}); got != "a" {
+		t.Errorf("got %q, want %q", got, "a")
+	}
+}
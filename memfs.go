@@ -0,0 +1,467 @@
+package ntfs_ads
+
+import (
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+const (
+	maxStreamNameLen = 255 // maximum length of stream name in UTF-16 code units
+)
+
+// MemFS is an in-memory StreamFS which follows how NTFS handles named data
+// streams, so that code using alternate data streams can be tested on any platform.
+//
+// As in NTFS, paths and stream names are case-insensitive, creating a stream
+// on a missing file creates the file, directories only have streams when
+// named ones are added, and a stream can only replace an existing stream of
+// zero size when renamed.
+type MemFS struct {
+	mut   sync.Mutex
+	files map[string]*memFile // key: folded path
+}
+
+type memFile struct {
+	isDir   bool
+	data    *memData            // unnamed data stream, nil for directories
+	streams map[string]*memData // key: folded stream name
+}
+
+type memData struct {
+	name string // name as given on creation
+	buf  []byte
+}
+
+// NewMemFS returns an empty in-memory StreamFS.
+func NewMemFS() *MemFS {
+	return &MemFS{
+		files: make(map[string]*memFile),
+	}
+}
+
+// foldName folds name for case-insensitive comparison like NTFS upcase table.
+func foldName(name string) string {
+	return strings.ToUpper(name)
+}
+
+func foldPath(path string) string {
+	return foldName(filepath.Clean(path))
+}
+
+// validStreamName checks name of a stream and strips optional ":$DATA" type from it.
+func validStreamName(name string) (string, bool) {
+	if i := strings.IndexByte(name, ':'); i >= 0 {
+		if foldName(name[i+1:]) != "$DATA" {
+			return "", false
+		}
+		name = name[:i]
+	}
+
+	if !ValidStreamName(name) {
+		return "", false
+	}
+
+	return name, true
+}
+
+// WriteFile creates the file with data as its unnamed data stream, existing
+// file is truncated and keeps its named streams.
+func (m *MemFS) WriteFile(path string, data []byte) error {
+	m.mut.Lock()
+	defer m.mut.Unlock()
+
+	key := foldPath(path)
+
+	file, ok := m.files[key]
+	if ok && file.isDir {
+		return &fs.PathError{Op: "open", Path: path, Err: fs.ErrExist}
+	}
+	if !ok {
+		file = &memFile{
+			streams: make(map[string]*memData),
+		}
+		m.files[key] = file
+	}
+
+	file.data = &memData{buf: append([]byte(nil), data...)}
+
+	return nil
+}
+
+// Mkdir creates a directory which can have named data streams.
+func (m *MemFS) Mkdir(path string) error {
+	m.mut.Lock()
+	defer m.mut.Unlock()
+
+	key := foldPath(path)
+
+	if _, ok := m.files[key]; ok {
+		return &fs.PathError{Op: "mkdir", Path: path, Err: fs.ErrExist}
+	}
+
+	m.files[key] = &memFile{
+		isDir:   true,
+		streams: make(map[string]*memData),
+	}
+
+	return nil
+}
+
+// Remove removes the file or directory with all of its streams.
+func (m *MemFS) Remove(path string) error {
+	m.mut.Lock()
+	defer m.mut.Unlock()
+
+	key := foldPath(path)
+
+	if _, ok := m.files[key]; !ok {
+		return &fs.PathError{Op: "remove", Path: path, Err: fs.ErrNotExist}
+	}
+
+	delete(m.files, key)
+
+	return nil
+}
+
+// ListStreams returns name and size of named data streams of the file.
+func (m *MemFS) ListStreams(path string) (map[string]int64, error) {
+	m.mut.Lock()
+	defer m.mut.Unlock()
+
+	file, ok := m.files[foldPath(path)]
+	if !ok {
+		return nil, &fs.PathError{Op: "open", Path: path, Err: fs.ErrNotExist}
+	}
+
+	if file.isDir && len(file.streams) == 0 {
+		// same as FindFirstStreamW for directories without named stream
+		return nil, ErrNoADS
+	}
+
+	streamInfoMap := make(map[string]int64, len(file.streams))
+	for _, strm := range file.streams {
+		streamInfoMap[strm.name] = int64(len(strm.buf))
+	}
+
+	return streamInfoMap, nil
+}
+
+// ListAllStreams returns name and size of data streams of the file including
+// the unnamed data stream, MemFS has no other attribute type.
+func (m *MemFS) ListAllStreams(path string) (map[StreamSpec]int64, error) {
+	m.mut.Lock()
+	defer m.mut.Unlock()
+
+	file, ok := m.files[foldPath(path)]
+	if !ok {
+		return nil, &fs.PathError{Op: "open", Path: path, Err: fs.ErrNotExist}
+	}
+
+	specs := make(map[StreamSpec]int64, len(file.streams)+1)
+	if file.data != nil {
+		specs[StreamSpec{Type: TypeData}] = int64(len(file.data.buf))
+	}
+	for _, strm := range file.streams {
+		specs[StreamSpec{Name: strm.name, Type: TypeData}] = int64(len(strm.buf))
+	}
+
+	return specs, nil
+}
+
+// OpenStream opens the named stream of the file with flag used in os.OpenFile().
+func (m *MemFS) OpenStream(path, name string, flag int) (Stream, error) {
+	strmPath := path + ":" + name
+
+	name, ok := validStreamName(name)
+	if !ok {
+		return nil, &fs.PathError{Op: "open", Path: strmPath, Err: fs.ErrInvalid}
+	}
+
+	m.mut.Lock()
+	defer m.mut.Unlock()
+
+	key := foldPath(path)
+
+	file, ok := m.files[key]
+	if !ok {
+		if flag&os.O_CREATE == 0 {
+			return nil, &fs.PathError{Op: "open", Path: strmPath, Err: fs.ErrNotExist}
+		}
+
+		// the file is created along with the stream
+		file = &memFile{
+			data:    &memData{},
+			streams: make(map[string]*memData),
+		}
+		m.files[key] = file
+	}
+
+	strmKey := foldName(name)
+
+	data, exists := file.streams[strmKey]
+	switch {
+	case exists && flag&(os.O_CREATE|os.O_EXCL) == os.O_CREATE|os.O_EXCL:
+		return nil, &fs.PathError{Op: "open", Path: strmPath, Err: fs.ErrExist}
+	case !exists && flag&os.O_CREATE == 0:
+		return nil, &fs.PathError{Op: "open", Path: strmPath, Err: fs.ErrNotExist}
+	case !exists:
+		data = &memData{name: name}
+		file.streams[strmKey] = data
+	case flag&os.O_TRUNC != 0:
+		data.buf = data.buf[:0]
+	}
+
+	return &memStream{
+		fs:   m,
+		data: data,
+		path: strmPath,
+		flag: flag,
+	}, nil
+}
+
+// RenameStream renames the stream oldName of the file to newName.
+func (m *MemFS) RenameStream(path, oldName, newName string, overwrite bool) error {
+	oldPath, newPath := path+":"+oldName, path+":"+newName
+
+	oldName, okOld := validStreamName(oldName)
+	newName, okNew := validStreamName(newName)
+	if !okOld || !okNew {
+		return &os.LinkError{Op: "rename", Old: oldPath, New: newPath, Err: fs.ErrInvalid}
+	}
+
+	m.mut.Lock()
+	defer m.mut.Unlock()
+
+	file, ok := m.files[foldPath(path)]
+	if !ok {
+		return &os.LinkError{Op: "rename", Old: oldPath, New: newPath, Err: fs.ErrNotExist}
+	}
+
+	oldKey, newKey := foldName(oldName), foldName(newName)
+
+	data, ok := file.streams[oldKey]
+	if !ok {
+		return &os.LinkError{Op: "rename", Old: oldPath, New: newPath, Err: fs.ErrNotExist}
+	}
+
+	if target, exists := file.streams[newKey]; exists && newKey != oldKey {
+		if !overwrite {
+			// STATUS_OBJECT_NAME_COLLISION
+			return &os.LinkError{Op: "rename", Old: oldPath, New: newPath, Err: fs.ErrExist}
+		}
+		if len(target.buf) != 0 {
+			// NTFS only replaces a stream with zero size, STATUS_INVALID_PARAMETER
+			return &os.LinkError{Op: "rename", Old: oldPath, New: newPath, Err: fs.ErrInvalid}
+		}
+	}
+
+	delete(file.streams, oldKey)
+	data.name = newName
+	file.streams[newKey] = data
+
+	return nil
+}
+
+// RemoveStream removes the named stream from the file.
+func (m *MemFS) RemoveStream(path, name string) error {
+	strmPath := path + ":" + name
+
+	name, ok := validStreamName(name)
+	if !ok {
+		return &fs.PathError{Op: "remove", Path: strmPath, Err: fs.ErrInvalid}
+	}
+
+	m.mut.Lock()
+	defer m.mut.Unlock()
+
+	file, ok := m.files[foldPath(path)]
+	if !ok {
+		return &fs.PathError{Op: "remove", Path: strmPath, Err: fs.ErrNotExist}
+	}
+
+	strmKey := foldName(name)
+
+	if _, ok := file.streams[strmKey]; !ok {
+		return &fs.PathError{Op: "remove", Path: strmPath, Err: fs.ErrNotExist}
+	}
+
+	delete(file.streams, strmKey)
+
+	return nil
+}
+
+// memStream is an opened stream of MemFS.
+type memStream struct {
+	fs     *MemFS
+	data   *memData
+	path   string
+	flag   int
+	off    int64
+	closed bool
+}
+
+func (s *memStream) Name() string {
+	return s.path
+}
+
+func (s *memStream) check(op string, write bool) error {
+	if s.closed {
+		return &fs.PathError{Op: op, Path: s.path, Err: fs.ErrClosed}
+	}
+
+	access := s.flag & (os.O_RDONLY | os.O_WRONLY | os.O_RDWR)
+	if (write && access == os.O_RDONLY) || (!write && access == os.O_WRONLY) {
+		// ERROR_ACCESS_DENIED
+		return &fs.PathError{Op: op, Path: s.path, Err: fs.ErrPermission}
+	}
+
+	return nil
+}
+
+func (s *memStream) Read(b []byte) (int, error) {
+	s.fs.mut.Lock()
+	defer s.fs.mut.Unlock()
+
+	if err := s.check("read", false); err != nil {
+		return 0, err
+	}
+
+	if s.off >= int64(len(s.data.buf)) {
+		if len(b) == 0 {
+			return 0, nil
+		}
+		return 0, io.EOF
+	}
+
+	n := copy(b, s.data.buf[s.off:])
+	s.off += int64(n)
+
+	return n, nil
+}
+
+func (s *memStream) ReadAt(b []byte, off int64) (int, error) {
+	s.fs.mut.Lock()
+	defer s.fs.mut.Unlock()
+
+	if err := s.check("read", false); err != nil {
+		return 0, err
+	}
+	if off < 0 {
+		return 0, &fs.PathError{Op: "readat", Path: s.path, Err: fs.ErrInvalid}
+	}
+
+	if off >= int64(len(s.data.buf)) {
+		return 0, io.EOF
+	}
+
+	n := copy(b, s.data.buf[off:])
+	if n < len(b) {
+		return n, io.EOF
+	}
+
+	return n, nil
+}
+
+// writeAt writes b at off, growing the stream if needed, with lock held.
+func (s *memStream) writeAt(b []byte, off int64) {
+	if end := off + int64(len(b)); end > int64(len(s.data.buf)) {
+		size := len(s.data.buf)
+
+		if end > int64(cap(s.data.buf)) {
+			grown := make([]byte, end, end*2)
+			copy(grown, s.data.buf)
+			s.data.buf = grown
+		} else {
+			s.data.buf = s.data.buf[:end]
+			// zero fill the gap left by previous truncation
+			for i := size; int64(i) < off; i++ {
+				s.data.buf[i] = 0
+			}
+		}
+	}
+
+	copy(s.data.buf[off:], b)
+}
+
+func (s *memStream) Write(b []byte) (int, error) {
+	s.fs.mut.Lock()
+	defer s.fs.mut.Unlock()
+
+	if err := s.check("write", true); err != nil {
+		return 0, err
+	}
+
+	if s.flag&os.O_APPEND != 0 {
+		s.off = int64(len(s.data.buf))
+	}
+
+	s.writeAt(b, s.off)
+	s.off += int64(len(b))
+
+	return len(b), nil
+}
+
+func (s *memStream) WriteAt(b []byte, off int64) (int, error) {
+	s.fs.mut.Lock()
+	defer s.fs.mut.Unlock()
+
+	if err := s.check("write", true); err != nil {
+		return 0, err
+	}
+	if s.flag&os.O_APPEND != 0 {
+		return 0, &fs.PathError{Op: "writeat", Path: s.path, Err: fs.ErrInvalid}
+	}
+	if off < 0 {
+		return 0, &fs.PathError{Op: "writeat", Path: s.path, Err: fs.ErrInvalid}
+	}
+
+	s.writeAt(b, off)
+
+	return len(b), nil
+}
+
+func (s *memStream) Seek(offset int64, whence int) (int64, error) {
+	s.fs.mut.Lock()
+	defer s.fs.mut.Unlock()
+
+	if s.closed {
+		return 0, &fs.PathError{Op: "seek", Path: s.path, Err: fs.ErrClosed}
+	}
+
+	var abs int64
+	switch whence {
+	case io.SeekStart:
+		abs = offset
+	case io.SeekCurrent:
+		abs = s.off + offset
+	case io.SeekEnd:
+		abs = int64(len(s.data.buf)) + offset
+	default:
+		return 0, &fs.PathError{Op: "seek", Path: s.path, Err: fs.ErrInvalid}
+	}
+
+	if abs < 0 {
+		return 0, &fs.PathError{Op: "seek", Path: s.path, Err: fs.ErrInvalid}
+	}
+
+	s.off = abs
+
+	return abs, nil
+}
+
+func (s *memStream) Close() error {
+	s.fs.mut.Lock()
+	defer s.fs.mut.Unlock()
+
+	if s.closed {
+		return &fs.PathError{Op: "close", Path: s.path, Err: fs.ErrClosed}
+	}
+
+	s.closed = true
+
+	return nil
+}
@@ -0,0 +1,290 @@
+package ntfs_ads
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"strings"
+	"testing"
+)
+
+// newTestFS returns MemFS with "file.txt" having streams of contents.
+func newTestFS(t *testing.T, contents map[string]string) *MemFS {
+	t.Helper()
+
+	m := NewMemFS()
+	if err := m.WriteFile("file.txt", []byte("unnamed")); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, content := range contents {
+		writeStream(t, m, "file.txt", name, content)
+	}
+
+	return m
+}
+
+func writeStream(t *testing.T, m *MemFS, path, name, content string) {
+	t.Helper()
+
+	strm, err := m.OpenStream(path, name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer strm.Close()
+
+	if _, err := io.WriteString(strm, content); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func readStream(t *testing.T, m *MemFS, path, name string) string {
+	t.Helper()
+
+	strm, err := m.OpenStream(path, name, os.O_RDONLY)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer strm.Close()
+
+	b, err := io.ReadAll(strm)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return string(b)
+}
+
+func TestMemFSCaseInsensitive(t *testing.T) {
+	tests := []struct {
+		name string // name to open the stream "Stream" with
+		path string
+	}{
+		{"Stream", "file.txt"},
+		{"stream", "file.txt"},
+		{"STREAM", "FILE.TXT"},
+		{"sTrEaM:$data", "File.Txt"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newTestFS(t, map[string]string{"Stream": "content"})
+
+			if got := readStream(t, m, tt.path, tt.name); got != "content" {
+				t.Errorf("got %q, want %q", got, "content")
+			}
+
+			// the name given on creation is kept
+			streams, err := m.ListStreams(tt.path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(streams) != 1 || streams["Stream"] != int64(len("content")) {
+				t.Errorf("got %v, want map[Stream:%d]", streams, len("content"))
+			}
+		})
+	}
+}
+
+func TestMemFSRename(t *testing.T) {
+	tests := []struct {
+		name      string
+		streams   map[string]string
+		old, new  string
+		overwrite bool
+		wantErr   error
+		want      map[string]int64
+	}{
+		{
+			name:    "rename",
+			streams: map[string]string{"a": "aa"},
+			old:     "a", new: "b",
+			want: map[string]int64{"b": 2},
+		},
+		{
+			name:    "case of the name",
+			streams: map[string]string{"a": "aa"},
+			old:     "A", new: "A",
+			want: map[string]int64{"A": 2},
+		},
+		{
+			name:    "case-insensitive target",
+			streams: map[string]string{"a": "aa", "b": "bb"},
+			old:     "a", new: "B",
+			wantErr: fs.ErrExist,
+			want:    map[string]int64{"a": 2, "b": 2},
+		},
+		{
+			name:    "overwrite zero size",
+			streams: map[string]string{"a": "aa", "b": ""},
+			old:     "a", new: "B", overwrite: true,
+			want: map[string]int64{"B": 2},
+		},
+		{
+			name:    "overwrite non-zero size",
+			streams: map[string]string{"a": "aa", "b": "bb"},
+			old:     "a", new: "b", overwrite: true,
+			wantErr: fs.ErrInvalid,
+			want:    map[string]int64{"a": 2, "b": 2},
+		},
+		{
+			name:    "missing stream",
+			streams: map[string]string{"a": "aa"},
+			old:     "c", new: "d",
+			wantErr: fs.ErrNotExist,
+			want:    map[string]int64{"a": 2},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newTestFS(t, tt.streams)
+
+			err := m.RenameStream("file.txt", tt.old, tt.new, tt.overwrite)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got error %v, want %v", err, tt.wantErr)
+			}
+
+			got, err := m.ListStreams("file.txt")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !equalStreams(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func equalStreams(a, b map[string]int64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for name, size := range a {
+		if s, ok := b[name]; !ok || s != size {
+			return false
+		}
+	}
+
+	return true
+}
+
+func TestMemFSNoADS(t *testing.T) {
+	m := newTestFS(t, nil)
+	if err := m.Mkdir("dir"); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		path    string
+		wantErr error
+	}{
+		{"file.txt", ErrNoADS},
+		{"dir", ErrNoADS},
+		{"missing.txt", fs.ErrNotExist},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			ads, err := NewFileADS(m, tt.path)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got error %v, want %v", err, tt.wantErr)
+			}
+			if len(ads.StreamInfoMap) != 0 {
+				t.Errorf("got streams %v", ads.StreamInfoMap)
+			}
+		})
+	}
+}
+
+func TestMemFSInvalidName(t *testing.T) {
+	tests := []struct {
+		name  string
+		valid bool
+	}{
+		{"", false},
+		{":", false},
+		{"a:b", false},
+		{"a:$INDEX_ALLOCATION", false},
+		{"a:$DATA:", false},
+		{"a/b", false},
+		{"a\\b", false},
+		{"a\x00b", false},
+		{strings.Repeat("a", 255), true},
+		{strings.Repeat("a", 256), false},
+		// 2 UTF-16 code units each
+		{strings.Repeat("\U0001F600", 127) + "a", true},
+		{strings.Repeat("\U0001F600", 128), false},
+		{"a:$data", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newTestFS(t, nil)
+
+			strm, err := m.OpenStream("file.txt", tt.name, os.O_RDWR|os.O_CREATE)
+			if tt.valid {
+				if err != nil {
+					t.Fatalf("got error %v", err)
+				}
+				strm.Close()
+				return
+			}
+
+			if !errors.Is(err, fs.ErrInvalid) {
+				t.Errorf("OpenStream: got error %v, want %v", err, fs.ErrInvalid)
+			}
+			if err := m.RenameStream("file.txt", "missing", tt.name, false); !errors.Is(err, fs.ErrInvalid) {
+				t.Errorf("RenameStream: got error %v, want %v", err, fs.ErrInvalid)
+			}
+			if err := m.RemoveStream("file.txt", tt.name); !errors.Is(err, fs.ErrInvalid) {
+				t.Errorf("RemoveStream: got error %v, want %v", err, fs.ErrInvalid)
+			}
+		})
+	}
+}
+
+func TestMemFSOpenFlag(t *testing.T) {
+	tests := []struct {
+		name    string
+		stream  string
+		flag    int
+		write   string
+		wantErr error
+		want    string // empty if the stream should not exist
+	}{
+		{"excl existing", "existing", os.O_WRONLY | os.O_CREATE | os.O_EXCL, "", fs.ErrExist, "content"},
+		{"excl new", "new", os.O_WRONLY | os.O_CREATE | os.O_EXCL, "new", nil, "new"},
+		{"missing", "new", os.O_WRONLY, "", fs.ErrNotExist, ""},
+		{"truncate", "existing", os.O_WRONLY | os.O_TRUNC, "new", nil, "new"},
+		{"overwrite", "existing", os.O_WRONLY, "NEW", nil, "NEWtent"},
+		{"append", "existing", os.O_WRONLY | os.O_APPEND, "+", nil, "content+"},
+		{"read only", "existing", os.O_RDONLY, "x", fs.ErrPermission, "content"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newTestFS(t, map[string]string{"existing": "content"})
+
+			strm, err := m.OpenStream("file.txt", tt.stream, tt.flag)
+			if err == nil && tt.write != "" {
+				_, err = io.WriteString(strm, tt.write)
+				strm.Close()
+			}
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got error %v, want %v", err, tt.wantErr)
+			}
+
+			if tt.want == "" {
+				if _, err := m.OpenStream("file.txt", tt.stream, os.O_RDONLY); !errors.Is(err, fs.ErrNotExist) {
+					t.Errorf("stream \"%s\" exists: %v", tt.stream, err)
+				}
+				return
+			}
+			if got := readStream(t, m, "file.txt", tt.stream); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
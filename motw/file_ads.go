@@ -0,0 +1,112 @@
+//go:build windows || linux
+// +build windows linux
+
+package motw
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/Snshadow/ntfs-ads"
+)
+
+// GetZoneInfo reads Zone.Identifier of the file with OpenFileADS.
+func GetZoneInfo(path string) (*ZoneInfo, error) {
+	strm, err := ntfs_ads.OpenFileADS(path, StreamName, os.O_RDONLY)
+	if err != nil {
+		return nil, err
+	}
+	defer strm.Close()
+
+	return read(strm)
+}
+
+// SetZoneInfo replaces Zone.Identifier of the file with info with OpenFileADS.
+func SetZoneInfo(path string, info *ZoneInfo) error {
+	strm, err := ntfs_ads.OpenFileADS(path, StreamName, writeFlag)
+	if err != nil {
+		return err
+	}
+
+	return write(strm, info)
+}
+
+// Propagate marks files extracted under root which are selected by policy with
+// Zone.Identifier of the archive, whose ReferrerUrl is the path of the archive.
+// Nothing is marked if the archive has no Zone.Identifier. Files already
+// marked with the same or more restricted zone are kept as is.
+func Propagate(archivePath, root string, policy *Policy) error {
+	archivePath, err := filepath.Abs(archivePath)
+	if err != nil {
+		return err
+	}
+
+	info, err := GetZoneInfo(archivePath)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+
+		return fmt.Errorf("could not read %s of \"%s\": %w", StreamName, archivePath, err)
+	}
+	info = info.Propagated(archivePath)
+
+	return filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() || !policy.Marks(path) {
+			return nil
+		}
+
+		if cur, err := GetZoneInfo(path); err == nil && cur.ZoneID >= info.ZoneID {
+			return nil
+		}
+
+		if err = SetZoneInfo(path, info); err != nil {
+			return fmt.Errorf("could not mark \"%s\": %w", path, err)
+		}
+
+		return nil
+	})
+}
+
+// Unblock removes Zone.Identifier of files and directories under root which
+// are selected by filter, or only lists them if dryRun is true. Returns files
+// which are unblocked.
+func Unblock(root string, filter *UnblockFilter, dryRun bool) ([]Unblocked, error) {
+	var unblocked []Unblocked
+
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.Type()&fs.ModeSymlink != 0 {
+			return nil
+		}
+
+		ads, err := ntfs_ads.GetFileADS(path)
+		if err != nil {
+			if errors.Is(err, ntfs_ads.ErrNoADS) || errors.Is(err, ntfs_ads.ErrUnsupported) {
+				return nil
+			}
+
+			return err
+		}
+
+		u, err := UnblockFileADS(&ads, filter, dryRun)
+		if err != nil {
+			return fmt.Errorf("could not unblock \"%s\": %w", path, err)
+		}
+		if u != nil {
+			unblocked = append(unblocked, *u)
+		}
+
+		return nil
+	})
+
+	return unblocked, err
+}
@@ -0,0 +1,28 @@
+//go:build !windows && !linux
+// +build !windows,!linux
+
+package motw
+
+import (
+	"github.com/Snshadow/ntfs-ads"
+)
+
+// GetZoneInfo is not supported on this platform, use ReadZoneInfo with a StreamFS.
+func GetZoneInfo(path string) (*ZoneInfo, error) {
+	return nil, ntfs_ads.ErrUnsupported
+}
+
+// SetZoneInfo is not supported on this platform, use WriteZoneInfo with a StreamFS.
+func SetZoneInfo(path string, info *ZoneInfo) error {
+	return ntfs_ads.ErrUnsupported
+}
+
+// Propagate is not supported on this platform.
+func Propagate(archivePath, root string, policy *Policy) error {
+	return ntfs_ads.ErrUnsupported
+}
+
+// Unblock is not supported on this platform, use UnblockFileADS with a StreamFS.
+func Unblock(root string, filter *UnblockFilter, dryRun bool) ([]Unblocked, error) {
+	return nil, ntfs_ads.ErrUnsupported
+}
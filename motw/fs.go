@@ -0,0 +1,28 @@
+package motw
+
+import (
+	"os"
+
+	"github.com/Snshadow/ntfs-ads"
+)
+
+// ReadZoneInfo reads Zone.Identifier of the file in fsys.
+func ReadZoneInfo(fsys ntfs_ads.StreamFS, path string) (*ZoneInfo, error) {
+	strm, err := fsys.OpenStream(path, StreamName, os.O_RDONLY)
+	if err != nil {
+		return nil, err
+	}
+	defer strm.Close()
+
+	return read(strm)
+}
+
+// WriteZoneInfo replaces Zone.Identifier of the file in fsys with info.
+func WriteZoneInfo(fsys ntfs_ads.StreamFS, path string, info *ZoneInfo) error {
+	strm, err := fsys.OpenStream(path, StreamName, writeFlag)
+	if err != nil {
+		return err
+	}
+
+	return write(strm, info)
+}
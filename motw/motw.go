@@ -0,0 +1,225 @@
+// Package motw reads and writes Mark-of-the-Web of files, the
+// Zone.Identifier stream holding the security zone where the file came from.
+//
+// Zone.Identifier is an INI text with [ZoneTransfer] section, e.g.
+//
+//	[ZoneTransfer]
+//	ZoneId=3
+//	ReferrerUrl=https://example.com/
+//	HostUrl=https://example.com/setup.exe
+package motw
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/Snshadow/ntfs-ads/internal/winfmt"
+)
+
+// StreamName is the name of the stream holding Mark-of-the-Web.
+const StreamName = "Zone.Identifier"
+
+const (
+	sectionName  = "ZoneTransfer"
+	maxZoneSize  = 0x10000 // limit of size of Zone.Identifier to be read
+	newLine      = "\r\n"
+	keyZoneID    = "ZoneId"
+	keyReferrer  = "ReferrerUrl"
+	keyHost      = "HostUrl"
+	keyLastWrite = "LastWriterPackageFamilyName"
+	keyAppZoneID = "AppZoneId"
+)
+
+// writeFlag opens Zone.Identifier for replacing it.
+const writeFlag = os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+
+var ErrInvalidZone = errors.New("invalid Zone.Identifier")
+
+// Zone is URL security zone of URLZONE.
+type Zone int
+
+const (
+	ZoneLocalMachine Zone = 0
+	ZoneIntranet     Zone = 1
+	ZoneTrusted      Zone = 2
+	ZoneInternet     Zone = 3
+	ZoneUntrusted    Zone = 4
+)
+
+func (z Zone) String() string {
+	switch z {
+	case ZoneLocalMachine:
+		return "LocalMachine"
+	case ZoneIntranet:
+		return "Intranet"
+	case ZoneTrusted:
+		return "Trusted"
+	case ZoneInternet:
+		return "Internet"
+	case ZoneUntrusted:
+		return "Untrusted"
+	}
+
+	return fmt.Sprintf("Zone(%d)", int(z))
+}
+
+// Field is a key and value in [ZoneTransfer] section.
+type Field struct {
+	Key   string
+	Value string
+}
+
+// ZoneInfo is the content of Zone.Identifier, empty values are omitted when written.
+type ZoneInfo struct {
+	ZoneID                      Zone
+	ReferrerURL                 string
+	HostURL                     string
+	LastWriterPackageFamilyName string
+	AppZoneID                   string
+
+	Extra []Field // other keys in [ZoneTransfer], kept in order
+}
+
+// Parse parses content of Zone.Identifier in UTF-8 or UTF-16 with or without
+// BOM, lines may end with CRLF, LF or CR. Keys are case-insensitive.
+func Parse(b []byte) (*ZoneInfo, error) {
+	var info ZoneInfo
+	var inSection, hasSection, hasZoneID bool
+
+	for _, line := range splitLines(decodeText(b)) {
+		line = strings.TrimSpace(strings.Trim(line, "\x00"))
+		if line == "" || line[0] == ';' || line[0] == '#' {
+			continue
+		}
+
+		if line[0] == '[' && line[len(line)-1] == ']' {
+			inSection = strings.EqualFold(strings.TrimSpace(line[1:len(line)-1]), sectionName)
+			hasSection = hasSection || inSection
+			continue
+		}
+		if !inSection {
+			continue
+		}
+
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			continue
+		}
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+
+		switch {
+		case strings.EqualFold(key, keyZoneID):
+			id, err := strconv.Atoi(value)
+			if err != nil {
+				return nil, fmt.Errorf("%w: ZoneId \"%s\"", ErrInvalidZone, value)
+			}
+			info.ZoneID, hasZoneID = Zone(id), true
+		case strings.EqualFold(key, keyReferrer):
+			info.ReferrerURL = value
+		case strings.EqualFold(key, keyHost):
+			info.HostURL = value
+		case strings.EqualFold(key, keyLastWrite):
+			info.LastWriterPackageFamilyName = value
+		case strings.EqualFold(key, keyAppZoneID):
+			info.AppZoneID = value
+		default:
+			info.Extra = append(info.Extra, Field{Key: key, Value: value})
+		}
+	}
+
+	if !hasSection {
+		return nil, fmt.Errorf("%w: no [%s] section", ErrInvalidZone, sectionName)
+	}
+	if !hasZoneID {
+		return nil, fmt.Errorf("%w: no ZoneId", ErrInvalidZone)
+	}
+
+	return &info, nil
+}
+
+// decodeText decodes text by its BOM, UTF-16 without BOM is detected by
+// null bytes of ASCII characters.
+func decodeText(b []byte) string {
+	switch {
+	case bytes.HasPrefix(b, []byte{0xEF, 0xBB, 0xBF}):
+		return string(b[3:])
+	case bytes.HasPrefix(b, []byte{0xFF, 0xFE}):
+		return winfmt.DecodeUTF16(b[2:])
+	case bytes.HasPrefix(b, []byte{0xFE, 0xFF}):
+		return winfmt.DecodeUTF16BE(b[2:])
+	case len(b) >= 2 && b[0] != 0 && b[1] == 0:
+		return winfmt.DecodeUTF16(b)
+	case len(b) >= 2 && b[0] == 0 && b[1] != 0:
+		return winfmt.DecodeUTF16BE(b)
+	}
+
+	if !utf8.Valid(b) {
+		// ANSI text of unknown code page, read as Latin-1
+		r := make([]rune, len(b))
+		for i, c := range b {
+			r[i] = rune(c)
+		}
+
+		return string(r)
+	}
+
+	return string(b)
+}
+
+func splitLines(s string) []string {
+	s = strings.ReplaceAll(s, "\r\n", "\n")
+
+	return strings.FieldsFunc(s, func(r rune) bool {
+		return r == '\n' || r == '\r'
+	})
+}
+
+// Bytes returns content of Zone.Identifier in UTF-8 with CRLF, as written by Windows.
+func (z *ZoneInfo) Bytes() []byte {
+	var b strings.Builder
+
+	b.WriteString("[" + sectionName + "]" + newLine)
+	b.WriteString(keyZoneID + "=" + strconv.Itoa(int(z.ZoneID)) + newLine)
+
+	for _, f := range append([]Field{
+		{keyReferrer, z.ReferrerURL},
+		{keyHost, z.HostURL},
+		{keyLastWrite, z.LastWriterPackageFamilyName},
+		{keyAppZoneID, z.AppZoneID},
+	}, z.Extra...) {
+		if f.Key != "" && f.Value != "" {
+			b.WriteString(f.Key + "=" + f.Value + newLine)
+		}
+	}
+
+	return []byte(b.String())
+}
+
+// read parses Zone.Identifier from r.
+func read(r io.Reader) (*ZoneInfo, error) {
+	b, err := io.ReadAll(io.LimitReader(r, maxZoneSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(b) > maxZoneSize {
+		return nil, fmt.Errorf("%w: larger than %d bytes", ErrInvalidZone, maxZoneSize)
+	}
+
+	return Parse(b)
+}
+
+// write writes info into w and closes it.
+func write(w io.WriteCloser, info *ZoneInfo) error {
+	if _, err := w.Write(info.Bytes()); err != nil {
+		w.Close()
+		return err
+	}
+
+	return w.Close()
+}
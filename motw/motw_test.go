@@ -0,0 +1,113 @@
+package motw
+
+import (
+	"encoding/binary"
+	"errors"
+	"reflect"
+	"testing"
+	"unicode/utf16"
+)
+
+const testZone = "[ZoneTransfer]\r\nZoneId=3\r\nReferrerUrl=https://example.com/\r\nHostUrl=https://example.com/setup.exe\r\n"
+
+var testInfo = &ZoneInfo{
+	ZoneID:      ZoneInternet,
+	ReferrerURL: "https://example.com/",
+	HostURL:     "https://example.com/setup.exe",
+}
+
+func encodeUTF16(s string, order binary.AppendByteOrder) []byte {
+	var b []byte
+	for _, c := range utf16.Encode([]rune(s)) {
+		b = order.AppendUint16(b, c)
+	}
+
+	return b
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name string
+		b    []byte
+		want *ZoneInfo
+	}{
+		{"UTF-8", []byte(testZone), testInfo},
+		{"UTF-8 BOM", append([]byte{0xEF, 0xBB, 0xBF}, testZone...), testInfo},
+		{"UTF-16LE BOM", append([]byte{0xFF, 0xFE}, encodeUTF16(testZone, binary.LittleEndian)...), testInfo},
+		{"UTF-16LE", encodeUTF16(testZone, binary.LittleEndian), testInfo},
+		{"UTF-16BE BOM", append([]byte{0xFE, 0xFF}, encodeUTF16(testZone, binary.BigEndian)...), testInfo},
+		{"UTF-16BE", encodeUTF16(testZone, binary.BigEndian), testInfo},
+		{"LF", []byte("[ZoneTransfer]\nZoneId=3\nReferrerUrl=https://example.com/\nHostUrl=https://example.com/setup.exe\n"), testInfo},
+		{"bare CR", []byte("[ZoneTransfer]\rZoneId=3\rReferrerUrl=https://example.com/\rHostUrl=https://example.com/setup.exe"), testInfo},
+		{"trailing null", []byte(testZone + "\x00"), testInfo},
+		{"case and spaces", []byte("; comment\r\n[ zonetransfer ]\r\n zoneid = 4 \r\n"), &ZoneInfo{ZoneID: ZoneUntrusted}},
+		{"other sections", []byte("[Other]\r\nZoneId=1\r\n[ZoneTransfer]\r\nZoneId=2\r\n[Next]\r\nZoneId=4\r\n"), &ZoneInfo{ZoneID: ZoneTrusted}},
+		{"extra fields", []byte("[ZoneTransfer]\r\nZoneId=3\r\nLastWriterPackageFamilyName=pkg\r\nAppZoneId=app\r\nB=2\r\nA=1\r\n"), &ZoneInfo{
+			ZoneID:                      ZoneInternet,
+			LastWriterPackageFamilyName: "pkg",
+			AppZoneID:                   "app",
+			Extra:                       []Field{{"B", "2"}, {"A", "1"}},
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Parse(tt.b)
+			if err != nil {
+				t.Fatalf("Parse: %v", err)
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		b    string
+	}{
+		{"empty", ""},
+		{"no section", "ZoneId=3\r\n"},
+		{"no ZoneId", "[ZoneTransfer]\r\nReferrerUrl=https://example.com/\r\n"},
+		{"ZoneId in other section", "[Other]\r\nZoneId=3\r\n[ZoneTransfer]\r\n"},
+		{"invalid ZoneId", "[ZoneTransfer]\r\nZoneId=internet\r\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Parse([]byte(tt.b)); !errors.Is(err, ErrInvalidZone) {
+				t.Errorf("got %v, want %v", err, ErrInvalidZone)
+			}
+		})
+	}
+}
+
+func TestBytes(t *testing.T) {
+	if got := string(testInfo.Bytes()); got != testZone {
+		t.Errorf("got %q, want %q", got, testZone)
+	}
+
+	info := &ZoneInfo{
+		ZoneID:    ZoneIntranet,
+		AppZoneID: "app",
+		Extra:     []Field{{"B", "2"}, {"", "no key"}, {"empty", ""}, {"A", "1"}},
+	}
+
+	// fields without key or value are omitted
+	want := &ZoneInfo{
+		ZoneID:    ZoneIntranet,
+		AppZoneID: "app",
+		Extra:     []Field{{"B", "2"}, {"A", "1"}},
+	}
+
+	got, err := Parse(info.Bytes())
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,48 @@
+package motw
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// DefaultExtensions are extensions of files which run code or may contain
+// macros, to be used with Policy for marking only risky files.
+var DefaultExtensions = []string{
+	".exe", ".com", ".scr", ".pif", ".cpl", ".dll", ".sys", ".msi", ".msp", ".msix", ".appx",
+	".bat", ".cmd", ".ps1", ".psm1", ".vbs", ".vbe", ".js", ".jse", ".wsf", ".wsh", ".hta",
+	".lnk", ".url", ".chm", ".jar", ".reg", ".iso", ".img", ".vhd", ".vhdx",
+	".doc", ".docm", ".docx", ".dot", ".dotm", ".xls", ".xlsm", ".xlsx", ".xlam", ".ppt", ".pptm", ".pptx",
+	".rtf", ".pdf", ".one",
+}
+
+// Policy selects extracted files to be marked by their extensions.
+type Policy struct {
+	Extensions []string // extensions with ".", compared case-insensitively, every file is marked if empty
+}
+
+// Marks reports whether the file at path should be marked, a nil Policy marks every file.
+func (p *Policy) Marks(path string) bool {
+	if p == nil || len(p.Extensions) == 0 {
+		return true
+	}
+
+	ext := filepath.Ext(path)
+	for _, e := range p.Extensions {
+		if strings.EqualFold(e, ext) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Propagated returns Zone.Identifier for a file extracted from the archive
+// marked with z, which has the same zone and HostUrl with ReferrerUrl set to
+// the path of the archive as Windows does.
+func (z *ZoneInfo) Propagated(archivePath string) *ZoneInfo {
+	return &ZoneInfo{
+		ZoneID:      z.ZoneID,
+		ReferrerURL: archivePath,
+		HostURL:     z.HostURL,
+	}
+}
@@ -0,0 +1,177 @@
+package motw
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Format is a representation of download provenance of a platform.
+type Format int
+
+const (
+	FormatZoneIdentifier Format = iota // Zone.Identifier stream of Windows
+	FormatQuarantine                   // com.apple.quarantine xattr of macOS
+	FormatXDG                          // user.xdg.origin.url and user.xdg.referrer.url xattrs of freedesktop
+)
+
+func (f Format) String() string {
+	switch f {
+	case FormatZoneIdentifier:
+		return "Zone.Identifier"
+	case FormatQuarantine:
+		return "com.apple.quarantine"
+	case FormatXDG:
+		return "xdg"
+	}
+
+	return fmt.Sprintf("Format(%d)", int(f))
+}
+
+// names of xattrs holding provenance
+const (
+	QuarantineAttr  = "com.apple.quarantine"
+	XDGOriginAttr   = "user.xdg.origin.url"
+	XDGReferrerAttr = "user.xdg.referrer.url"
+)
+
+// flags of com.apple.quarantine
+const (
+	QuarantineDownload     = 0x0001 // downloaded from the network
+	QuarantineSandbox      = 0x0002 // created by a sandboxed app
+	QuarantineHard         = 0x0004 // cannot be opened even if approved
+	QuarantineUserApproved = 0x0040 // user approved to open the file
+)
+
+// QuarantineAgent is the agent name written into com.apple.quarantine.
+var QuarantineAgent = "ntfs-ads"
+
+var (
+	ErrNoProvenance      = errors.New("no provenance metadata")
+	ErrInvalidQuarantine = errors.New("invalid com.apple.quarantine")
+)
+
+// Quarantine is the value of com.apple.quarantine, "flags;time;agent;event ID".
+// URLs are not kept in it, but in the quarantine database of the system.
+type Quarantine struct {
+	Flags   uint16
+	Time    time.Time
+	Agent   string
+	EventID string // UUID of the event in the quarantine database, may be empty
+}
+
+// ParseQuarantine parses the value of com.apple.quarantine.
+func ParseQuarantine(value string) (*Quarantine, error) {
+	fields := strings.SplitN(strings.TrimRight(value, "\x00"), ";", 4)
+
+	flags, err := strconv.ParseUint(fields[0], 16, 16)
+	if err != nil {
+		return nil, fmt.Errorf("%w: flags \"%s\"", ErrInvalidQuarantine, fields[0])
+	}
+
+	q := &Quarantine{Flags: uint16(flags)}
+	if len(fields) > 1 && fields[1] != "" {
+		sec, err := strconv.ParseInt(fields[1], 16, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%w: time \"%s\"", ErrInvalidQuarantine, fields[1])
+		}
+		q.Time = time.Unix(sec, 0).UTC()
+	}
+	if len(fields) > 2 {
+		q.Agent = fields[2]
+	}
+	if len(fields) > 3 {
+		q.EventID = fields[3]
+	}
+
+	return q, nil
+}
+
+func (q *Quarantine) String() string {
+	return fmt.Sprintf("%04x;%08x;%s;%s", q.Flags, q.Time.Unix(), q.Agent, q.EventID)
+}
+
+// ZoneInfo returns Zone.Identifier of a file in quarantine, which is from
+// the Internet zone without URLs.
+func (q *Quarantine) ZoneInfo() *ZoneInfo {
+	return &ZoneInfo{ZoneID: ZoneInternet}
+}
+
+// QuarantineFromZone returns com.apple.quarantine for the file marked with
+// info at t, or nil if its zone is not restricted enough to be quarantined.
+func QuarantineFromZone(info *ZoneInfo, t time.Time) *Quarantine {
+	if info.ZoneID < ZoneInternet {
+		return nil
+	}
+
+	return &Quarantine{
+		Flags: QuarantineDownload,
+		Time:  t,
+		Agent: QuarantineAgent,
+	}
+}
+
+// ToXattrs returns xattrs holding provenance of info in the format, URLs are
+// lost for FormatQuarantine. Result is empty if nothing is to be recorded.
+func ToXattrs(info *ZoneInfo, format Format) (map[string][]byte, error) {
+	attrs := make(map[string][]byte)
+
+	switch format {
+	case FormatQuarantine:
+		if q := QuarantineFromZone(info, time.Now()); q != nil {
+			attrs[QuarantineAttr] = []byte(q.String())
+		}
+	case FormatXDG:
+		if info.HostURL != "" {
+			attrs[XDGOriginAttr] = []byte(info.HostURL)
+		}
+		if info.ReferrerURL != "" {
+			attrs[XDGReferrerAttr] = []byte(info.ReferrerURL)
+		}
+	default:
+		return nil, fmt.Errorf("provenance in %s is not stored in xattrs", format)
+	}
+
+	return attrs, nil
+}
+
+// FromXattrs returns Zone.Identifier equivalent to provenance in xattrs of
+// com.apple.quarantine or freedesktop, or ErrNoProvenance if there is none.
+// Files with only origin URL are regarded as from the Internet zone.
+func FromXattrs(attrs map[string][]byte) (*ZoneInfo, error) {
+	var info *ZoneInfo
+
+	if v, ok := attrs[QuarantineAttr]; ok {
+		q, err := ParseQuarantine(string(v))
+		if err != nil {
+			return nil, err
+		}
+		info = q.ZoneInfo()
+	}
+
+	origin, referrer := string(attrs[XDGOriginAttr]), string(attrs[XDGReferrerAttr])
+	if origin != "" || referrer != "" {
+		if info == nil {
+			info = &ZoneInfo{ZoneID: ZoneInternet}
+		}
+		info.HostURL, info.ReferrerURL = origin, referrer
+	}
+
+	if info == nil {
+		return nil, ErrNoProvenance
+	}
+
+	return info, nil
+}
+
+// CopyProvenance copies provenance of src in any format into dst in the format.
+func CopyProvenance(src, dst string, format Format) error {
+	info, err := ReadProvenance(src)
+	if err != nil {
+		return err
+	}
+
+	return WriteProvenance(dst, info, format)
+}
@@ -0,0 +1,18 @@
+//go:build !windows && !linux && !darwin
+// +build !windows,!linux,!darwin
+
+package motw
+
+import (
+	"github.com/Snshadow/ntfs-ads"
+)
+
+// ReadProvenance is not supported on this platform, use FromXattrs or ReadZoneInfo.
+func ReadProvenance(path string) (*ZoneInfo, error) {
+	return nil, ntfs_ads.ErrUnsupported
+}
+
+// WriteProvenance is not supported on this platform, use ToXattrs or WriteZoneInfo.
+func WriteProvenance(path string, info *ZoneInfo, format Format) error {
+	return ntfs_ads.ErrUnsupported
+}
@@ -0,0 +1,81 @@
+//go:build linux || darwin
+// +build linux darwin
+
+package motw
+
+import (
+	"errors"
+	"io/fs"
+
+	"golang.org/x/sys/unix"
+
+	"github.com/Snshadow/ntfs-ads"
+)
+
+// ReadProvenance reads provenance of the file from Zone.Identifier, or from
+// xattrs of com.apple.quarantine or freedesktop if it is not found.
+func ReadProvenance(path string) (*ZoneInfo, error) {
+	info, err := GetZoneInfo(path)
+	if err == nil {
+		return info, nil
+	}
+	if !errors.Is(err, fs.ErrNotExist) && !errors.Is(err, ntfs_ads.ErrUnsupported) {
+		return nil, err
+	}
+
+	attrs := make(map[string][]byte)
+	for _, name := range []string{QuarantineAttr, XDGOriginAttr, XDGReferrerAttr} {
+		value, err := getxattr(path, name)
+		if err != nil {
+			if err == errNoAttr || err == unix.ENOTSUP || err == unix.EPERM {
+				// missing, or name not allowed on this platform
+				continue
+			}
+
+			return nil, &fs.PathError{Op: "getxattr", Path: path, Err: err}
+		}
+		attrs[name] = value
+	}
+
+	return FromXattrs(attrs)
+}
+
+// WriteProvenance writes provenance of info into the file in the format.
+func WriteProvenance(path string, info *ZoneInfo, format Format) error {
+	if format == FormatZoneIdentifier {
+		return SetZoneInfo(path, info)
+	}
+
+	attrs, err := ToXattrs(info, format)
+	if err != nil {
+		return err
+	}
+
+	for name, value := range attrs {
+		if err = unix.Setxattr(path, name, value, 0); err != nil {
+			if err == unix.ENOTSUP {
+				return ntfs_ads.ErrUnsupported
+			}
+
+			return &fs.PathError{Op: "setxattr", Path: path, Err: err}
+		}
+	}
+
+	return nil
+}
+
+func getxattr(path, name string) ([]byte, error) {
+	size, err := unix.Getxattr(path, name, nil)
+	for err == nil {
+		buf := make([]byte, size)
+		if size, err = unix.Getxattr(path, name, buf); err == nil {
+			return buf[:size], nil
+		}
+		if err == unix.ERANGE {
+			// value grown between calls
+			size, err = unix.Getxattr(path, name, nil)
+		}
+	}
+
+	return nil, err
+}
@@ -0,0 +1,28 @@
+package motw
+
+import (
+	"errors"
+	"io/fs"
+
+	"github.com/Snshadow/ntfs-ads"
+)
+
+// ReadProvenance reads provenance of the file from Zone.Identifier.
+func ReadProvenance(path string) (*ZoneInfo, error) {
+	info, err := GetZoneInfo(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrNoProvenance
+	}
+
+	return info, err
+}
+
+// WriteProvenance writes provenance of info into the file, only
+// FormatZoneIdentifier is supported on Windows.
+func WriteProvenance(path string, info *ZoneInfo, format Format) error {
+	if format != FormatZoneIdentifier {
+		return ntfs_ads.ErrUnsupported
+	}
+
+	return SetZoneInfo(path, info)
+}
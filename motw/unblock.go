@@ -0,0 +1,100 @@
+package motw
+
+import (
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/Snshadow/ntfs-ads"
+)
+
+// UnblockFilter selects marked files to be unblocked, every marked file is
+// selected by nil or empty filter.
+type UnblockFilter struct {
+	Zones   []Zone // zones of files to be unblocked, any zone if empty
+	HostURL string // pattern of HostUrl compared case-insensitively, "*" matches any characters and "?" one character
+}
+
+func (f *UnblockFilter) empty() bool {
+	return f == nil || (len(f.Zones) == 0 && f.HostURL == "")
+}
+
+// Matches reports whether the file marked with info is selected, info is nil
+// if Zone.Identifier could not be parsed, which is only selected by empty filter.
+func (f *UnblockFilter) Matches(info *ZoneInfo) bool {
+	if f.empty() {
+		return true
+	}
+	if info == nil {
+		return false
+	}
+
+	if len(f.Zones) > 0 {
+		found := false
+		for _, z := range f.Zones {
+			if z == info.ZoneID {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	return f.HostURL == "" || globRegexp(f.HostURL).MatchString(info.HostURL)
+}
+
+// globRegexp converts the pattern with "*" and "?" into case-insensitive regexp.
+func globRegexp(pattern string) *regexp.Regexp {
+	expr := regexp.QuoteMeta(pattern)
+	expr = strings.ReplaceAll(expr, `\*`, ".*")
+	expr = strings.ReplaceAll(expr, `\?`, ".")
+
+	return regexp.MustCompile("(?is)^" + expr + "$")
+}
+
+// Unblocked is a file whose Zone.Identifier is removed.
+type Unblocked struct {
+	Path   string
+	Stream string    // name of the stream as stored in the file
+	Info   *ZoneInfo // nil if Zone.Identifier could not be parsed
+}
+
+// UnblockFileADS removes Zone.Identifier of the file with RemoveADS if it is
+// selected by filter, or only reports it if dryRun is true. Returns nil if the
+// file is not marked or not selected.
+func UnblockFileADS(ads *ntfs_ads.FileADS, filter *UnblockFilter, dryRun bool) (*Unblocked, error) {
+	var name string
+	for n := range ads.StreamInfoMap {
+		if strings.EqualFold(n, StreamName) {
+			name = n
+			break
+		}
+	}
+	if name == "" {
+		return nil, nil
+	}
+
+	strm, err := ads.OpenADS(name, os.O_RDONLY)
+	if err != nil {
+		return nil, err
+	}
+	info, err := read(strm)
+	strm.Close()
+	if err != nil {
+		info = nil
+	}
+
+	if !filter.Matches(info) {
+		return nil, nil
+	}
+
+	if !dryRun {
+		if err = ads.RemoveADS(name); err != nil {
+			return nil, err
+		}
+	}
+
+	return &Unblocked{Path: ads.Path, Stream: name, Info: info}, nil
+}
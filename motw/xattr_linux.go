@@ -0,0 +1,8 @@
+package motw
+
+import (
+	"golang.org/x/sys/unix"
+)
+
+// errNoAttr is returned by getxattr for a missing xattr.
+const errNoAttr = unix.ENODATA
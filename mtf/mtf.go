@@ -0,0 +1,263 @@
+// Package mtf reads named data streams of files from backup sets written in
+// Microsoft Tape Format, e.g. .bkf files of NTBackup.
+//
+// A backup is a sequence of descriptor blocks(TAPE, SSET, VOLB, DIRB, FILE...)
+// each followed by streams, where the unnamed data stream of a file is stored
+// in STAN stream and each named data stream in ADAT stream beginning with its
+// name. Compressed, encrypted and multi-tape backups are not supported.
+package mtf
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/Snshadow/ntfs-ads/internal/winfmt"
+)
+
+const (
+	dblkHdrSize   = 52 // MTF_DB_HDR
+	streamHdrSize = 22 // MTF_STREAM_HDR
+	tapeDblkSize  = 94 // MTF_TAPE without strings
+	defaultFLB    = 1024
+	maxDblkSize   = 0x10000 // limit of fixed part of descriptor block with strings
+
+	// descriptor block types
+	BlockTape = "TAPE" // start of the media
+	BlockSet  = "SSET" // start of a data set
+	BlockVol  = "VOLB" // volume of following directories
+	BlockDir  = "DIRB" // directory
+	BlockFile = "FILE" // file
+	BlockCFil = "CFIL" // corrupt file
+	BlockESPB = "ESPB" // end of set pad
+	BlockESet = "ESET" // end of a data set
+	BlockEOTM = "EOTM" // end of the media
+	BlockSFMB = "SFMB" // soft filemark
+
+	// stream types
+	StreamStandard  = "STAN" // unnamed data stream
+	StreamAlternate = "ADAT" // named data stream
+	StreamPath      = "PNAM" // name of directory if not in DIRB
+	StreamFileName  = "FNAM" // name of file if not in FILE
+	StreamPad       = "SPAD" // pad to next descriptor block
+
+	stringANSI    = 1
+	stringUnicode = 2
+
+	// media format attributes of streams
+	streamEncrypted  = 0x0008
+	streamCompressed = 0x0010
+
+	dirbPathInStream = 0x00020000
+	fileNameInStream = 0x00020000
+
+	backupAlternateData = 4 // BACKUP_ALTERNATE_DATA of WIN32_STREAM_ID
+	win32StreamIDSize   = 20
+)
+
+var (
+	ErrNotMTF      = errors.New("not a MTF backup")
+	ErrInvalidDBLK = errors.New("invalid descriptor block")
+	ErrUnsupported = errors.New("unsupported MTF stream")
+)
+
+// tapeAddress is MTF_TAPE_ADDRESS, size and offset of a string from the start of descriptor block.
+type tapeAddress struct {
+	size, offset uint16
+}
+
+func readTapeAddress(b []byte) tapeAddress {
+	return tapeAddress{
+		size:   binary.LittleEndian.Uint16(b),
+		offset: binary.LittleEndian.Uint16(b[2:]),
+	}
+}
+
+// dblk is a descriptor block with its fixed part and strings.
+type dblk struct {
+	typ         string
+	attributes  uint32
+	firstEvent  uint16 // offset of the first stream
+	stringType  uint8
+	controlID   uint32
+	buf         []byte // from the start of descriptor block to the first stream
+	offset      int64  // offset of descriptor block in the backup
+	streamStart int64
+}
+
+func (d *dblk) string(at tapeAddress) string {
+	if at.size == 0 || int(at.offset)+int(at.size) > len(d.buf) {
+		return ""
+	}
+
+	return decodeString(d.buf[at.offset:at.offset+at.size], d.stringType)
+}
+
+func (d *dblk) date(off int) time.Time {
+	if off+5 > len(d.buf) {
+		return time.Time{}
+	}
+
+	return parseDate(d.buf[off : off+5])
+}
+
+// decodeString decodes ANSI or little endian UTF-16 string, trailing null is removed.
+func decodeString(b []byte, stringType uint8) string {
+	var s string
+	if stringType == stringUnicode {
+		s = winfmt.DecodeUTF16(b)
+	} else {
+		// code page of ANSI strings is unknown, read as Latin-1
+		r := make([]rune, len(b))
+		for i, c := range b {
+			r[i] = rune(c)
+		}
+		s = string(r)
+	}
+
+	return strings.TrimRight(s, "\x00")
+}
+
+// parseDate parses MTF_DATE_TIME, 5 bytes packed into year(14 bits), month(4),
+// day(5), hour(5), minute(6) and second(6). Zero date is zero time.
+func parseDate(b []byte) time.Time {
+	year := int(b[0])<<6 | int(b[1])>>2
+	month := int(b[1]&0x03)<<2 | int(b[2])>>6
+	day := int(b[2]>>1) & 0x1F
+	hour := int(b[2]&0x01)<<4 | int(b[3])>>4
+	minute := int(b[3]&0x0F)<<2 | int(b[4])>>6
+	second := int(b[4] & 0x3F)
+
+	if year == 0 && month == 0 && day == 0 {
+		return time.Time{}
+	}
+
+	return time.Date(year, time.Month(month), day, hour, minute, second, 0, time.UTC)
+}
+
+// readDBLK reads the descriptor block at off.
+func readDBLK(r io.ReaderAt, off int64) (*dblk, error) {
+	hdr := make([]byte, dblkHdrSize)
+	if n, err := r.ReadAt(hdr, off); n < len(hdr) {
+		return nil, fmt.Errorf("could not read descriptor block at %d: %w", off, err)
+	}
+
+	d := &dblk{
+		typ:        string(hdr[:4]),
+		attributes: binary.LittleEndian.Uint32(hdr[4:]),
+		firstEvent: binary.LittleEndian.Uint16(hdr[8:]),
+		stringType: hdr[48],
+		controlID:  binary.LittleEndian.Uint32(hdr[36:]),
+		offset:     off,
+	}
+
+	if sum := checksum(hdr[:dblkHdrSize-2]); sum != binary.LittleEndian.Uint16(hdr[50:]) {
+		return nil, fmt.Errorf("%w: checksum mismatch of %q at %d", ErrInvalidDBLK, d.typ, off)
+	}
+
+	size := int(d.firstEvent)
+	if size < dblkHdrSize {
+		// no stream follows, e.g. SFMB
+		size = dblkHdrSize
+	}
+	if size > maxDblkSize {
+		return nil, fmt.Errorf("%w: %q at %d has size %d", ErrInvalidDBLK, d.typ, off, size)
+	}
+
+	d.buf = make([]byte, size)
+	if n, err := r.ReadAt(d.buf, off); n < len(d.buf) {
+		return nil, fmt.Errorf("could not read descriptor block at %d: %w", off, err)
+	}
+	d.streamStart = off + int64(size)
+
+	return d, nil
+}
+
+// checksum is word-wise XOR used in headers of descriptor blocks and streams.
+func checksum(b []byte) uint16 {
+	var sum uint16
+	for i := 0; i+1 < len(b); i += 2 {
+		sum ^= binary.LittleEndian.Uint16(b[i:])
+	}
+
+	return sum
+}
+
+// streamHdr is MTF_STREAM_HDR.
+type streamHdr struct {
+	id          string
+	fsAttrs     uint16
+	mediaAttrs  uint16
+	length      int64
+	encryption  uint16
+	compression uint16
+	offset      int64 // offset of data in the backup
+}
+
+func readStreamHdr(r io.ReaderAt, off int64) (*streamHdr, error) {
+	b := make([]byte, streamHdrSize)
+	if n, err := r.ReadAt(b, off); n < len(b) {
+		return nil, fmt.Errorf("could not read stream header at %d: %w", off, err)
+	}
+
+	if checksum(b[:streamHdrSize-2]) != binary.LittleEndian.Uint16(b[20:]) {
+		return nil, nil
+	}
+
+	return &streamHdr{
+		id:          string(b[:4]),
+		fsAttrs:     binary.LittleEndian.Uint16(b[4:]),
+		mediaAttrs:  binary.LittleEndian.Uint16(b[6:]),
+		length:      int64(binary.LittleEndian.Uint64(b[8:])),
+		encryption:  binary.LittleEndian.Uint16(b[16:]),
+		compression: binary.LittleEndian.Uint16(b[18:]),
+		offset:      off + streamHdrSize,
+	}, nil
+}
+
+// alternateName parses name of ADAT stream at the start of its data, which
+// is WIN32_STREAM_ID of BackupRead or only size and name of it. Returns name
+// of the stream and offset of its data.
+func alternateName(r io.ReaderAt, hdr *streamHdr) (string, int64, error) {
+	b := make([]byte, win32StreamIDSize)
+	n, _ := r.ReadAt(b, hdr.offset)
+	if int64(n) > hdr.length {
+		n = int(hdr.length)
+	}
+	b = b[:n]
+
+	var nameOff, nameSize int64
+	switch {
+	case len(b) == win32StreamIDSize && binary.LittleEndian.Uint32(b) == backupAlternateData &&
+		win32StreamIDSize+int64(binary.LittleEndian.Uint32(b[16:]))+int64(binary.LittleEndian.Uint64(b[8:])) == hdr.length:
+		nameOff, nameSize = win32StreamIDSize, int64(binary.LittleEndian.Uint32(b[16:]))
+	case len(b) >= 4:
+		nameOff, nameSize = 4, int64(binary.LittleEndian.Uint32(b))
+	default:
+		return "", 0, fmt.Errorf("%w: ADAT stream at %d is too short", ErrInvalidDBLK, hdr.offset)
+	}
+
+	if nameSize <= 0 || nameSize%2 != 0 || nameOff+nameSize > hdr.length || nameSize > maxDblkSize {
+		return "", 0, fmt.Errorf("%w: invalid name size %d of ADAT stream at %d", ErrInvalidDBLK, nameSize, hdr.offset)
+	}
+
+	name := make([]byte, nameSize)
+	if n, err := r.ReadAt(name, hdr.offset+nameOff); n < len(name) {
+		return "", 0, fmt.Errorf("could not read name of ADAT stream at %d: %w", hdr.offset, err)
+	}
+
+	return streamName(decodeString(name, stringUnicode)), nameOff + nameSize, nil
+}
+
+// streamName strips ":" and ":$DATA" from ":name:$DATA".
+func streamName(s string) string {
+	s = strings.TrimPrefix(s, ":")
+	if i := strings.LastIndexByte(s, ':'); i >= 0 && strings.EqualFold(s[i+1:], "$DATA") {
+		s = s[:i]
+	}
+
+	return s
+}
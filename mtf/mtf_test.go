@@ -0,0 +1,318 @@
+package mtf
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+	"unicode/utf16"
+
+	"github.com/Snshadow/ntfs-ads"
+)
+
+const testFLB = 1024
+
+// testDate is MTF_DATE_TIME of 2022-06-18 04:26:40.
+var testDate = []byte{0x1F, 0x99, 0xA4, 0x46, 0xA8}
+
+func utf16le(s string) []byte {
+	var b []byte
+	for _, c := range utf16.Encode([]rune(s)) {
+		b = binary.LittleEndian.AppendUint16(b, c)
+	}
+
+	return b
+}
+
+// testDBLK builds a descriptor block with strings in UTF-16 after its fixed part.
+type testDBLK struct {
+	b []byte
+}
+
+func newTestDBLK(typ string, size int) *testDBLK {
+	d := &testDBLK{b: make([]byte, size)}
+	copy(d.b, typ)
+	d.b[48] = stringUnicode
+
+	return d
+}
+
+func (d *testDBLK) str(off int, s string) *testDBLK {
+	u := utf16le(s)
+	binary.LittleEndian.PutUint16(d.b[off:], uint16(len(u)))
+	binary.LittleEndian.PutUint16(d.b[off+2:], uint16(len(d.b)))
+	d.b = append(d.b, u...)
+
+	return d
+}
+
+func (d *testDBLK) u32(off int, v uint32) *testDBLK {
+	binary.LittleEndian.PutUint32(d.b[off:], v)
+	return d
+}
+
+func (d *testDBLK) date(off int) *testDBLK {
+	copy(d.b[off:], testDate)
+	return d
+}
+
+// bytes returns the descriptor block padded to 4 bytes, followed by streams
+// and SPAD stream padding it to the format logical block.
+func (d *testDBLK) bytes(streams ...[]byte) []byte {
+	b := append(d.b, make([]byte, (4-len(d.b)%4)%4)...)
+	binary.LittleEndian.PutUint16(b[8:], uint16(len(b)))
+	binary.LittleEndian.PutUint16(b[50:], checksum(b[:50]))
+
+	for _, s := range streams {
+		b = append(b, s...)
+	}
+
+	pad := (len(b)+streamHdrSize+testFLB-1)&^(testFLB-1) - len(b) - streamHdrSize
+	b = append(b, testStreamHdr(StreamPad, 0, pad)...)
+
+	return append(b, make([]byte, pad)...)
+}
+
+func testStreamHdr(id string, mediaAttrs uint16, length int) []byte {
+	b := make([]byte, streamHdrSize)
+	copy(b, id)
+	binary.LittleEndian.PutUint16(b[6:], mediaAttrs)
+	binary.LittleEndian.PutUint64(b[8:], uint64(length))
+	binary.LittleEndian.PutUint16(b[20:], checksum(b[:20]))
+
+	return b
+}
+
+// testStream returns a stream padded to 4 bytes.
+func testStream(id string, mediaAttrs uint16, data []byte) []byte {
+	b := append(testStreamHdr(id, mediaAttrs, len(data)), data...)
+
+	return append(b, make([]byte, (4-len(b)%4)%4)...)
+}
+
+// win32ADAT returns data of ADAT stream beginning with WIN32_STREAM_ID.
+func win32ADAT(name string, data []byte) []byte {
+	u := utf16le(name)
+	b := binary.LittleEndian.AppendUint32(nil, backupAlternateData)
+	b = binary.LittleEndian.AppendUint32(b, 0)
+	b = binary.LittleEndian.AppendUint64(b, uint64(len(data)))
+	b = binary.LittleEndian.AppendUint32(b, uint32(len(u)))
+
+	return append(append(b, u...), data...)
+}
+
+// shortADAT returns data of ADAT stream beginning with size and name only.
+func shortADAT(name string, data []byte) []byte {
+	u := utf16le(name)
+	b := binary.LittleEndian.AppendUint32(nil, uint32(len(u)))
+
+	return append(append(b, u...), data...)
+}
+
+// testBackup returns a backup of a data set with files in "/dir/sub" and
+// "/other", whose names are stored in streams, and a corrupted descriptor
+// block between them.
+func testBackup() []byte {
+	corrupted := newTestDBLK(BlockFile, 92).str(84, "corrupted.txt").bytes()
+	corrupted[50] ^= 0xFF
+
+	blocks := [][]byte{
+		newTestDBLK(BlockTape, 96).str(68, "Test Media").str(80, "ntfs-ads").u32(84, testFLB).bytes(),
+		newTestDBLK(BlockSet, 100).u32(62, 1).str(64, "Set 1").str(68, "test set").str(76, "user").date(88).bytes(),
+		newTestDBLK(BlockVol, 64).str(56, "C:").bytes(),
+		newTestDBLK(BlockDir, 88).u32(76, 5).str(80, "dir\x00sub\x00").bytes(),
+		newTestDBLK(BlockFile, 92).date(56).date(61).u32(76, 5).str(84, "a.txt").bytes(
+			testStream(StreamStandard, 0, []byte("unnamed")),
+			testStream(StreamAlternate, 0, win32ADAT(":Zone.Identifier:$DATA", []byte("[ZoneTransfer]\r\nZoneId=3\r\n"))),
+			testStream(StreamAlternate, 0, shortADAT("notes", []byte("some notes"))),
+		),
+		corrupted,
+		newTestDBLK(BlockDir, 88).u32(52, dirbPathInStream).u32(76, 6).bytes(
+			testStream(StreamPath, 0, utf16le("other\x00")),
+		),
+		newTestDBLK(BlockFile, 92).u32(52, fileNameInStream).u32(76, 6).bytes(
+			testStream(StreamFileName, 0, utf16le("b.txt")),
+			testStream(StreamAlternate, streamEncrypted, []byte("encrypted")),
+		),
+		newTestDBLK(BlockFile, 92).u32(76, 6).str(84, "bad.txt").bytes(
+			testStream(StreamAlternate, 0, shortADAT("a/b", []byte("data"))),
+		),
+	}
+
+	return bytes.Join(blocks, nil)
+}
+
+func newTestReader(t *testing.T, b []byte) *Reader {
+	t.Helper()
+
+	rd, err := NewReader(bytes.NewReader(b), int64(len(b)))
+	if err != nil {
+		t.Fatalf("NewReader: %v", err)
+	}
+
+	return rd
+}
+
+func TestParseDate(t *testing.T) {
+	tests := []struct {
+		b    []byte
+		want time.Time
+	}{
+		{testDate, time.Date(2022, 6, 18, 4, 26, 40, 0, time.UTC)},
+		{[]byte{0x1F, 0x40, 0x43, 0x7E, 0xFB}, time.Date(2000, 1, 1, 23, 59, 59, 0, time.UTC)},
+		{make([]byte, 5), time.Time{}},
+	}
+
+	for _, tt := range tests {
+		if got := parseDate(tt.b); !got.Equal(tt.want) {
+			t.Errorf("parseDate(% X): got %v, want %v", tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestNewReader(t *testing.T) {
+	b := testBackup()
+
+	rd := newTestReader(t, b)
+	if rd.MediaName != "Test Media" || rd.SoftwareName != "ntfs-ads" || rd.BlockSize != testFLB {
+		t.Errorf("got media %q written by %q with block size %d", rd.MediaName, rd.SoftwareName, rd.BlockSize)
+	}
+
+	tests := []struct {
+		name string
+		b    []byte
+	}{
+		{"checksum", append([]byte{'X'}, b[1:]...)},
+		{"not TAPE", b[testFLB:]},
+		{"truncated", b[:dblkHdrSize-1]},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewReader(bytes.NewReader(tt.b), int64(len(tt.b))); !errors.Is(err, ErrNotMTF) {
+				t.Errorf("got %v, want %v", err, ErrNotMTF)
+			}
+		})
+	}
+}
+
+func TestReadDBLKChecksum(t *testing.T) {
+	b := testBackup()
+
+	// the corrupted block follows FILE of "a.txt"
+	_, err := readDBLK(bytes.NewReader(b), 5*testFLB)
+	if !errors.Is(err, ErrInvalidDBLK) {
+		t.Errorf("got %v, want %v", err, ErrInvalidDBLK)
+	}
+}
+
+func TestWalk(t *testing.T) {
+	rd := newTestReader(t, testBackup())
+
+	got := make(map[string]map[string]int64)
+	err := rd.Walk(func(f *File) error {
+		if f.Set == nil || f.Set.Number != 1 || f.Set.Name != "Set 1" || f.Set.UserName != "user" || f.Volume != "C:" {
+			t.Errorf("%s: got data set %+v of volume %q", f.Path, f.Set, f.Volume)
+		}
+
+		got[f.Path] = f.StreamInfoMap()
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Walk: %v", err)
+	}
+
+	want := map[string]map[string]int64{
+		"/dir/sub":       {},
+		"/dir/sub/a.txt": {"Zone.Identifier": 26, "notes": 10},
+		"/other":         {},
+		"/other/b.txt":   {"?0": 9},
+		"/other/bad.txt": {"a/b": 4},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestLookup(t *testing.T) {
+	rd := newTestReader(t, testBackup())
+
+	f, err := rd.Lookup("c:", "\\DIR\\sub\\A.TXT")
+	if err != nil {
+		t.Fatalf("Lookup: %v", err)
+	}
+
+	date := time.Date(2022, 6, 18, 4, 26, 40, 0, time.UTC)
+	if !f.Set.WriteTime.Equal(date) || !f.Modified.Equal(date) || !f.Created.Equal(date) || !f.Accessed.IsZero() {
+		t.Errorf("got set written at %v, file modified at %v, created at %v, accessed at %v",
+			f.Set.WriteTime, f.Modified, f.Created, f.Accessed)
+	}
+
+	r, err := f.Data.Open()
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	if b, _ := io.ReadAll(r); string(b) != "unnamed" {
+		t.Errorf("got unnamed stream %q", b)
+	}
+
+	if _, err = rd.Lookup("D:", "/dir/sub/a.txt"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Lookup in other volume: got %v, want %v", err, os.ErrNotExist)
+	}
+}
+
+func TestRestoreFS(t *testing.T) {
+	tests := []struct {
+		path     string
+		restored int
+		want     error
+		streams  map[string]string
+	}{
+		{"/dir/sub/a.txt", 2, nil, map[string]string{
+			"Zone.Identifier": "[ZoneTransfer]\r\nZoneId=3\r\n",
+			"notes":           "some notes",
+		}},
+		{"/other/b.txt", 0, ErrUnsupported, map[string]string{}},
+		{"/other/bad.txt", 0, ErrInvalidDBLK, map[string]string{}},
+	}
+
+	rd := newTestReader(t, testBackup())
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			f, err := rd.Lookup("", tt.path)
+			if err != nil {
+				t.Fatalf("Lookup: %v", err)
+			}
+
+			m := ntfs_ads.NewMemFS()
+			if err = m.WriteFile("target", nil); err != nil {
+				t.Fatal(err)
+			}
+
+			n, err := RestoreFS(m, f, "target")
+			if n != tt.restored || !errors.Is(err, tt.want) {
+				t.Fatalf("got %d streams restored with %v, want %d with %v", n, err, tt.restored, tt.want)
+			}
+
+			got := make(map[string]string)
+			streams, _ := m.ListStreams("target")
+			for name := range streams {
+				strm, err := m.OpenStream("target", name, os.O_RDONLY)
+				if err != nil {
+					t.Fatal(err)
+				}
+				b, _ := io.ReadAll(strm)
+				strm.Close()
+				got[name] = string(b)
+			}
+			if !reflect.DeepEqual(got, tt.streams) {
+				t.Errorf("got streams %v, want %v", got, tt.streams)
+			}
+		})
+	}
+}
@@ -0,0 +1,380 @@
+package mtf
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/fs"
+	"strings"
+	"time"
+)
+
+// Stream is a data stream of a file in the backup.
+type Stream struct {
+	Name string // empty for the unnamed data stream, "?N" for Nth named stream which is encrypted or compressed
+	Size int64
+
+	r           io.ReaderAt
+	offset      int64 // offset of data in the backup
+	unsupported string
+}
+
+// Open returns reader of data of the stream.
+func (s *Stream) Open() (*io.SectionReader, error) {
+	if s.unsupported != "" {
+		return nil, fmt.Errorf("%w: %s", ErrUnsupported, s.unsupported)
+	}
+
+	return io.NewSectionReader(s.r, s.offset, s.Size), nil
+}
+
+// DataSet is a backup set started with SSET descriptor block.
+type DataSet struct {
+	Number      uint16
+	Name        string
+	Description string
+	UserName    string
+	WriteTime   time.Time
+}
+
+// File is a file or directory in a data set.
+type File struct {
+	Set        *DataSet
+	Volume     string // device name of VOLB, e.g. "C:"
+	Path       string // path in the volume separated with "/"
+	IsDir      bool
+	Attributes uint32 // attributes of FILE or DIRB descriptor block
+
+	Modified time.Time
+	Created  time.Time
+	Accessed time.Time
+
+	Data    *Stream   // unnamed data stream, nil if not backed up
+	Streams []*Stream // named data streams
+}
+
+// StreamInfoMap returns name and size of named data streams of the file,
+// same as StreamInfoMap of FileADS.
+func (f *File) StreamInfoMap() map[string]int64 {
+	streamInfoMap := make(map[string]int64, len(f.Streams))
+	for _, strm := range f.Streams {
+		streamInfoMap[strm.Name] = strm.Size
+	}
+
+	return streamInfoMap
+}
+
+// Stream returns the named stream of the file, compared case-insensitively as in NTFS.
+func (f *File) Stream(name string) (*Stream, bool) {
+	for _, strm := range f.Streams {
+		if strings.EqualFold(strm.Name, name) {
+			return strm, true
+		}
+	}
+
+	return nil, false
+}
+
+// Reader reads descriptor blocks of a backup.
+type Reader struct {
+	MediaName        string
+	MediaDescription string
+	SoftwareName     string
+	BlockSize        int64 // format logical block size, descriptor blocks are aligned to it
+
+	r    io.ReaderAt
+	size int64
+}
+
+// NewReader reads TAPE descriptor block at the start of backup r of size bytes.
+func NewReader(r io.ReaderAt, size int64) (*Reader, error) {
+	d, err := readDBLK(r, 0)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrNotMTF, err)
+	}
+	if d.typ != BlockTape || len(d.buf) < tapeDblkSize {
+		return nil, ErrNotMTF
+	}
+
+	rd := &Reader{
+		MediaName:        d.string(readTapeAddress(d.buf[68:])),
+		MediaDescription: d.string(readTapeAddress(d.buf[72:])),
+		SoftwareName:     d.string(readTapeAddress(d.buf[80:])),
+		BlockSize:        int64(binary.LittleEndian.Uint16(d.buf[84:])),
+		r:                r,
+		size:             size,
+	}
+
+	if rd.BlockSize < 512 || rd.BlockSize&(rd.BlockSize-1) != 0 {
+		rd.BlockSize = defaultFLB
+	}
+
+	return rd, nil
+}
+
+// alignBlock rounds off up to the format logical block.
+func (rd *Reader) alignBlock(off int64) int64 {
+	return (off + rd.BlockSize - 1) &^ (rd.BlockSize - 1)
+}
+
+// readStreams reads headers of streams following the descriptor block,
+// returns them with offset of the next descriptor block.
+func (rd *Reader) readStreams(d *dblk) ([]*streamHdr, int64, error) {
+	var strms []*streamHdr
+
+	off := d.streamStart
+	if d.firstEvent < dblkHdrSize {
+		return nil, rd.alignBlock(off), nil
+	}
+
+	for off+streamHdrSize <= rd.size {
+		hdr, err := readStreamHdr(rd.r, off)
+		if err != nil {
+			return nil, 0, err
+		}
+		if hdr == nil {
+			// not a stream header, descriptor block without SPAD
+			break
+		}
+		if hdr.length < 0 || hdr.length > rd.size-hdr.offset {
+			return nil, 0, fmt.Errorf("%w: stream %q at %d exceeds backup", ErrInvalidDBLK, hdr.id, off)
+		}
+
+		off = hdr.offset + hdr.length
+		if hdr.id == StreamPad {
+			break
+		}
+		strms = append(strms, hdr)
+
+		// stream headers are aligned to 4 bytes
+		off = (off + 3) &^ 3
+	}
+
+	return strms, rd.alignBlock(off), nil
+}
+
+// walkState keeps descriptor blocks of current data set for files.
+type walkState struct {
+	set    *DataSet
+	volume string
+	dirs   map[uint32]string // path of DIRB by directory ID
+	dir    string            // path of the last DIRB
+}
+
+// Walk calls fn for every file and directory in all data sets of the backup,
+// in order of descriptor blocks.
+func (rd *Reader) Walk(fn func(*File) error) error {
+	st := &walkState{
+		dirs: make(map[uint32]string),
+	}
+
+	for off := int64(0); off+dblkHdrSize <= rd.size; {
+		d, err := readDBLK(rd.r, off)
+		if err != nil {
+			// padding or filemark between descriptor blocks
+			off += rd.BlockSize
+			continue
+		}
+
+		strms, next, err := rd.readStreams(d)
+		if err != nil {
+			return err
+		}
+
+		if f := rd.handleDBLK(st, d, strms); f != nil {
+			if err = fn(f); err != nil {
+				return err
+			}
+		}
+
+		if next <= off {
+			next = off + rd.BlockSize
+		}
+		off = next
+	}
+
+	return nil
+}
+
+// WalkStreams calls fn for every file and directory which has at least one named data stream.
+func (rd *Reader) WalkStreams(fn func(*File) error) error {
+	return rd.Walk(func(f *File) error {
+		if len(f.Streams) == 0 {
+			return nil
+		}
+
+		return fn(f)
+	})
+}
+
+// handleDBLK updates st with the descriptor block, returns File for FILE and DIRB.
+func (rd *Reader) handleDBLK(st *walkState, d *dblk, strms []*streamHdr) *File {
+	b := d.buf
+
+	switch d.typ {
+	case BlockSet:
+		if len(b) < 96 {
+			return nil
+		}
+
+		st.set = &DataSet{
+			Number:      binary.LittleEndian.Uint16(b[62:]),
+			Name:        d.string(readTapeAddress(b[64:])),
+			Description: d.string(readTapeAddress(b[68:])),
+			UserName:    d.string(readTapeAddress(b[76:])),
+			WriteTime:   d.date(88),
+		}
+		st.volume, st.dir = "", ""
+		st.dirs = make(map[uint32]string)
+	case BlockVol:
+		if len(b) < 60 {
+			return nil
+		}
+
+		st.volume = d.string(readTapeAddress(b[56:]))
+	case BlockDir:
+		if len(b) < 84 {
+			return nil
+		}
+
+		// DIRB attributes follow the common block header
+		attrs := binary.LittleEndian.Uint32(b[52:])
+
+		name := d.string(readTapeAddress(b[80:]))
+		if attrs&dirbPathInStream != 0 {
+			name = rd.nameInStream(d, strms, StreamPath)
+		}
+
+		// components of path are separated with null
+		var names []string
+		for _, n := range strings.Split(name, "\x00") {
+			if n != "" {
+				names = append(names, n)
+			}
+		}
+
+		st.dir = "/" + strings.Join(names, "/")
+		st.dirs[binary.LittleEndian.Uint32(b[76:])] = st.dir
+
+		return rd.newFile(st, d, strms, st.dir, attrs, true)
+	case BlockFile:
+		if len(b) < 88 {
+			return nil
+		}
+
+		// FILE attributes follow the common block header
+		attrs := binary.LittleEndian.Uint32(b[52:])
+
+		name := d.string(readTapeAddress(b[84:]))
+		if attrs&fileNameInStream != 0 {
+			name = rd.nameInStream(d, strms, StreamFileName)
+		}
+
+		dir, ok := st.dirs[binary.LittleEndian.Uint32(b[76:])]
+		if !ok {
+			dir = st.dir
+		}
+
+		return rd.newFile(st, d, strms, strings.TrimSuffix(dir, "/")+"/"+name, attrs, false)
+	}
+
+	return nil
+}
+
+// nameInStream reads name of directory or file stored in the stream of id.
+func (rd *Reader) nameInStream(d *dblk, strms []*streamHdr, id string) string {
+	for _, hdr := range strms {
+		if hdr.id != id || hdr.length > maxDblkSize {
+			continue
+		}
+
+		b := make([]byte, hdr.length)
+		if n, _ := rd.r.ReadAt(b, hdr.offset); n == len(b) {
+			return decodeString(b, d.stringType)
+		}
+	}
+
+	return ""
+}
+
+// newFile returns File of FILE or DIRB with its data streams.
+func (rd *Reader) newFile(st *walkState, d *dblk, strms []*streamHdr, path string, attrs uint32, isDir bool) *File {
+	f := &File{
+		Set:        st.set,
+		Volume:     st.volume,
+		Path:       path,
+		IsDir:      isDir,
+		Attributes: attrs,
+		Modified:   d.date(56),
+		Created:    d.date(61),
+		Accessed:   d.date(71),
+	}
+
+	for _, hdr := range strms {
+		if hdr.id != StreamStandard && hdr.id != StreamAlternate {
+			continue
+		}
+
+		strm := &Stream{
+			Size:   hdr.length,
+			r:      rd.r,
+			offset: hdr.offset,
+		}
+
+		switch {
+		case hdr.mediaAttrs&streamEncrypted != 0:
+			strm.unsupported = "encrypted"
+		case hdr.mediaAttrs&streamCompressed != 0:
+			strm.unsupported = "compressed"
+		}
+
+		if hdr.id == StreamStandard {
+			f.Data = strm
+			continue
+		}
+
+		if strm.unsupported != "" {
+			// name cannot be read from encrypted or compressed data
+			strm.Name = fmt.Sprintf("?%d", len(f.Streams))
+			f.Streams = append(f.Streams, strm)
+			continue
+		}
+
+		name, dataOff, err := alternateName(rd.r, hdr)
+		if err != nil {
+			continue
+		}
+
+		strm.Name = name
+		strm.offset += dataOff
+		strm.Size -= dataOff
+		f.Streams = append(f.Streams, strm)
+	}
+
+	return f
+}
+
+// Lookup returns the first file with the path in the volume, compared
+// case-insensitively as in NTFS. Volume is ignored if empty.
+func (rd *Reader) Lookup(volume, path string) (*File, error) {
+	path = "/" + strings.Trim(strings.ReplaceAll(path, "\\", "/"), "/")
+
+	var found *File
+	err := rd.Walk(func(f *File) error {
+		if (volume == "" || strings.EqualFold(f.Volume, volume)) && strings.EqualFold(f.Path, path) {
+			found = f
+			return io.EOF
+		}
+
+		return nil
+	})
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+
+	if found == nil {
+		return nil, &fs.PathError{Op: "lookup", Path: path, Err: fs.ErrNotExist}
+	}
+
+	return found, nil
+}
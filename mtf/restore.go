@@ -0,0 +1,65 @@
+package mtf
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/Snshadow/ntfs-ads"
+)
+
+// restoreFlag opens streams of the target file for restoring.
+const restoreFlag = os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+
+// RestoreFS writes named data streams of the file in the backup to the target
+// file in fsys, replacing streams with the same name, and returns the number
+// of streams written. Encrypted or compressed streams are skipped and reported
+// with ErrUnsupported in the returned error.
+func RestoreFS(fsys ntfs_ads.StreamFS, f *File, target string) (int, error) {
+	return restore(f, func(name string) (io.WriteCloser, error) {
+		return fsys.OpenStream(target, name, restoreFlag)
+	})
+}
+
+func restore(f *File, open func(name string) (io.WriteCloser, error)) (int, error) {
+	var skipped error
+
+	restored := 0
+	for _, strm := range f.Streams {
+		if !ntfs_ads.ValidStreamName(strm.Name) {
+			return restored, fmt.Errorf("%w: invalid name \"%s\" of ADAT stream of \"%s\"", ErrInvalidDBLK, strm.Name, f.Path)
+		}
+
+		err := restoreStream(strm, open)
+		if errors.Is(err, ErrUnsupported) {
+			skipped = errors.Join(skipped, fmt.Errorf("skipped stream \"%s\" of \"%s\": %w", strm.Name, f.Path, err))
+			continue
+		}
+		if err != nil {
+			return restored, fmt.Errorf("could not restore stream \"%s\" of \"%s\": %w", strm.Name, f.Path, err)
+		}
+		restored++
+	}
+
+	return restored, skipped
+}
+
+func restoreStream(strm *Stream, open func(name string) (io.WriteCloser, error)) error {
+	r, err := strm.Open()
+	if err != nil {
+		return err
+	}
+
+	w, err := open(strm.Name)
+	if err != nil {
+		return err
+	}
+
+	if _, err = io.Copy(w, r); err != nil {
+		w.Close()
+		return err
+	}
+
+	return w.Close()
+}
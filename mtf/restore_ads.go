@@ -0,0 +1,20 @@
+//go:build windows || linux
+// +build windows linux
+
+package mtf
+
+import (
+	"io"
+
+	"github.com/Snshadow/ntfs-ads"
+)
+
+// Restore writes named data streams of the file in the backup to the target
+// file with OpenFileADS, replacing streams with the same name, and returns the
+// number of streams written. Encrypted or compressed streams are skipped and
+// reported with ErrUnsupported in the returned error.
+func Restore(f *File, target string) (int, error) {
+	return restore(f, func(name string) (io.WriteCloser, error) {
+		return ntfs_ads.OpenFileADS(target, name, restoreFlag)
+	})
+}
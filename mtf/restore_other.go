@@ -0,0 +1,13 @@
+//go:build !windows && !linux
+// +build !windows,!linux
+
+package mtf
+
+import (
+	"github.com/Snshadow/ntfs-ads"
+)
+
+// Restore is not supported on this platform, use RestoreFS with a StreamFS.
+func Restore(f *File, target string) (int, error) {
+	return 0, ntfs_ads.ErrUnsupported
+}
@@ -4,12 +4,10 @@
 package ntfs_ads
 
 import (
-	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
 	"strings"
-	"sync"
 
 	"golang.org/x/sys/windows"
 
@@ -20,26 +18,15 @@ const (
 	adsRename = 0x100000 // rename ADS, should be used alone for OpenFileADS
 )
 
-var (
-	ErrNoADS       = errors.New("no alternate data stream found")
-	ErrUnsupported = errors.New("file system does not support stream")
-)
-
 // parseStreamDataName parses ":streamname:$streamtype" format into name of stream.
 // Returns stream name only if $streamtype is $DATA, otherwise returns empty string.
 func parseStreamDataName(data w32api.WIN32_FIND_STREAM_DATA) string {
-	dataStr := windows.UTF16ToString(data.StreamName[:])
-
-	fields := strings.Split(dataStr, ":")
-
-	name, strmType := fields[1], fields[2]
-
-	// not a data stream type
-	if strmType != "$DATA" {
+	spec, err := ParseStreamSpec(windows.UTF16ToString(data.StreamName[:]))
+	if err != nil || !spec.IsData() {
 		return ""
 	}
 
-	return name
+	return spec.Name
 }
 
 // OpenFileADS opens data stream of the name from the given file with specified flag(used in os.OpenFile()),
@@ -103,48 +90,12 @@ func OpenFileADS(path string, name string, openFlag int) (*os.File, error) {
 	return os.NewFile(uintptr(hnd), path), nil
 }
 
-// FileADS handles alternate data streams of a file.
-type FileADS struct {
-	Path          string
-	StreamInfoMap map[string]int64
-
-	mut *sync.Mutex // mutex for concurrent map handling
-}
-
-// GetFileADS returns ADS handler with a map of alternate data streams
-// from the specified file.
-func GetFileADS(path string) (FileADS, error) {
-	var err error
-	var absPath string // normalized path
-
-	if strings.HasPrefix(path, "\\??\\") {
-		// has NT Namespace prefix
-		absPath = path
-	} else {
-		absPath, err = filepath.Abs(path)
-		if err != nil {
-			return FileADS{}, err
-		}
-	}
-
-	ads := FileADS{
-		Path: absPath,
-		mut: &sync.Mutex{},
-	}
-
-	if err = ads.CollectADS(); err != nil {
-		return ads, err
-	}
-
-	return ads, err
-}
-
-// CollectADS collects name and size of alternate data streams of the file.
-func (a *FileADS) CollectADS() error {
-	a.mut.Lock()
-	defer a.mut.Unlock()
+// Win32FS is a StreamFS which accesses alternate data streams in NTFS with Win32 API.
+type Win32FS struct{}
 
-	findStrm, data, err := w32api.FindFirstStream(a.Path, w32api.FindStreamInfoStandard, 0)
+// findStreams calls fn for every stream of the file found with FindFirstStreamW.
+func findStreams(path string, fn func(data w32api.WIN32_FIND_STREAM_DATA)) error {
+	findStrm, data, err := w32api.FindFirstStream(path, w32api.FindStreamInfoStandard, 0)
 	if err == windows.ERROR_HANDLE_EOF {
 		// possible for directories or reparse points, files have at least one for unnamed data stream
 		return ErrNoADS
@@ -154,11 +105,7 @@ func (a *FileADS) CollectADS() error {
 		return err
 	}
 
-	streamInfoMap := make(map[string]int64)
-
-	if strmName := parseStreamDataName(data); strmName != "" {
-		streamInfoMap[strmName] = data.StreamSize
-	}
+	fn(data)
 
 	for {
 		data, findErr := w32api.FindNextStream(findStrm)
@@ -167,114 +114,154 @@ func (a *FileADS) CollectADS() error {
 			break
 		} else if findErr != nil {
 			err = findErr
-			goto EXIT
+			break
 		}
 
-		if strmName := parseStreamDataName(data); strmName != "" {
-			streamInfoMap[strmName] = data.StreamSize
-		}
+		fn(data)
 	}
 
-EXIT:
 	closeErr := w32api.FindClose(findStrm)
 	if closeErr != nil {
 		return fmt.Errorf("error: %v, FindClose err: %v", err, closeErr)
 	}
 
-	a.StreamInfoMap = streamInfoMap
+	return err
+}
 
-	if len(a.StreamInfoMap) == 0 {
-		// return ErrNoADS for files
-		return ErrNoADS
+// ListStreams collects name and size of alternate data streams of the file.
+func (Win32FS) ListStreams(path string) (map[string]int64, error) {
+	streamInfoMap := make(map[string]int64)
+
+	err := findStreams(path, func(data w32api.WIN32_FIND_STREAM_DATA) {
+		if strmName := parseStreamDataName(data); strmName != "" {
+			streamInfoMap[strmName] = data.StreamSize
+		}
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	return nil
+	return streamInfoMap, nil
 }
 
-// RenameADS renames alternate data stream with oldName to newName.
-// If stream with newName exists, it will be overwitten if overwrite is true,
-// otherwise return an error.
-func (a *FileADS) RenameADS(oldName, newName string, overwrite bool) error {
-	a.mut.Lock()
-	defer a.mut.Unlock()
+// ListAllStreams collects data streams of the file with their sizes including
+// the unnamed data stream, with $EA and $REPARSE_POINT if the file has them.
+// Other attribute types, e.g. $INDEX_ALLOCATION of directories, cannot be
+// queried with Win32 API and are not included.
+func (Win32FS) ListAllStreams(path string) (map[StreamSpec]int64, error) {
+	specs := make(map[StreamSpec]int64)
 
-	size, ok := a.StreamInfoMap[oldName]
-	if !ok {
-		return fmt.Errorf("ADS \"%s\" does not exist", oldName)
+	err := findStreams(path, func(data w32api.WIN32_FIND_STREAM_DATA) {
+		if spec, err := ParseStreamSpec(windows.UTF16ToString(data.StreamName[:])); err == nil {
+			specs[spec] = data.StreamSize
+		}
+	})
+	if err != nil && err != ErrNoADS {
+		return nil, err
 	}
 
-	hnd, err := OpenFileADS(a.Path, oldName, adsRename)
+	u16Path, err := windows.UTF16PtrFromString(path)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	defer hnd.Close()
 
-	// https://learn.microsoft.com/en-us/windows/win32/api/winbase/ns-winbase-file_rename_info#:~:text=The%20new%20name%20of%20an%20NTFS%20file%20stream%2C%20starting%20with%20%3A
-	renameInfo, err := w32api.NewFileRenameInfo(":" + newName, overwrite)
+	hnd, err := windows.CreateFile(
+		u16Path,
+		windows.FILE_READ_ATTRIBUTES|windows.FILE_READ_EA,
+		windows.FILE_SHARE_READ|windows.FILE_SHARE_WRITE|windows.FILE_SHARE_DELETE,
+		nil,
+		windows.OPEN_EXISTING,
+		windows.FILE_FLAG_BACKUP_SEMANTICS|windows.FILE_FLAG_OPEN_REPARSE_POINT,
+		0,
+	)
 	if err != nil {
-		return err
+		return nil, &os.PathError{Op: "open", Path: path, Err: err}
 	}
+	defer windows.CloseHandle(hnd)
 
-	fmt.Println(renameInfo)
+	eaSize, err := w32api.GetFileEaSize(hnd)
+	if err != nil {
+		return nil, &os.PathError{Op: "NtQueryInformationFile", Path: path, Err: err}
+	}
+	if eaSize != 0 {
+		specs[StreamSpec{Type: TypeEA}] = int64(eaSize)
+	}
 
+	buf := make([]byte, windows.MAXIMUM_REPARSE_DATA_BUFFER_SIZE)
+	var n uint32
 
-	//TODO fix 32bit ERROR_INVALID_NAME error
-	if err = windows.SetFileInformationByHandle(
-		windows.Handle(hnd.Fd()),
-		windows.FileRenameInfo,
-		&renameInfo[0],
-		uint32(len(renameInfo)),
-	); err != nil {
-		return err
+	err = windows.DeviceIoControl(hnd, windows.FSCTL_GET_REPARSE_POINT, nil, 0, &buf[0], uint32(len(buf)), &n, nil)
+	switch err {
+	case nil:
+		specs[StreamSpec{Type: TypeReparsePoint}] = int64(n)
+	case windows.ERROR_NOT_A_REPARSE_POINT:
+		// no reparse point
+	default:
+		return nil, &os.PathError{Op: "DeviceIoControl", Path: path, Err: err}
 	}
 
-	delete(a.StreamInfoMap, oldName)
-	a.StreamInfoMap[newName] = size
-
-	return nil
+	return specs, nil
 }
 
-// RemoveADS removes alternate data stream with the name.
-func (a *FileADS) RemoveADS(name string) error {
-	a.mut.Lock()
-	defer a.mut.Unlock()
-
-	_, ok := a.StreamInfoMap[name]
-	if !ok {
-		return fmt.Errorf("stream \"%s\" does not exist", name)
+// OpenStream opens data stream of the name from the file, see OpenFileADS.
+func (Win32FS) OpenStream(path, name string, flag int) (Stream, error) {
+	f, err := OpenFileADS(path, name, flag)
+	if err != nil {
+		return nil, err
 	}
 
-	if err := os.Remove(a.Path + ":" + name); err != nil {
+	return f, nil
+}
+
+// RenameStream renames data stream of the file with FILE_RENAME_INFO.
+func (Win32FS) RenameStream(path, oldName, newName string, overwrite bool) error {
+	hnd, err := OpenFileADS(path, oldName, adsRename)
+	if err != nil {
 		return err
 	}
+	defer hnd.Close()
 
-	delete(a.StreamInfoMap, name)
+	// https://learn.microsoft.com/en-us/windows/win32/api/winbase/ns-winbase-file_rename_info#:~:text=The%20new%20name%20of%20an%20NTFS%20file%20stream%2C%20starting%20with%20%3A
+	renameInfo, err := w32api.NewFileRenameInfo(":"+newName, overwrite)
+	if err != nil {
+		return err
+	}
 
-	return nil
+	//TODO fix 32bit ERROR_INVALID_NAME error
+	return windows.SetFileInformationByHandle(
+		windows.Handle(hnd.Fd()),
+		windows.FileRenameInfo,
+		&renameInfo[0],
+		uint32(len(renameInfo)),
+	)
 }
 
-// RemoveAllADS removes all alternate data streams from the file, leaving
-// only the unnamed data stream, in which data are normally stored.
-func (a *FileADS) RemoveAllADS() error {
-	var err error
-
-	// collect current ADS
-	err = a.CollectADS()
+// RemoveStream removes data stream of the name from the file, the unnamed
+// data stream is not removed since it is the file itself.
+func (Win32FS) RemoveStream(path, name string) error {
+	strmName, err := namedDataStream(name)
 	if err != nil {
 		return err
 	}
 
-	a.mut.Lock()
-	defer a.mut.Unlock()
+	return os.Remove(path + ":" + strmName)
+}
 
-	for name := range a.StreamInfoMap {
-		if removeErr := os.Remove(a.Path + ":" + name); removeErr != nil {
-			err = errors.Join(err, removeErr)
-			continue
-		}
+// GetFileADS returns ADS handler with a map of alternate data streams
+// from the specified file.
+func GetFileADS(path string) (FileADS, error) {
+	var err error
+	var absPath string // normalized path
 
-		delete(a.StreamInfoMap, name)
+	if strings.HasPrefix(path, "\\??\\") {
+		// has NT Namespace prefix
+		absPath = path
+	} else {
+		absPath, err = filepath.Abs(path)
+		if err != nil {
+			return FileADS{}, err
+		}
 	}
 
-	return err
+	return NewFileADS(Win32FS{}, absPath)
 }
@@ -0,0 +1,292 @@
+//go:build linux
+// +build linux
+
+package ntfs_ads
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"strings"
+	"sync/atomic"
+
+	"golang.org/x/sys/unix"
+)
+
+// Streams interfaces of ntfs-3g, set with streams_interface mount option.
+const (
+	NTFS3GStreamsWindows = "windows" // streams are opened as "file:stream"
+	NTFS3GStreamsXattr   = "xattr"   // streams are accessed as "user.stream" xattrs
+)
+
+const (
+	fuseSuperMagic = 0x65735546 // FUSE_SUPER_MAGIC
+
+	ntfs3gStreamsList = "ntfs.streams.list"  // names of streams, only available with streams_interface=windows
+	ntfs3gAttrib      = "system.ntfs_attrib" // NTFS file attributes, available for any file in ntfs-3g
+)
+
+// NTFS3GStreamsInterface returns the streams interface of ntfs-3g mount where
+// the file is, or empty string if the file is not in a ntfs-3g mount.
+func NTFS3GStreamsInterface(path string) (string, error) {
+	var st unix.Statfs_t
+	if err := unix.Statfs(path, &st); err != nil {
+		return "", &fs.PathError{Op: "statfs", Path: path, Err: err}
+	}
+
+	if st.Type != fuseSuperMagic {
+		return "", nil
+	}
+
+	if _, err := unix.Getxattr(path, ntfs3gStreamsList, nil); err == nil {
+		return NTFS3GStreamsWindows, nil
+	}
+
+	if _, err := unix.Getxattr(path, ntfs3gAttrib, nil); err == nil {
+		// also for streams_interface=none, for which xattrs are not supported
+		return NTFS3GStreamsXattr, nil
+	}
+
+	// other FUSE file system
+	return "", nil
+}
+
+// NTFS3GFS is a StreamFS for files in NTFS mounted with ntfs-3g, which uses
+// the streams interface configured for the mount of each file.
+type NTFS3GFS struct{}
+
+// ntfs3gBackend returns StreamFS for the streams interface of ntfs-3g mount
+// where the file is, or nil if the file is not in a ntfs-3g mount.
+func ntfs3gBackend(path string) (StreamFS, error) {
+	iface, err := NTFS3GStreamsInterface(path)
+	if err != nil {
+		return nil, err
+	}
+
+	switch iface {
+	case NTFS3GStreamsWindows:
+		return ntfs3gWindowsFS{}, nil
+	case NTFS3GStreamsXattr:
+		return XattrFS{Prefix: DefaultXattrPrefix}, nil
+	}
+
+	return nil, nil
+}
+
+func (NTFS3GFS) backend(path string) (StreamFS, error) {
+	fsys, err := ntfs3gBackend(path)
+	if err != nil {
+		return nil, err
+	} else if fsys == nil {
+		return nil, ErrUnsupported
+	}
+
+	return fsys, nil
+}
+
+func (n NTFS3GFS) ListStreams(path string) (map[string]int64, error) {
+	fsys, err := n.backend(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return fsys.ListStreams(path)
+}
+
+func (n NTFS3GFS) OpenStream(path, name string, flag int) (Stream, error) {
+	fsys, err := n.backend(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return fsys.OpenStream(path, name, flag)
+}
+
+func (n NTFS3GFS) RenameStream(path, oldName, newName string, overwrite bool) error {
+	fsys, err := n.backend(path)
+	if err != nil {
+		return err
+	}
+
+	return fsys.RenameStream(path, oldName, newName, overwrite)
+}
+
+func (n NTFS3GFS) RemoveStream(path, name string) error {
+	fsys, err := n.backend(path)
+	if err != nil {
+		return err
+	}
+
+	return fsys.RemoveStream(path, name)
+}
+
+// DetectFS is a StreamFS which uses NTFS3GFS for files in ntfs-3g mounts,
+// and Default for other files.
+type DetectFS struct {
+	Default StreamFS
+}
+
+func (d DetectFS) backend(path string) (StreamFS, error) {
+	fsys, err := ntfs3gBackend(path)
+	if err != nil {
+		return nil, err
+	} else if fsys == nil {
+		return d.Default, nil
+	}
+
+	return fsys, nil
+}
+
+func (d DetectFS) ListStreams(path string) (map[string]int64, error) {
+	fsys, err := d.backend(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return fsys.ListStreams(path)
+}
+
+func (d DetectFS) OpenStream(path, name string, flag int) (Stream, error) {
+	fsys, err := d.backend(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return fsys.OpenStream(path, name, flag)
+}
+
+func (d DetectFS) RenameStream(path, oldName, newName string, overwrite bool) error {
+	fsys, err := d.backend(path)
+	if err != nil {
+		return err
+	}
+
+	return fsys.RenameStream(path, oldName, newName, overwrite)
+}
+
+func (d DetectFS) RemoveStream(path, name string) error {
+	fsys, err := d.backend(path)
+	if err != nil {
+		return err
+	}
+
+	return fsys.RemoveStream(path, name)
+}
+
+// ntfs3gWindowsFS accesses streams in ntfs-3g mount with streams_interface=windows.
+type ntfs3gWindowsFS struct{}
+
+func (ntfs3gWindowsFS) ListStreams(path string) (map[string]int64, error) {
+	list, err := getxattr(path, ntfs3gStreamsList)
+	if err != nil {
+		return nil, xattrErr("getxattr", path, err)
+	}
+
+	streamInfoMap := make(map[string]int64)
+
+	// names are separated with NUL or newline depending on version of ntfs-3g
+	names := strings.FieldsFunc(string(list), func(r rune) bool {
+		return r == 0 || r == '\n'
+	})
+
+	for _, name := range names {
+		info, err := os.Stat(path + ":" + name)
+		if os.IsNotExist(err) {
+			// removed in between
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+
+		streamInfoMap[name] = info.Size()
+	}
+
+	return streamInfoMap, nil
+}
+
+func (ntfs3gWindowsFS) OpenStream(path, name string, flag int) (Stream, error) {
+	f, err := os.OpenFile(path+":"+name, flag, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	return f, nil
+}
+
+// RenameStream copies the stream into a new one and removes the old one,
+// as ntfs-3g cannot rename streams.
+func (n ntfs3gWindowsFS) RenameStream(path, oldName, newName string, overwrite bool) error {
+	return renameByCopy(n, path, oldName, newName, overwrite)
+}
+
+// tempStreamSeq makes names of temporary streams unique in the process.
+var tempStreamSeq atomic.Uint32
+
+// renameByCopy renames the stream by copying it into a new one and removing
+// the old one. An existing stream is replaced by copying the old one into a
+// temporary stream first, and is only removed after the copy succeeds. The
+// old stream is kept until it is copied into place, so if copying fails
+// after the existing stream is removed, content of the old one is not lost.
+func renameByCopy(fsys StreamFS, path, oldName, newName string, overwrite bool) error {
+	if oldName == newName {
+		return nil
+	}
+
+	linkErr := func(err error) error {
+		return &os.LinkError{Op: "rename", Old: path + ":" + oldName, New: path + ":" + newName, Err: err}
+	}
+
+	if !overwrite {
+		if err := copyStream(fsys, path, oldName, newName); err != nil {
+			return linkErr(err)
+		}
+
+		return fsys.RemoveStream(path, oldName)
+	}
+
+	tmpName := fmt.Sprintf("ntfs-ads.%d.%d.tmp", os.Getpid(), tempStreamSeq.Add(1))
+	if err := copyStream(fsys, path, oldName, tmpName); err != nil {
+		return linkErr(err)
+	}
+	defer fsys.RemoveStream(path, tmpName)
+
+	if err := fsys.RemoveStream(path, newName); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return linkErr(err)
+	}
+	if err := copyStream(fsys, path, tmpName, newName); err != nil {
+		return linkErr(err)
+	}
+
+	return fsys.RemoveStream(path, oldName)
+}
+
+// copyStream copies content of the stream into a new stream, which is
+// removed if copying fails.
+func copyStream(fsys StreamFS, path, srcName, dstName string) error {
+	src, err := fsys.OpenStream(path, srcName, os.O_RDONLY)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := fsys.OpenStream(path, dstName, os.O_WRONLY|os.O_CREATE|os.O_EXCL)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(dst, src)
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		fsys.RemoveStream(path, dstName)
+	}
+
+	return err
+}
+
+func (ntfs3gWindowsFS) RemoveStream(path, name string) error {
+	return os.Remove(path + ":" + name)
+}
@@ -0,0 +1,88 @@
+package ntfs_ads
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"testing"
+)
+
+var errWriteFailed = errors.New("write failed")
+
+// failFS is MemFS failing writes into streams matching fail after the first byte.
+type failFS struct {
+	*MemFS
+	fail func(name string) bool
+}
+
+func (f failFS) OpenStream(path, name string, flag int) (Stream, error) {
+	strm, err := f.MemFS.OpenStream(path, name, flag)
+	if err != nil || !f.fail(name) {
+		return strm, err
+	}
+
+	return &failStream{Stream: strm}, nil
+}
+
+type failStream struct {
+	Stream
+	written int
+}
+
+func (s *failStream) Write(b []byte) (int, error) {
+	if s.written+len(b) > 1 {
+		n, _ := s.Stream.Write(b[:1-s.written])
+		s.written += n
+		return n, errWriteFailed
+	}
+
+	n, err := s.Stream.Write(b)
+	s.written += n
+	return n, err
+}
+
+func TestRenameByCopy(t *testing.T) {
+	isTemp := func(name string) bool { return strings.HasPrefix(name, "ntfs-ads.") }
+	isTarget := func(name string) bool { return name == "b" }
+	never := func(string) bool { return false }
+
+	tests := []struct {
+		name      string
+		streams   map[string]string
+		overwrite bool
+		fail      func(name string) bool
+		wantErr   error
+		want      map[string]string
+	}{
+		{"rename", map[string]string{"a": "aaa"}, false, never, nil, map[string]string{"b": "aaa"}},
+		{"replace", map[string]string{"a": "aaa", "b": "bbbb"}, true, never, nil, map[string]string{"b": "aaa"}},
+		{"copy fails", map[string]string{"a": "aaa"}, false, isTarget, errWriteFailed, map[string]string{"a": "aaa"}},
+		{"existing target", map[string]string{"a": "aaa", "b": "bbbb"}, false, never, os.ErrExist, map[string]string{"a": "aaa", "b": "bbbb"}},
+		{"temporary copy fails", map[string]string{"a": "aaa", "b": "bbbb"}, true, isTemp, errWriteFailed, map[string]string{"a": "aaa", "b": "bbbb"}},
+		{"copy into place fails", map[string]string{"a": "aaa", "b": "bbbb"}, true, isTarget, errWriteFailed, map[string]string{"a": "aaa"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newTestFS(t, tt.streams)
+
+			err := renameByCopy(failFS{MemFS: m, fail: tt.fail}, "file.txt", "a", "b", tt.overwrite)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got error %v, want %v", err, tt.wantErr)
+			}
+
+			got, err := m.ListStreams("file.txt")
+			if err != nil && !errors.Is(err, ErrNoADS) {
+				t.Fatal(err)
+			}
+			if len(got) != len(tt.want) {
+				t.Errorf("got streams %v, want %v", got, tt.want)
+			}
+			for name, content := range tt.want {
+				if c := readStream(t, m, "file.txt", name); c != content {
+					t.Errorf("stream \"%s\": got %q, want %q", name, c, content)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,124 @@
+package ntfsimage
+
+import (
+	"encoding/binary"
+	"fmt"
+	"time"
+
+	"github.com/Snshadow/ntfs-ads/internal/winfmt"
+)
+
+// Namespaces of $FILE_NAME.
+const (
+	NamespacePOSIX    = 0
+	NamespaceWin32    = 1
+	NamespaceDOS      = 2
+	NamespaceWin32DOS = 3
+)
+
+// StandardInformation is value of $STANDARD_INFORMATION attribute.
+type StandardInformation struct {
+	Created        time.Time
+	Modified       time.Time
+	MFTModified    time.Time
+	Accessed       time.Time
+	FileAttributes uint32
+}
+
+// ParseStandardInformation parses value of $STANDARD_INFORMATION attribute.
+func ParseStandardInformation(b []byte) (*StandardInformation, error) {
+	if len(b) < 0x24 {
+		return nil, fmt.Errorf("%w: $STANDARD_INFORMATION too short", ErrInvalidAttr)
+	}
+
+	return &StandardInformation{
+		Created:        winfmt.FiletimeToTime(binary.LittleEndian.Uint64(b[0x00:])),
+		Modified:       winfmt.FiletimeToTime(binary.LittleEndian.Uint64(b[0x08:])),
+		MFTModified:    winfmt.FiletimeToTime(binary.LittleEndian.Uint64(b[0x10:])),
+		Accessed:       winfmt.FiletimeToTime(binary.LittleEndian.Uint64(b[0x18:])),
+		FileAttributes: binary.LittleEndian.Uint32(b[0x20:]),
+	}, nil
+}
+
+// FileName is value of $FILE_NAME attribute.
+type FileName struct {
+	Parent         FileReference
+	Created        time.Time
+	Modified       time.Time
+	MFTModified    time.Time
+	Accessed       time.Time
+	AllocatedSize  int64
+	RealSize       int64
+	FileAttributes uint32
+	Namespace      uint8
+	Name           string
+}
+
+// ParseFileName parses value of $FILE_NAME attribute.
+func ParseFileName(b []byte) (*FileName, error) {
+	if len(b) < 0x42 {
+		return nil, fmt.Errorf("%w: $FILE_NAME too short", ErrInvalidAttr)
+	}
+
+	nameLen := int(b[0x40])
+	if 0x42+nameLen*2 > len(b) {
+		return nil, fmt.Errorf("%w: name of $FILE_NAME out of range", ErrInvalidAttr)
+	}
+
+	return &FileName{
+		Parent:         FileReference(binary.LittleEndian.Uint64(b[0x00:])),
+		Created:        winfmt.FiletimeToTime(binary.LittleEndian.Uint64(b[0x08:])),
+		Modified:       winfmt.FiletimeToTime(binary.LittleEndian.Uint64(b[0x10:])),
+		MFTModified:    winfmt.FiletimeToTime(binary.LittleEndian.Uint64(b[0x18:])),
+		Accessed:       winfmt.FiletimeToTime(binary.LittleEndian.Uint64(b[0x20:])),
+		AllocatedSize:  int64(binary.LittleEndian.Uint64(b[0x28:])),
+		RealSize:       int64(binary.LittleEndian.Uint64(b[0x30:])),
+		FileAttributes: binary.LittleEndian.Uint32(b[0x38:]),
+		Namespace:      b[0x41],
+		Name:           winfmt.DecodeUTF16(b[0x42 : 0x42+nameLen*2]),
+	}, nil
+}
+
+// AttributeListEntry is an entry of $ATTRIBUTE_LIST, which tells the record holding the attribute.
+type AttributeListEntry struct {
+	Type      AttrType
+	Name      string
+	StartVCN  int64
+	Reference FileReference // record holding the attribute
+	ID        uint16
+}
+
+// parseAttributeList parses entries of $ATTRIBUTE_LIST attribute value.
+func parseAttributeList(b []byte) ([]AttributeListEntry, error) {
+	var entries []AttributeListEntry
+
+	for off := 0; off+0x1A <= len(b); {
+		length := int(binary.LittleEndian.Uint16(b[off+0x04:]))
+		if length < 0x1A || off+length > len(b) {
+			return entries, fmt.Errorf("%w: bad $ATTRIBUTE_LIST entry length %d", ErrInvalidAttr, length)
+		}
+
+		entry := b[off : off+length]
+
+		attrEntry := AttributeListEntry{
+			Type:      AttrType(binary.LittleEndian.Uint32(entry[0x00:])),
+			StartVCN:  int64(binary.LittleEndian.Uint64(entry[0x08:])),
+			Reference: FileReference(binary.LittleEndian.Uint64(entry[0x10:])),
+			ID:        binary.LittleEndian.Uint16(entry[0x18:]),
+		}
+
+		nameLen := int(entry[0x06])
+		nameOffset := int(entry[0x07])
+		if nameLen > 0 {
+			if nameOffset+nameLen*2 > len(entry) {
+				return entries, fmt.Errorf("%w: name of $ATTRIBUTE_LIST entry out of range", ErrInvalidAttr)
+			}
+			attrEntry.Name = winfmt.DecodeUTF16(entry[nameOffset : nameOffset+nameLen*2])
+		}
+
+		entries = append(entries, attrEntry)
+		off += length
+	}
+
+	return entries, nil
+}
@@ -0,0 +1,320 @@
+package ntfsimage
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"strings"
+	"sync"
+)
+
+var (
+	ErrEncrypted = errors.New("attribute is encrypted with EFS")
+)
+
+// maxCompressionUnitSize is size of compression units of NTFS, 16 clusters of
+// 4KiB, as compression is not supported for larger clusters.
+const maxCompressionUnitSize = 64 << 10
+
+// StreamReader reads value of a $DATA attribute, resident or non-resident.
+type StreamReader struct {
+	name string
+	size int64
+	r    io.ReaderAt
+}
+
+// Name returns name of the stream, empty for the unnamed data stream.
+func (s *StreamReader) Name() string {
+	return s.name
+}
+
+// Size returns size of the stream in bytes.
+func (s *StreamReader) Size() int64 {
+	return s.size
+}
+
+// ReadAt reads data of the stream at off.
+func (s *StreamReader) ReadAt(b []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, fmt.Errorf("ntfsimage: negative offset %d", off)
+	}
+
+	return s.r.ReadAt(b, off)
+}
+
+// OpenStream opens the data stream of the name from the file of the record,
+// empty name opens the unnamed data stream. Name is compared case-insensitively as in NTFS.
+func (v *Volume) OpenStream(num uint64, name string) (*StreamReader, error) {
+	rec, err := v.ReadRecord(num)
+	if err != nil {
+		return nil, err
+	}
+
+	attrs, err := v.Attributes(rec)
+	if err != nil {
+		return nil, err
+	}
+
+	return v.OpenAttribute(attrs, AttrData, name)
+}
+
+// OpenUsnJournal opens $J stream of the USN change journal in $Extend\$UsnJrnl,
+// which can be parsed with usn package.
+func (v *Volume) OpenUsnJournal() (*StreamReader, error) {
+	recNum, err := v.Lookup("/$Extend/$UsnJrnl")
+	if err != nil {
+		return nil, err
+	}
+
+	return v.OpenStream(recNum, "$J")
+}
+
+// OpenAttribute opens value of the attribute with type and name from the
+// attributes of a file, which may be in multiple extents.
+func (v *Volume) OpenAttribute(attrs []Attribute, typ AttrType, name string) (*StreamReader, error) {
+	var extents []Attribute
+	for _, attr := range attrs {
+		if attr.Type == typ && strings.EqualFold(attr.Name, name) {
+			extents = append(extents, attr)
+		}
+	}
+
+	if len(extents) == 0 {
+		return nil, &fs.PathError{Op: "open", Path: typ.String() + ":" + name, Err: fs.ErrNotExist}
+	}
+
+	first := extents[0]
+	for _, ext := range extents {
+		if ext.StartVCN == 0 {
+			first = ext
+			break
+		}
+	}
+
+	if !first.NonResident {
+		return &StreamReader{
+			name: first.Name,
+			size: int64(len(first.Value)),
+			r:    bytes.NewReader(first.Value),
+		}, nil
+	}
+
+	if first.Flags&AttrFlagEncrypted != 0 {
+		return nil, ErrEncrypted
+	}
+
+	runs, _, _ := mergeExtents(extents, typ, first.Name)
+
+	strm := &StreamReader{
+		name: first.Name,
+		size: first.RealSize,
+	}
+
+	if first.Flags&AttrFlagCompressed != 0 && first.CompressionUnit != 0 {
+		if first.CompressionUnit > 4 || int64(v.ClusterSize)<<first.CompressionUnit > maxCompressionUnitSize {
+			return nil, fmt.Errorf("%w: bad compression unit %d of %d bytes clusters", ErrInvalidAttr, first.CompressionUnit, v.ClusterSize)
+		}
+
+		strm.r = &compressedReader{
+			r:           v.r,
+			runs:        runs,
+			clusterSize: int64(v.ClusterSize),
+			unitSize:    int64(v.ClusterSize) << first.CompressionUnit,
+			size:        first.RealSize,
+			initSize:    first.InitializedSize,
+			lastUnit:    -1,
+		}
+	} else {
+		strm.r = &initReader{
+			r: &runReader{
+				r:           v.r,
+				runs:        runs,
+				clusterSize: int64(v.ClusterSize),
+				size:        first.InitializedSize,
+			},
+			size:     first.RealSize,
+			initSize: first.InitializedSize,
+		}
+	}
+
+	return strm, nil
+}
+
+// initReader reads zeros after the initialized size up to the real size.
+type initReader struct {
+	r        io.ReaderAt
+	size     int64
+	initSize int64
+}
+
+func (ir *initReader) ReadAt(b []byte, off int64) (int, error) {
+	if off >= ir.size {
+		return 0, io.EOF
+	}
+
+	want := b
+	if remain := ir.size - off; int64(len(want)) > remain {
+		want = want[:remain]
+	}
+
+	n := 0
+	if off < ir.initSize {
+		initPart := want
+		if remain := ir.initSize - off; int64(len(initPart)) > remain {
+			initPart = initPart[:remain]
+		}
+
+		var err error
+		n, err = ir.r.ReadAt(initPart, off)
+		if err != nil && err != io.EOF {
+			return n, err
+		}
+	}
+
+	for i := n; i < len(want); i++ {
+		want[i] = 0
+	}
+
+	if len(want) < len(b) {
+		return len(want), io.EOF
+	}
+
+	return len(b), nil
+}
+
+// compressedReader reads attribute compressed with LZNT1 in compression units.
+type compressedReader struct {
+	r           io.ReaderAt
+	runs        []Run
+	clusterSize int64
+	unitSize    int64
+	size        int64
+	initSize    int64
+
+	mut      sync.Mutex
+	lastUnit int64 // index of cached unit, -1 if none
+	unitBuf  []byte
+}
+
+// unitRuns returns runs covering clusters of the compression unit.
+func (cr *compressedReader) unitRuns(unit int64) (runs []Run, allocated int64) {
+	clustersPerUnit := cr.unitSize / cr.clusterSize
+	startVCN, endVCN := unit*clustersPerUnit, (unit+1)*clustersPerUnit
+
+	vcn := int64(0)
+	for _, run := range cr.runs {
+		runStart, runEnd := vcn, vcn+run.Length
+		vcn = runEnd
+
+		if runEnd <= startVCN || runStart >= endVCN {
+			continue
+		}
+
+		from, to := runStart, runEnd
+		if from < startVCN {
+			from = startVCN
+		}
+		if to > endVCN {
+			to = endVCN
+		}
+
+		part := Run{LCN: -1, Length: to - from}
+		if !run.Sparse() {
+			part.LCN = run.LCN + (from - runStart)
+			allocated += part.Length
+		}
+
+		runs = append(runs, part)
+	}
+
+	return runs, allocated
+}
+
+// readUnit reads and decompresses the compression unit into unitBuf.
+func (cr *compressedReader) readUnit(unit int64) error {
+	if cr.lastUnit == unit {
+		return nil
+	}
+
+	if cr.unitBuf == nil {
+		cr.unitBuf = make([]byte, cr.unitSize)
+	}
+
+	runs, allocated := cr.unitRuns(unit)
+	clustersPerUnit := cr.unitSize / cr.clusterSize
+
+	raw := &runReader{r: cr.r, runs: runs, clusterSize: cr.clusterSize, size: cr.unitSize}
+
+	switch {
+	case allocated == 0:
+		// sparse unit
+		for i := range cr.unitBuf {
+			cr.unitBuf[i] = 0
+		}
+	case allocated == clustersPerUnit:
+		// unit stored without compression
+		if _, err := raw.ReadAt(cr.unitBuf, 0); err != nil && err != io.EOF {
+			return err
+		}
+	default:
+		compressed := make([]byte, allocated*cr.clusterSize)
+		raw.size = int64(len(compressed))
+		if _, err := raw.ReadAt(compressed, 0); err != nil && err != io.EOF {
+			return err
+		}
+
+		if err := decompressLZNT1(cr.unitBuf, compressed); err != nil {
+			cr.lastUnit = -1
+			return fmt.Errorf("compression unit %d: %w", unit, err)
+		}
+	}
+
+	cr.lastUnit = unit
+
+	return nil
+}
+
+func (cr *compressedReader) ReadAt(b []byte, off int64) (int, error) {
+	cr.mut.Lock()
+	defer cr.mut.Unlock()
+
+	if off >= cr.size {
+		return 0, io.EOF
+	}
+
+	want := b
+	if remain := cr.size - off; int64(len(want)) > remain {
+		want = want[:remain]
+	}
+
+	for n := 0; n < len(want); {
+		pos := off + int64(n)
+
+		if pos >= cr.initSize {
+			for i := n; i < len(want); i++ {
+				want[i] = 0
+			}
+			break
+		}
+
+		unit := pos / cr.unitSize
+		if err := cr.readUnit(unit); err != nil {
+			return n, err
+		}
+
+		end := len(want)
+		if limit := cr.initSize - off; int64(end) > limit {
+			end = int(limit)
+		}
+
+		n += copy(want[n:end], cr.unitBuf[pos-unit*cr.unitSize:])
+	}
+
+	if len(want) < len(b) {
+		return len(want), io.EOF
+	}
+
+	return len(b), nil
+}
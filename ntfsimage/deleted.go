@@ -0,0 +1,172 @@
+package ntfsimage
+
+import (
+	"fmt"
+	"io"
+)
+
+const (
+	mftRecordBitmap = 6 // $Bitmap, allocation status of clusters
+)
+
+// Recoverability tells whether data of a deleted stream can still be recovered.
+type Recoverability int
+
+const (
+	RecoverResident    Recoverability = iota // data is stored in the MFT record
+	RecoverUnallocated                       // all clusters are still unallocated
+	RecoverPartial                           // some clusters were allocated again
+	RecoverOverwritten                       // all clusters were allocated again
+)
+
+func (r Recoverability) String() string {
+	switch r {
+	case RecoverResident:
+		return "resident"
+	case RecoverUnallocated:
+		return "unallocated"
+	case RecoverPartial:
+		return "partially overwritten"
+	case RecoverOverwritten:
+		return "overwritten"
+	}
+
+	return fmt.Sprintf("Recoverability(%d)", int(r))
+}
+
+// loadBitmap reads $Bitmap of the volume, which is cached after the first call.
+func (v *Volume) loadBitmap() ([]byte, error) {
+	if v.bitmap != nil {
+		return v.bitmap, nil
+	}
+
+	strm, err := v.OpenStream(mftRecordBitmap, "")
+	if err != nil {
+		return nil, fmt.Errorf("could not open $Bitmap: %w", err)
+	}
+
+	// a bit for each cluster, rounded up to 8 bytes
+	clusters := v.volumeSize() / int64(v.ClusterSize)
+	if size := strm.Size(); size > (clusters+63)/64*8 {
+		return nil, fmt.Errorf("%w: $Bitmap of %d bytes exceeds %d clusters", ErrInvalidAttr, size, clusters)
+	}
+
+	bitmap := make([]byte, strm.Size())
+	if _, err = strm.ReadAt(bitmap, 0); err != nil && err != io.EOF {
+		return nil, fmt.Errorf("could not read $Bitmap: %w", err)
+	}
+
+	v.bitmap = bitmap
+
+	return bitmap, nil
+}
+
+// ClusterAllocated reports whether the cluster is in use according to $Bitmap.
+func (v *Volume) ClusterAllocated(lcn int64) (bool, error) {
+	bitmap, err := v.loadBitmap()
+	if err != nil {
+		return false, err
+	}
+
+	if lcn < 0 || lcn/8 >= int64(len(bitmap)) {
+		return false, fmt.Errorf("cluster %d out of range of $Bitmap", lcn)
+	}
+
+	return bitmap[lcn/8]&(1<<(lcn%8)) != 0, nil
+}
+
+// recoverability checks allocation status of clusters of the stream.
+func (v *Volume) recoverability(attrs []Attribute, name string) (Recoverability, error) {
+	runs, _, found := mergeExtents(attrs, AttrData, name)
+	if !found && len(runs) == 0 {
+		return RecoverResident, nil
+	}
+
+	var total, allocated int64
+
+	for _, run := range runs {
+		if run.Sparse() {
+			continue
+		}
+
+		for lcn := run.LCN; lcn < run.LCN+run.Length; lcn++ {
+			inUse, err := v.ClusterAllocated(lcn)
+			if err != nil {
+				return 0, err
+			}
+
+			total++
+			if inUse {
+				allocated++
+			}
+		}
+	}
+
+	switch {
+	case allocated == 0:
+		return RecoverUnallocated, nil
+	case allocated < total:
+		return RecoverPartial, nil
+	}
+
+	return RecoverOverwritten, nil
+}
+
+// WalkDeletedStreams calls fn for every deleted file, whose record is not in
+// use, which still has named data streams in its record. Recovery of returned
+// FileStreams tells whether clusters of each stream are still unallocated.
+func (v *Volume) WalkDeletedStreams(fn func(*FileStreams) error) error {
+	count := v.RecordCount()
+
+	for num := uint64(0); num < count; num++ {
+		rec, err := v.ReadRecord(num)
+		if err != nil {
+			continue
+		}
+
+		if rec.InUse() || rec.BaseReference != 0 {
+			continue
+		}
+
+		attrs, err := v.Attributes(rec)
+		if err != nil {
+			continue
+		}
+
+		streamInfoMap := namedStreams(attrs)
+		if len(streamInfoMap) == 0 {
+			continue
+		}
+
+		path, err := v.Path(num)
+		if err != nil {
+			path = "/" + orphanDir + fmt.Sprintf("/record-%d", num)
+		}
+
+		strms := &FileStreams{
+			Record:        num,
+			Sequence:      rec.Sequence,
+			Path:          path,
+			IsDir:         rec.IsDir(),
+			Deleted:       true,
+			StreamInfoMap: streamInfoMap,
+			Recovery:      make(map[string]Recoverability, len(streamInfoMap)),
+		}
+		strms.setFileInfo(attrs)
+
+		for name := range streamInfoMap {
+			recovery, err := v.recoverability(attrs, name)
+			if err != nil {
+				return err
+			}
+
+			strms.Recovery[name] = recovery
+		}
+
+		if err = fn(strms); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,525 @@
+package ntfsimage
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+)
+
+const (
+	mftRecordLogFile = 2 // $LogFile
+
+	logRecordHeaderSize = 0x30 // header of log record before client data
+	logClientRecord     = 1    // record type of client log record
+	maxLogRecordSize    = 1 << 20
+	maxLogPageSize      = 64 << 10 // limit of system and log page sizes
+)
+
+var (
+	ErrInvalidLog = errors.New("invalid $LogFile")
+)
+
+// LogOperation is redo or undo operation of NTFS log record.
+type LogOperation uint16
+
+const (
+	LogNoop                        LogOperation = 0x00
+	LogCompensationLogRecord       LogOperation = 0x01
+	LogInitializeFileRecordSegment LogOperation = 0x02
+	LogDeallocateFileRecordSegment LogOperation = 0x03
+	LogWriteEndOfFileRecordSegment LogOperation = 0x04
+	LogCreateAttribute             LogOperation = 0x05
+	LogDeleteAttribute             LogOperation = 0x06
+	LogUpdateResidentValue         LogOperation = 0x07
+	LogUpdateNonresidentValue      LogOperation = 0x08
+	LogUpdateMappingPairs          LogOperation = 0x09
+	LogDeleteDirtyClusters         LogOperation = 0x0A
+	LogSetNewAttributeSizes        LogOperation = 0x0B
+)
+
+var logOperationNames = map[LogOperation]string{
+	LogNoop:                        "Noop",
+	LogCompensationLogRecord:       "CompensationLogRecord",
+	LogInitializeFileRecordSegment: "InitializeFileRecordSegment",
+	LogDeallocateFileRecordSegment: "DeallocateFileRecordSegment",
+	LogWriteEndOfFileRecordSegment: "WriteEndOfFileRecordSegment",
+	LogCreateAttribute:             "CreateAttribute",
+	LogDeleteAttribute:             "DeleteAttribute",
+	LogUpdateResidentValue:         "UpdateResidentValue",
+	LogUpdateNonresidentValue:      "UpdateNonresidentValue",
+	LogUpdateMappingPairs:          "UpdateMappingPairs",
+	LogDeleteDirtyClusters:         "DeleteDirtyClusters",
+	LogSetNewAttributeSizes:        "SetNewAttributeSizes",
+}
+
+func (op LogOperation) String() string {
+	if name, ok := logOperationNames[op]; ok {
+		return name
+	}
+
+	return fmt.Sprintf("LogOperation(0x%X)", uint16(op))
+}
+
+// LogRecord is a client log record of $LogFile.
+type LogRecord struct {
+	LSN         uint64
+	PreviousLSN uint64
+	UndoNextLSN uint64
+	Transaction uint32
+
+	Redo     LogOperation
+	Undo     LogOperation
+	RedoData []byte
+	UndoData []byte
+
+	TargetAttribute    uint16 // index in open attribute table
+	RecordOffset       uint16 // offset of the attribute in MFT record
+	AttributeOffset    uint16 // offset in the attribute
+	ClusterBlockOffset uint16 // offset in the cluster in 512 bytes
+	TargetVCN          int64
+	LCNs               []int64
+}
+
+// LogFile reads log records from $LogFile.
+type LogFile struct {
+	SystemPageSize uint32
+	LogPageSize    uint32
+	CurrentLSN     uint64
+	MajorVersion   int16
+	MinorVersion   int16
+
+	r           io.ReaderAt
+	seqBits     uint32
+	dataOffset  int // offset of log records in a log page
+	logFileSize int64
+}
+
+// OpenLogFile opens $LogFile of the volume.
+func (v *Volume) OpenLogFile() (*LogFile, error) {
+	strm, err := v.OpenStream(mftRecordLogFile, "")
+	if err != nil {
+		return nil, fmt.Errorf("could not open $LogFile: %w", err)
+	}
+
+	return ParseLogFile(strm, strm.Size())
+}
+
+// ParseLogFile reads restart area of $LogFile with the size, which may be
+// copied from a volume.
+func ParseLogFile(r io.ReaderAt, size int64) (*LogFile, error) {
+	// second copy of restart page is at the system page size
+	first, err := parseRestartPage(r, size, 0)
+	secondOffset := int64(4096)
+	if err == nil {
+		secondOffset = int64(first.SystemPageSize)
+	}
+
+	second, err := parseRestartPage(r, size, secondOffset)
+	if err == nil && (first == nil || second.CurrentLSN > first.CurrentLSN) {
+		return second, nil
+	}
+
+	if first == nil {
+		return nil, fmt.Errorf("%w: no valid restart page", ErrInvalidLog)
+	}
+
+	return first, nil
+}
+
+func parseRestartPage(r io.ReaderAt, size, off int64) (*LogFile, error) {
+	header := make([]byte, 0x1E)
+	if _, err := r.ReadAt(header, off); err != nil {
+		return nil, err
+	}
+
+	if sig := string(header[:4]); sig != "RSTR" && sig != "CHKD" {
+		return nil, fmt.Errorf("%w: bad restart page signature", ErrInvalidLog)
+	}
+
+	lf := &LogFile{
+		SystemPageSize: binary.LittleEndian.Uint32(header[0x10:]),
+		LogPageSize:    binary.LittleEndian.Uint32(header[0x14:]),
+		MinorVersion:   int16(binary.LittleEndian.Uint16(header[0x1A:])),
+		MajorVersion:   int16(binary.LittleEndian.Uint16(header[0x1C:])),
+		r:              r,
+	}
+
+	if lf.SystemPageSize < 512 || lf.SystemPageSize&(lf.SystemPageSize-1) != 0 || lf.SystemPageSize > maxLogPageSize ||
+		lf.LogPageSize < 512 || lf.LogPageSize&(lf.LogPageSize-1) != 0 || lf.LogPageSize > maxLogPageSize {
+		return nil, fmt.Errorf("%w: bad page size", ErrInvalidLog)
+	}
+
+	page := make([]byte, lf.SystemPageSize)
+	if _, err := r.ReadAt(page, off); err != nil {
+		return nil, err
+	}
+	if err := applyFixups(page); err != nil {
+		return nil, err
+	}
+
+	areaOffset := int(binary.LittleEndian.Uint16(page[0x18:]))
+	if areaOffset+0x30 > len(page) {
+		return nil, fmt.Errorf("%w: restart area out of range", ErrInvalidLog)
+	}
+	area := page[areaOffset:]
+
+	lf.CurrentLSN = binary.LittleEndian.Uint64(area[0x00:])
+	lf.seqBits = binary.LittleEndian.Uint32(area[0x10:])
+	lf.logFileSize = int64(binary.LittleEndian.Uint64(area[0x18:]))
+	lf.dataOffset = int(binary.LittleEndian.Uint16(area[0x26:]))
+
+	if lf.seqBits < 3 || lf.seqBits > 60 || lf.dataOffset < 0x28 || lf.dataOffset >= int(lf.LogPageSize) {
+		return nil, fmt.Errorf("%w: bad restart area", ErrInvalidLog)
+	}
+	if lf.logFileSize <= 0 || lf.logFileSize > size {
+		lf.logFileSize = size
+	}
+
+	return lf, nil
+}
+
+// lsnOffset returns offset in $LogFile where the record of the LSN is.
+func (lf *LogFile) lsnOffset(lsn uint64) int64 {
+	return int64(lsn<<lf.seqBits>>lf.seqBits) << 3
+}
+
+// readPage reads log record page at off with fixups applied.
+func (lf *LogFile) readPage(off int64) ([]byte, error) {
+	page := make([]byte, lf.LogPageSize)
+	if _, err := lf.r.ReadAt(page, off); err != nil && err != io.EOF {
+		return nil, err
+	}
+
+	if string(page[:4]) != "RCRD" {
+		return nil, fmt.Errorf("%w: bad log page signature at %d", ErrInvalidLog, off)
+	}
+
+	if err := applyFixups(page); err != nil {
+		return nil, err
+	}
+
+	return page, nil
+}
+
+// readRecordData reads length bytes of log record at pos of the page at off,
+// following data of next pages if the record spans pages.
+func (lf *LogFile) readRecordData(page []byte, off int64, pos, length int) ([]byte, error) {
+	data := make([]byte, 0, length)
+
+	for {
+		n := len(page) - pos
+		if n > length-len(data) {
+			n = length - len(data)
+		}
+		data = append(data, page[pos:pos+n]...)
+
+		if len(data) == length {
+			return data, nil
+		}
+
+		off += int64(lf.LogPageSize)
+		if off+int64(lf.LogPageSize) > lf.logFileSize {
+			return nil, fmt.Errorf("%w: log record wraps around end of $LogFile", ErrInvalidLog)
+		}
+
+		var err error
+		if page, err = lf.readPage(off); err != nil {
+			return nil, err
+		}
+		pos = lf.dataOffset
+	}
+}
+
+// parseLogRecord parses client log record from the bytes of its header and client data.
+func parseLogRecord(b []byte) (*LogRecord, error) {
+	client := b[logRecordHeaderSize:]
+	if len(client) < 0x20 {
+		return nil, fmt.Errorf("%w: client data too short", ErrInvalidLog)
+	}
+
+	rec := &LogRecord{
+		LSN:                binary.LittleEndian.Uint64(b[0x00:]),
+		PreviousLSN:        binary.LittleEndian.Uint64(b[0x08:]),
+		UndoNextLSN:        binary.LittleEndian.Uint64(b[0x10:]),
+		Transaction:        binary.LittleEndian.Uint32(b[0x24:]),
+		Redo:               LogOperation(binary.LittleEndian.Uint16(client[0x00:])),
+		Undo:               LogOperation(binary.LittleEndian.Uint16(client[0x02:])),
+		TargetAttribute:    binary.LittleEndian.Uint16(client[0x0C:]),
+		RecordOffset:       binary.LittleEndian.Uint16(client[0x10:]),
+		AttributeOffset:    binary.LittleEndian.Uint16(client[0x12:]),
+		ClusterBlockOffset: binary.LittleEndian.Uint16(client[0x14:]),
+		TargetVCN:          int64(binary.LittleEndian.Uint64(client[0x18:])),
+	}
+
+	redoOffset := int(binary.LittleEndian.Uint16(client[0x04:]))
+	redoLen := int(binary.LittleEndian.Uint16(client[0x06:]))
+	undoOffset := int(binary.LittleEndian.Uint16(client[0x08:]))
+	undoLen := int(binary.LittleEndian.Uint16(client[0x0A:]))
+	lcnCount := int(binary.LittleEndian.Uint16(client[0x0E:]))
+
+	if redoOffset+redoLen > len(client) || undoOffset+undoLen > len(client) || 0x20+lcnCount*8 > len(client) {
+		return nil, fmt.Errorf("%w: data of log record %d out of range", ErrInvalidLog, rec.LSN)
+	}
+
+	rec.RedoData = client[redoOffset : redoOffset+redoLen]
+	rec.UndoData = client[undoOffset : undoOffset+undoLen]
+	for i := 0; i < lcnCount; i++ {
+		rec.LCNs = append(rec.LCNs, int64(binary.LittleEndian.Uint64(client[0x20+i*8:])))
+	}
+
+	return rec, nil
+}
+
+// WalkRecords calls fn for every client log record found in log pages, in
+// order of pages in $LogFile. Records of pages which could not be read are
+// skipped, and the same record may be found more than once in copies of pages.
+func (lf *LogFile) WalkRecords(fn func(*LogRecord) error) error {
+	pageSize := int64(lf.LogPageSize)
+
+	for off := 2 * int64(lf.SystemPageSize); off+pageSize <= lf.logFileSize; off += pageSize {
+		page, err := lf.readPage(off)
+		if err != nil {
+			continue
+		}
+
+		for pos := lf.dataOffset; pos+logRecordHeaderSize <= len(page); pos += 8 {
+			lsn := binary.LittleEndian.Uint64(page[pos:])
+
+			// a record header has LSN pointing itself
+			if lsn == 0 || lf.lsnOffset(lsn) != off+int64(pos) {
+				continue
+			}
+
+			recType := binary.LittleEndian.Uint32(page[pos+0x20:])
+			length := logRecordHeaderSize + int(binary.LittleEndian.Uint32(page[pos+0x18:]))
+			if recType != logClientRecord || length > maxLogRecordSize {
+				continue
+			}
+
+			b, err := lf.readRecordData(page, off, pos, length)
+			if err != nil {
+				continue
+			}
+
+			rec, err := parseLogRecord(b)
+			if err != nil {
+				continue
+			}
+
+			if err = fn(rec); err != nil {
+				return err
+			}
+
+			if end := pos + (length+7)&^7; end <= len(page) {
+				pos = end - 8
+			}
+		}
+	}
+
+	return nil
+}
+
+// StreamEvent is an operation of $LogFile on a named $DATA attribute.
+type StreamEvent struct {
+	LSN         uint64
+	Transaction uint32
+	Record      uint64       // MFT record number of the file, or of the extension record
+	Operation   LogOperation // LogCreateAttribute, LogDeleteAttribute or LogUpdateResidentValue
+	Name        string       // name of the stream
+	Resident    bool
+	Size        int64  // size of the stream created or deleted, or bytes written by update
+	Offset      int64  // offset in the stream written by update
+	Data        []byte // value of resident stream created or deleted, or bytes written by update
+}
+
+// loggedAttr is an attribute at an offset of MFT record known from the log.
+type loggedAttr struct {
+	offset      int
+	length      int
+	typ         AttrType
+	name        string
+	valueOffset int
+}
+
+// attributeAt returns attribute at the offset of MFT record in the volume.
+func (v *Volume) attributeAt(num uint64, offset int) (*loggedAttr, error) {
+	buf, err := v.readRecordRaw(num)
+	if err != nil {
+		return nil, err
+	}
+
+	if string(buf[:4]) != "FILE" {
+		return nil, fmt.Errorf("%w: bad signature of record %d", ErrInvalidRecord, num)
+	}
+	if err = applyFixups(buf); err != nil {
+		return nil, err
+	}
+
+	for off := int(binary.LittleEndian.Uint16(buf[0x14:])); off+0x18 <= len(buf) && off <= offset; {
+		if binary.LittleEndian.Uint32(buf[off:]) == attrEnd {
+			break
+		}
+
+		length := int(binary.LittleEndian.Uint32(buf[off+4:]))
+		if length < 0x18 || off+length > len(buf) {
+			break
+		}
+
+		if off == offset {
+			return newLoggedAttr(buf[off:off+length], off)
+		}
+
+		off += length
+	}
+
+	return nil, fmt.Errorf("%w: no attribute at offset %d of record %d", ErrInvalidAttr, offset, num)
+}
+
+func newLoggedAttr(b []byte, offset int) (*loggedAttr, error) {
+	if len(b) < 0x18 {
+		return nil, fmt.Errorf("%w: logged attribute too short", ErrInvalidAttr)
+	}
+
+	attr, err := parseAttribute(b)
+	if err != nil {
+		return nil, err
+	}
+
+	la := &loggedAttr{
+		offset: offset,
+		length: int(binary.LittleEndian.Uint32(b[0x04:])),
+		typ:    attr.Type,
+		name:   attr.Name,
+	}
+	if !attr.NonResident {
+		la.valueOffset = int(binary.LittleEndian.Uint16(b[0x14:]))
+	}
+
+	return la, nil
+}
+
+// StreamHistory reads operations on named $DATA attributes from $LogFile,
+// returning events of each MFT record in order of LSN. $LogFile does not
+// have time of operations, and only the latest changes not yet overwritten
+// in the circular log are found.
+func (v *Volume) StreamHistory() (map[uint64][]StreamEvent, error) {
+	lf, err := v.OpenLogFile()
+	if err != nil {
+		return nil, err
+	}
+
+	// the same record may be in copies of pages
+	records := make(map[uint64]*LogRecord)
+	err = lf.WalkRecords(func(rec *LogRecord) error {
+		switch rec.Redo {
+		case LogCreateAttribute, LogDeleteAttribute, LogUpdateResidentValue:
+			records[rec.LSN] = rec
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	lsns := make([]uint64, 0, len(records))
+	for lsn := range records {
+		lsns = append(lsns, lsn)
+	}
+	sort.Slice(lsns, func(i, j int) bool { return lsns[i] < lsns[j] })
+
+	// attributes of records from the log, as offsets change when attributes are created or deleted
+	layouts := make(map[uint64][]*loggedAttr)
+	history := make(map[uint64][]StreamEvent)
+
+	for _, lsn := range lsns {
+		rec := records[lsn]
+
+		mftOffset := rec.TargetVCN*int64(v.ClusterSize) + int64(rec.ClusterBlockOffset)*512
+		num := uint64(mftOffset / int64(v.RecordSize))
+		recOffset := int(rec.RecordOffset)
+
+		var attrData []byte
+		switch rec.Redo {
+		case LogCreateAttribute:
+			attrData = rec.RedoData
+		case LogDeleteAttribute:
+			attrData = rec.UndoData
+		}
+
+		var la *loggedAttr
+		if attrData != nil {
+			if la, err = newLoggedAttr(attrData, recOffset); err != nil {
+				continue
+			}
+			layouts[num] = updateLayout(layouts[num], rec.Redo, la)
+		} else {
+			for _, known := range layouts[num] {
+				if known.offset == recOffset {
+					la = known
+					break
+				}
+			}
+
+			if la == nil {
+				if la, err = v.attributeAt(num, recOffset); err != nil {
+					continue
+				}
+			}
+		}
+
+		if la.typ != AttrData || la.name == "" {
+			continue
+		}
+
+		event := StreamEvent{
+			LSN:         rec.LSN,
+			Transaction: rec.Transaction,
+			Record:      num,
+			Operation:   rec.Redo,
+			Name:        la.name,
+		}
+
+		if attrData != nil {
+			attr, _ := parseAttribute(attrData)
+			event.Resident = !attr.NonResident
+			event.Size = attr.Size()
+			event.Data = attr.Value
+		} else {
+			event.Resident = true
+			event.Offset = int64(rec.AttributeOffset) - int64(la.valueOffset)
+			event.Size = int64(len(rec.RedoData))
+			event.Data = rec.RedoData
+		}
+
+		history[num] = append(history[num], event)
+	}
+
+	return history, nil
+}
+
+// updateLayout records created or deleted attribute, moving the attributes after it.
+func updateLayout(layout []*loggedAttr, op LogOperation, la *loggedAttr) []*loggedAttr {
+	updated := layout[:0]
+
+	for _, known := range layout {
+		switch {
+		case op == LogCreateAttribute && known.offset >= la.offset:
+			known.offset += la.length
+		case op == LogDeleteAttribute && known.offset == la.offset:
+			continue
+		case op == LogDeleteAttribute && known.offset > la.offset:
+			known.offset -= la.length
+		}
+
+		updated = append(updated, known)
+	}
+
+	if op == LogCreateAttribute {
+		updated = append(updated, la)
+	}
+
+	return updated
+}
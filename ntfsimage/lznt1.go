@@ -0,0 +1,110 @@
+package ntfsimage
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+const (
+	lznt1ChunkSize = 4096 // uncompressed size of a chunk
+
+	lznt1Compressed = 0x8000 // chunk header flag for compressed chunk
+	lznt1SizeMask   = 0x0FFF // chunk header bits for size of chunk data minus 1
+)
+
+var errLZNT1 = errors.New("corrupted LZNT1 data")
+
+// decompressLZNT1 decompresses LZNT1 chunks from src into dst, which is the
+// whole uncompressed compression unit. Chunks shorter than 4096 bytes are
+// followed with zeros, as NTFS does not store trailing zeros of a chunk.
+func decompressLZNT1(dst, src []byte) error {
+	out := 0
+
+	for in := 0; in+2 <= len(src) && out < len(dst); {
+		header := binary.LittleEndian.Uint16(src[in:])
+		if header == 0 {
+			// end of compressed data
+			break
+		}
+
+		chunkLen := int(header&lznt1SizeMask) + 1
+		in += 2
+		if in+chunkLen > len(src) {
+			return errLZNT1
+		}
+
+		chunk := src[in : in+chunkLen]
+		in += chunkLen
+
+		end := out + lznt1ChunkSize
+		if end > len(dst) {
+			end = len(dst)
+		}
+
+		if header&lznt1Compressed == 0 {
+			copy(dst[out:end], chunk)
+		} else if err := decompressLZNT1Chunk(dst[out:end], chunk); err != nil {
+			return err
+		}
+
+		out = end
+	}
+
+	// rest of the unit is zero
+	for i := out; i < len(dst); i++ {
+		dst[i] = 0
+	}
+
+	return nil
+}
+
+// decompressLZNT1Chunk decompresses a compressed chunk, zero filling rest of dst.
+func decompressLZNT1Chunk(dst, chunk []byte) error {
+	out := 0
+
+	for in := 0; in < len(chunk) && out < len(dst); {
+		flags := chunk[in]
+		in++
+
+		for bit := 0; bit < 8 && in < len(chunk) && out < len(dst); bit++ {
+			if flags&(1<<bit) == 0 {
+				// literal byte
+				dst[out] = chunk[in]
+				out++
+				in++
+				continue
+			}
+
+			if in+2 > len(chunk) {
+				return errLZNT1
+			}
+
+			token := int(binary.LittleEndian.Uint16(chunk[in:]))
+			in += 2
+
+			// bits for offset grow with the position in the chunk
+			lenBits := 12
+			for pos := out - 1; pos >= 0x10; pos >>= 1 {
+				lenBits--
+			}
+
+			back := token>>lenBits + 1
+			length := token&(1<<lenBits-1) + 3
+
+			if back > out {
+				return errLZNT1
+			}
+
+			for i := 0; i < length && out < len(dst); i++ {
+				dst[out] = dst[out-back]
+				out++
+			}
+		}
+	}
+
+	for i := out; i < len(dst); i++ {
+		dst[i] = 0
+	}
+
+	return nil
+}
@@ -0,0 +1,430 @@
+package ntfsimage
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"reflect"
+	"testing"
+	"unicode/utf16"
+)
+
+const (
+	testRecordSize = 1024
+	testUSN        = 0x0007
+)
+
+func utf16le(s string) []byte {
+	var b []byte
+	for _, c := range utf16.Encode([]rune(s)) {
+		b = binary.LittleEndian.AppendUint16(b, c)
+	}
+
+	return b
+}
+
+func align8(n int) int {
+	return (n + 7) &^ 7
+}
+
+func residentAttr(typ AttrType, name string, value []byte) []byte {
+	nameBytes := utf16le(name)
+	valueOffset := align8(0x18 + len(nameBytes))
+
+	b := make([]byte, align8(valueOffset+len(value)))
+	binary.LittleEndian.PutUint32(b[0x00:], uint32(typ))
+	binary.LittleEndian.PutUint32(b[0x04:], uint32(len(b)))
+	b[0x09] = byte(len(name))
+	binary.LittleEndian.PutUint16(b[0x0A:], 0x18)
+	binary.LittleEndian.PutUint32(b[0x10:], uint32(len(value)))
+	binary.LittleEndian.PutUint16(b[0x14:], uint16(valueOffset))
+	copy(b[0x18:], nameBytes)
+	copy(b[valueOffset:], value)
+
+	return b
+}
+
+func nonResidentAttr(typ AttrType, name string, runs []byte, size int64) []byte {
+	nameBytes := utf16le(name)
+	runsOffset := align8(0x40 + len(nameBytes))
+
+	// mapping pairs end with a zero byte
+	b := make([]byte, align8(runsOffset+len(runs)+1))
+	binary.LittleEndian.PutUint32(b[0x00:], uint32(typ))
+	binary.LittleEndian.PutUint32(b[0x04:], uint32(len(b)))
+	b[0x08] = 1
+	b[0x09] = byte(len(name))
+	binary.LittleEndian.PutUint16(b[0x0A:], 0x40)
+	binary.LittleEndian.PutUint16(b[0x20:], uint16(runsOffset))
+	for _, off := range []int{0x28, 0x30, 0x38} {
+		binary.LittleEndian.PutUint64(b[off:], uint64(size))
+	}
+	copy(b[0x40:], nameBytes)
+	copy(b[runsOffset:], runs)
+
+	return b
+}
+
+// record returns a MFT record in use with attributes, whose last 2 bytes of
+// each 512 bytes are replaced with the update sequence number.
+func record(attrs ...[]byte) []byte {
+	b := make([]byte, testRecordSize)
+	copy(b, "FILE")
+	binary.LittleEndian.PutUint16(b[0x04:], 0x30) // update sequence array
+	binary.LittleEndian.PutUint16(b[0x06:], 1+testRecordSize/fixupStride)
+	binary.LittleEndian.PutUint16(b[0x10:], 1) // sequence
+	binary.LittleEndian.PutUint16(b[0x12:], 1) // link count
+	binary.LittleEndian.PutUint16(b[0x14:], 0x38)
+	binary.LittleEndian.PutUint16(b[0x16:], RecordInUse)
+
+	off := 0x38
+	for _, attr := range attrs {
+		off += copy(b[off:], attr)
+	}
+	binary.LittleEndian.PutUint32(b[off:], attrEnd)
+	binary.LittleEndian.PutUint32(b[0x18:], uint32(off+8))
+	binary.LittleEndian.PutUint32(b[0x1C:], testRecordSize)
+
+	binary.LittleEndian.PutUint16(b[0x30:], testUSN)
+	for i := 1; i <= testRecordSize/fixupStride; i++ {
+		end := i*fixupStride - 2
+		copy(b[0x30+i*2:], b[end:end+2])
+		binary.LittleEndian.PutUint16(b[end:], testUSN)
+	}
+
+	return b
+}
+
+// pattern returns n bytes of non-zero content.
+func pattern(n int) []byte {
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = byte(i%251) + 1
+	}
+
+	return b
+}
+
+func TestParseRecord(t *testing.T) {
+	// value spans the end of the first 512 bytes restored by fixup
+	spanning := pattern(600)
+
+	rec, err := parseRecord(record(
+		residentAttr(AttrData, "", spanning),
+		residentAttr(AttrData, "Zone.Identifier", []byte("[ZoneTransfer]")),
+		nonResidentAttr(AttrData, "big", []byte{0x21, 0x10, 0x00, 0x01, 0x01, 0x08, 0x11, 0x04, 0xF0}, 28*512),
+	), 42)
+	if err != nil {
+		t.Fatalf("parseRecord: %v", err)
+	}
+
+	if rec.Number != 42 || !rec.InUse() || rec.IsDir() || rec.Sequence != 1 || len(rec.Attributes) != 3 {
+		t.Fatalf("got %+v", rec)
+	}
+
+	if !bytes.Equal(rec.Attributes[0].Value, spanning) {
+		t.Errorf("value across fixup differs")
+	}
+	if got := rec.Attributes[1]; got.Name != "Zone.Identifier" || string(got.Value) != "[ZoneTransfer]" {
+		t.Errorf("got named attribute %q of %q", got.Name, got.Value)
+	}
+
+	big := rec.Attributes[2]
+	// sparse run between runs, and the last run before the first one
+	wantRuns := []Run{{LCN: 256, Length: 16}, {LCN: -1, Length: 8}, {LCN: 240, Length: 4}}
+	if big.Name != "big" || !big.NonResident || big.Size() != 28*512 || !reflect.DeepEqual(big.Runs, wantRuns) {
+		t.Errorf("got %+v, want runs %v", big, wantRuns)
+	}
+}
+
+func TestParseRecordInvalid(t *testing.T) {
+	valid := func() []byte {
+		return record(residentAttr(AttrData, "", []byte("data")))
+	}
+
+	tests := []struct {
+		name string
+		buf  func() []byte
+		want error
+	}{
+		{"signature", func() []byte {
+			b := valid()
+			copy(b, "BAAD")
+			return b
+		}, ErrInvalidRecord},
+		{"fixup mismatch", func() []byte {
+			b := valid()
+			b[2*fixupStride-2] ^= 0xFF
+			return b
+		}, ErrInvalidRecord},
+		{"update sequence array out of record", func() []byte {
+			b := valid()
+			binary.LittleEndian.PutUint16(b[0x04:], testRecordSize-2)
+			return b
+		}, ErrInvalidRecord},
+		{"no update sequence", func() []byte {
+			b := valid()
+			binary.LittleEndian.PutUint16(b[0x06:], 0)
+			return b
+		}, ErrInvalidRecord},
+		{"attribute past the record", func() []byte {
+			attr := residentAttr(AttrData, "", []byte("data"))
+			binary.LittleEndian.PutUint32(attr[0x04:], testRecordSize)
+			return record(attr)
+		}, ErrInvalidAttr},
+		{"attribute too short", func() []byte {
+			attr := residentAttr(AttrData, "", []byte("data"))
+			binary.LittleEndian.PutUint32(attr[0x04:], 0x10)
+			return record(attr)
+		}, ErrInvalidAttr},
+		{"value past the attribute", func() []byte {
+			attr := residentAttr(AttrData, "", []byte("data"))
+			binary.LittleEndian.PutUint32(attr[0x10:], 0x100)
+			return record(attr)
+		}, ErrInvalidAttr},
+		{"name past the attribute", func() []byte {
+			attr := residentAttr(AttrData, "ads", []byte("data"))
+			attr[0x09] = 0x40
+			return record(attr)
+		}, ErrInvalidAttr},
+		{"non-resident header too short", func() []byte {
+			attr := residentAttr(AttrData, "", []byte("data"))
+			attr[0x08] = 1
+			return record(attr)
+		}, ErrInvalidAttr},
+		{"overlapping runs", func() []byte {
+			return record(nonResidentAttr(AttrData, "", []byte{0x21, 0x10, 0x00, 0x01, 0x11, 0x04, 0x08}, 20*512))
+		}, ErrInvalidAttr},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseRecord(tt.buf(), 0)
+			if !errors.Is(err, tt.want) {
+				t.Errorf("got %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseRuns(t *testing.T) {
+	tests := []struct {
+		name    string
+		pairs   []byte
+		want    []Run
+		wantErr bool
+	}{
+		{"empty", []byte{0x00}, nil, false},
+		{"single", []byte{0x21, 0x10, 0x00, 0x01, 0x00}, []Run{{256, 16}}, false},
+		{"sparse", []byte{0x01, 0x10, 0x00}, []Run{{-1, 16}}, false},
+		{"negative offset", []byte{0x11, 0x04, 0x40, 0x11, 0x04, 0xF0, 0x00}, []Run{{64, 4}, {48, 4}}, false},
+		{"8 bytes offset", []byte{0x81, 0x01, 1, 0, 0, 0, 0, 0, 0, 0}, []Run{{1, 1}}, false},
+		{"adjacent", []byte{0x11, 0x04, 0x40, 0x11, 0x04, 0x04}, []Run{{64, 4}, {68, 4}}, false},
+		{"overlapping", []byte{0x11, 0x04, 0x40, 0x11, 0x04, 0x03}, nil, true},
+		{"overlapping earlier run", []byte{0x11, 0x08, 0x40, 0x11, 0x01, 0x10, 0x11, 0x01, 0xF2}, nil, true},
+		{"zero length", []byte{0x11, 0x00, 0x40}, nil, true},
+		{"length size 0", []byte{0x10, 0x40}, nil, true},
+		{"offset size 9", []byte{0x91, 0x01, 1, 0, 0, 0, 0, 0, 0, 0, 0}, nil, true},
+		{"truncated", []byte{0x21, 0x10}, nil, true},
+		{"negative LCN", []byte{0x11, 0x01, 0xFF}, nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runs, err := parseRuns(tt.pairs)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidAttr) {
+					t.Errorf("got %v, want %v", err, ErrInvalidAttr)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("parseRuns: %v", err)
+			}
+			if !reflect.DeepEqual(runs, tt.want) {
+				t.Errorf("got %v, want %v", runs, tt.want)
+			}
+		})
+	}
+}
+
+// volumeImage returns an image of at least 16 clusters of 512 bytes, with
+// $MFT records at cluster 4.
+func volumeImage(records ...[]byte) []byte {
+	sectors := 16
+	if n := 4 + len(records)*testRecordSize/512; n > sectors {
+		sectors = n
+	}
+	b := make([]byte, sectors*512)
+
+	boot := b[:bootSectorSize]
+	copy(boot[3:], ntfsOEMID)
+	binary.LittleEndian.PutUint16(boot[0x0B:], 512)
+	boot[0x0D] = 1
+	binary.LittleEndian.PutUint64(boot[0x28:], uint64(sectors))
+	binary.LittleEndian.PutUint64(boot[0x30:], 4)
+	binary.LittleEndian.PutUint64(boot[0x38:], 8)
+	boot[0x40] = 0xF6 // 2^10 bytes
+	boot[0x44] = 0xF4 // 2^12 bytes
+	binary.LittleEndian.PutUint64(boot[0x48:], 0x1122334455667788)
+	boot[510], boot[511] = 0x55, 0xAA
+
+	for i, rec := range records {
+		copy(b[4*512+i*testRecordSize:], rec)
+	}
+
+	return b
+}
+
+func TestOpen(t *testing.T) {
+	mft0 := record(nonResidentAttr(AttrData, "", []byte{0x11, 0x04, 0x04}, 2*testRecordSize))
+	mft1 := record(residentAttr(AttrData, "ads", []byte("stream data")))
+
+	v, err := Open(bytes.NewReader(volumeImage(mft0, mft1)))
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+
+	if v.BytesPerSector != 512 || v.ClusterSize != 512 || v.RecordSize != 1024 || v.IndexSize != 4096 ||
+		v.MFTCluster != 4 || v.MFTMirrCluster != 8 || v.SerialNumber != 0x1122334455667788 || v.RecordCount() != 2 {
+		t.Errorf("got %+v", v)
+	}
+
+	rec, err := v.ReadRecord(1)
+	if err != nil {
+		t.Fatalf("ReadRecord: %v", err)
+	}
+	if len(rec.Attributes) != 1 || rec.Attributes[0].Name != "ads" || string(rec.Attributes[0].Value) != "stream data" {
+		t.Errorf("got %+v", rec.Attributes)
+	}
+
+	if _, err = v.ReadRecord(2); !errors.Is(err, ErrInvalidRecord) {
+		t.Errorf("ReadRecord(2): got %v, want %v", err, ErrInvalidRecord)
+	}
+}
+
+func TestOpenInvalid(t *testing.T) {
+	mft0 := record(nonResidentAttr(AttrData, "", []byte{0x11, 0x04, 0x04}, 2*testRecordSize))
+	mft1 := record()
+
+	tests := []struct {
+		name   string
+		modify func([]byte) []byte
+		want   error
+	}{
+		{"OEM ID", func(b []byte) []byte {
+			copy(b[3:], "EXFAT   ")
+			return b
+		}, ErrNotNTFS},
+		{"boot signature", func(b []byte) []byte {
+			b[510] = 0
+			return b
+		}, ErrNotNTFS},
+		{"bytes per sector", func(b []byte) []byte {
+			binary.LittleEndian.PutUint16(b[0x0B:], 1000)
+			return b
+		}, ErrNotNTFS},
+		{"sectors per cluster", func(b []byte) []byte {
+			b[0x0D] = 0
+			return b
+		}, ErrNotNTFS},
+		{"record size", func(b []byte) []byte {
+			b[0x40] = 0xF8
+			return b
+		}, ErrNotNTFS},
+		{"$MFT fixup", func(b []byte) []byte {
+			b[4*512+fixupStride-1] ^= 0xFF
+			return b
+		}, ErrInvalidRecord},
+		{"$MFT without $DATA", func(b []byte) []byte {
+			copy(b[4*512:], record(residentAttr(AttrData, "ads", nil)))
+			return b
+		}, ErrInvalidRecord},
+		{"truncated", func(b []byte) []byte {
+			return b[:bootSectorSize-1]
+		}, io.EOF},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Open(bytes.NewReader(tt.modify(volumeImage(mft0, mft1))))
+			if !errors.Is(err, tt.want) {
+				t.Errorf("got %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestClusterAllocated(t *testing.T) {
+	// $MFT of 7 records on 18 clusters, whose $Bitmap has 3 bytes rounded up to 8
+	records := [][]byte{record(nonResidentAttr(AttrData, "", []byte{0x11, 0x0E, 0x04}, 7*testRecordSize))}
+	for i := 1; i < mftRecordBitmap; i++ {
+		records = append(records, record())
+	}
+
+	tests := []struct {
+		name   string
+		bitmap []byte
+		want   error
+	}{
+		{"rounded up", []byte{0x1F, 0, 0, 0, 0, 0, 0, 0}, nil},
+		{"too large", make([]byte, 16), ErrInvalidAttr},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			img := volumeImage(append(records, record(residentAttr(AttrData, "", tt.bitmap)))...)
+
+			v, err := Open(bytes.NewReader(img))
+			if err != nil {
+				t.Fatalf("Open: %v", err)
+			}
+
+			allocated, err := v.ClusterAllocated(4)
+			if tt.want != nil {
+				if !errors.Is(err, tt.want) {
+					t.Errorf("got %v, want %v", err, tt.want)
+				}
+				return
+			}
+			if err != nil || !allocated {
+				t.Errorf("cluster 4: got %v with %v, want allocated", allocated, err)
+			}
+
+			if allocated, err = v.ClusterAllocated(5); err != nil || allocated {
+				t.Errorf("cluster 5: got %v with %v, want unallocated", allocated, err)
+			}
+			if _, err = v.ClusterAllocated(64); err == nil {
+				t.Errorf("cluster 64: got no error")
+			}
+		})
+	}
+}
+
+func TestParseRestartPageSize(t *testing.T) {
+	tests := []struct {
+		name                string
+		systemPage, logPage uint32
+	}{
+		{"system page too large", 128 << 10, 4096},
+		{"log page too large", 4096, 128 << 10},
+		{"system page not power of 2", 3072, 4096},
+		{"log page too small", 4096, 256},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// the page is not read with bad page size
+			b := make([]byte, 0x1E)
+			copy(b, "RSTR")
+			binary.LittleEndian.PutUint32(b[0x10:], tt.systemPage)
+			binary.LittleEndian.PutUint32(b[0x14:], tt.logPage)
+
+			if _, err := parseRestartPage(bytes.NewReader(b), int64(len(b)), 0); !errors.Is(err, ErrInvalidLog) {
+				t.Errorf("got %v, want %v", err, ErrInvalidLog)
+			}
+		})
+	}
+}
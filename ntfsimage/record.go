@@ -0,0 +1,377 @@
+package ntfsimage
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sort"
+
+	"github.com/Snshadow/ntfs-ads/internal/winfmt"
+)
+
+const (
+	fixupStride = 512 // update sequence protects every 512 bytes regardless of sector size
+
+	attrEnd = 0xFFFFFFFF // end marker of attributes in a record
+)
+
+// Flags of MFT record.
+const (
+	RecordInUse     = 0x0001
+	RecordDirectory = 0x0002
+)
+
+// AttrType is type of attribute in MFT record.
+type AttrType uint32
+
+const (
+	AttrStandardInformation AttrType = 0x10
+	AttrAttributeList       AttrType = 0x20
+	AttrFileName            AttrType = 0x30
+	AttrObjectID            AttrType = 0x40
+	AttrSecurityDescriptor  AttrType = 0x50
+	AttrVolumeName          AttrType = 0x60
+	AttrVolumeInformation   AttrType = 0x70
+	AttrData                AttrType = 0x80
+	AttrIndexRoot           AttrType = 0x90
+	AttrIndexAllocation     AttrType = 0xA0
+	AttrBitmap              AttrType = 0xB0
+	AttrReparsePoint        AttrType = 0xC0
+	AttrEAInformation       AttrType = 0xD0
+	AttrEA                  AttrType = 0xE0
+	AttrLoggedUtilityStream AttrType = 0x100
+)
+
+var attrTypeNames = map[AttrType]string{
+	AttrStandardInformation: "$STANDARD_INFORMATION",
+	AttrAttributeList:       "$ATTRIBUTE_LIST",
+	AttrFileName:            "$FILE_NAME",
+	AttrObjectID:            "$OBJECT_ID",
+	AttrSecurityDescriptor:  "$SECURITY_DESCRIPTOR",
+	AttrVolumeName:          "$VOLUME_NAME",
+	AttrVolumeInformation:   "$VOLUME_INFORMATION",
+	AttrData:                "$DATA",
+	AttrIndexRoot:           "$INDEX_ROOT",
+	AttrIndexAllocation:     "$INDEX_ALLOCATION",
+	AttrBitmap:              "$BITMAP",
+	AttrReparsePoint:        "$REPARSE_POINT",
+	AttrEAInformation:       "$EA_INFORMATION",
+	AttrEA:                  "$EA",
+	AttrLoggedUtilityStream: "$LOGGED_UTILITY_STREAM",
+}
+
+func (t AttrType) String() string {
+	if name, ok := attrTypeNames[t]; ok {
+		return name
+	}
+
+	return fmt.Sprintf("0x%X", uint32(t))
+}
+
+// Flags of attribute.
+const (
+	AttrFlagCompressed = 0x0001
+	AttrFlagEncrypted  = 0x4000
+	AttrFlagSparse     = 0x8000
+)
+
+// FileReference is a reference to MFT record, with 48 bit record number and 16 bit sequence number.
+type FileReference uint64
+
+// Record returns the record number of the reference.
+func (r FileReference) Record() uint64 {
+	return uint64(r) & 0xFFFFFFFFFFFF
+}
+
+// Sequence returns the sequence number of the reference.
+func (r FileReference) Sequence() uint16 {
+	return uint16(r >> 48)
+}
+
+// Run is a data run of non-resident attribute, a sequence of clusters.
+type Run struct {
+	LCN    int64 // first logical cluster, -1 for sparse run
+	Length int64 // number of clusters
+}
+
+// Sparse reports whether the run is not allocated and read as zero.
+func (r Run) Sparse() bool {
+	return r.LCN < 0
+}
+
+// Attribute is an attribute of MFT record.
+type Attribute struct {
+	Type        AttrType
+	Name        string
+	NonResident bool
+	Flags       uint16
+	ID          uint16
+
+	Value []byte // value of resident attribute
+
+	// fields of non-resident attribute
+	StartVCN        int64
+	LastVCN         int64
+	CompressionUnit uint16 // log2 of clusters in a compression unit
+	AllocatedSize   int64
+	RealSize        int64
+	InitializedSize int64
+	CompressedSize  int64
+	Runs            []Run
+}
+
+// Size returns size of the attribute value.
+func (a *Attribute) Size() int64 {
+	if a.NonResident {
+		return a.RealSize
+	}
+
+	return int64(len(a.Value))
+}
+
+// Record is a parsed MFT record.
+type Record struct {
+	Number        uint64
+	LSN           uint64 // $LogFile sequence number of last change
+	Sequence      uint16
+	LinkCount     uint16
+	Flags         uint16
+	BaseReference FileReference // base record of extension record, 0 for base record
+	Attributes    []Attribute
+}
+
+// InUse reports whether the record is used by a file.
+func (r *Record) InUse() bool {
+	return r.Flags&RecordInUse != 0
+}
+
+// IsDir reports whether the record is of a directory.
+func (r *Record) IsDir() bool {
+	return r.Flags&RecordDirectory != 0
+}
+
+// Reference returns the file reference of the record.
+func (r *Record) Reference() FileReference {
+	return FileReference(r.Number&0xFFFFFFFFFFFF | uint64(r.Sequence)<<48)
+}
+
+func (r *Record) hasAttr(typ AttrType) bool {
+	for _, attr := range r.Attributes {
+		if attr.Type == typ {
+			return true
+		}
+	}
+
+	return false
+}
+
+// applyFixups verifies update sequence of multi-sector protected buffer and
+// restores the original last two bytes of each 512 byte block.
+func applyFixups(buf []byte) error {
+	usaOffset := int(binary.LittleEndian.Uint16(buf[0x04:]))
+	usaCount := int(binary.LittleEndian.Uint16(buf[0x06:]))
+
+	if usaCount == 0 || usaOffset+usaCount*2 > len(buf) || (usaCount-1)*fixupStride > len(buf) {
+		return fmt.Errorf("%w: bad update sequence array", ErrInvalidRecord)
+	}
+
+	usn := buf[usaOffset : usaOffset+2]
+
+	for i := 1; i < usaCount; i++ {
+		end := i*fixupStride - 2
+		if buf[end] != usn[0] || buf[end+1] != usn[1] {
+			return fmt.Errorf("%w: update sequence mismatch in block %d", ErrInvalidRecord, i-1)
+		}
+
+		copy(buf[end:end+2], buf[usaOffset+i*2:usaOffset+i*2+2])
+	}
+
+	return nil
+}
+
+// parseRecord applies fixups to buf and parses the MFT record.
+func parseRecord(buf []byte, num uint64) (*Record, error) {
+	if len(buf) < 0x30 || string(buf[:4]) != "FILE" {
+		return nil, fmt.Errorf("%w: bad signature of record %d", ErrInvalidRecord, num)
+	}
+
+	if err := applyFixups(buf); err != nil {
+		return nil, err
+	}
+
+	rec := &Record{
+		Number:        num,
+		LSN:           binary.LittleEndian.Uint64(buf[0x08:]),
+		Sequence:      binary.LittleEndian.Uint16(buf[0x10:]),
+		LinkCount:     binary.LittleEndian.Uint16(buf[0x12:]),
+		Flags:         binary.LittleEndian.Uint16(buf[0x16:]),
+		BaseReference: FileReference(binary.LittleEndian.Uint64(buf[0x20:])),
+	}
+
+	attrOffset := int(binary.LittleEndian.Uint16(buf[0x14:]))
+	usedSize := int(binary.LittleEndian.Uint32(buf[0x18:]))
+	if usedSize > len(buf) || usedSize == 0 {
+		usedSize = len(buf)
+	}
+
+	attrs, err := parseAttributes(buf[:usedSize], attrOffset)
+	if err != nil {
+		return nil, fmt.Errorf("record %d: %w", num, err)
+	}
+
+	rec.Attributes = attrs
+
+	return rec, nil
+}
+
+// parseAttributes parses attributes in the record starting from the offset.
+func parseAttributes(buf []byte, off int) ([]Attribute, error) {
+	var attrs []Attribute
+
+	for off+8 <= len(buf) {
+		typ := binary.LittleEndian.Uint32(buf[off:])
+		if typ == attrEnd {
+			break
+		}
+
+		length := int(binary.LittleEndian.Uint32(buf[off+4:]))
+		if length < 0x18 || off+length > len(buf) {
+			return attrs, fmt.Errorf("%w: bad length %d at offset %d", ErrInvalidAttr, length, off)
+		}
+
+		attr, err := parseAttribute(buf[off : off+length])
+		if err != nil {
+			return attrs, err
+		}
+
+		attrs = append(attrs, attr)
+		off += length
+	}
+
+	return attrs, nil
+}
+
+// parseAttribute parses an attribute with its header.
+func parseAttribute(b []byte) (Attribute, error) {
+	attr := Attribute{
+		Type:        AttrType(binary.LittleEndian.Uint32(b[0x00:])),
+		NonResident: b[0x08] != 0,
+		Flags:       binary.LittleEndian.Uint16(b[0x0C:]),
+		ID:          binary.LittleEndian.Uint16(b[0x0E:]),
+	}
+
+	nameLen := int(b[0x09])
+	nameOffset := int(binary.LittleEndian.Uint16(b[0x0A:]))
+	if nameLen > 0 {
+		if nameOffset+nameLen*2 > len(b) {
+			return attr, fmt.Errorf("%w: name of %s out of range", ErrInvalidAttr, attr.Type)
+		}
+		attr.Name = winfmt.DecodeUTF16(b[nameOffset : nameOffset+nameLen*2])
+	}
+
+	if !attr.NonResident {
+		valueLen := int(binary.LittleEndian.Uint32(b[0x10:]))
+		valueOffset := int(binary.LittleEndian.Uint16(b[0x14:]))
+		if valueOffset+valueLen > len(b) {
+			return attr, fmt.Errorf("%w: value of %s out of range", ErrInvalidAttr, attr.Type)
+		}
+
+		attr.Value = b[valueOffset : valueOffset+valueLen]
+
+		return attr, nil
+	}
+
+	if len(b) < 0x40 {
+		return attr, fmt.Errorf("%w: non-resident header of %s too short", ErrInvalidAttr, attr.Type)
+	}
+
+	attr.StartVCN = int64(binary.LittleEndian.Uint64(b[0x10:]))
+	attr.LastVCN = int64(binary.LittleEndian.Uint64(b[0x18:]))
+	runsOffset := int(binary.LittleEndian.Uint16(b[0x20:]))
+	attr.CompressionUnit = binary.LittleEndian.Uint16(b[0x22:])
+	attr.AllocatedSize = int64(binary.LittleEndian.Uint64(b[0x28:]))
+	attr.RealSize = int64(binary.LittleEndian.Uint64(b[0x30:]))
+	attr.InitializedSize = int64(binary.LittleEndian.Uint64(b[0x38:]))
+	if attr.CompressionUnit != 0 && len(b) >= 0x48 {
+		attr.CompressedSize = int64(binary.LittleEndian.Uint64(b[0x40:]))
+	}
+
+	if runsOffset > len(b) {
+		return attr, fmt.Errorf("%w: data runs of %s out of range", ErrInvalidAttr, attr.Type)
+	}
+
+	runs, err := parseRuns(b[runsOffset:])
+	if err != nil {
+		return attr, fmt.Errorf("%s: %w", attr.Type, err)
+	}
+	attr.Runs = runs
+
+	return attr, nil
+}
+
+// parseRuns decodes mapping pairs of non-resident attribute into data runs.
+func parseRuns(b []byte) ([]Run, error) {
+	var runs []Run
+	var lcn int64
+
+	for i := 0; i < len(b) && b[i] != 0; {
+		lenSize := int(b[i] & 0x0F)
+		offSize := int(b[i] >> 4)
+		i++
+
+		if lenSize == 0 || lenSize > 8 || offSize > 8 || i+lenSize+offSize > len(b) {
+			return runs, fmt.Errorf("%w: bad data run header", ErrInvalidAttr)
+		}
+
+		length := readVarInt(b[i:i+lenSize], false)
+		i += lenSize
+
+		if length <= 0 {
+			return runs, fmt.Errorf("%w: bad data run length %d", ErrInvalidAttr, length)
+		}
+
+		if offSize == 0 {
+			runs = append(runs, Run{LCN: -1, Length: length})
+			continue
+		}
+
+		lcn += readVarInt(b[i:i+offSize], true)
+		i += offSize
+
+		if lcn < 0 {
+			return runs, fmt.Errorf("%w: negative LCN in data run", ErrInvalidAttr)
+		}
+
+		runs = append(runs, Run{LCN: lcn, Length: length})
+	}
+
+	// clusters are never shared by runs of an attribute
+	allocated := make([]Run, 0, len(runs))
+	for _, run := range runs {
+		if !run.Sparse() {
+			allocated = append(allocated, run)
+		}
+	}
+	sort.Slice(allocated, func(i, j int) bool { return allocated[i].LCN < allocated[j].LCN })
+	for i := 1; i < len(allocated); i++ {
+		if prev := allocated[i-1]; allocated[i].LCN-prev.LCN < prev.Length {
+			return runs, fmt.Errorf("%w: data runs overlap at LCN %d", ErrInvalidAttr, allocated[i].LCN)
+		}
+	}
+
+	return runs, nil
+}
+
+// readVarInt reads little endian integer of variable size.
+func readVarInt(b []byte, signed bool) int64 {
+	var v uint64
+	for i := len(b) - 1; i >= 0; i-- {
+		v = v<<8 | uint64(b[i])
+	}
+
+	if signed && len(b) < 8 && b[len(b)-1]&0x80 != 0 {
+		// sign extend
+		v |= ^uint64(0) << (uint(len(b)) * 8)
+	}
+
+	return int64(v)
+}
@@ -0,0 +1,292 @@
+package ntfsimage
+
+import (
+	"fmt"
+	"io/fs"
+	"strings"
+)
+
+const (
+	orphanDir    = "$OrphanFiles" // parent of files whose parent directory is gone
+	maxPathDepth = 1024
+)
+
+// nameEntry is a cached name of MFT record.
+type nameEntry struct {
+	name     string
+	parent   FileReference
+	sequence uint16
+	inUse    bool
+	hasName  bool
+}
+
+// FileStreams has named data streams of a file in the volume.
+type FileStreams struct {
+	Record   uint64
+	Sequence uint16
+	Path     string // full path from root of the volume separated with "/"
+	IsDir    bool
+	Deleted  bool // record is not in use, streams are of a deleted file
+
+	StreamInfoMap map[string]int64          // same as StreamInfoMap of FileADS
+	StreamIDs     map[string]uint16         // attribute ID of each stream
+	Recovery      map[string]Recoverability // status of each stream of deleted file
+
+	StandardInformation *StandardInformation // nil if not found
+	FileName            *FileName            // $FILE_NAME of Path, nil if not found
+}
+
+// bestFileName returns the name to be shown for the file, preferring Win32 names over DOS names.
+func bestFileName(attrs []Attribute) *FileName {
+	var best *FileName
+
+	for i := range attrs {
+		if attrs[i].Type != AttrFileName || attrs[i].NonResident {
+			continue
+		}
+
+		fn, err := ParseFileName(attrs[i].Value)
+		if err != nil {
+			continue
+		}
+
+		if best == nil || (best.Namespace == NamespaceDOS && fn.Namespace != NamespaceDOS) {
+			best = fn
+		}
+	}
+
+	return best
+}
+
+// nameOf returns cached name of the record.
+func (v *Volume) nameOf(num uint64) (*nameEntry, error) {
+	if entry, ok := v.names[num]; ok {
+		return entry, nil
+	}
+
+	rec, err := v.ReadRecord(num)
+	if err != nil {
+		return nil, err
+	}
+
+	entry := &nameEntry{
+		sequence: rec.Sequence,
+		inUse:    rec.InUse(),
+	}
+
+	fn := bestFileName(rec.Attributes)
+	if fn == nil && rec.hasAttr(AttrAttributeList) {
+		if attrs, err := v.Attributes(rec); err == nil {
+			fn = bestFileName(attrs)
+		}
+	}
+
+	if fn != nil {
+		entry.name = fn.Name
+		entry.parent = fn.Parent
+		entry.hasName = true
+	}
+
+	v.names[num] = entry
+
+	return entry, nil
+}
+
+// Path returns full path of the file of the record, separated with "/". Files
+// whose parent directory does not exist anymore are placed under "/$OrphanFiles".
+func (v *Volume) Path(num uint64) (string, error) {
+	if num == mftRecordRoot {
+		return "/", nil
+	}
+
+	var parts []string
+
+	for num != mftRecordRoot {
+		entry, err := v.nameOf(num)
+		if err != nil {
+			if len(parts) == 0 {
+				return "", err
+			}
+			parts = append(parts, orphanDir)
+			break
+		}
+
+		if !entry.hasName {
+			if len(parts) == 0 {
+				return "", fmt.Errorf("%w: record %d has no $FILE_NAME", ErrInvalidRecord, num)
+			}
+			parts = append(parts, orphanDir)
+			break
+		}
+
+		parts = append(parts, entry.name)
+		if len(parts) > maxPathDepth {
+			return "", fmt.Errorf("%w: path of record %d is too deep or looped", ErrInvalidRecord, num)
+		}
+
+		parentNum := entry.parent.Record()
+		if parentNum == num {
+			// only the root directory refers itself
+			parts = append(parts, orphanDir)
+			break
+		}
+
+		parent, err := v.nameOf(parentNum)
+		if err != nil || !parent.inUse || parent.sequence != entry.parent.Sequence() {
+			// parent directory was deleted or its record was reused
+			parts = append(parts, orphanDir)
+			break
+		}
+
+		num = parentNum
+	}
+
+	var sb strings.Builder
+	for i := len(parts) - 1; i >= 0; i-- {
+		sb.WriteByte('/')
+		sb.WriteString(parts[i])
+	}
+
+	return sb.String(), nil
+}
+
+// namedStreams returns name and size of named $DATA attributes.
+func namedStreams(attrs []Attribute) map[string]int64 {
+	streamInfoMap := make(map[string]int64)
+
+	for i := range attrs {
+		attr := &attrs[i]
+		if attr.Type != AttrData || attr.Name == "" {
+			continue
+		}
+
+		if !attr.NonResident {
+			streamInfoMap[attr.Name] = int64(len(attr.Value))
+		} else if attr.StartVCN == 0 {
+			// size is only valid in the first extent
+			streamInfoMap[attr.Name] = attr.RealSize
+		} else if _, ok := streamInfoMap[attr.Name]; !ok {
+			streamInfoMap[attr.Name] = 0
+		}
+	}
+
+	return streamInfoMap
+}
+
+// streamIDs returns attribute ID of named $DATA attributes.
+func streamIDs(attrs []Attribute) map[string]uint16 {
+	ids := make(map[string]uint16)
+
+	for i := range attrs {
+		attr := &attrs[i]
+		if attr.Type == AttrData && attr.Name != "" && (!attr.NonResident || attr.StartVCN == 0) {
+			ids[attr.Name] = attr.ID
+		}
+	}
+
+	return ids
+}
+
+// setFileInfo sets attribute IDs of streams and timestamps of the file from its attributes.
+func (f *FileStreams) setFileInfo(attrs []Attribute) {
+	f.StreamIDs = streamIDs(attrs)
+	f.FileName = bestFileName(attrs)
+
+	for i := range attrs {
+		if attrs[i].Type == AttrStandardInformation && !attrs[i].NonResident {
+			f.StandardInformation, _ = ParseStandardInformation(attrs[i].Value)
+			break
+		}
+	}
+}
+
+// FileStreams returns named data streams of the file of the record.
+func (v *Volume) FileStreams(num uint64) (*FileStreams, error) {
+	rec, err := v.ReadRecord(num)
+	if err != nil {
+		return nil, err
+	}
+
+	return v.fileStreams(rec)
+}
+
+func (v *Volume) fileStreams(rec *Record) (*FileStreams, error) {
+	attrs, err := v.Attributes(rec)
+	if err != nil {
+		return nil, err
+	}
+
+	path, err := v.Path(rec.Number)
+	if err != nil {
+		return nil, err
+	}
+
+	strms := &FileStreams{
+		Record:        rec.Number,
+		Sequence:      rec.Sequence,
+		Path:          path,
+		IsDir:         rec.IsDir(),
+		StreamInfoMap: namedStreams(attrs),
+	}
+	strms.setFileInfo(attrs)
+
+	return strms, nil
+}
+
+// WalkStreams calls fn for every file in use which has at least one named data
+// stream, in order of MFT record number. Records which cannot be parsed are skipped.
+func (v *Volume) WalkStreams(fn func(*FileStreams) error) error {
+	count := v.RecordCount()
+
+	for num := uint64(0); num < count; num++ {
+		rec, err := v.ReadRecord(num)
+		if err != nil {
+			// never used or corrupted record
+			continue
+		}
+
+		if !rec.InUse() || rec.BaseReference != 0 {
+			continue
+		}
+
+		strms, err := v.fileStreams(rec)
+		if err != nil || len(strms.StreamInfoMap) == 0 {
+			continue
+		}
+
+		if err = fn(strms); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Lookup returns the record number of the file in use with the path,
+// compared case-insensitively as in NTFS.
+func (v *Volume) Lookup(path string) (uint64, error) {
+	path = "/" + strings.Trim(strings.ReplaceAll(path, "\\", "/"), "/")
+	if path == "/" {
+		return mftRecordRoot, nil
+	}
+
+	count := v.RecordCount()
+
+	for num := uint64(0); num < count; num++ {
+		rec, err := v.ReadRecord(num)
+		if err != nil || !rec.InUse() || rec.BaseReference != 0 {
+			continue
+		}
+
+		recPath, err := v.Path(num)
+		if err != nil {
+			continue
+		}
+
+		if strings.EqualFold(recPath, path) {
+			return num, nil
+		}
+	}
+
+	return 0, &fs.PathError{Op: "lookup", Path: path, Err: fs.ErrNotExist}
+}
@@ -0,0 +1,377 @@
+// Package ntfsimage reads alternate data streams from NTFS volume images
+// without the Win32 API, by parsing the boot sector and $MFT records.
+package ntfsimage
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+)
+
+const (
+	bootSectorSize = 512
+	ntfsOEMID      = "NTFS    "
+
+	mftRecordMFT  = 0 // $MFT
+	mftRecordRoot = 5 // root directory
+)
+
+var (
+	ErrNotNTFS       = errors.New("not a NTFS volume")
+	ErrInvalidRecord = errors.New("invalid MFT record")
+	ErrInvalidAttr   = errors.New("invalid attribute")
+)
+
+// Volume is a NTFS volume read from an image.
+type Volume struct {
+	BytesPerSector uint32
+	ClusterSize    uint32 // bytes per cluster
+	RecordSize     uint32 // bytes per MFT record
+	IndexSize      uint32 // bytes per index record
+	TotalSectors   uint64
+	MFTCluster     uint64 // LCN of $MFT
+	MFTMirrCluster uint64 // LCN of $MFTMirr
+	SerialNumber   uint64
+
+	r       io.ReaderAt
+	mftRuns []Run // data runs of unnamed $DATA of $MFT
+	mftSize int64 // size of $MFT in bytes
+
+	names  map[uint64]*nameEntry // cache of names of records for building paths
+	bitmap []byte                // cache of $Bitmap
+}
+
+// Open reads the boot sector and $MFT of NTFS volume from r.
+func Open(r io.ReaderAt) (*Volume, error) {
+	boot := make([]byte, bootSectorSize)
+	if _, err := r.ReadAt(boot, 0); err != nil {
+		return nil, fmt.Errorf("could not read boot sector: %w", err)
+	}
+
+	if string(boot[3:11]) != ntfsOEMID || boot[510] != 0x55 || boot[511] != 0xAA {
+		return nil, ErrNotNTFS
+	}
+
+	v := &Volume{
+		BytesPerSector: uint32(binary.LittleEndian.Uint16(boot[0x0B:])),
+		TotalSectors:   binary.LittleEndian.Uint64(boot[0x28:]),
+		MFTCluster:     binary.LittleEndian.Uint64(boot[0x30:]),
+		MFTMirrCluster: binary.LittleEndian.Uint64(boot[0x38:]),
+		SerialNumber:   binary.LittleEndian.Uint64(boot[0x48:]),
+		r:              r,
+		names:          make(map[uint64]*nameEntry),
+	}
+
+	if v.BytesPerSector < 256 || v.BytesPerSector&(v.BytesPerSector-1) != 0 {
+		return nil, fmt.Errorf("%w: bytes per sector %d", ErrNotNTFS, v.BytesPerSector)
+	}
+
+	// values over 0x80 are negative exponent of 2 for large clusters
+	sectorsPerCluster := uint32(boot[0x0D])
+	if sectorsPerCluster > 0x80 {
+		sectorsPerCluster = 1 << (256 - sectorsPerCluster)
+	}
+	if sectorsPerCluster == 0 {
+		return nil, fmt.Errorf("%w: sectors per cluster is 0", ErrNotNTFS)
+	}
+	v.ClusterSize = sectorsPerCluster * v.BytesPerSector
+	if v.ClusterSize == 0 {
+		return nil, fmt.Errorf("%w: cluster size overflows", ErrNotNTFS)
+	}
+
+	v.RecordSize = clustersToBytes(int8(boot[0x40]), v.ClusterSize)
+	v.IndexSize = clustersToBytes(int8(boot[0x44]), v.ClusterSize)
+	if v.RecordSize < 256 || v.RecordSize%512 != 0 {
+		return nil, fmt.Errorf("%w: MFT record size %d", ErrNotNTFS, v.RecordSize)
+	}
+
+	if err := v.loadMFT(); err != nil {
+		return nil, err
+	}
+
+	return v, nil
+}
+
+// clustersToBytes converts size in clusters from boot sector, negative value is exponent of 2 in bytes.
+func clustersToBytes(v int8, clusterSize uint32) uint32 {
+	if v < 0 {
+		return 1 << uint32(-v)
+	}
+
+	return uint32(v) * clusterSize
+}
+
+// loadMFT reads data runs of $MFT from its first record.
+func (v *Volume) loadMFT() error {
+	buf := make([]byte, v.RecordSize)
+	if _, err := v.r.ReadAt(buf, int64(v.MFTCluster)*int64(v.ClusterSize)); err != nil {
+		return fmt.Errorf("could not read $MFT record: %w", err)
+	}
+
+	rec, err := parseRecord(buf, mftRecordMFT)
+	if err != nil {
+		return fmt.Errorf("could not parse $MFT record: %w", err)
+	}
+
+	var dataAttrs []*Attribute
+	for i := range rec.Attributes {
+		if attr := &rec.Attributes[i]; attr.Type == AttrData && attr.Name == "" {
+			dataAttrs = append(dataAttrs, attr)
+		}
+	}
+	if len(dataAttrs) == 0 {
+		return fmt.Errorf("%w: $MFT has no $DATA", ErrInvalidRecord)
+	}
+
+	v.mftRuns = dataAttrs[0].Runs
+	v.mftSize = dataAttrs[0].RealSize
+
+	if !rec.hasAttr(AttrAttributeList) {
+		return nil
+	}
+
+	// $DATA of a fragmented $MFT continues in extension records, which are
+	// found with the runs read so far
+	attrs, err := v.Attributes(rec)
+	if err != nil {
+		return fmt.Errorf("could not read attributes of $MFT: %w", err)
+	}
+
+	runs, size, found := mergeExtents(attrs, AttrData, "")
+	if found {
+		v.mftRuns = runs
+		v.mftSize = size
+	}
+
+	return nil
+}
+
+// RecordCount returns number of records in $MFT.
+func (v *Volume) RecordCount() uint64 {
+	return uint64(v.mftSize) / uint64(v.RecordSize)
+}
+
+// readRecordRaw reads the record from $MFT without applying fixups.
+func (v *Volume) readRecordRaw(num uint64) ([]byte, error) {
+	if num >= v.RecordCount() {
+		return nil, fmt.Errorf("%w: record %d out of range", ErrInvalidRecord, num)
+	}
+
+	buf := make([]byte, v.RecordSize)
+
+	rr := &runReader{r: v.r, runs: v.mftRuns, clusterSize: int64(v.ClusterSize), size: v.mftSize}
+	if _, err := rr.ReadAt(buf, int64(num)*int64(v.RecordSize)); err != nil && err != io.EOF {
+		return nil, err
+	}
+
+	return buf, nil
+}
+
+// ReadRecord reads the MFT record of the number.
+func (v *Volume) ReadRecord(num uint64) (*Record, error) {
+	buf, err := v.readRecordRaw(num)
+	if err != nil {
+		return nil, err
+	}
+
+	return parseRecord(buf, num)
+}
+
+// Attributes returns attributes of the base record, including ones in extension
+// records listed in its $ATTRIBUTE_LIST.
+func (v *Volume) Attributes(rec *Record) ([]Attribute, error) {
+	var listAttr *Attribute
+	for i := range rec.Attributes {
+		if rec.Attributes[i].Type == AttrAttributeList {
+			listAttr = &rec.Attributes[i]
+			break
+		}
+	}
+
+	if listAttr == nil {
+		return rec.Attributes, nil
+	}
+
+	listData, err := v.readAttrRaw(listAttr)
+	if err != nil {
+		return nil, fmt.Errorf("could not read $ATTRIBUTE_LIST of record %d: %w", rec.Number, err)
+	}
+
+	entries, err := parseAttributeList(listData)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse $ATTRIBUTE_LIST of record %d: %w", rec.Number, err)
+	}
+
+	attrs := append([]Attribute(nil), rec.Attributes...)
+	extRecords := map[uint64]*Record{rec.Number: rec}
+
+	for _, entry := range entries {
+		num := entry.Reference.Record()
+		if num == rec.Number {
+			continue
+		}
+
+		ext, ok := extRecords[num]
+		if !ok {
+			ext, err = v.ReadRecord(num)
+			if err != nil {
+				return nil, fmt.Errorf("could not read extension record %d: %w", num, err)
+			}
+			if ext.BaseReference.Record() != rec.Number {
+				// extension record was reused for another file
+				ext = &Record{Number: num}
+			}
+			extRecords[num] = ext
+		}
+
+		for _, attr := range ext.Attributes {
+			if attr.Type == entry.Type && attr.ID == entry.ID && attr.Name == entry.Name {
+				attrs = append(attrs, attr)
+			}
+		}
+	}
+
+	return attrs, nil
+}
+
+// readAttrRaw reads the whole value of an uncompressed attribute.
+func (v *Volume) readAttrRaw(attr *Attribute) ([]byte, error) {
+	if !attr.NonResident {
+		return attr.Value, nil
+	}
+
+	// sizes are not trusted before allocating the value
+	if attr.RealSize < 0 || attr.RealSize > attr.InitializedSize {
+		return nil, fmt.Errorf("%w: size %d with initialized size %d", ErrInvalidAttr, attr.RealSize, attr.InitializedSize)
+	}
+
+	var runSize int64
+	for _, run := range attr.Runs {
+		if run.Length < 0 || run.Length > v.volumeSize()/int64(v.ClusterSize) {
+			return nil, fmt.Errorf("%w: data run of %d clusters", ErrInvalidAttr, run.Length)
+		}
+		if runSize += run.Length * int64(v.ClusterSize); runSize > v.volumeSize() {
+			runSize = v.volumeSize()
+		}
+	}
+	if attr.RealSize > runSize || attr.RealSize > v.volumeSize() {
+		return nil, fmt.Errorf("%w: size %d exceeds data runs of %d bytes", ErrInvalidAttr, attr.RealSize, runSize)
+	}
+
+	buf := make([]byte, attr.RealSize)
+
+	rr := &runReader{r: v.r, runs: attr.Runs, clusterSize: int64(v.ClusterSize), size: attr.InitializedSize}
+	if _, err := rr.ReadAt(buf, 0); err != nil && err != io.EOF {
+		return nil, err
+	}
+
+	return buf, nil
+}
+
+// volumeSize returns size of the volume in bytes from the boot sector.
+func (v *Volume) volumeSize() int64 {
+	if v.TotalSectors > uint64(math.MaxInt64)/uint64(v.BytesPerSector) {
+		return math.MaxInt64
+	}
+
+	return int64(v.TotalSectors * uint64(v.BytesPerSector))
+}
+
+// mergeExtents joins data runs of a non-resident attribute stored in multiple
+// extents, size is taken from the extent starting at VCN 0.
+func mergeExtents(attrs []Attribute, typ AttrType, name string) (runs []Run, size int64, found bool) {
+	var extents []*Attribute
+	for i := range attrs {
+		if attr := &attrs[i]; attr.Type == typ && attr.Name == name && attr.NonResident {
+			extents = append(extents, attr)
+		}
+	}
+
+	if len(extents) == 0 {
+		return nil, 0, false
+	}
+
+	// extents are listed in order of VCN in $ATTRIBUTE_LIST, sort in case they are not
+	for i := 1; i < len(extents); i++ {
+		for j := i; j > 0 && extents[j].StartVCN < extents[j-1].StartVCN; j-- {
+			extents[j], extents[j-1] = extents[j-1], extents[j]
+		}
+	}
+
+	for _, ext := range extents {
+		if ext.StartVCN == 0 {
+			size = ext.RealSize
+			found = true
+		}
+		runs = append(runs, ext.Runs...)
+	}
+
+	return runs, size, found
+}
+
+// runReader reads data stored in clusters of data runs.
+type runReader struct {
+	r           io.ReaderAt
+	runs        []Run
+	clusterSize int64
+	size        int64 // bytes beyond size are read as zero, and EOF beyond
+}
+
+func (rr *runReader) ReadAt(b []byte, off int64) (int, error) {
+	if off >= rr.size {
+		return 0, io.EOF
+	}
+
+	want := b
+	if remain := rr.size - off; int64(len(want)) > remain {
+		want = want[:remain]
+	}
+
+	n := 0
+	vcnStart := int64(0)
+
+	for _, run := range rr.runs {
+		if n == len(want) {
+			break
+		}
+
+		runStart := vcnStart * rr.clusterSize
+		runEnd := (vcnStart + run.Length) * rr.clusterSize
+		vcnStart += run.Length
+
+		pos := off + int64(n)
+		if pos >= runEnd || pos < runStart {
+			continue
+		}
+
+		chunk := want[n:]
+		if int64(len(chunk)) > runEnd-pos {
+			chunk = chunk[:runEnd-pos]
+		}
+
+		if run.Sparse() {
+			for i := range chunk {
+				chunk[i] = 0
+			}
+		} else if _, err := rr.r.ReadAt(chunk, run.LCN*rr.clusterSize+(pos-runStart)); err != nil {
+			return n, err
+		}
+
+		n += len(chunk)
+	}
+
+	if n < len(want) {
+		// runs do not cover the size
+		for i := range want[n:] {
+			want[n+i] = 0
+		}
+	}
+
+	if len(want) < len(b) {
+		return len(want), io.EOF
+	}
+
+	return len(b), nil
+}
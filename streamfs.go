@@ -0,0 +1,295 @@
+package ntfs_ads
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+)
+
+var (
+	ErrNoADS       = errors.New("no alternate data stream found")
+	ErrUnsupported = errors.New("file system does not support stream")
+)
+
+// Stream is an opened data stream of a file, *os.File satisfies this interface.
+type Stream interface {
+	io.Reader
+	io.ReaderAt
+	io.Writer
+	io.WriterAt
+	io.Seeker
+	io.Closer
+
+	// Name returns the name of the stream as presented to OpenStream.
+	Name() string
+}
+
+// StreamFS is a backend which stores named data streams of files.
+//
+// ListStreams returns names and sizes of named data streams of the file, the
+// unnamed data stream is not included. It returns ErrNoADS if the file cannot
+// have any stream, e.g. a directory without any named stream.
+//
+// OpenStream opens the named stream of the file with flag used in
+// os.OpenFile(), streams are created with os.O_CREATE.
+//
+// RenameStream renames the stream oldName to newName. If a stream with newName
+// exists, it is replaced only if overwrite is true.
+//
+// RemoveStream removes the named stream from the file.
+type StreamFS interface {
+	ListStreams(path string) (map[string]int64, error)
+	OpenStream(path, name string, flag int) (Stream, error)
+	RenameStream(path, oldName, newName string, overwrite bool) error
+	RemoveStream(path, name string) error
+}
+
+// TypedStreamFS is a StreamFS which can list streams of every attribute type
+// with ListAllStreams, including the unnamed data stream.
+type TypedStreamFS interface {
+	StreamFS
+	ListAllStreams(path string) (map[StreamSpec]int64, error)
+}
+
+// CollectOption changes streams collected by CollectADS.
+type CollectOption int
+
+const (
+	// CollectAllTypes also collects streams of every attribute type including
+	// the unnamed data stream into StreamSpecMap. Only named data streams are
+	// collected if the backend is not TypedStreamFS.
+	CollectAllTypes CollectOption = iota + 1
+)
+
+// FileADS handles alternate data streams of a file.
+type FileADS struct {
+	Path          string
+	StreamInfoMap map[string]int64
+
+	// StreamSpecMap has streams of every attribute type collected with
+	// CollectAllTypes, nil otherwise.
+	StreamSpecMap map[StreamSpec]int64
+
+	fs  StreamFS    // backend storing streams of the file
+	mut *sync.Mutex // mutex for concurrent map handling
+}
+
+// NewFileADS returns ADS handler with a map of alternate data streams from
+// the specified file, which are stored in fsys. Path is passed to fsys as is.
+func NewFileADS(fsys StreamFS, path string) (FileADS, error) {
+	ads := FileADS{
+		Path: path,
+		fs:   fsys,
+		mut:  &sync.Mutex{},
+	}
+
+	if err := ads.CollectADS(); err != nil {
+		return ads, err
+	}
+
+	return ads, nil
+}
+
+// FS returns the backend which stores streams of the file.
+func (a *FileADS) FS() StreamFS {
+	return a.fs
+}
+
+// OpenADS opens alternate data stream with the name with specified flag(used in os.OpenFile()),
+// should be closed with Close() after use. StreamInfoMap is not updated for created streams
+// until CollectADS is called.
+func (a *FileADS) OpenADS(name string, openFlag int) (Stream, error) {
+	return a.fs.OpenStream(a.Path, name, openFlag)
+}
+
+// CollectADS collects name and size of alternate data streams of the file,
+// and of streams of every attribute type with CollectAllTypes.
+func (a *FileADS) CollectADS(opts ...CollectOption) error {
+	a.mut.Lock()
+	defer a.mut.Unlock()
+
+	allTypes := false
+	for _, opt := range opts {
+		allTypes = allTypes || opt == CollectAllTypes
+	}
+
+	if !allTypes {
+		streamInfoMap, err := a.fs.ListStreams(a.Path)
+		if err != nil {
+			return err
+		}
+
+		a.StreamInfoMap, a.StreamSpecMap = streamInfoMap, nil
+
+		if len(a.StreamInfoMap) == 0 {
+			// return ErrNoADS for files
+			return ErrNoADS
+		}
+
+		return nil
+	}
+
+	specs, err := a.listAllStreams()
+	if err != nil {
+		return err
+	}
+
+	a.StreamSpecMap = specs
+	a.StreamInfoMap = make(map[string]int64)
+	for spec, size := range specs {
+		if spec.IsData() && !spec.IsDefault() {
+			a.StreamInfoMap[spec.Name] = size
+		}
+	}
+
+	if len(a.StreamSpecMap) == 0 {
+		return ErrNoADS
+	}
+
+	return nil
+}
+
+// listAllStreams lists streams of every attribute type.
+func (a *FileADS) listAllStreams() (map[StreamSpec]int64, error) {
+	if tfs, ok := a.fs.(TypedStreamFS); ok {
+		return tfs.ListAllStreams(a.Path)
+	}
+
+	named, err := a.fs.ListStreams(a.Path)
+	if err != nil && err != ErrNoADS {
+		return nil, err
+	}
+
+	specs := make(map[StreamSpec]int64, len(named))
+	for name, size := range named {
+		specs[StreamSpec{Name: name, Type: TypeData}] = size
+	}
+
+	return specs, nil
+}
+
+// namedDataStream returns name of the named data stream specified with name,
+// which may be given as "name:$DATA". Names which are not stream specifiers,
+// e.g. of xattrs, are returned as is.
+func namedDataStream(name string) (string, error) {
+	spec, err := ParseStreamSpec(name)
+	if err != nil {
+		if name == "" {
+			return "", err
+		}
+
+		return name, nil
+	}
+
+	if !spec.IsData() || spec.IsDefault() {
+		return "", fmt.Errorf("%w: \"%s\" is not an alternate data stream", ErrInvalidStreamSpec, name)
+	}
+
+	return spec.Name, nil
+}
+
+// RenameADS renames alternate data stream with oldName to newName.
+// If stream with newName exists, it will be overwitten if overwrite is true,
+// otherwise return an error.
+func (a *FileADS) RenameADS(oldName, newName string, overwrite bool) error {
+	a.mut.Lock()
+	defer a.mut.Unlock()
+
+	oldStrm, err := namedDataStream(oldName)
+	if err != nil {
+		return err
+	}
+	newStrm, err := namedDataStream(newName)
+	if err != nil {
+		return err
+	}
+
+	if err := a.fs.RenameStream(a.Path, oldStrm, newStrm, overwrite); err != nil {
+		return err
+	}
+
+	a.refreshStreams(func() {
+		size := a.StreamInfoMap[oldStrm]
+		delete(a.StreamInfoMap, oldStrm)
+		a.StreamInfoMap[newStrm] = size
+	})
+
+	return nil
+}
+
+// RemoveADS removes alternate data stream with the name.
+func (a *FileADS) RemoveADS(name string) error {
+	a.mut.Lock()
+	defer a.mut.Unlock()
+
+	strmName, err := namedDataStream(name)
+	if err != nil {
+		return err
+	}
+
+	if err := a.fs.RemoveStream(a.Path, strmName); err != nil {
+		return err
+	}
+
+	a.refreshStreams(func() {
+		delete(a.StreamInfoMap, strmName)
+	})
+
+	return nil
+}
+
+// refreshStreams updates maps of streams after renaming or removing a stream,
+// the backend decides which stream is affected, e.g. case-insensitive names in
+// NTFS. fallback updates StreamInfoMap if streams cannot be listed again.
+func (a *FileADS) refreshStreams(fallback func()) {
+	streamInfoMap, err := a.fs.ListStreams(a.Path)
+	switch {
+	case err == nil:
+		a.StreamInfoMap = streamInfoMap
+	case errors.Is(err, ErrNoADS):
+		a.StreamInfoMap = make(map[string]int64)
+	default:
+		if a.StreamInfoMap == nil {
+			a.StreamInfoMap = make(map[string]int64)
+		}
+		fallback()
+	}
+
+	if a.StreamSpecMap != nil {
+		for spec := range a.StreamSpecMap {
+			if spec.IsData() && !spec.IsDefault() {
+				delete(a.StreamSpecMap, spec)
+			}
+		}
+		for name, size := range a.StreamInfoMap {
+			a.StreamSpecMap[StreamSpec{Name: name, Type: TypeData}] = size
+		}
+	}
+}
+
+// RemoveAllADS removes all alternate data streams from the file, leaving
+// only the unnamed data stream, in which data are normally stored.
+func (a *FileADS) RemoveAllADS() error {
+	var err error
+
+	// collect current ADS
+	err = a.CollectADS()
+	if err != nil {
+		return err
+	}
+
+	a.mut.Lock()
+	defer a.mut.Unlock()
+
+	for name := range a.StreamInfoMap {
+		if removeErr := a.fs.RemoveStream(a.Path, name); removeErr != nil {
+			err = errors.Join(err, removeErr)
+			continue
+		}
+
+		delete(a.StreamInfoMap, name)
+	}
+
+	return err
+}
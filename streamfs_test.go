@@ -0,0 +1,115 @@
+package ntfs_ads
+
+import (
+	"errors"
+	"io/fs"
+	"testing"
+)
+
+func TestFileADSRemove(t *testing.T) {
+	all := map[string]int64{"Zone.Identifier": 4, "other": 1}
+
+	tests := []struct {
+		name    string
+		wantErr error
+		want    map[string]int64
+	}{
+		{"Zone.Identifier", nil, map[string]int64{"other": 1}},
+		{"zone.identifier", nil, map[string]int64{"other": 1}},
+		{"ZONE.IDENTIFIER:$DATA", nil, map[string]int64{"other": 1}},
+		{"missing", fs.ErrNotExist, all},
+		{"::$DATA", ErrInvalidStreamSpec, all},
+		{":$DATA", fs.ErrNotExist, all},
+		{"$I30:$INDEX_ALLOCATION", ErrInvalidStreamSpec, all},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newTestFS(t, map[string]string{"Zone.Identifier": "zone", "other": "o"})
+
+			ads, err := NewFileADS(m, "file.txt")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if err = ads.RemoveADS(tt.name); !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got error %v, want %v", err, tt.wantErr)
+			}
+			if !equalStreams(ads.StreamInfoMap, tt.want) {
+				t.Errorf("got %v, want %v", ads.StreamInfoMap, tt.want)
+			}
+
+			// the unnamed data stream is kept
+			specs, err := m.ListAllStreams("file.txt")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if size, ok := specs[StreamSpec{Type: TypeData}]; !ok || size != int64(len("unnamed")) {
+				t.Errorf("unnamed data stream is changed: %v", specs)
+			}
+		})
+	}
+}
+
+func TestFileADSRename(t *testing.T) {
+	tests := []struct {
+		old, new string
+		wantErr  error
+		want     map[string]int64
+	}{
+		{"a", "b", nil, map[string]int64{"b": 1}},
+		{"A", "b", nil, map[string]int64{"b": 1}},
+		{"a:$DATA", "B:$data", nil, map[string]int64{"B": 1}},
+		{"a", "::$DATA", ErrInvalidStreamSpec, map[string]int64{"a": 1}},
+		{"c", "b", fs.ErrNotExist, map[string]int64{"a": 1}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.old+"->"+tt.new, func(t *testing.T) {
+			m := newTestFS(t, map[string]string{"a": "a"})
+
+			ads, err := NewFileADS(m, "file.txt")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if err = ads.RenameADS(tt.old, tt.new, false); !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got error %v, want %v", err, tt.wantErr)
+			}
+			if !equalStreams(ads.StreamInfoMap, tt.want) {
+				t.Errorf("got %v, want %v", ads.StreamInfoMap, tt.want)
+			}
+		})
+	}
+}
+
+func TestFileADSCollectAllTypes(t *testing.T) {
+	m := newTestFS(t, map[string]string{"a": "a"})
+
+	ads, err := NewFileADS(m, "file.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = ads.CollectADS(CollectAllTypes); err != nil {
+		t.Fatal(err)
+	}
+
+	// typed streams are kept out of StreamInfoMap
+	if !equalStreams(ads.StreamInfoMap, map[string]int64{"a": 1}) {
+		t.Errorf("got StreamInfoMap %v", ads.StreamInfoMap)
+	}
+
+	want := map[StreamSpec]int64{
+		{Type: TypeData}:            int64(len("unnamed")),
+		{Name: "a", Type: TypeData}: 1,
+	}
+	if len(ads.StreamSpecMap) != len(want) {
+		t.Fatalf("got StreamSpecMap %v, want %v", ads.StreamSpecMap, want)
+	}
+	for spec, size := range want {
+		if ads.StreamSpecMap[spec] != size {
+			t.Errorf("got StreamSpecMap %v, want %v", ads.StreamSpecMap, want)
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package ntfs_ads
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf16"
+)
+
+// names of NTFS attribute types used in stream specifiers
+const (
+	TypeStandardInformation = "$STANDARD_INFORMATION"
+	TypeAttributeList       = "$ATTRIBUTE_LIST"
+	TypeFileName            = "$FILE_NAME"
+	TypeObjectID            = "$OBJECT_ID"
+	TypeSecurityDescriptor  = "$SECURITY_DESCRIPTOR"
+	TypeVolumeName          = "$VOLUME_NAME"
+	TypeVolumeInformation   = "$VOLUME_INFORMATION"
+	TypeData                = "$DATA"
+	TypeIndexRoot           = "$INDEX_ROOT"
+	TypeIndexAllocation     = "$INDEX_ALLOCATION"
+	TypeBitmap              = "$BITMAP"
+	TypeReparsePoint        = "$REPARSE_POINT"
+	TypeEAInformation       = "$EA_INFORMATION"
+	TypeEA                  = "$EA"
+	TypeLoggedUtilityStream = "$LOGGED_UTILITY_STREAM"
+)
+
+var attributeTypes = []string{
+	TypeStandardInformation, TypeAttributeList, TypeFileName, TypeObjectID,
+	TypeSecurityDescriptor, TypeVolumeName, TypeVolumeInformation, TypeData,
+	TypeIndexRoot, TypeIndexAllocation, TypeBitmap, TypeReparsePoint,
+	TypeEAInformation, TypeEA, TypeLoggedUtilityStream,
+}
+
+var ErrInvalidStreamSpec = errors.New("invalid stream specifier")
+
+// StreamSpec is a stream specifier ":name:$TYPE" following a file name.
+type StreamSpec struct {
+	Name string // name of the stream, empty for the unnamed stream
+	Type string // attribute type in upper case, e.g. "$DATA"
+}
+
+// ParseStreamSpec parses stream specifier in form of ":name:$TYPE", where the
+// leading ":" and ":$TYPE" may be omitted, e.g. "name", ":name", "name:$DATA"
+// and "::$DATA" for the unnamed data stream. Type is $DATA if omitted and is
+// compared case-insensitively.
+func ParseStreamSpec(s string) (StreamSpec, error) {
+	spec := strings.TrimPrefix(s, ":")
+
+	name, typ, hasType := strings.Cut(spec, ":")
+	if !hasType {
+		typ = TypeData
+	}
+
+	if name == "" && !hasType {
+		return StreamSpec{}, fmt.Errorf("%w: \"%s\" has no name or type", ErrInvalidStreamSpec, s)
+	}
+
+	found := false
+	for _, t := range attributeTypes {
+		if strings.EqualFold(t, typ) {
+			typ, found = t, true
+			break
+		}
+	}
+	if !found {
+		return StreamSpec{}, fmt.Errorf("%w: unknown type \"%s\" in \"%s\"", ErrInvalidStreamSpec, typ, s)
+	}
+
+	if name != "" && !ValidStreamName(name) {
+		return StreamSpec{}, fmt.Errorf("%w: invalid name \"%s\" in \"%s\"", ErrInvalidStreamSpec, name, s)
+	}
+
+	return StreamSpec{Name: name, Type: typ}, nil
+}
+
+// ValidStreamName reports whether name is a valid name of a named data stream
+// without type, not empty and without ":", "/", "\" and NUL, up to 255 UTF-16
+// code units.
+func ValidStreamName(name string) bool {
+	if name == "" || len(utf16.Encode([]rune(name))) > maxStreamNameLen {
+		return false
+	}
+
+	return !strings.ContainsAny(name, "\x00\\/:")
+}
+
+// String returns the stream specifier as ":name:$TYPE".
+func (s StreamSpec) String() string {
+	return ":" + s.Qualified()
+}
+
+// Qualified returns "name:$TYPE", which can be passed as name of a stream to
+// OpenFileADS on Windows.
+func (s StreamSpec) Qualified() string {
+	return s.Name + ":" + s.Type
+}
+
+// IsData reports whether the stream is a data stream.
+func (s StreamSpec) IsData() bool {
+	return s.Type == TypeData
+}
+
+// IsDefault reports whether the stream is the unnamed data stream "::$DATA".
+func (s StreamSpec) IsDefault() bool {
+	return s.Name == "" && s.IsData()
+}
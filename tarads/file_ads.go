@@ -0,0 +1,81 @@
+//go:build windows || linux
+// +build windows linux
+
+package tarads
+
+import (
+	"archive/tar"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/Snshadow/ntfs-ads"
+)
+
+// AddFile writes the file, directory or symbolic link at path as an entry of
+// the name, followed by entries of its named streams from GetFileADS.
+func AddFile(tw *tar.Writer, path, name string) error {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return err
+	}
+
+	var link string
+	if info.Mode()&os.ModeSymlink != 0 {
+		if link, err = os.Readlink(path); err != nil {
+			return err
+		}
+	}
+
+	hdr, err := tar.FileInfoHeader(info, link)
+	if err != nil {
+		return err
+	}
+	hdr.Name = name
+	if info.IsDir() {
+		hdr.Name = strings.TrimSuffix(name, "/") + "/"
+	}
+
+	if err = tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+
+	if info.Mode().IsRegular() {
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		if _, err = io.CopyN(tw, f, hdr.Size); err != nil {
+			return err
+		}
+	} else if !info.IsDir() {
+		// streams of symbolic links and devices are not followed
+		return nil
+	}
+
+	ads, err := ntfs_ads.GetFileADS(path)
+	if err != nil {
+		if noStreams(err) {
+			return nil
+		}
+
+		return err
+	}
+
+	return WriteFileADS(tw, &ads, hdr)
+}
+
+// NewReader returns Reader restoring named streams with OpenFileADS into files
+// extracted under dir.
+func NewReader(tr *tar.Reader, dir string) *Reader {
+	return &Reader{
+		tr:  tr,
+		dir: dir,
+		open: func(path, name string) (io.WriteCloser, error) {
+			return ntfs_ads.OpenFileADS(path, name, restoreFlag)
+		},
+		files: make(map[string]bool),
+	}
+}
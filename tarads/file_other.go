@@ -0,0 +1,29 @@
+//go:build !windows && !linux
+// +build !windows,!linux
+
+package tarads
+
+import (
+	"archive/tar"
+	"io"
+
+	"github.com/Snshadow/ntfs-ads"
+)
+
+// AddFile is not supported on this platform, use WriteFileADS with a StreamFS.
+func AddFile(tw *tar.Writer, path, name string) error {
+	return ntfs_ads.ErrUnsupported
+}
+
+// NewReader returns Reader which cannot restore named streams on this
+// platform, entries of streams are returned to be extracted as sidecar files.
+func NewReader(tr *tar.Reader, dir string) *Reader {
+	return &Reader{
+		tr:  tr,
+		dir: dir,
+		open: func(path, name string) (io.WriteCloser, error) {
+			return nil, ntfs_ads.ErrUnsupported
+		},
+		files: make(map[string]bool),
+	}
+}
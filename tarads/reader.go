@@ -0,0 +1,110 @@
+package tarads
+
+import (
+	"archive/tar"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/Snshadow/ntfs-ads"
+	"github.com/Snshadow/ntfs-ads/internal/streamentry"
+)
+
+var (
+	ErrInvalidStream = errors.New("invalid stream entry")
+)
+
+// Reader reads entries of a tar archive, restoring entries of named streams
+// into files extracted under a directory.
+type Reader struct {
+	tr    *tar.Reader
+	dir   string
+	open  func(path, name string) (io.WriteCloser, error)
+	files map[string]bool // names of files and directories returned by Next
+}
+
+// NewReaderFS returns Reader restoring named streams into files in fsys,
+// path of a file is its entry name joined to dir.
+func NewReaderFS(tr *tar.Reader, fsys ntfs_ads.StreamFS, dir string) *Reader {
+	return &Reader{
+		tr:  tr,
+		dir: dir,
+		open: func(path, name string) (io.WriteCloser, error) {
+			return fsys.OpenStream(path, name, restoreFlag)
+		},
+		files: make(map[string]bool),
+	}
+}
+
+// Next restores entries of named streams and returns the header of the next
+// entry which should be extracted by the caller, or io.EOF at the end of the
+// archive. Entries of files should be extracted before their streams follow,
+// streams are only restored into regular files and directories returned by
+// Next before, which are not symbolic links or under them on disk.
+//
+// If the file system returns ErrUnsupported, the entry of the stream is
+// returned to be extracted as a sidecar file named "<file>:<stream>".
+func (r *Reader) Next() (*tar.Header, error) {
+	for {
+		hdr, err := r.tr.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		name, stream, ok := ParseStreamHeader(hdr)
+		if !ok {
+			if hdr.Typeflag == tar.TypeReg || hdr.Typeflag == tar.TypeDir {
+				r.files[strings.TrimSuffix(hdr.Name, "/")] = true
+			}
+
+			return hdr, nil
+		}
+
+		if !ntfs_ads.ValidStreamName(stream) {
+			return nil, fmt.Errorf("%w: name of stream \"%s\" is invalid", ErrInvalidStream, hdr.Name)
+		}
+		if !filepath.IsLocal(filepath.FromSlash(name)) {
+			return nil, fmt.Errorf("%w: file \"%s\" of stream \"%s\" is outside of the directory", ErrInvalidStream, name, stream)
+		}
+		if !r.files[name] {
+			return nil, fmt.Errorf("%w: file \"%s\" of stream \"%s\" is not extracted before", ErrInvalidStream, name, stream)
+		}
+		link, err := streamentry.Symlink(r.dir, name)
+		if err != nil {
+			return nil, err
+		}
+		if link != "" {
+			return nil, fmt.Errorf("%w: \"%s\" of stream \"%s\" is a symbolic link", ErrInvalidStream, link, stream)
+		}
+
+		path := filepath.Join(r.dir, filepath.FromSlash(name))
+		if err = r.restoreStream(path, stream); err != nil {
+			if errors.Is(err, ntfs_ads.ErrUnsupported) {
+				return hdr, nil
+			}
+
+			return nil, fmt.Errorf("could not restore stream \"%s\" of \"%s\": %w", stream, path, err)
+		}
+	}
+}
+
+func (r *Reader) restoreStream(path, name string) error {
+	w, err := r.open(path, name)
+	if err != nil {
+		return err
+	}
+
+	if _, err = io.Copy(w, r.tr); err != nil {
+		w.Close()
+		return err
+	}
+
+	return w.Close()
+}
+
+// Read reads data of the current entry returned by Next.
+func (r *Reader) Read(b []byte) (int, error) {
+	return r.tr.Read(b)
+}
@@ -0,0 +1,115 @@
+// Package tarads keeps named data streams of files in tar archives.
+//
+// Each named stream of a file is stored as a regular entry following the
+// entry of the file, named "<file>:<stream>" with PAX record "NTFSADS.stream"
+// holding the name of the stream, e.g. "dir/a.txt:Zone.Identifier". Tools
+// which do not know the convention extract the entry as a sidecar file next to
+// the file, or as the stream itself on Windows.
+package tarads
+
+import (
+	"archive/tar"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+
+	"github.com/Snshadow/ntfs-ads"
+	"github.com/Snshadow/ntfs-ads/internal/streamentry"
+)
+
+const (
+	// PAXStream is the key of PAX record holding the name of the stream.
+	PAXStream = "NTFSADS.stream"
+)
+
+// restoreFlag opens streams of the file for restoring.
+const restoreFlag = os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+
+// StreamHeader returns header of the entry for the stream of size bytes,
+// owner, mode and times are copied from hdr of the file.
+func StreamHeader(hdr *tar.Header, stream string, size int64) *tar.Header {
+	mode := hdr.Mode &^ 0111
+	if hdr.Typeflag == tar.TypeDir {
+		mode = 0644
+	}
+
+	return &tar.Header{
+		Typeflag:   tar.TypeReg,
+		Name:       streamentry.Name(hdr.Name, stream),
+		Size:       size,
+		Mode:       mode,
+		Uid:        hdr.Uid,
+		Gid:        hdr.Gid,
+		Uname:      hdr.Uname,
+		Gname:      hdr.Gname,
+		ModTime:    hdr.ModTime,
+		PAXRecords: map[string]string{PAXStream: stream},
+		Format:     tar.FormatPAX,
+	}
+}
+
+// ParseStreamHeader returns entry name of the file and name of the stream if
+// hdr is an entry of a named stream. The name of the stream is not validated.
+func ParseStreamHeader(hdr *tar.Header) (name, stream string, ok bool) {
+	stream, ok = hdr.PAXRecords[PAXStream]
+	if !ok || stream == "" || hdr.Typeflag != tar.TypeReg {
+		return "", "", false
+	}
+
+	name, ok = streamentry.FileName(hdr.Name, stream)
+	if !ok {
+		return "", "", false
+	}
+
+	return name, stream, true
+}
+
+// WriteFileADS writes all named streams of ads as entries following the
+// entry of the file, which should be written with hdr before.
+func WriteFileADS(tw *tar.Writer, ads *ntfs_ads.FileADS, hdr *tar.Header) error {
+	names := make([]string, 0, len(ads.StreamInfoMap))
+	for name := range ads.StreamInfoMap {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if err := writeStream(tw, ads, hdr, name); err != nil {
+			return fmt.Errorf("could not write stream \"%s\" of \"%s\": %w", name, ads.Path, err)
+		}
+	}
+
+	return nil
+}
+
+func writeStream(tw *tar.Writer, ads *ntfs_ads.FileADS, hdr *tar.Header, name string) error {
+	strm, err := ads.OpenADS(name, os.O_RDONLY)
+	if err != nil {
+		return err
+	}
+	defer strm.Close()
+
+	// size in StreamInfoMap may be outdated
+	size, err := strm.Seek(0, io.SeekEnd)
+	if err != nil {
+		return err
+	}
+	if _, err = strm.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	if err = tw.WriteHeader(StreamHeader(hdr, name, size)); err != nil {
+		return err
+	}
+
+	_, err = io.CopyN(tw, strm, size)
+
+	return err
+}
+
+// noStreams reports whether err only tells that the file has no stream to be written.
+func noStreams(err error) bool {
+	return errors.Is(err, ntfs_ads.ErrNoADS) || errors.Is(err, ntfs_ads.ErrUnsupported)
+}
@@ -0,0 +1,106 @@
+package tarads
+
+import (
+	"archive/tar"
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Snshadow/ntfs-ads"
+)
+
+// archive returns a tar archive of "file.txt" followed by entries of streams
+// named by keys of streams.
+func archive(t *testing.T, file string, streams map[string]string) *tar.Reader {
+	t.Helper()
+
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+
+	hdr := &tar.Header{Typeflag: tar.TypeReg, Name: file, Mode: 0755, Size: 7, ModTime: time.Unix(0, 0)}
+	if err := tw.WriteHeader(hdr); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.WriteString(tw, "unnamed"); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, content := range streams {
+		sh := StreamHeader(hdr, name, int64(len(content)))
+		sh.Name = "file.txt:" + name
+		if err := tw.WriteHeader(sh); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := io.WriteString(tw, content); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	return tar.NewReader(&buf)
+}
+
+func TestReaderNext(t *testing.T) {
+	m := ntfs_ads.NewMemFS()
+	r := NewReaderFS(archive(t, "file.txt", map[string]string{"Zone.Identifier": "zone"}), m, "")
+
+	hdr, err := r.Next()
+	if err != nil {
+		t.Fatalf("Next: %v", err)
+	}
+	if hdr.Name != "file.txt" {
+		t.Fatalf("got entry %q, want %q", hdr.Name, "file.txt")
+	}
+	if err = m.WriteFile(hdr.Name, []byte("unnamed")); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = r.Next(); err != io.EOF {
+		t.Fatalf("Next: got %v, want %v", err, io.EOF)
+	}
+
+	strm, err := m.OpenStream("file.txt", "Zone.Identifier", os.O_RDONLY)
+	if err != nil {
+		t.Fatalf("OpenStream: %v", err)
+	}
+	defer strm.Close()
+
+	if b, _ := io.ReadAll(strm); string(b) != "zone" {
+		t.Errorf("got stream %q, want %q", b, "zone")
+	}
+}
+
+func TestReaderInvalidStream(t *testing.T) {
+	tests := []struct {
+		name   string
+		file   string
+		stream string
+	}{
+		{"attribute type", "file.txt", "x:$INDEX_ALLOCATION"},
+		{"backslash", "file.txt", "a\\b"},
+		{"too long", "file.txt", strings.Repeat("a", 256)},
+		{"not extracted", "other.txt", "Zone.Identifier"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := ntfs_ads.NewMemFS()
+			r := NewReaderFS(archive(t, tt.file, map[string]string{tt.stream: "data"}), m, "")
+
+			if _, err := r.Next(); err != nil {
+				t.Fatalf("Next: %v", err)
+			}
+
+			if _, err := r.Next(); !errors.Is(err, ErrInvalidStream) {
+				t.Errorf("got %v, want %v", err, ErrInvalidStream)
+			}
+		})
+	}
+}
@@ -0,0 +1,389 @@
+// Package usn parses records of NTFS USN change journal($Extend\$UsnJrnl:$J),
+// which is read from a volume image with ntfsimage package or as ADS of a
+// live volume with OpenFileADS.
+package usn
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/Snshadow/ntfs-ads/internal/winfmt"
+)
+
+// JournalPath and JournalStream locate the change journal in a NTFS volume.
+const (
+	JournalPath   = "$Extend\\$UsnJrnl"
+	JournalStream = "$J"
+)
+
+const (
+	minRecordSize = 0x3C     // size of USN_RECORD_V2 without file name
+	maxRecordSize = 64 << 10 // larger records are treated as corrupted
+	windowSize    = 1 << 20  // bytes of the journal read at once
+	recordAlign   = 8        // records are aligned in the journal
+)
+
+var (
+	ErrInvalidRecord = errors.New("invalid USN record")
+)
+
+// Reason is reason flags of USN record.
+type Reason uint32
+
+const (
+	ReasonDataOverwrite             Reason = 0x00000001
+	ReasonDataExtend                Reason = 0x00000002
+	ReasonDataTruncation            Reason = 0x00000004
+	ReasonNamedDataOverwrite        Reason = 0x00000010
+	ReasonNamedDataExtend           Reason = 0x00000020
+	ReasonNamedDataTruncation       Reason = 0x00000040
+	ReasonFileCreate                Reason = 0x00000100
+	ReasonFileDelete                Reason = 0x00000200
+	ReasonEAChange                  Reason = 0x00000400
+	ReasonSecurityChange            Reason = 0x00000800
+	ReasonRenameOldName             Reason = 0x00001000
+	ReasonRenameNewName             Reason = 0x00002000
+	ReasonIndexableChange           Reason = 0x00004000
+	ReasonBasicInfoChange           Reason = 0x00008000
+	ReasonHardLinkChange            Reason = 0x00010000
+	ReasonCompressionChange         Reason = 0x00020000
+	ReasonEncryptionChange          Reason = 0x00040000
+	ReasonObjectIDChange            Reason = 0x00080000
+	ReasonReparsePointChange        Reason = 0x00100000
+	ReasonStreamChange              Reason = 0x00200000
+	ReasonTransactedChange          Reason = 0x00400000
+	ReasonIntegrityChange           Reason = 0x00800000
+	ReasonDesiredStorageClassChange Reason = 0x01000000
+	ReasonClose                     Reason = 0x80000000
+
+	// ReasonNamedStream has reasons of changes to named data streams, a named
+	// stream was added, removed or renamed for ReasonStreamChange.
+	ReasonNamedStream = ReasonNamedDataOverwrite | ReasonNamedDataExtend | ReasonNamedDataTruncation | ReasonStreamChange
+)
+
+var reasonNames = []struct {
+	reason Reason
+	name   string
+}{
+	{ReasonDataOverwrite, "DATA_OVERWRITE"},
+	{ReasonDataExtend, "DATA_EXTEND"},
+	{ReasonDataTruncation, "DATA_TRUNCATION"},
+	{ReasonNamedDataOverwrite, "NAMED_DATA_OVERWRITE"},
+	{ReasonNamedDataExtend, "NAMED_DATA_EXTEND"},
+	{ReasonNamedDataTruncation, "NAMED_DATA_TRUNCATION"},
+	{ReasonFileCreate, "FILE_CREATE"},
+	{ReasonFileDelete, "FILE_DELETE"},
+	{ReasonEAChange, "EA_CHANGE"},
+	{ReasonSecurityChange, "SECURITY_CHANGE"},
+	{ReasonRenameOldName, "RENAME_OLD_NAME"},
+	{ReasonRenameNewName, "RENAME_NEW_NAME"},
+	{ReasonIndexableChange, "INDEXABLE_CHANGE"},
+	{ReasonBasicInfoChange, "BASIC_INFO_CHANGE"},
+	{ReasonHardLinkChange, "HARD_LINK_CHANGE"},
+	{ReasonCompressionChange, "COMPRESSION_CHANGE"},
+	{ReasonEncryptionChange, "ENCRYPTION_CHANGE"},
+	{ReasonObjectIDChange, "OBJECT_ID_CHANGE"},
+	{ReasonReparsePointChange, "REPARSE_POINT_CHANGE"},
+	{ReasonStreamChange, "STREAM_CHANGE"},
+	{ReasonTransactedChange, "TRANSACTED_CHANGE"},
+	{ReasonIntegrityChange, "INTEGRITY_CHANGE"},
+	{ReasonDesiredStorageClassChange, "DESIRED_STORAGE_CLASS_CHANGE"},
+	{ReasonClose, "CLOSE"},
+}
+
+// String returns names of the flags joined with "|".
+func (r Reason) String() string {
+	var names []string
+
+	for _, rn := range reasonNames {
+		if r&rn.reason != 0 {
+			names = append(names, rn.name)
+			r &^= rn.reason
+		}
+	}
+
+	if r != 0 {
+		names = append(names, fmt.Sprintf("0x%X", uint32(r)))
+	}
+
+	return strings.Join(names, "|")
+}
+
+// FileID is 128 bit file ID of USN record, V2 records have 64 bit file
+// reference in the lower half.
+type FileID [16]byte
+
+// Reference returns lower 64 bits of the ID, which is the file reference in NTFS.
+func (id FileID) Reference() uint64 {
+	return binary.LittleEndian.Uint64(id[:8])
+}
+
+// Record returns MFT record number of the file reference.
+func (id FileID) Record() uint64 {
+	return id.Reference() & 0xFFFFFFFFFFFF
+}
+
+// Sequence returns sequence number of the file reference.
+func (id FileID) Sequence() uint16 {
+	return uint16(id.Reference() >> 48)
+}
+
+// String returns "record-sequence" of NTFS file reference, or hex of the
+// whole ID if upper 64 bits are used(e.g. ReFS).
+func (id FileID) String() string {
+	if binary.LittleEndian.Uint64(id[8:]) != 0 {
+		return fmt.Sprintf("%X", id[:])
+	}
+
+	return fmt.Sprintf("%d-%d", id.Record(), id.Sequence())
+}
+
+// Extent is a range of the file changed, reported by USN_RECORD_V4.
+type Extent struct {
+	Offset int64
+	Length int64
+}
+
+// Record is a USN_RECORD_V2, V3 or V4.
+type Record struct {
+	Offset          int64 // offset of the record in the journal stream
+	MajorVersion    uint16
+	MinorVersion    uint16
+	FileReference   FileID
+	ParentReference FileID
+	USN             int64
+	Timestamp       time.Time // zero for V4
+	Reason          Reason
+	SourceInfo      uint32
+	SecurityID      uint32   // zero for V4
+	FileAttributes  uint32   // zero for V4
+	FileName        string   // empty for V4
+	Extents         []Extent // changed ranges for V4
+}
+
+// NamedStreamEvent reports whether the record tells a change of named data stream.
+func (rec *Record) NamedStreamEvent() bool {
+	return rec.Reason&ReasonNamedStream != 0
+}
+
+// ParseRecord parses a USN record at start of b, whose length is given by RecordLength of the record.
+func ParseRecord(b []byte) (*Record, error) {
+	if len(b) < 8 {
+		return nil, fmt.Errorf("%w: too short", ErrInvalidRecord)
+	}
+
+	length := int(binary.LittleEndian.Uint32(b[0:]))
+	if length < minRecordSize || length > len(b) {
+		return nil, fmt.Errorf("%w: bad record length %d", ErrInvalidRecord, length)
+	}
+	b = b[:length]
+
+	rec := &Record{
+		MajorVersion: binary.LittleEndian.Uint16(b[4:]),
+		MinorVersion: binary.LittleEndian.Uint16(b[6:]),
+	}
+
+	var nameLen, nameOffset int
+
+	switch rec.MajorVersion {
+	case 2:
+		binary.LittleEndian.PutUint64(rec.FileReference[:], binary.LittleEndian.Uint64(b[0x08:]))
+		binary.LittleEndian.PutUint64(rec.ParentReference[:], binary.LittleEndian.Uint64(b[0x10:]))
+		rec.USN = int64(binary.LittleEndian.Uint64(b[0x18:]))
+		rec.Timestamp = winfmt.FiletimeToTime(binary.LittleEndian.Uint64(b[0x20:]))
+		rec.Reason = Reason(binary.LittleEndian.Uint32(b[0x28:]))
+		rec.SourceInfo = binary.LittleEndian.Uint32(b[0x2C:])
+		rec.SecurityID = binary.LittleEndian.Uint32(b[0x30:])
+		rec.FileAttributes = binary.LittleEndian.Uint32(b[0x34:])
+		nameLen = int(binary.LittleEndian.Uint16(b[0x38:]))
+		nameOffset = int(binary.LittleEndian.Uint16(b[0x3A:]))
+	case 3:
+		if length < 0x4C {
+			return nil, fmt.Errorf("%w: V3 record too short", ErrInvalidRecord)
+		}
+		copy(rec.FileReference[:], b[0x08:0x18])
+		copy(rec.ParentReference[:], b[0x18:0x28])
+		rec.USN = int64(binary.LittleEndian.Uint64(b[0x28:]))
+		rec.Timestamp = winfmt.FiletimeToTime(binary.LittleEndian.Uint64(b[0x30:]))
+		rec.Reason = Reason(binary.LittleEndian.Uint32(b[0x38:]))
+		rec.SourceInfo = binary.LittleEndian.Uint32(b[0x3C:])
+		rec.SecurityID = binary.LittleEndian.Uint32(b[0x40:])
+		rec.FileAttributes = binary.LittleEndian.Uint32(b[0x44:])
+		nameLen = int(binary.LittleEndian.Uint16(b[0x48:]))
+		nameOffset = int(binary.LittleEndian.Uint16(b[0x4A:]))
+	case 4:
+		if length < 0x40 {
+			return nil, fmt.Errorf("%w: V4 record too short", ErrInvalidRecord)
+		}
+		copy(rec.FileReference[:], b[0x08:0x18])
+		copy(rec.ParentReference[:], b[0x18:0x28])
+		rec.USN = int64(binary.LittleEndian.Uint64(b[0x28:]))
+		rec.Reason = Reason(binary.LittleEndian.Uint32(b[0x30:]))
+		rec.SourceInfo = binary.LittleEndian.Uint32(b[0x34:])
+
+		count := int(binary.LittleEndian.Uint16(b[0x3C:]))
+		extentSize := int(binary.LittleEndian.Uint16(b[0x3E:]))
+		if count > 0 && (extentSize < 16 || 0x40+count*extentSize > length) {
+			return nil, fmt.Errorf("%w: extents of V4 record out of range", ErrInvalidRecord)
+		}
+
+		for i := 0; i < count; i++ {
+			ext := b[0x40+i*extentSize:]
+			rec.Extents = append(rec.Extents, Extent{
+				Offset: int64(binary.LittleEndian.Uint64(ext[0:])),
+				Length: int64(binary.LittleEndian.Uint64(ext[8:])),
+			})
+		}
+
+		return rec, nil
+	default:
+		return nil, fmt.Errorf("%w: unknown version %d.%d", ErrInvalidRecord, rec.MajorVersion, rec.MinorVersion)
+	}
+
+	if nameOffset+nameLen > length || nameLen%2 != 0 {
+		return nil, fmt.Errorf("%w: file name out of range", ErrInvalidRecord)
+	}
+	rec.FileName = winfmt.DecodeUTF16(b[nameOffset : nameOffset+nameLen])
+
+	return rec, nil
+}
+
+// Reader reads records from the journal stream in order. Zero filled and
+// sparse ranges of the stream are skipped, and corrupted records are skipped
+// until the next valid record.
+type Reader struct {
+	r    io.ReaderAt
+	size int64
+	off  int64
+
+	window    []byte
+	windowOff int64
+}
+
+// NewReader returns Reader reading the journal stream of size in bytes.
+func NewReader(r io.ReaderAt, size int64) *Reader {
+	return &Reader{
+		r:    r,
+		size: size,
+	}
+}
+
+// read returns n bytes of the journal at off from the window.
+func (jr *Reader) read(off int64, n int) ([]byte, error) {
+	if off < jr.windowOff || off+int64(n) > jr.windowOff+int64(len(jr.window)) {
+		size := int64(windowSize)
+		if remain := jr.size - off; size > remain {
+			size = remain
+		}
+
+		if jr.window == nil {
+			jr.window = make([]byte, windowSize)
+		}
+		jr.window = jr.window[:size]
+		jr.windowOff = off
+
+		if _, err := jr.r.ReadAt(jr.window, off); err != nil && err != io.EOF {
+			jr.window = jr.window[:0]
+			return nil, err
+		}
+	}
+
+	if start := off - jr.windowOff; start+int64(n) <= int64(len(jr.window)) {
+		return jr.window[start : start+int64(n)], nil
+	}
+
+	return nil, io.ErrUnexpectedEOF
+}
+
+// skipZeros moves to the next aligned non zero byte.
+func (jr *Reader) skipZeros() error {
+	for jr.off < jr.size {
+		n := int64(windowSize)
+		if remain := jr.size - jr.off; n > remain {
+			n = remain
+		}
+
+		b, err := jr.read(jr.off, int(n))
+		if err != nil {
+			return err
+		}
+
+		for i, c := range b {
+			if c != 0 {
+				jr.off += int64(i) &^ (recordAlign - 1)
+				return nil
+			}
+		}
+
+		jr.off += n
+	}
+
+	return nil
+}
+
+// Next returns the next record, or io.EOF at end of the journal.
+func (jr *Reader) Next() (*Record, error) {
+	for {
+		if err := jr.skipZeros(); err != nil {
+			return nil, err
+		}
+
+		if jr.off+minRecordSize > jr.size {
+			return nil, io.EOF
+		}
+
+		header, err := jr.read(jr.off, 8)
+		if err != nil {
+			return nil, err
+		}
+
+		length := int64(binary.LittleEndian.Uint32(header))
+		if length < minRecordSize || length > maxRecordSize || jr.off+length > jr.size {
+			jr.off += recordAlign
+			continue
+		}
+
+		b, err := jr.read(jr.off, int(length))
+		if err != nil {
+			return nil, err
+		}
+
+		rec, err := ParseRecord(b)
+		if err != nil {
+			jr.off += recordAlign
+			continue
+		}
+
+		rec.Offset = jr.off
+		jr.off += (length + recordAlign - 1) &^ (recordAlign - 1)
+
+		return rec, nil
+	}
+}
+
+// WalkStreamEvents calls fn for every record of the journal stream of size in
+// bytes, which tells a change of named data stream.
+func WalkStreamEvents(r io.ReaderAt, size int64, fn func(*Record) error) error {
+	jr := NewReader(r, size)
+
+	for {
+		rec, err := jr.Next()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		if !rec.NamedStreamEvent() {
+			continue
+		}
+
+		if err = fn(rec); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,275 @@
+package usn
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"reflect"
+	"testing"
+	"time"
+	"unicode/utf16"
+)
+
+// 2022-06-18 04:26:40 UTC
+const testFiletime = 133000000000000000
+
+var testTime = time.Date(2022, 6, 18, 4, 26, 40, 0, time.UTC)
+
+func utf16le(s string) []byte {
+	var b []byte
+	for _, c := range utf16.Encode([]rune(s)) {
+		b = binary.LittleEndian.AppendUint16(b, c)
+	}
+
+	return b
+}
+
+func fileID(ref, upper uint64) FileID {
+	var id FileID
+	binary.LittleEndian.PutUint64(id[:], ref)
+	binary.LittleEndian.PutUint64(id[8:], upper)
+
+	return id
+}
+
+// v2Record returns USN_RECORD_V2, whose length is not padded to 8 bytes.
+func v2Record(ref uint64, usn int64, reason Reason, name string) []byte {
+	n := utf16le(name)
+	b := make([]byte, minRecordSize+len(n))
+	binary.LittleEndian.PutUint32(b, uint32(len(b)))
+	binary.LittleEndian.PutUint16(b[4:], 2)
+	binary.LittleEndian.PutUint64(b[0x08:], ref)
+	binary.LittleEndian.PutUint64(b[0x10:], 5|5<<48)
+	binary.LittleEndian.PutUint64(b[0x18:], uint64(usn))
+	binary.LittleEndian.PutUint64(b[0x20:], testFiletime)
+	binary.LittleEndian.PutUint32(b[0x28:], uint32(reason))
+	binary.LittleEndian.PutUint32(b[0x30:], 0x100)
+	binary.LittleEndian.PutUint32(b[0x34:], 0x20)
+	binary.LittleEndian.PutUint16(b[0x38:], uint16(len(n)))
+	binary.LittleEndian.PutUint16(b[0x3A:], minRecordSize)
+	copy(b[minRecordSize:], n)
+
+	return b
+}
+
+// v3Record returns USN_RECORD_V3 padded to 8 bytes.
+func v3Record(ref FileID, usn int64, reason Reason, name string) []byte {
+	n := utf16le(name)
+	b := make([]byte, (0x4C+len(n)+7)&^7)
+	binary.LittleEndian.PutUint32(b, uint32(len(b)))
+	binary.LittleEndian.PutUint16(b[4:], 3)
+	copy(b[0x08:], ref[:])
+	binary.LittleEndian.PutUint64(b[0x18:], 5|5<<48)
+	binary.LittleEndian.PutUint64(b[0x28:], uint64(usn))
+	binary.LittleEndian.PutUint64(b[0x30:], testFiletime)
+	binary.LittleEndian.PutUint32(b[0x38:], uint32(reason))
+	binary.LittleEndian.PutUint32(b[0x40:], 0x100)
+	binary.LittleEndian.PutUint32(b[0x44:], 0x20)
+	binary.LittleEndian.PutUint16(b[0x48:], uint16(len(n)))
+	binary.LittleEndian.PutUint16(b[0x4A:], 0x4C)
+	copy(b[0x4C:], n)
+
+	return b
+}
+
+// v4Record returns USN_RECORD_V4 with extents.
+func v4Record(ref FileID, usn int64, reason Reason, extents ...Extent) []byte {
+	b := make([]byte, 0x40+len(extents)*16)
+	binary.LittleEndian.PutUint32(b, uint32(len(b)))
+	binary.LittleEndian.PutUint16(b[4:], 4)
+	copy(b[0x08:], ref[:])
+	binary.LittleEndian.PutUint64(b[0x18:], 5|5<<48)
+	binary.LittleEndian.PutUint64(b[0x28:], uint64(usn))
+	binary.LittleEndian.PutUint32(b[0x30:], uint32(reason))
+	binary.LittleEndian.PutUint16(b[0x3C:], uint16(len(extents)))
+	binary.LittleEndian.PutUint16(b[0x3E:], 16)
+	for i, ext := range extents {
+		binary.LittleEndian.PutUint64(b[0x40+i*16:], uint64(ext.Offset))
+		binary.LittleEndian.PutUint64(b[0x48+i*16:], uint64(ext.Length))
+	}
+
+	return b
+}
+
+func TestParseRecord(t *testing.T) {
+	parent := fileID(5|5<<48, 0)
+
+	tests := []struct {
+		name string
+		b    []byte
+		want *Record
+	}{
+		{"V2", v2Record(42|3<<48, 100, ReasonNamedDataExtend, "a.txt"), &Record{
+			MajorVersion: 2, FileReference: fileID(42|3<<48, 0), ParentReference: parent, USN: 100,
+			Timestamp: testTime, Reason: ReasonNamedDataExtend, SecurityID: 0x100, FileAttributes: 0x20, FileName: "a.txt",
+		}},
+		{"V3", v3Record(fileID(7, 1), 200, ReasonStreamChange, "b.txt"), &Record{
+			MajorVersion: 3, FileReference: fileID(7, 1), ParentReference: parent, USN: 200,
+			Timestamp: testTime, Reason: ReasonStreamChange, SecurityID: 0x100, FileAttributes: 0x20, FileName: "b.txt",
+		}},
+		{"V4", v4Record(fileID(42|3<<48, 0), 300, ReasonDataOverwrite, Extent{0, 4096}, Extent{8192, 512}), &Record{
+			MajorVersion: 4, FileReference: fileID(42|3<<48, 0), ParentReference: parent, USN: 300,
+			Reason: ReasonDataOverwrite, Extents: []Extent{{0, 4096}, {8192, 512}},
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseRecord(tt.b)
+			if err != nil {
+				t.Fatalf("ParseRecord: %v", err)
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseRecordInvalid(t *testing.T) {
+	tests := []struct {
+		name   string
+		b      []byte
+		modify func(b []byte)
+	}{
+		{"too short", v2Record(1, 1, 0, "")[:7], nil},
+		{"length beyond buffer", v2Record(1, 1, 0, "a"), func(b []byte) {
+			binary.LittleEndian.PutUint32(b, uint32(len(b)+8))
+		}},
+		{"length too small", v2Record(1, 1, 0, "a"), func(b []byte) {
+			binary.LittleEndian.PutUint32(b, minRecordSize-8)
+		}},
+		{"unknown version", v2Record(1, 1, 0, "a"), func(b []byte) {
+			binary.LittleEndian.PutUint16(b[4:], 5)
+		}},
+		{"name out of range", v2Record(1, 1, 0, "a"), func(b []byte) {
+			binary.LittleEndian.PutUint16(b[0x38:], 4)
+		}},
+		{"odd name length", v2Record(1, 1, 0, "a"), func(b []byte) {
+			binary.LittleEndian.PutUint16(b[0x38:], 1)
+		}},
+		{"V3 too short", v2Record(1, 1, 0, "a"), func(b []byte) {
+			binary.LittleEndian.PutUint16(b[4:], 3)
+		}},
+		{"V4 extents out of range", v4Record(fileID(1, 0), 1, 0, Extent{0, 1}), func(b []byte) {
+			binary.LittleEndian.PutUint16(b[0x3C:], 2)
+		}},
+		{"V4 extent size", v4Record(fileID(1, 0), 1, 0, Extent{0, 1}), func(b []byte) {
+			binary.LittleEndian.PutUint16(b[0x3E:], 8)
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.modify != nil {
+				tt.modify(tt.b)
+			}
+
+			if _, err := ParseRecord(tt.b); !errors.Is(err, ErrInvalidRecord) {
+				t.Errorf("got %v, want %v", err, ErrInvalidRecord)
+			}
+		})
+	}
+}
+
+// testJournal returns a journal starting with a sparse range, whose records
+// are separated by padding, garbage and zeros, and offsets of the records.
+func testJournal() ([]byte, []int64) {
+	var b []byte
+	var offsets []int64
+
+	add := func(rec []byte) {
+		offsets = append(offsets, int64(len(b)))
+		b = append(b, rec...)
+		// records are aligned to 8 bytes
+		b = append(b, make([]byte, (8-len(b)%8)%8)...)
+	}
+
+	b = make([]byte, 4096)
+	add(v2Record(40, 4096, ReasonFileCreate, "a.txt"))
+	add(v2Record(40, 4168, ReasonNamedDataExtend, "a.txt"))
+	// record of invalid length
+	b = append(b, 0x10, 0, 0, 0, 2, 0, 0, 0)
+	add(v3Record(fileID(41, 0), 4264, ReasonDataExtend|ReasonClose, "b.txt"))
+	b = append(b, make([]byte, 64)...)
+	add(v4Record(fileID(42, 0), 4408, ReasonStreamChange|ReasonClose))
+	add(v2Record(43, 4536, ReasonNamedDataOverwrite|ReasonNamedDataTruncation, "c.txt"))
+	b = append(b, make([]byte, 512)...)
+
+	return b, offsets
+}
+
+func TestReader(t *testing.T) {
+	b, want := testJournal()
+
+	jr := NewReader(bytes.NewReader(b), int64(len(b)))
+
+	var offsets []int64
+	for {
+		rec, err := jr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Next: %v", err)
+		}
+
+		offsets = append(offsets, rec.Offset)
+	}
+
+	if !reflect.DeepEqual(offsets, want) {
+		t.Errorf("got records at %v, want %v", offsets, want)
+	}
+}
+
+func TestWalkStreamEvents(t *testing.T) {
+	b, _ := testJournal()
+
+	var got []uint64
+	err := WalkStreamEvents(bytes.NewReader(b), int64(len(b)), func(rec *Record) error {
+		got = append(got, rec.FileReference.Record())
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("WalkStreamEvents: %v", err)
+	}
+
+	if want := []uint64{40, 42, 43}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got records of files %v, want %v", got, want)
+	}
+}
+
+func TestReasonString(t *testing.T) {
+	tests := []struct {
+		reason Reason
+		want   string
+	}{
+		{0, ""},
+		{ReasonNamedDataExtend | ReasonClose, "NAMED_DATA_EXTEND|CLOSE"},
+		{ReasonStreamChange | 0x02000000, "STREAM_CHANGE|0x2000000"},
+	}
+
+	for _, tt := range tests {
+		if got := tt.reason.String(); got != tt.want {
+			t.Errorf("got %q, want %q", got, tt.want)
+		}
+	}
+}
+
+func TestFileIDString(t *testing.T) {
+	tests := []struct {
+		id   FileID
+		want string
+	}{
+		{fileID(42|3<<48, 0), "42-3"},
+		{fileID(1, 2), "01000000000000000200000000000000"},
+	}
+
+	for _, tt := range tests {
+		if got := tt.id.String(); got != tt.want {
+			t.Errorf("got %q, want %q", got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,206 @@
+package vdisk
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strings"
+
+	"github.com/Snshadow/ntfs-ads/internal/winfmt"
+)
+
+// Partitioning schemes.
+const (
+	SchemeNone = "" // whole disk is a volume
+	SchemeMBR  = "MBR"
+	SchemeGPT  = "GPT"
+)
+
+const (
+	mbrSignature  = 0xAA55
+	mbrTypeGPT    = 0xEE
+	mbrMaxLogical = 128 // limit of logical partitions in EBR chain
+	gptSignature  = "EFI PART"
+	gptMaxEntries = 1024
+)
+
+// Partition is a partition of the disk.
+type Partition struct {
+	Number int // 1-based, logical partitions of MBR start from 5
+	Scheme string
+	Type   string // hex type byte for MBR, type GUID for GPT
+	Name   string // name of GPT partition
+	Offset int64  // offset in bytes from start of the disk
+	Size   int64
+	NTFS   bool // partition has NTFS boot sector
+}
+
+func (p Partition) String() string {
+	desc := fmt.Sprintf("#%d %s type %s offset %d size %d", p.Number, p.Scheme, p.Type, p.Offset, p.Size)
+	if p.Name != "" {
+		desc += fmt.Sprintf(" \"%s\"", p.Name)
+	}
+	if p.NTFS {
+		desc += " NTFS"
+	}
+
+	return desc
+}
+
+// Partitions returns partitions in MBR or GPT of the disk. If the disk has no
+// partition table but a volume, the whole disk is returned as partition 0.
+func (d *Disk) Partitions() ([]Partition, error) {
+	if d.isNTFS(0) {
+		return []Partition{{Scheme: SchemeNone, Offset: 0, Size: d.Size, NTFS: true}}, nil
+	}
+
+	mbr := make([]byte, 512)
+	if _, err := d.ReadAt(mbr, 0); err != nil {
+		return nil, fmt.Errorf("could not read MBR: %w", err)
+	}
+
+	if binary.LittleEndian.Uint16(mbr[510:]) != mbrSignature {
+		return nil, nil
+	}
+
+	for i := 0; i < 4; i++ {
+		if mbr[446+i*16+4] == mbrTypeGPT {
+			return d.gptPartitions()
+		}
+	}
+
+	return d.mbrPartitions(mbr)
+}
+
+func isExtended(typ byte) bool {
+	return typ == 0x05 || typ == 0x0F || typ == 0x85
+}
+
+func (d *Disk) mbrPartitions(mbr []byte) ([]Partition, error) {
+	var parts []Partition
+
+	for i := 0; i < 4; i++ {
+		entry := mbr[446+i*16:]
+		typ := entry[4]
+		start := int64(binary.LittleEndian.Uint32(entry[8:])) * d.SectorSize
+		size := int64(binary.LittleEndian.Uint32(entry[12:])) * d.SectorSize
+
+		if typ == 0 || size == 0 {
+			continue
+		}
+
+		if isExtended(typ) {
+			logical, err := d.logicalPartitions(start)
+			if err != nil {
+				return parts, err
+			}
+			parts = append(parts, logical...)
+			continue
+		}
+
+		parts = append(parts, d.newPartition(i+1, SchemeMBR, fmt.Sprintf("0x%02X", typ), "", start, size))
+	}
+
+	return parts, nil
+}
+
+// logicalPartitions follows chain of EBR in the extended partition at base.
+func (d *Disk) logicalPartitions(base int64) ([]Partition, error) {
+	var parts []Partition
+
+	ebr := make([]byte, 512)
+	ebrOffset := base
+
+	for num := 5; num < 5+mbrMaxLogical; num++ {
+		if _, err := d.ReadAt(ebr, ebrOffset); err != nil {
+			return parts, fmt.Errorf("could not read EBR at %d: %w", ebrOffset, err)
+		}
+		if binary.LittleEndian.Uint16(ebr[510:]) != mbrSignature {
+			return parts, fmt.Errorf("%w: bad EBR signature at %d", ErrCorrupted, ebrOffset)
+		}
+
+		// first entry is relative to this EBR
+		entry := ebr[446:]
+		if typ := entry[4]; typ != 0 {
+			start := ebrOffset + int64(binary.LittleEndian.Uint32(entry[8:]))*d.SectorSize
+			size := int64(binary.LittleEndian.Uint32(entry[12:])) * d.SectorSize
+			parts = append(parts, d.newPartition(num, SchemeMBR, fmt.Sprintf("0x%02X", typ), "", start, size))
+		}
+
+		// second entry is relative to the extended partition
+		next := ebr[446+16:]
+		if !isExtended(next[4]) {
+			break
+		}
+		ebrOffset = base + int64(binary.LittleEndian.Uint32(next[8:]))*d.SectorSize
+	}
+
+	return parts, nil
+}
+
+func (d *Disk) gptPartitions() ([]Partition, error) {
+	header := make([]byte, 512)
+	if _, err := d.ReadAt(header, d.SectorSize); err != nil {
+		return nil, fmt.Errorf("could not read GPT header: %w", err)
+	}
+
+	if string(header[:8]) != gptSignature && d.SectorSize != 4096 {
+		// raw image of disk with 4K sectors
+		if _, err := d.ReadAt(header, 4096); err == nil && string(header[:8]) == gptSignature {
+			d.SectorSize = 4096
+		}
+	}
+
+	if string(header[:8]) != gptSignature {
+		return nil, fmt.Errorf("%w: bad GPT header signature", ErrCorrupted)
+	}
+
+	entryLBA := int64(binary.LittleEndian.Uint64(header[0x48:]))
+	entryCount := int(binary.LittleEndian.Uint32(header[0x50:]))
+	entrySize := int(binary.LittleEndian.Uint32(header[0x54:]))
+
+	// entries are multiple of 128 bytes, not larger than a sector in practice
+	if entrySize < 128 || entrySize%128 != 0 || int64(entrySize) > d.SectorSize || entryCount > gptMaxEntries {
+		return nil, fmt.Errorf("%w: bad GPT entry size %d or count %d", ErrCorrupted, entrySize, entryCount)
+	}
+
+	entries := make([]byte, entryCount*entrySize)
+	if _, err := d.ReadAt(entries, entryLBA*d.SectorSize); err != nil {
+		return nil, fmt.Errorf("could not read GPT entries: %w", err)
+	}
+
+	var parts []Partition
+	for i := 0; i < entryCount; i++ {
+		entry := entries[i*entrySize : (i+1)*entrySize]
+
+		typ := guidString(entry[0:16])
+		if typ == "00000000-0000-0000-0000-000000000000" {
+			continue
+		}
+
+		first := int64(binary.LittleEndian.Uint64(entry[0x20:]))
+		last := int64(binary.LittleEndian.Uint64(entry[0x28:]))
+		if last < first {
+			continue
+		}
+
+		// NUL terminated
+		name, _, _ := strings.Cut(winfmt.DecodeUTF16(entry[0x38:0x80]), "\x00")
+		parts = append(parts, d.newPartition(i+1, SchemeGPT, typ, name, first*d.SectorSize, (last-first+1)*d.SectorSize))
+	}
+
+	return parts, nil
+}
+
+func (d *Disk) newPartition(num int, scheme, typ, name string, offset, size int64) Partition {
+	// type 0x07 of MBR and basic data of GPT are shared with other file
+	// systems, and NTFS can be in partitions of other types, so check the boot sector
+	return Partition{
+		Number: num,
+		Scheme: scheme,
+		Type:   typ,
+		Name:   name,
+		Offset: offset,
+		Size:   size,
+		NTFS:   offset+size <= d.Size && d.isNTFS(offset),
+	}
+}
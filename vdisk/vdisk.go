@@ -0,0 +1,128 @@
+// Package vdisk reads virtual disk images(VHD, VHDX or raw disk images) and
+// their MBR or GPT partitions, so NTFS volumes in them can be opened with
+// ntfsimage package without converting the image.
+package vdisk
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Formats of disk image.
+const (
+	FormatRaw        = "raw"
+	FormatVHDFixed   = "vhd-fixed"
+	FormatVHDDynamic = "vhd-dynamic"
+	FormatVHDX       = "vhdx"
+)
+
+const defaultSectorSize = 512
+
+var (
+	ErrUnsupported = errors.New("unsupported disk image")
+	ErrCorrupted   = errors.New("corrupted disk image")
+)
+
+// Disk is a virtual disk read from an image, which reads as a raw disk.
+type Disk struct {
+	Format     string
+	Size       int64 // size of the virtual disk in bytes
+	SectorSize int64 // logical sector size
+
+	r io.ReaderAt // reads the virtual disk
+}
+
+// Open detects format of the image with size in bytes and returns its virtual disk.
+func Open(r io.ReaderAt, size int64) (*Disk, error) {
+	sig := make([]byte, 8)
+	if _, err := r.ReadAt(sig, 0); err != nil {
+		return nil, fmt.Errorf("could not read image: %w", err)
+	}
+
+	if string(sig) == vhdxSignature {
+		return openVHDX(r, size)
+	}
+
+	if size >= vhdFooterSize {
+		footer := make([]byte, vhdFooterSize)
+		if _, err := r.ReadAt(footer, size-vhdFooterSize); err != nil {
+			return nil, fmt.Errorf("could not read image: %w", err)
+		}
+
+		if string(footer[:8]) == vhdCookie {
+			return openVHD(r, size, footer)
+		}
+	}
+
+	return &Disk{
+		Format:     FormatRaw,
+		Size:       size,
+		SectorSize: defaultSectorSize,
+		r:          r,
+	}, nil
+}
+
+// ReadAt reads the virtual disk at off.
+func (d *Disk) ReadAt(b []byte, off int64) (int, error) {
+	if off >= d.Size {
+		return 0, io.EOF
+	}
+
+	want := b
+	if remain := d.Size - off; int64(len(want)) > remain {
+		want = want[:remain]
+	}
+
+	n, err := d.r.ReadAt(want, off)
+	if err == nil && len(want) < len(b) {
+		err = io.EOF
+	}
+
+	return n, err
+}
+
+// OpenPartition returns reader of the partition.
+func (d *Disk) OpenPartition(p Partition) *io.SectionReader {
+	return io.NewSectionReader(d, p.Offset, p.Size)
+}
+
+// NTFSPartitions returns partitions which have NTFS boot sector. If the disk
+// has no partition table but a NTFS volume, the whole disk is returned.
+func (d *Disk) NTFSPartitions() ([]Partition, error) {
+	parts, err := d.Partitions()
+	if err != nil {
+		return nil, err
+	}
+
+	var ntfsParts []Partition
+	for _, p := range parts {
+		if p.NTFS {
+			ntfsParts = append(ntfsParts, p)
+		}
+	}
+
+	return ntfsParts, nil
+}
+
+// isNTFS checks OEM ID of the boot sector at off.
+func (d *Disk) isNTFS(off int64) bool {
+	oem := make([]byte, 8)
+	if _, err := d.ReadAt(oem, off+3); err != nil {
+		return false
+	}
+
+	return string(oem) == "NTFS    "
+}
+
+// guidString formats GUID stored in mixed endian as in Windows.
+func guidString(b []byte) string {
+	return fmt.Sprintf("%08X-%04X-%04X-%X-%X",
+		binary.LittleEndian.Uint32(b[0:]),
+		binary.LittleEndian.Uint16(b[4:]),
+		binary.LittleEndian.Uint16(b[6:]),
+		b[8:10],
+		b[10:16],
+	)
+}
@@ -0,0 +1,355 @@
+package vdisk
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"hash/crc32"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/Snshadow/ntfs-ads/internal/winfmt"
+)
+
+// guidBytes encodes GUID string in mixed endian, as read by guidString.
+func guidBytes(s string) []byte {
+	raw, err := hex.DecodeString(strings.ReplaceAll(s, "-", ""))
+	if err != nil {
+		panic(err)
+	}
+
+	b := make([]byte, 16)
+	binary.LittleEndian.PutUint32(b[0:], binary.BigEndian.Uint32(raw[0:]))
+	binary.LittleEndian.PutUint16(b[4:], binary.BigEndian.Uint16(raw[4:]))
+	binary.LittleEndian.PutUint16(b[6:], binary.BigEndian.Uint16(raw[6:]))
+	copy(b[8:], raw[8:])
+
+	return b
+}
+
+func readAll(t *testing.T, d *Disk) []byte {
+	t.Helper()
+
+	b, err := io.ReadAll(io.NewSectionReader(d, 0, d.Size))
+	if err != nil {
+		t.Fatalf("read disk: %v", err)
+	}
+
+	return b
+}
+
+// pattern returns n bytes of non-zero content.
+func pattern(n int, seed byte) []byte {
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = seed + byte(i%251) | 1
+	}
+
+	return b
+}
+
+func vhdFooter(diskType uint32, dataOffset, diskSize uint64) []byte {
+	footer := make([]byte, vhdFooterSize)
+	copy(footer, vhdCookie)
+	binary.BigEndian.PutUint64(footer[16:], dataOffset)
+	binary.BigEndian.PutUint64(footer[48:], diskSize)
+	binary.BigEndian.PutUint32(footer[60:], diskType)
+
+	return footer
+}
+
+func TestVHDFixed(t *testing.T) {
+	data := pattern(4096, 1)
+
+	img := append(append([]byte{}, data...), vhdFooter(vhdTypeFixed, 0xFFFFFFFFFFFFFFFF, 4096)...)
+	d, err := Open(bytes.NewReader(img), int64(len(img)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Format != FormatVHDFixed || d.Size != 4096 {
+		t.Errorf("got format %s size %d", d.Format, d.Size)
+	}
+	if !bytes.Equal(readAll(t, d), data) {
+		t.Error("content of the disk differs")
+	}
+}
+
+// dynamicVHDImage returns dynamic VHD of blockSize 4096 and 2 blocks, the first
+// block has sectors 0 and 2 present with data.
+func dynamicVHDImage(data []byte, maxEntries uint32, diskSize uint64) []byte {
+	const (
+		headerOffset = 512
+		tableOffset  = 1536
+		blockOffset  = 2048
+	)
+
+	img := make([]byte, blockOffset+512+4096)
+	copy(img, vhdFooter(vhdTypeDynamic, headerOffset, diskSize))
+
+	header := img[headerOffset:]
+	copy(header, vhdDynamicCookie)
+	binary.BigEndian.PutUint64(header[16:], tableOffset)
+	binary.BigEndian.PutUint32(header[28:], maxEntries)
+	binary.BigEndian.PutUint32(header[32:], 4096)
+
+	binary.BigEndian.PutUint32(img[tableOffset:], blockOffset/512)
+	binary.BigEndian.PutUint32(img[tableOffset+4:], vhdBATUnused)
+
+	img[blockOffset] = 0xA0 // sectors 0 and 2
+	copy(img[blockOffset+512:], data)
+
+	return append(img, vhdFooter(vhdTypeDynamic, headerOffset, diskSize)...)
+}
+
+func TestVHDDynamic(t *testing.T) {
+	data := pattern(4096, 3)
+
+	img := dynamicVHDImage(data, 2, 8192)
+	d, err := Open(bytes.NewReader(img), int64(len(img)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Format != FormatVHDDynamic || d.Size != 8192 {
+		t.Errorf("got format %s size %d", d.Format, d.Size)
+	}
+
+	want := make([]byte, 8192)
+	copy(want[0:512], data[0:512])
+	copy(want[1024:1536], data[1024:1536])
+	if !bytes.Equal(readAll(t, d), want) {
+		t.Error("content of the disk differs")
+	}
+}
+
+func TestVHDCorrupted(t *testing.T) {
+	tests := []struct {
+		name string
+		img  []byte
+	}{
+		{"fixed size exceeds the image", append(make([]byte, 4096), vhdFooter(vhdTypeFixed, 0, 8192)...)},
+		{"fixed negative size", append(make([]byte, 4096), vhdFooter(vhdTypeFixed, 0, 1<<63)...)},
+		{"dynamic negative size", dynamicVHDImage(nil, 2, 1<<63)},
+		{"BAT does not cover the disk", dynamicVHDImage(nil, 2, 3*4096)},
+		{"BAT out of the image", dynamicVHDImage(nil, 0xFFFFFFFF, 8192)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Open(bytes.NewReader(tt.img), int64(len(tt.img))); !errors.Is(err, ErrCorrupted) {
+				t.Errorf("got error %v, want %v", err, ErrCorrupted)
+			}
+		})
+	}
+}
+
+// vhdxOptions are fields of crafted VHDX image.
+type vhdxOptions struct {
+	diskSize  uint64
+	batLength uint32
+	metaOff   uint64
+}
+
+// vhdxImage returns VHDX of 1MiB blocks, whose first block is present with
+// data at 3MiB and the second block is not present.
+func vhdxImage(data []byte, opts vhdxOptions) []byte {
+	const (
+		metaOffset  = 1 << 20
+		batOffset   = 2 << 20
+		blockOffset = 3 << 20
+	)
+
+	img := make([]byte, 4<<20)
+	copy(img, vhdxSignature)
+
+	header := img[vhdxHeader1Offset : vhdxHeader1Offset+vhdxHeaderSize]
+	copy(header, vhdxHeaderSignature)
+	binary.LittleEndian.PutUint32(header[4:], crc32.Checksum(header, crc32c))
+
+	if opts.metaOff == 0 {
+		opts.metaOff = metaOffset
+	}
+	regions := img[vhdxRegionOffset : vhdxRegionOffset+vhdxRegionSize]
+	copy(regions, vhdxRegionSignature)
+	binary.LittleEndian.PutUint32(regions[8:], 2)
+	for i, region := range []struct {
+		guid   string
+		offset uint64
+		length uint32
+	}{
+		{vhdxBATGUID, batOffset, opts.batLength},
+		{vhdxMetadataGUID, opts.metaOff, 64 << 10},
+	} {
+		entry := regions[16+i*32:]
+		copy(entry, guidBytes(region.guid))
+		binary.LittleEndian.PutUint64(entry[16:], region.offset)
+		binary.LittleEndian.PutUint32(entry[24:], region.length)
+	}
+	binary.LittleEndian.PutUint32(regions[4:], crc32.Checksum(regions, crc32c))
+
+	meta := img[metaOffset:]
+	copy(meta, vhdxMetadataSignature)
+	binary.LittleEndian.PutUint16(meta[10:], 3)
+	for i, item := range []struct {
+		guid  string
+		value []byte
+	}{
+		{vhdxFileParamGUID, binary.LittleEndian.AppendUint32(binary.LittleEndian.AppendUint32(nil, 1<<20), 0)},
+		{vhdxDiskSizeGUID, binary.LittleEndian.AppendUint64(nil, opts.diskSize)},
+		{vhdxLogicalSectGUID, binary.LittleEndian.AppendUint32(nil, 512)},
+	} {
+		entry := meta[32+i*32:]
+		offset := 64<<10/2 + i*16
+		copy(entry, guidBytes(item.guid))
+		binary.LittleEndian.PutUint32(entry[16:], uint32(offset))
+		binary.LittleEndian.PutUint32(entry[20:], uint32(len(item.value)))
+		copy(meta[offset:], item.value)
+	}
+
+	binary.LittleEndian.PutUint64(img[batOffset:], blockOffset/vhdxMB<<20|vhdxBlockFullyPresent)
+	binary.LittleEndian.PutUint64(img[batOffset+8:], vhdxBlockNotPresent)
+	copy(img[blockOffset:], data)
+
+	return img
+}
+
+func TestVHDX(t *testing.T) {
+	data := pattern(1<<20, 5)
+
+	img := vhdxImage(data, vhdxOptions{diskSize: 2 << 20, batLength: 1 << 20})
+	d, err := Open(bytes.NewReader(img), int64(len(img)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Format != FormatVHDX || d.Size != 2<<20 || d.SectorSize != 512 {
+		t.Errorf("got format %s size %d sector size %d", d.Format, d.Size, d.SectorSize)
+	}
+
+	want := append(append([]byte{}, data...), make([]byte, 1<<20)...)
+	if !bytes.Equal(readAll(t, d), want) {
+		t.Error("content of the disk differs")
+	}
+}
+
+func TestVHDXCorrupted(t *testing.T) {
+	tests := []struct {
+		name string
+		opts vhdxOptions
+	}{
+		{"zero size", vhdxOptions{diskSize: 0, batLength: 1 << 20}},
+		{"negative size", vhdxOptions{diskSize: 1 << 63, batLength: 1 << 20}},
+		{"size overflowing BAT size", vhdxOptions{diskSize: 0x7FFFFFFFFFFFFFFF, batLength: 1 << 20}},
+		{"size over 64TiB", vhdxOptions{diskSize: 64<<40 + 1, batLength: 1 << 20}},
+		{"BAT region too small", vhdxOptions{diskSize: 2 << 20, batLength: 8}},
+		{"region out of the image", vhdxOptions{diskSize: 2 << 20, batLength: 1 << 20, metaOff: 1 << 40}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			img := vhdxImage(nil, tt.opts)
+			if _, err := Open(bytes.NewReader(img), int64(len(img))); !errors.Is(err, ErrCorrupted) {
+				t.Errorf("got error %v, want %v", err, ErrCorrupted)
+			}
+		})
+	}
+}
+
+func ntfsBoot(disk []byte, off int) {
+	copy(disk[off+3:], "NTFS    ")
+}
+
+func mbrEntry(sector []byte, i int, typ byte, start, size uint32) {
+	entry := sector[446+i*16:]
+	entry[4] = typ
+	binary.LittleEndian.PutUint32(entry[8:], start)
+	binary.LittleEndian.PutUint32(entry[12:], size)
+	binary.LittleEndian.PutUint16(sector[510:], mbrSignature)
+}
+
+func gptDisk(entrySize uint32) []byte {
+	disk := make([]byte, 64*512)
+	mbrEntry(disk, 0, mbrTypeGPT, 1, 63)
+
+	header := disk[512:]
+	copy(header, gptSignature)
+	binary.LittleEndian.PutUint64(header[0x48:], 2)
+	binary.LittleEndian.PutUint32(header[0x50:], 4)
+	binary.LittleEndian.PutUint32(header[0x54:], entrySize)
+
+	entry := disk[2*512:]
+	copy(entry, guidBytes("EBD0A0A2-B9E5-4433-87C0-68B6B72699C7"))
+	binary.LittleEndian.PutUint64(entry[0x20:], 34)
+	binary.LittleEndian.PutUint64(entry[0x28:], 41)
+	copy(entry[0x38:], winfmt.EncodeUTF16("data"))
+	ntfsBoot(disk, 34*512)
+
+	return disk
+}
+
+func TestPartitions(t *testing.T) {
+	whole := make([]byte, 8*512)
+	ntfsBoot(whole, 0)
+
+	mbr := make([]byte, 32*512)
+	mbrEntry(mbr, 0, 0x07, 1, 8)
+	ntfsBoot(mbr, 512)
+	mbrEntry(mbr, 1, 0x05, 16, 16)
+	// EBRs at sector 16 and 24
+	mbrEntry(mbr[16*512:], 0, 0x07, 1, 4)
+	mbrEntry(mbr[16*512:], 1, 0x05, 8, 8)
+	mbrEntry(mbr[24*512:], 0, 0x83, 1, 2)
+
+	tests := []struct {
+		name string
+		disk []byte
+		want []Partition
+	}{
+		{"whole disk", whole, []Partition{{Scheme: SchemeNone, Size: 8 * 512, NTFS: true}}},
+		{"MBR", mbr, []Partition{
+			{Number: 1, Scheme: SchemeMBR, Type: "0x07", Offset: 512, Size: 8 * 512, NTFS: true},
+			{Number: 5, Scheme: SchemeMBR, Type: "0x07", Offset: 17 * 512, Size: 4 * 512},
+			{Number: 6, Scheme: SchemeMBR, Type: "0x83", Offset: 25 * 512, Size: 2 * 512},
+		}},
+		{"GPT", gptDisk(128), []Partition{
+			{Number: 1, Scheme: SchemeGPT, Type: "EBD0A0A2-B9E5-4433-87C0-68B6B72699C7", Name: "data", Offset: 34 * 512, Size: 8 * 512, NTFS: true},
+		}},
+		{"no partition table", make([]byte, 8*512), nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, err := Open(bytes.NewReader(tt.disk), int64(len(tt.disk)))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			parts, err := d.Partitions()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(parts) != len(tt.want) {
+				t.Fatalf("got %v, want %v", parts, tt.want)
+			}
+			for i := range parts {
+				if parts[i] != tt.want[i] {
+					t.Errorf("got %v, want %v", parts[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestGPTBadEntrySize(t *testing.T) {
+	for _, size := range []uint32{0, 96, 130, 1024, 0xFFFFFFFF} {
+		disk := gptDisk(size)
+
+		d, err := Open(bytes.NewReader(disk), int64(len(disk)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := d.Partitions(); !errors.Is(err, ErrCorrupted) {
+			t.Errorf("entry size %d: got error %v, want %v", size, err, ErrCorrupted)
+		}
+	}
+}
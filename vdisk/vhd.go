@@ -0,0 +1,198 @@
+package vdisk
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sync"
+)
+
+const (
+	vhdCookie        = "conectix"
+	vhdDynamicCookie = "cxsparse"
+	vhdFooterSize    = 512
+	vhdDynHeaderSize = 1024
+	vhdSectorSize    = 512
+
+	vhdTypeFixed        = 2
+	vhdTypeDynamic      = 3
+	vhdTypeDifferencing = 4
+
+	vhdBATUnused = 0xFFFFFFFF
+)
+
+// openVHD opens VHD image with footer read from end of the image.
+func openVHD(r io.ReaderAt, size int64, footer []byte) (*Disk, error) {
+	diskType := binary.BigEndian.Uint32(footer[60:])
+	diskSize := int64(binary.BigEndian.Uint64(footer[48:]))
+	if diskSize < 0 {
+		return nil, fmt.Errorf("%w: bad VHD disk size %d", ErrCorrupted, diskSize)
+	}
+
+	switch diskType {
+	case vhdTypeFixed:
+		if diskSize > size-vhdFooterSize {
+			return nil, fmt.Errorf("%w: VHD disk size %d exceeds the image", ErrCorrupted, diskSize)
+		}
+
+		return &Disk{
+			Format:     FormatVHDFixed,
+			Size:       diskSize,
+			SectorSize: vhdSectorSize,
+			r:          r,
+		}, nil
+	case vhdTypeDynamic:
+		dataOffset := int64(binary.BigEndian.Uint64(footer[16:]))
+		vhd, err := openDynamicVHD(r, size, dataOffset, diskSize)
+		if err != nil {
+			return nil, err
+		}
+
+		return &Disk{
+			Format:     FormatVHDDynamic,
+			Size:       diskSize,
+			SectorSize: vhdSectorSize,
+			r:          vhd,
+		}, nil
+	case vhdTypeDifferencing:
+		return nil, fmt.Errorf("%w: differencing VHD needs its parent image", ErrUnsupported)
+	default:
+		return nil, fmt.Errorf("%w: VHD disk type %d", ErrUnsupported, diskType)
+	}
+}
+
+// dynamicVHD reads blocks of dynamic VHD through its block allocation table.
+type dynamicVHD struct {
+	r          io.ReaderAt
+	bat        []uint32 // sector offset of each block, vhdBATUnused if not allocated
+	blockSize  int64
+	bitmapSize int64 // size of sector bitmap preceding each block
+	size       int64
+
+	mut        sync.Mutex
+	lastBlock  int64 // index of the block of cached bitmap, -1 if none
+	lastBitmap []byte
+}
+
+// openDynamicVHD opens dynamic VHD in the image with size in bytes, whose
+// dynamic header is at headerOffset.
+func openDynamicVHD(r io.ReaderAt, size, headerOffset, diskSize int64) (*dynamicVHD, error) {
+	header := make([]byte, vhdDynHeaderSize)
+	if _, err := r.ReadAt(header, headerOffset); err != nil {
+		return nil, fmt.Errorf("could not read VHD dynamic header: %w", err)
+	}
+
+	if string(header[:8]) != vhdDynamicCookie {
+		return nil, fmt.Errorf("%w: bad VHD dynamic header cookie", ErrCorrupted)
+	}
+
+	tableOffset := int64(binary.BigEndian.Uint64(header[16:]))
+	maxEntries := int64(binary.BigEndian.Uint32(header[28:]))
+	blockSize := int64(binary.BigEndian.Uint32(header[32:]))
+
+	if blockSize == 0 || blockSize%vhdSectorSize != 0 {
+		return nil, fmt.Errorf("%w: bad VHD block size %d", ErrCorrupted, blockSize)
+	}
+	if maxEntries < (diskSize+blockSize-1)/blockSize {
+		return nil, fmt.Errorf("%w: VHD block allocation table does not cover the disk", ErrCorrupted)
+	}
+	if tableOffset < 0 || tableOffset+maxEntries*4 > size {
+		return nil, fmt.Errorf("%w: VHD block allocation table out of the image", ErrCorrupted)
+	}
+
+	raw := make([]byte, maxEntries*4)
+	if _, err := r.ReadAt(raw, tableOffset); err != nil {
+		return nil, fmt.Errorf("could not read VHD block allocation table: %w", err)
+	}
+
+	bat := make([]uint32, maxEntries)
+	for i := range bat {
+		bat[i] = binary.BigEndian.Uint32(raw[i*4:])
+	}
+
+	// bitmap has a bit for each sector in the block, padded to sector boundary
+	bitmapSize := (blockSize/vhdSectorSize + 7) / 8
+	bitmapSize = (bitmapSize + vhdSectorSize - 1) / vhdSectorSize * vhdSectorSize
+
+	return &dynamicVHD{
+		r:          r,
+		bat:        bat,
+		blockSize:  blockSize,
+		bitmapSize: bitmapSize,
+		size:       diskSize,
+		lastBlock:  -1,
+	}, nil
+}
+
+// bitmap returns sector bitmap of the allocated block.
+func (v *dynamicVHD) bitmap(block int64) ([]byte, error) {
+	v.mut.Lock()
+	defer v.mut.Unlock()
+
+	if v.lastBlock == block {
+		return v.lastBitmap, nil
+	}
+
+	bitmap := make([]byte, v.bitmapSize)
+	if _, err := v.r.ReadAt(bitmap, int64(v.bat[block])*vhdSectorSize); err != nil {
+		return nil, fmt.Errorf("could not read VHD sector bitmap of block %d: %w", block, err)
+	}
+
+	v.lastBlock, v.lastBitmap = block, bitmap
+
+	return bitmap, nil
+}
+
+func (v *dynamicVHD) ReadAt(b []byte, off int64) (int, error) {
+	if off >= v.size {
+		return 0, io.EOF
+	}
+
+	want := b
+	if remain := v.size - off; int64(len(want)) > remain {
+		want = want[:remain]
+	}
+
+	for n := 0; n < len(want); {
+		pos := off + int64(n)
+		block := pos / v.blockSize
+		inBlock := pos % v.blockSize
+
+		// read up to end of the sector, so the bitmap is checked per sector
+		end := n + int(vhdSectorSize-inBlock%vhdSectorSize)
+		if end > len(want) {
+			end = len(want)
+		}
+		part := want[n:end]
+
+		present := false
+		if v.bat[block] != vhdBATUnused {
+			bitmap, err := v.bitmap(block)
+			if err != nil {
+				return n, err
+			}
+
+			sector := inBlock / vhdSectorSize
+			present = bitmap[sector/8]&(0x80>>(sector%8)) != 0
+		}
+
+		if present {
+			dataOffset := int64(v.bat[block])*vhdSectorSize + v.bitmapSize + inBlock
+			if _, err := v.r.ReadAt(part, dataOffset); err != nil {
+				return n, fmt.Errorf("could not read VHD block %d: %w", block, err)
+			}
+		} else {
+			for i := range part {
+				part[i] = 0
+			}
+		}
+
+		n = end
+	}
+
+	if len(want) < len(b) {
+		return len(want), io.EOF
+	}
+
+	return len(b), nil
+}
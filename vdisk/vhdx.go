@@ -0,0 +1,289 @@
+package vdisk
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+)
+
+const (
+	vhdxSignature         = "vhdxfile"
+	vhdxHeaderSignature   = "head"
+	vhdxRegionSignature   = "regi"
+	vhdxMetadataSignature = "metadata"
+
+	vhdxHeader1Offset = 64 << 10
+	vhdxHeader2Offset = 128 << 10
+	vhdxRegionOffset  = 192 << 10
+	vhdxHeaderSize    = 4 << 10
+	vhdxRegionSize    = 64 << 10
+
+	vhdxBATGUID          = "2DC27766-F623-4200-9D64-115E9BFD4A08"
+	vhdxMetadataGUID     = "8B7CA206-4790-4B9A-B8FE-575F050F886E"
+	vhdxFileParamGUID    = "CAA16737-FA36-4D43-B3B6-33F0AA44E76B"
+	vhdxDiskSizeGUID     = "2FA54224-CD1B-4876-B211-5DBED83BF4B8"
+	vhdxLogicalSectGUID  = "8141BF1D-A96F-4709-BA47-F233A8FAAB5F"
+	vhdxFileParamsParent = 0x2 // HasParent flag of file parameters
+
+	// states of payload block in BAT
+	vhdxBlockNotPresent     = 0
+	vhdxBlockUndefined      = 1
+	vhdxBlockZero           = 2
+	vhdxBlockUnmapped       = 3
+	vhdxBlockFullyPresent   = 6
+	vhdxBlockPartialPresent = 7
+
+	vhdxBATStateMask = 0x7
+	vhdxMB           = 1 << 20
+	vhdxMaxBlockSize = 256 << 20
+	vhdxMaxDiskSize  = 64 << 40
+)
+
+var crc32c = crc32.MakeTable(crc32.Castagnoli)
+
+// vhdxChecksumValid checks CRC-32C at offset 4 of the structure.
+func vhdxChecksumValid(b []byte) bool {
+	sum := binary.LittleEndian.Uint32(b[4:])
+
+	buf := make([]byte, len(b))
+	copy(buf, b)
+	binary.LittleEndian.PutUint32(buf[4:], 0)
+
+	return crc32.Checksum(buf, crc32c) == sum
+}
+
+// vhdx reads payload blocks of VHDX through its block allocation table.
+type vhdx struct {
+	r          io.ReaderAt
+	bat        []uint64
+	blockSize  int64
+	chunkRatio int64 // number of payload blocks between sector bitmap blocks
+	size       int64
+}
+
+// openVHDX opens VHDX image. Log of the image is not replayed, so an image
+// not closed cleanly may read as before the last writes.
+func openVHDX(r io.ReaderAt, size int64) (*Disk, error) {
+	if err := checkVHDXHeader(r); err != nil {
+		return nil, err
+	}
+
+	regions, err := readVHDXRegions(r)
+	if err != nil {
+		return nil, err
+	}
+
+	batRegion, ok := regions[vhdxBATGUID]
+	if !ok {
+		return nil, fmt.Errorf("%w: VHDX has no BAT region", ErrCorrupted)
+	}
+	metaRegion, ok := regions[vhdxMetadataGUID]
+	if !ok {
+		return nil, fmt.Errorf("%w: VHDX has no metadata region", ErrCorrupted)
+	}
+
+	for _, region := range [][2]int64{batRegion, metaRegion} {
+		if region[0] < 0 || region[0]+region[1] > size {
+			return nil, fmt.Errorf("%w: VHDX region out of the image", ErrCorrupted)
+		}
+	}
+
+	meta, err := readVHDXMetadata(r, metaRegion[0], metaRegion[1])
+	if err != nil {
+		return nil, err
+	}
+
+	params, ok := meta[vhdxFileParamGUID]
+	if !ok || len(params) < 8 {
+		return nil, fmt.Errorf("%w: VHDX has no file parameters", ErrCorrupted)
+	}
+	if binary.LittleEndian.Uint32(params[4:])&vhdxFileParamsParent != 0 {
+		return nil, fmt.Errorf("%w: differencing VHDX needs its parent image", ErrUnsupported)
+	}
+	blockSize := int64(binary.LittleEndian.Uint32(params[0:]))
+
+	sizeItem, ok := meta[vhdxDiskSizeGUID]
+	if !ok || len(sizeItem) < 8 {
+		return nil, fmt.Errorf("%w: VHDX has no virtual disk size", ErrCorrupted)
+	}
+	diskSize := int64(binary.LittleEndian.Uint64(sizeItem))
+
+	sectorSize := int64(defaultSectorSize)
+	if item, ok := meta[vhdxLogicalSectGUID]; ok && len(item) >= 4 {
+		sectorSize = int64(binary.LittleEndian.Uint32(item))
+	}
+
+	if diskSize <= 0 || diskSize > vhdxMaxDiskSize {
+		return nil, fmt.Errorf("%w: bad VHDX virtual disk size %d", ErrCorrupted, diskSize)
+	}
+	if blockSize < vhdxMB || blockSize > vhdxMaxBlockSize || blockSize&(blockSize-1) != 0 {
+		return nil, fmt.Errorf("%w: bad VHDX block size %d", ErrCorrupted, blockSize)
+	}
+	if sectorSize != 512 && sectorSize != 4096 {
+		return nil, fmt.Errorf("%w: bad VHDX logical sector size %d", ErrCorrupted, sectorSize)
+	}
+
+	chunkRatio := (int64(1) << 23) * sectorSize / blockSize
+	payloadBlocks := (diskSize + blockSize - 1) / blockSize
+	entries := payloadBlocks + (payloadBlocks-1)/chunkRatio
+
+	if entries > batRegion[1]/8 {
+		return nil, fmt.Errorf("%w: VHDX BAT region too small", ErrCorrupted)
+	}
+
+	raw := make([]byte, entries*8)
+	if _, err := r.ReadAt(raw, batRegion[0]); err != nil {
+		return nil, fmt.Errorf("could not read VHDX BAT: %w", err)
+	}
+
+	bat := make([]uint64, entries)
+	for i := range bat {
+		bat[i] = binary.LittleEndian.Uint64(raw[i*8:])
+	}
+
+	return &Disk{
+		Format:     FormatVHDX,
+		Size:       diskSize,
+		SectorSize: sectorSize,
+		r: &vhdx{
+			r:          r,
+			bat:        bat,
+			blockSize:  blockSize,
+			chunkRatio: chunkRatio,
+			size:       diskSize,
+		},
+	}, nil
+}
+
+// checkVHDXHeader checks that at least one of the two headers is valid.
+func checkVHDXHeader(r io.ReaderAt) error {
+	header := make([]byte, vhdxHeaderSize)
+
+	for _, off := range []int64{vhdxHeader1Offset, vhdxHeader2Offset} {
+		if _, err := r.ReadAt(header, off); err != nil {
+			continue
+		}
+
+		if string(header[:4]) == vhdxHeaderSignature && vhdxChecksumValid(header) {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("%w: VHDX has no valid header", ErrCorrupted)
+}
+
+// readVHDXRegions returns file offset and length of regions by GUID.
+func readVHDXRegions(r io.ReaderAt) (map[string][2]int64, error) {
+	table := make([]byte, vhdxRegionSize)
+
+	for _, off := range []int64{vhdxRegionOffset, vhdxRegionOffset + vhdxRegionSize} {
+		if _, err := r.ReadAt(table, off); err != nil {
+			continue
+		}
+
+		if string(table[:4]) != vhdxRegionSignature || !vhdxChecksumValid(table) {
+			continue
+		}
+
+		count := int(binary.LittleEndian.Uint32(table[8:]))
+		if 16+count*32 > len(table) {
+			continue
+		}
+
+		regions := make(map[string][2]int64, count)
+		for i := 0; i < count; i++ {
+			entry := table[16+i*32:]
+			regions[guidString(entry[0:16])] = [2]int64{
+				int64(binary.LittleEndian.Uint64(entry[16:])),
+				int64(binary.LittleEndian.Uint32(entry[24:])),
+			}
+		}
+
+		return regions, nil
+	}
+
+	return nil, fmt.Errorf("%w: VHDX has no valid region table", ErrCorrupted)
+}
+
+// readVHDXMetadata returns metadata items by GUID.
+func readVHDXMetadata(r io.ReaderAt, off, length int64) (map[string][]byte, error) {
+	region := make([]byte, length)
+	if _, err := r.ReadAt(region, off); err != nil {
+		return nil, fmt.Errorf("could not read VHDX metadata: %w", err)
+	}
+
+	if len(region) < 32 || string(region[:8]) != vhdxMetadataSignature {
+		return nil, fmt.Errorf("%w: bad VHDX metadata signature", ErrCorrupted)
+	}
+
+	count := int(binary.LittleEndian.Uint16(region[10:]))
+	if 32+count*32 > len(region) {
+		return nil, fmt.Errorf("%w: too many VHDX metadata entries", ErrCorrupted)
+	}
+
+	items := make(map[string][]byte, count)
+	for i := 0; i < count; i++ {
+		entry := region[32+i*32:]
+		itemOffset := int64(binary.LittleEndian.Uint32(entry[16:]))
+		itemLength := int64(binary.LittleEndian.Uint32(entry[20:]))
+
+		if itemOffset+itemLength > length {
+			return nil, fmt.Errorf("%w: VHDX metadata item out of range", ErrCorrupted)
+		}
+
+		items[guidString(entry[0:16])] = region[itemOffset : itemOffset+itemLength]
+	}
+
+	return items, nil
+}
+
+func (v *vhdx) ReadAt(b []byte, off int64) (int, error) {
+	if off >= v.size {
+		return 0, io.EOF
+	}
+
+	want := b
+	if remain := v.size - off; int64(len(want)) > remain {
+		want = want[:remain]
+	}
+
+	for n := 0; n < len(want); {
+		pos := off + int64(n)
+		block := pos / v.blockSize
+		inBlock := pos % v.blockSize
+
+		end := n + int(v.blockSize-inBlock)
+		if end > len(want) {
+			end = len(want)
+		}
+		part := want[n:end]
+
+		// a sector bitmap entry follows every chunkRatio payload entries
+		entry := v.bat[block+block/v.chunkRatio]
+
+		switch entry & vhdxBATStateMask {
+		case vhdxBlockFullyPresent:
+			fileOffset := int64(entry>>20)*vhdxMB + inBlock
+			if _, err := v.r.ReadAt(part, fileOffset); err != nil {
+				return n, fmt.Errorf("could not read VHDX block %d: %w", block, err)
+			}
+		case vhdxBlockPartialPresent:
+			return n, fmt.Errorf("%w: VHDX block %d is in the parent image", ErrUnsupported, block)
+		case vhdxBlockNotPresent, vhdxBlockUndefined, vhdxBlockZero, vhdxBlockUnmapped:
+			for i := range part {
+				part[i] = 0
+			}
+		default:
+			return n, fmt.Errorf("%w: bad state of VHDX block %d", ErrCorrupted, block)
+		}
+
+		n = end
+	}
+
+	if len(want) < len(b) {
+		return len(want), io.EOF
+	}
+
+	return len(b), nil
+}
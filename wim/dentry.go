@@ -0,0 +1,355 @@
+package wim
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io/fs"
+	"strings"
+	"time"
+
+	"github.com/Snshadow/ntfs-ads/internal/winfmt"
+)
+
+const (
+	dentrySize      = 102 // fixed part of wim_dentry_on_disk
+	streamEntrySize = 38  // fixed part of wim_extra_stream_entry_on_disk
+	maxDentryDepth  = 1024
+
+	attrDirectory = 0x10
+	attrReparse   = 0x400
+)
+
+// Dentry is a file or directory in an image.
+type Dentry struct {
+	Name           string
+	ShortName      string
+	Attributes     uint32 // FILE_ATTRIBUTE_*
+	SecurityID     int32  // index in security data, -1 if none
+	CreationTime   time.Time
+	LastAccessTime time.Time
+	LastWriteTime  time.Time
+	ReparseTag     uint32 // only for reparse points
+	Hash           Hash   // unnamed data stream
+	Streams        []StreamEntry
+	Children       []*Dentry
+
+	parent *Dentry
+}
+
+// StreamEntry is a named data stream of a dentry.
+type StreamEntry struct {
+	Name string
+	Hash Hash
+	Size int64
+}
+
+// IsDir reports whether the dentry is a directory.
+func (d *Dentry) IsDir() bool {
+	return d.Attributes&attrDirectory != 0
+}
+
+// Path returns full path of the dentry from the root of the image, separated with "/".
+func (d *Dentry) Path() string {
+	if d.parent == nil {
+		return "/"
+	}
+
+	var names []string
+	for cur := d; cur.parent != nil; cur = cur.parent {
+		names = append(names, cur.Name)
+	}
+
+	for i, j := 0, len(names)-1; i < j; i, j = i+1, j-1 {
+		names[i], names[j] = names[j], names[i]
+	}
+
+	return "/" + strings.Join(names, "/")
+}
+
+// StreamInfoMap returns name and size of named data streams of the dentry,
+// same as StreamInfoMap of FileADS.
+func (d *Dentry) StreamInfoMap() map[string]int64 {
+	streamInfoMap := make(map[string]int64, len(d.Streams))
+	for _, strm := range d.Streams {
+		streamInfoMap[strm.Name] = strm.Size
+	}
+
+	return streamInfoMap
+}
+
+// stream returns the named stream of the dentry, compared case-insensitively as in NTFS.
+func (d *Dentry) stream(name string) (*StreamEntry, bool) {
+	for i := range d.Streams {
+		if strings.EqualFold(d.Streams[i].Name, name) {
+			return &d.Streams[i], true
+		}
+	}
+
+	return nil, false
+}
+
+// child returns the child of the name, compared case-insensitively as in NTFS.
+func (d *Dentry) child(name string) (*Dentry, bool) {
+	for _, c := range d.Children {
+		if strings.EqualFold(c.Name, name) {
+			return c, true
+		}
+	}
+
+	return nil, false
+}
+
+// Image is an image in WIM, which has a directory tree of files.
+type Image struct {
+	Index int
+
+	w    *WIM
+	root *Dentry
+}
+
+// loadImage parses the metadata resource of an image, which has security
+// data followed by the root dentry.
+func (w *WIM) loadImage(index int, b *blob) (*Image, error) {
+	if b.hdr.size > maxTableSize {
+		return nil, fmt.Errorf("%w: metadata resource of size %d", ErrCorrupted, b.hdr.size)
+	}
+
+	rd, err := w.openResource(b.hdr)
+	if err != nil {
+		return nil, err
+	}
+
+	buf := make([]byte, rd.Size())
+	if n, err := rd.ReadAt(buf, 0); n < len(buf) {
+		return nil, fmt.Errorf("could not read metadata resource: %w", err)
+	}
+
+	if len(buf) < 8 {
+		return nil, fmt.Errorf("%w: metadata resource is too short", ErrCorrupted)
+	}
+
+	// total length of security data, aligned to 8 bytes
+	off := uint64(binary.LittleEndian.Uint32(buf))
+	if off < 8 {
+		off = 8
+	}
+	off = (off + 7) &^ 7
+
+	p := &metadataParser{
+		w:       w,
+		buf:     buf,
+		subdirs: make(map[*Dentry]uint64),
+		seen:    make(map[uint64]bool),
+	}
+
+	root, _, err := p.readDentry(off)
+	if err != nil {
+		return nil, err
+	}
+	if root == nil {
+		return nil, fmt.Errorf("%w: no root dentry", ErrCorrupted)
+	}
+	root.Name = ""
+
+	if err = p.readChildren(root, 0); err != nil {
+		return nil, err
+	}
+
+	return &Image{
+		Index: index,
+		w:     w,
+		root:  root,
+	}, nil
+}
+
+type metadataParser struct {
+	w   *WIM
+	buf []byte
+
+	subdirs map[*Dentry]uint64 // offset of children of directories
+	seen    map[uint64]bool    // offsets of children already read
+}
+
+// readDentry reads a dentry with its stream entries at off, returns nil if
+// it is the end of a directory, with offset of the next sibling.
+func (p *metadataParser) readDentry(off uint64) (*Dentry, uint64, error) {
+	buf := p.buf
+
+	if off > uint64(len(buf)) || uint64(len(buf))-off < 8 {
+		return nil, 0, fmt.Errorf("%w: dentry at %d exceeds metadata", ErrCorrupted, off)
+	}
+
+	length := binary.LittleEndian.Uint64(buf[off:])
+	if length <= 8 {
+		// end of directory
+		return nil, off + 8, nil
+	}
+
+	if length < dentrySize || length > uint64(len(buf))-off {
+		return nil, 0, fmt.Errorf("%w: invalid length %d of dentry at %d", ErrCorrupted, length, off)
+	}
+
+	b := buf[off : off+length]
+
+	d := &Dentry{
+		Attributes:     binary.LittleEndian.Uint32(b[8:]),
+		SecurityID:     int32(binary.LittleEndian.Uint32(b[12:])),
+		CreationTime:   winfmt.FiletimeToTime(binary.LittleEndian.Uint64(b[40:])),
+		LastAccessTime: winfmt.FiletimeToTime(binary.LittleEndian.Uint64(b[48:])),
+		LastWriteTime:  winfmt.FiletimeToTime(binary.LittleEndian.Uint64(b[56:])),
+	}
+	copy(d.Hash[:], b[64:84])
+
+	if d.Attributes&attrReparse != 0 {
+		d.ReparseTag = binary.LittleEndian.Uint32(b[88:])
+	}
+
+	numStreams := int(binary.LittleEndian.Uint16(b[96:]))
+	shortNameLen := uint64(binary.LittleEndian.Uint16(b[98:]))
+	nameLen := uint64(binary.LittleEndian.Uint16(b[100:]))
+
+	pos := uint64(dentrySize)
+	if pos+nameLen+shortNameLen > length {
+		return nil, 0, fmt.Errorf("%w: names exceed dentry at %d", ErrCorrupted, off)
+	}
+
+	d.Name = winfmt.DecodeUTF16(b[pos : pos+nameLen])
+	if nameLen > 0 {
+		pos += nameLen + 2 // null terminator
+	}
+	if pos+shortNameLen <= length {
+		d.ShortName = winfmt.DecodeUTF16(b[pos : pos+shortNameLen])
+	}
+
+	subdir := binary.LittleEndian.Uint64(b[16:])
+	if subdir != 0 {
+		p.subdirs[d] = subdir
+	}
+
+	next := off + (length+7)&^7
+	for i := 0; i < numStreams; i++ {
+		strm, strmLen, err := p.readStreamEntry(next)
+		if err != nil {
+			return nil, 0, err
+		}
+		next += (strmLen + 7) &^ 7
+
+		if strm.Name == "" {
+			// unnamed data stream is stored along with named ones
+			if !strm.Hash.IsZero() {
+				d.Hash = strm.Hash
+			}
+			continue
+		}
+
+		if strm.Size, err = p.w.StreamSize(strm.Hash); err != nil {
+			return nil, 0, fmt.Errorf("stream %q of %q: %w", strm.Name, d.Name, err)
+		}
+		d.Streams = append(d.Streams, strm)
+	}
+
+	return d, next, nil
+}
+
+// readStreamEntry reads an extra stream entry at off.
+func (p *metadataParser) readStreamEntry(off uint64) (StreamEntry, uint64, error) {
+	buf := p.buf
+
+	if off > uint64(len(buf)) || uint64(len(buf))-off < streamEntrySize {
+		return StreamEntry{}, 0, fmt.Errorf("%w: stream entry at %d exceeds metadata", ErrCorrupted, off)
+	}
+
+	length := binary.LittleEndian.Uint64(buf[off:])
+	nameLen := uint64(binary.LittleEndian.Uint16(buf[off+36:]))
+	if length < streamEntrySize+nameLen || length > uint64(len(buf))-off {
+		return StreamEntry{}, 0, fmt.Errorf("%w: invalid length %d of stream entry at %d", ErrCorrupted, length, off)
+	}
+
+	var strm StreamEntry
+	copy(strm.Hash[:], buf[off+16:off+36])
+	strm.Name = winfmt.DecodeUTF16(buf[off+streamEntrySize : off+streamEntrySize+nameLen])
+
+	return strm, length, nil
+}
+
+// readChildren reads children of the directory recursively.
+func (p *metadataParser) readChildren(dir *Dentry, depth int) error {
+	off, ok := p.subdirs[dir]
+	if !ok {
+		return nil
+	}
+	delete(p.subdirs, dir)
+
+	if depth >= maxDentryDepth {
+		return fmt.Errorf("%w: directory tree is too deep", ErrCorrupted)
+	}
+	if p.seen[off] {
+		return fmt.Errorf("%w: directory at %d is referenced twice", ErrCorrupted, off)
+	}
+	p.seen[off] = true
+
+	for {
+		child, next, err := p.readDentry(off)
+		if err != nil {
+			return err
+		}
+		if child == nil {
+			return nil
+		}
+
+		child.parent = dir
+		dir.Children = append(dir.Children, child)
+
+		if err = p.readChildren(child, depth+1); err != nil {
+			return err
+		}
+
+		off = next
+	}
+}
+
+// Root returns the root directory of the image.
+func (img *Image) Root() *Dentry {
+	return img.root
+}
+
+// Lookup returns the dentry with the path, compared case-insensitively as in NTFS.
+func (img *Image) Lookup(path string) (*Dentry, error) {
+	d := img.root
+
+	for _, name := range strings.Split(strings.ReplaceAll(path, "\\", "/"), "/") {
+		if name == "" {
+			continue
+		}
+
+		child, ok := d.child(name)
+		if !ok {
+			return nil, &fs.PathError{Op: "lookup", Path: path, Err: fs.ErrNotExist}
+		}
+		d = child
+	}
+
+	return d, nil
+}
+
+// WalkStreams calls fn for every dentry which has at least one named data
+// stream, in order of the directory tree.
+func (img *Image) WalkStreams(fn func(*Dentry) error) error {
+	return walk(img.root, fn)
+}
+
+func walk(d *Dentry, fn func(*Dentry) error) error {
+	if len(d.Streams) > 0 {
+		if err := fn(d); err != nil {
+			return err
+		}
+	}
+
+	for _, c := range d.Children {
+		if err := walk(c, fn); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,114 @@
+package wim
+
+import (
+	"io"
+	"io/fs"
+	"os"
+
+	ntfs_ads "github.com/Snshadow/ntfs-ads"
+)
+
+// Image is a read-only StreamFS, so that streams in it can be handled with
+// FileADS as other files, e.g. ntfs_ads.NewFileADS(img, "/Windows/explorer.exe").
+var _ ntfs_ads.StreamFS = (*Image)(nil)
+
+// ListStreams returns name and size of named data streams of the file in the image.
+func (img *Image) ListStreams(path string) (map[string]int64, error) {
+	d, err := img.Lookup(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if d.IsDir() && len(d.Streams) == 0 {
+		// same as FindFirstStreamW for directories without named stream
+		return nil, ntfs_ads.ErrNoADS
+	}
+
+	return d.StreamInfoMap(), nil
+}
+
+// OpenStream opens the named stream of the file in the image, which can only
+// be opened for reading.
+func (img *Image) OpenStream(path, name string, flag int) (ntfs_ads.Stream, error) {
+	strmPath := path + ":" + name
+
+	if flag&(os.O_WRONLY|os.O_RDWR|os.O_CREATE|os.O_TRUNC|os.O_APPEND) != 0 {
+		return nil, &fs.PathError{Op: "open", Path: strmPath, Err: fs.ErrPermission}
+	}
+
+	d, err := img.Lookup(path)
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: strmPath, Err: fs.ErrNotExist}
+	}
+
+	strm, ok := d.stream(name)
+	if !ok {
+		return nil, &fs.PathError{Op: "open", Path: strmPath, Err: fs.ErrNotExist}
+	}
+
+	sr, err := img.w.OpenHash(strm.Hash)
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: strmPath, Err: err}
+	}
+
+	return &stream{SectionReader: sr, path: strmPath}, nil
+}
+
+// RenameStream fails as the image is read-only.
+func (img *Image) RenameStream(path, oldName, newName string, overwrite bool) error {
+	return &os.LinkError{Op: "rename", Old: path + ":" + oldName, New: path + ":" + newName, Err: fs.ErrPermission}
+}
+
+// RemoveStream fails as the image is read-only.
+func (img *Image) RemoveStream(path, name string) error {
+	return &fs.PathError{Op: "remove", Path: path + ":" + name, Err: fs.ErrPermission}
+}
+
+// OpenUnnamed returns reader of the unnamed data stream of the dentry.
+func (img *Image) OpenUnnamed(d *Dentry) (*io.SectionReader, error) {
+	return img.w.OpenHash(d.Hash)
+}
+
+// stream is an opened stream of Image.
+type stream struct {
+	*io.SectionReader
+	path   string
+	closed bool
+}
+
+func (s *stream) Name() string {
+	return s.path
+}
+
+func (s *stream) Read(b []byte) (int, error) {
+	if s.closed {
+		return 0, &fs.PathError{Op: "read", Path: s.path, Err: fs.ErrClosed}
+	}
+
+	return s.SectionReader.Read(b)
+}
+
+func (s *stream) ReadAt(b []byte, off int64) (int, error) {
+	if s.closed {
+		return 0, &fs.PathError{Op: "read", Path: s.path, Err: fs.ErrClosed}
+	}
+
+	return s.SectionReader.ReadAt(b, off)
+}
+
+func (s *stream) Write(b []byte) (int, error) {
+	return 0, &fs.PathError{Op: "write", Path: s.path, Err: fs.ErrPermission}
+}
+
+func (s *stream) WriteAt(b []byte, off int64) (int, error) {
+	return 0, &fs.PathError{Op: "write", Path: s.path, Err: fs.ErrPermission}
+}
+
+func (s *stream) Close() error {
+	if s.closed {
+		return &fs.PathError{Op: "close", Path: s.path, Err: fs.ErrClosed}
+	}
+	s.closed = true
+
+	return nil
+}
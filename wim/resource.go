@@ -0,0 +1,197 @@
+package wim
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/Snshadow/ntfs-ads/internal/compress"
+)
+
+const (
+	solidHeaderSize = 16 // alt_chunk_table_header_disk
+)
+
+// sizedReaderAt is a decompressed resource.
+type sizedReaderAt interface {
+	io.ReaderAt
+	Size() int64
+}
+
+// decompressor returns decompression function of the format with chunkSize.
+func decompressor(c Compression, chunkSize int64) (compress.Func, error) {
+	switch c {
+	case CompressionXPRESS:
+		return compress.Xpress, nil
+	case CompressionLZX:
+		return compress.LZX(int(chunkSize)), nil
+	case CompressionLZMS:
+		return compress.LZMS, nil
+	}
+
+	return nil, fmt.Errorf("%w: compression %s", ErrUnsupported, c)
+}
+
+// openResource returns reader of decompressed data of a non-solid resource.
+func (w *WIM) openResource(hdr resHdr) (sizedReaderAt, error) {
+	if hdr.flags&resSpanned != 0 {
+		return nil, fmt.Errorf("%w: spanned resource", ErrUnsupported)
+	}
+
+	sr := io.NewSectionReader(w.r, hdr.offset, hdr.compressedSize)
+
+	if hdr.flags&resCompressed == 0 {
+		if hdr.compressedSize != hdr.size {
+			return nil, fmt.Errorf("%w: uncompressed resource of size %d has %d bytes",
+				ErrCorrupted, hdr.size, hdr.compressedSize)
+		}
+		return sr, nil
+	}
+
+	chunkSize := int64(w.ChunkSize)
+
+	decompress, err := decompressor(w.Compression, chunkSize)
+	if err != nil {
+		return nil, err
+	}
+
+	offsets, err := compress.ReadChunkTable(sr, hdr.compressedSize, hdr.size, chunkSize)
+	if err != nil {
+		return nil, err
+	}
+
+	return compress.NewChunkReader(sr, offsets, hdr.size, chunkSize, decompress), nil
+}
+
+// openSolidResource returns reader of decompressed data of a solid resource,
+// which has its own chunk size and compression format in its header, followed
+// by compressed sizes of all chunks.
+func (w *WIM) openSolidResource(hdr resHdr) (sizedReaderAt, error) {
+	sr := io.NewSectionReader(w.r, hdr.offset, hdr.compressedSize)
+
+	b := make([]byte, solidHeaderSize)
+	if n, err := sr.ReadAt(b, 0); n < len(b) {
+		return nil, fmt.Errorf("could not read header of solid resource: %w", err)
+	}
+
+	size := int64(binary.LittleEndian.Uint64(b))
+	chunkSize := int64(binary.LittleEndian.Uint32(b[8:]))
+	format := Compression(binary.LittleEndian.Uint32(b[12:]))
+
+	if size < 0 || chunkSize <= 0 {
+		return nil, fmt.Errorf("%w: solid resource of size %d with chunk size %d", ErrCorrupted, size, chunkSize)
+	}
+
+	decompress, err := decompressor(format, chunkSize)
+	if err != nil {
+		return nil, err
+	}
+
+	numChunks := (size + chunkSize - 1) / chunkSize
+	tableEnd := solidHeaderSize + numChunks*4
+	if tableEnd > hdr.compressedSize {
+		return nil, fmt.Errorf("%w: chunk table exceeds solid resource", ErrCorrupted)
+	}
+
+	table := make([]byte, numChunks*4)
+	if n, err := sr.ReadAt(table, solidHeaderSize); n < len(table) {
+		return nil, fmt.Errorf("could not read chunk table: %w", err)
+	}
+
+	offsets := make([]int64, numChunks+1)
+	offsets[0] = tableEnd
+	for i := int64(0); i < numChunks; i++ {
+		offsets[i+1] = offsets[i] + int64(binary.LittleEndian.Uint32(table[i*4:]))
+		if offsets[i+1] > hdr.compressedSize {
+			return nil, fmt.Errorf("%w: invalid size of chunk %d", ErrCorrupted, i)
+		}
+	}
+
+	return compress.NewChunkReader(sr, offsets, size, chunkSize, decompress), nil
+}
+
+// solidGroup is consecutive solid resources in the lookup table, streams
+// following them are stored in their concatenated data.
+type solidGroup struct {
+	w         *WIM
+	resources []resHdr
+	closed    bool // streams were found after the resources
+
+	once   sync.Once
+	err    error
+	parts  []sizedReaderAt
+	starts []int64 // offset of each resource in concatenated data
+	size   int64
+}
+
+func (g *solidGroup) open() error {
+	g.once.Do(func() {
+		for _, hdr := range g.resources {
+			rd, err := g.w.openSolidResource(hdr)
+			if err != nil {
+				g.err = err
+				return
+			}
+
+			g.parts = append(g.parts, rd)
+			g.starts = append(g.starts, g.size)
+			g.size += rd.Size()
+		}
+	})
+
+	return g.err
+}
+
+// ReadAt reads concatenated data of the resources at off.
+func (g *solidGroup) ReadAt(b []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, fmt.Errorf("wim: negative offset %d", off)
+	}
+
+	n := 0
+	for i, rd := range g.parts {
+		if n == len(b) {
+			break
+		}
+
+		start := g.starts[i]
+		if off+int64(n) >= start+rd.Size() {
+			continue
+		}
+
+		read, err := rd.ReadAt(b[n:], off+int64(n)-start)
+		n += read
+		if err != nil && err != io.EOF {
+			return n, err
+		}
+	}
+
+	if n < len(b) {
+		return n, io.EOF
+	}
+
+	return n, nil
+}
+
+// openBlob returns reader of decompressed data of the blob.
+func (w *WIM) openBlob(b *blob) (*io.SectionReader, error) {
+	if b.solid == nil {
+		rd, err := w.openResource(b.hdr)
+		if err != nil {
+			return nil, err
+		}
+
+		return io.NewSectionReader(rd, 0, rd.Size()), nil
+	}
+
+	if err := b.solid.open(); err != nil {
+		return nil, err
+	}
+
+	if b.hdr.offset < 0 || b.hdr.size < 0 || b.hdr.offset+b.hdr.size > b.solid.size {
+		return nil, fmt.Errorf("%w: stream %x exceeds solid resource", ErrCorrupted, b.hash[:])
+	}
+
+	return io.NewSectionReader(b.solid, b.hdr.offset, b.hdr.size), nil
+}
@@ -0,0 +1,300 @@
+// Package wim reads alternate data streams of files in Windows Imaging Format
+// archives, e.g. install.wim of Windows installation media, without the
+// Imaging API. WIM stores each data stream of a file once as a resource found
+// by its SHA-1 hash, which may be compressed with XPRESS, LZX or LZMS.
+//
+// Split WIM parts other than the opened one are not supported.
+package wim
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/Snshadow/ntfs-ads/internal/compress"
+)
+
+const (
+	headerSize     = 208
+	wimMagic       = "MSWIM\x00\x00\x00"
+	resHdrSize     = 24
+	blobEntrySize  = 50
+	hashSize       = 20
+	solidMagicSize = 0x100000000 // uncompressed size of solid resource entries
+	maxTableSize   = 1 << 30     // limit of lookup table and metadata read into memory
+
+	// flags of the header
+	FlagCompressed = 0x00000002
+	FlagReadOnly   = 0x00000004
+	FlagSpanned    = 0x00000008
+	FlagXPRESS     = 0x00020000
+	FlagLZX        = 0x00040000
+	FlagLZMS       = 0x00080000
+
+	// flags of resource headers
+	resFree       = 0x01
+	resMetadata   = 0x02
+	resCompressed = 0x04
+	resSpanned    = 0x08
+	resSolid      = 0x10
+)
+
+var (
+	ErrNotWIM      = errors.New("not a WIM file")
+	ErrUnsupported = errors.New("unsupported WIM feature")
+	ErrCorrupted   = compress.ErrCorrupted
+	ErrNoImage     = errors.New("image not found in WIM")
+	ErrNoResource  = errors.New("resource not found in WIM")
+)
+
+// Compression is compression format of WIM resources.
+type Compression uint32
+
+const (
+	CompressionNone   Compression = 0
+	CompressionXPRESS Compression = 1
+	CompressionLZX    Compression = 2
+	CompressionLZMS   Compression = 3
+)
+
+func (c Compression) String() string {
+	switch c {
+	case CompressionNone:
+		return "None"
+	case CompressionXPRESS:
+		return "XPRESS"
+	case CompressionLZX:
+		return "LZX"
+	case CompressionLZMS:
+		return "LZMS"
+	}
+
+	return fmt.Sprintf("Compression(%d)", uint32(c))
+}
+
+// Hash is SHA-1 hash of a data stream, by which its resource is found.
+type Hash [hashSize]byte
+
+// IsZero reports whether the hash is all zero, which is used for empty streams.
+func (h Hash) IsZero() bool {
+	return h == Hash{}
+}
+
+// resHdr is reshdr_disk of a resource.
+type resHdr struct {
+	compressedSize int64 // size_in_wim, 56 bits
+	flags          uint8
+	offset         int64
+	size           int64 // uncompressed size
+}
+
+func parseResHdr(b []byte) resHdr {
+	return resHdr{
+		compressedSize: int64(binary.LittleEndian.Uint64(b) & 0x00FFFFFFFFFFFFFF),
+		flags:          b[7],
+		offset:         int64(binary.LittleEndian.Uint64(b[8:])),
+		size:           int64(binary.LittleEndian.Uint64(b[16:])),
+	}
+}
+
+// blob is an entry of the lookup table.
+type blob struct {
+	hdr    resHdr
+	part   uint16
+	refCnt uint32
+	hash   Hash
+
+	solid *solidGroup // solid resources containing the blob, hdr.offset is offset in them
+}
+
+// WIM is a WIM file read from r.
+type WIM struct {
+	Version     uint32
+	Flags       uint32
+	ChunkSize   uint32 // chunk size of non-solid compressed resources
+	GUID        [16]byte
+	PartNumber  uint16
+	TotalParts  uint16
+	ImageCount  uint32
+	BootIndex   uint32 // index of bootable image, 0 if none
+	Compression Compression
+
+	r        io.ReaderAt
+	blobs    map[Hash]*blob
+	metadata []*blob // metadata resources in order of images
+
+	mut    sync.Mutex
+	images map[int]*Image // cache of parsed images
+}
+
+// Open reads the header and lookup table of WIM file from r.
+func Open(r io.ReaderAt) (*WIM, error) {
+	hdr := make([]byte, headerSize)
+	if n, err := r.ReadAt(hdr, 0); n < len(hdr) {
+		return nil, fmt.Errorf("could not read WIM header: %w", err)
+	}
+
+	if string(hdr[:8]) != wimMagic {
+		return nil, ErrNotWIM
+	}
+	if size := binary.LittleEndian.Uint32(hdr[8:]); size != headerSize {
+		return nil, fmt.Errorf("%w: header size %d", ErrNotWIM, size)
+	}
+
+	w := &WIM{
+		Version:    binary.LittleEndian.Uint32(hdr[12:]),
+		Flags:      binary.LittleEndian.Uint32(hdr[16:]),
+		ChunkSize:  binary.LittleEndian.Uint32(hdr[20:]),
+		PartNumber: binary.LittleEndian.Uint16(hdr[40:]),
+		TotalParts: binary.LittleEndian.Uint16(hdr[42:]),
+		ImageCount: binary.LittleEndian.Uint32(hdr[44:]),
+		BootIndex:  binary.LittleEndian.Uint32(hdr[120:]),
+		r:          r,
+		blobs:      make(map[Hash]*blob),
+		images:     make(map[int]*Image),
+	}
+	copy(w.GUID[:], hdr[24:40])
+
+	if w.Flags&FlagCompressed != 0 {
+		switch {
+		case w.Flags&FlagXPRESS != 0:
+			w.Compression = CompressionXPRESS
+		case w.Flags&FlagLZX != 0:
+			w.Compression = CompressionLZX
+		case w.Flags&FlagLZMS != 0:
+			w.Compression = CompressionLZMS
+		default:
+			return nil, fmt.Errorf("%w: compression flags 0x%08X", ErrUnsupported, w.Flags)
+		}
+	}
+
+	if w.ChunkSize == 0 {
+		// older versions have no chunk size
+		w.ChunkSize = 32768
+	}
+
+	if err := w.loadBlobTable(parseResHdr(hdr[48:])); err != nil {
+		return nil, err
+	}
+
+	return w, nil
+}
+
+// loadBlobTable reads the lookup table, which lists resources of streams and
+// metadata of images.
+func (w *WIM) loadBlobTable(hdr resHdr) error {
+	if hdr.size > maxTableSize {
+		return fmt.Errorf("%w: lookup table of size %d", ErrCorrupted, hdr.size)
+	}
+
+	rd, err := w.openResource(hdr)
+	if err != nil {
+		return fmt.Errorf("could not open lookup table: %w", err)
+	}
+
+	table := make([]byte, hdr.size)
+	if n, err := rd.ReadAt(table, 0); n < len(table) {
+		return fmt.Errorf("could not read lookup table: %w", err)
+	}
+
+	var group *solidGroup
+	for off := 0; off+blobEntrySize <= len(table); off += blobEntrySize {
+		b := &blob{
+			hdr:    parseResHdr(table[off:]),
+			part:   binary.LittleEndian.Uint16(table[off+resHdrSize:]),
+			refCnt: binary.LittleEndian.Uint32(table[off+resHdrSize+2:]),
+		}
+		copy(b.hash[:], table[off+resHdrSize+6:])
+
+		if b.hdr.flags&resSolid != 0 {
+			if b.hdr.size == solidMagicSize {
+				// solid resource, streams in it follow consecutive resources
+				if group == nil || group.closed {
+					group = &solidGroup{w: w}
+				}
+				group.resources = append(group.resources, b.hdr)
+				continue
+			}
+
+			if group == nil {
+				return fmt.Errorf("%w: stream in solid resource without resource", ErrCorrupted)
+			}
+			group.closed = true
+			b.solid = group
+		} else if group != nil {
+			group.closed = true
+		}
+
+		if b.part != w.PartNumber {
+			// stored in other part of split WIM
+			continue
+		}
+
+		if b.hdr.flags&resMetadata != 0 {
+			w.metadata = append(w.metadata, b)
+			continue
+		}
+
+		w.blobs[b.hash] = b
+	}
+
+	return nil
+}
+
+// Image returns the image of index, which starts from 1 as in DISM.
+func (w *WIM) Image(index int) (*Image, error) {
+	if index < 1 || index > len(w.metadata) {
+		return nil, fmt.Errorf("%w: index %d", ErrNoImage, index)
+	}
+
+	w.mut.Lock()
+	defer w.mut.Unlock()
+
+	if img, ok := w.images[index]; ok {
+		return img, nil
+	}
+
+	img, err := w.loadImage(index, w.metadata[index-1])
+	if err != nil {
+		return nil, fmt.Errorf("could not read metadata of image %d: %w", index, err)
+	}
+	w.images[index] = img
+
+	return img, nil
+}
+
+// StreamSize returns size of the stream with hash, 0 for zero hash.
+func (w *WIM) StreamSize(hash Hash) (int64, error) {
+	if hash.IsZero() {
+		return 0, nil
+	}
+
+	b, ok := w.blobs[hash]
+	if !ok {
+		return 0, fmt.Errorf("%w: %x", ErrNoResource, hash[:])
+	}
+
+	return b.hdr.size, nil
+}
+
+// OpenHash returns reader of decompressed data of the stream with hash.
+func (w *WIM) OpenHash(hash Hash) (*io.SectionReader, error) {
+	if hash.IsZero() {
+		return io.NewSectionReader(emptyReader{}, 0, 0), nil
+	}
+
+	b, ok := w.blobs[hash]
+	if !ok {
+		return nil, fmt.Errorf("%w: %x", ErrNoResource, hash[:])
+	}
+
+	return w.openBlob(b)
+}
+
+type emptyReader struct{}
+
+func (emptyReader) ReadAt(b []byte, off int64) (int, error) {
+	return 0, io.EOF
+}
@@ -0,0 +1,320 @@
+package wim
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/binary"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	ntfs_ads "github.com/Snshadow/ntfs-ads"
+)
+
+// WIM files in testdata are written by internal/compress/testdata/gen_wim.go,
+// lzx.wim has metadata and a stream of two chunks compressed with LZX, and
+// solid.wim has streams in a solid resource of two chunks compressed with LZMS.
+func readTestdata(t *testing.T, name string) []byte {
+	t.Helper()
+
+	b, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return b
+}
+
+func openImage(t *testing.T, b []byte) *Image {
+	t.Helper()
+
+	w, err := Open(bytes.NewReader(b))
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+
+	img, err := w.Image(1)
+	if err != nil {
+		t.Fatalf("Image: %v", err)
+	}
+
+	return img
+}
+
+// resourceOffset returns offset of the first resource with flags in the
+// lookup table of WIM file b.
+func resourceOffset(t *testing.T, b []byte, flags uint8) int {
+	t.Helper()
+
+	table := parseResHdr(b[48:])
+	for off := table.offset; off+blobEntrySize <= table.offset+table.size; off += blobEntrySize {
+		if hdr := parseResHdr(b[off:]); hdr.flags == flags {
+			return int(hdr.offset)
+		}
+	}
+
+	t.Fatalf("no resource with flags 0x%02X", flags)
+
+	return 0
+}
+
+func TestOpen(t *testing.T) {
+	tests := []struct {
+		file        string
+		version     uint32
+		compression Compression
+	}{
+		{"lzx.wim", 0x10D00, CompressionLZX},
+		{"solid.wim", 0xE00, CompressionLZMS},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			w, err := Open(bytes.NewReader(readTestdata(t, tt.file)))
+			if err != nil {
+				t.Fatalf("Open: %v", err)
+			}
+
+			if w.Version != tt.version || w.Compression != tt.compression {
+				t.Errorf("got version 0x%X with %s, want 0x%X with %s", w.Version, w.Compression, tt.version, tt.compression)
+			}
+			if w.ChunkSize != 32768 || w.ImageCount != 1 || w.PartNumber != 1 || w.TotalParts != 1 {
+				t.Errorf("got chunk size %d, image count %d, part %d of %d", w.ChunkSize, w.ImageCount, w.PartNumber, w.TotalParts)
+			}
+			if string(w.GUID[:]) != "ntfs-ads testwim" {
+				t.Errorf("got GUID %q", w.GUID[:])
+			}
+
+			if _, err = w.Image(2); !errors.Is(err, ErrNoImage) {
+				t.Errorf("Image(2): got %v, want %v", err, ErrNoImage)
+			}
+		})
+	}
+}
+
+func TestImageStreams(t *testing.T) {
+	zoneID := "[ZoneTransfer]\r\nZoneId=3\r\n"
+
+	tests := []struct {
+		file    string
+		path    string
+		unnamed string // prefix of unnamed data stream
+		streams map[string]int64
+		prefix  map[string]string // prefix of named streams
+	}{
+		{"lzx.wim", "/file.txt", "unnamed data",
+			map[string]int64{"Zone.Identifier": int64(len(zoneID))},
+			map[string]string{"Zone.Identifier": zoneID}},
+		// unnamed stream in an extra stream entry, and a stream of zero hash
+		{"lzx.wim", "/DIR/Big.TXT", "unnamed data",
+			map[string]int64{"big": 40000, "empty": 0}, nil},
+		// streams in a solid resource, "notes" starts in the first chunk and
+		// ends in the second
+		{"solid.wim", "/solid.txt", "line 0 of the stream in a solid resource ---",
+			map[string]int64{"notes": 2478}, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.file+tt.path, func(t *testing.T) {
+			img := openImage(t, readTestdata(t, tt.file))
+
+			got, err := img.ListStreams(tt.path)
+			if err != nil {
+				t.Fatalf("ListStreams: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.streams) {
+				t.Errorf("got streams %v, want %v", got, tt.streams)
+			}
+
+			d, err := img.Lookup(tt.path)
+			if err != nil {
+				t.Fatalf("Lookup: %v", err)
+			}
+
+			sr, err := img.OpenUnnamed(d)
+			if err != nil {
+				t.Fatalf("OpenUnnamed: %v", err)
+			}
+			unnamed, err := io.ReadAll(sr)
+			if err != nil {
+				t.Fatalf("read unnamed stream: %v", err)
+			}
+			if !strings.HasPrefix(string(unnamed), tt.unnamed) || sha1.Sum(unnamed) != d.Hash {
+				t.Errorf("unnamed stream of %d bytes differs, starting with %.50q", len(unnamed), unnamed)
+			}
+
+			for _, entry := range d.Streams {
+				strm, err := img.OpenStream(tt.path, strings.ToUpper(entry.Name), os.O_RDONLY)
+				if err != nil {
+					t.Fatalf("OpenStream(%q): %v", entry.Name, err)
+				}
+
+				data, err := io.ReadAll(strm)
+				strm.Close()
+				if err != nil {
+					t.Fatalf("read stream %q: %v", entry.Name, err)
+				}
+
+				// zero hash is of empty stream
+				if int64(len(data)) != entry.Size || (len(data) > 0 && sha1.Sum(data) != entry.Hash) {
+					t.Errorf("stream %q of %d bytes differs from hash", entry.Name, len(data))
+				}
+				if !strings.HasPrefix(string(data), tt.prefix[entry.Name]) {
+					t.Errorf("stream %q starts with %.50q, want %q", entry.Name, data, tt.prefix[entry.Name])
+				}
+			}
+		})
+	}
+}
+
+func TestImageTree(t *testing.T) {
+	img := openImage(t, readTestdata(t, "lzx.wim"))
+
+	var paths []string
+	err := img.WalkStreams(func(d *Dentry) error {
+		paths = append(paths, d.Path())
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("WalkStreams: %v", err)
+	}
+	if want := []string{"/file.txt", "/dir/big.txt"}; !reflect.DeepEqual(paths, want) {
+		t.Errorf("got %v, want %v", paths, want)
+	}
+
+	d, err := img.Lookup("/file.txt")
+	if err != nil {
+		t.Fatalf("Lookup: %v", err)
+	}
+	want := time.Date(2022, 6, 18, 4, 26, 40, 0, time.UTC)
+	if !d.LastWriteTime.Equal(want) || !d.CreationTime.Equal(want) || d.SecurityID != -1 || d.IsDir() {
+		t.Errorf("got %+v", d)
+	}
+
+	if _, err = img.ListStreams("/dir"); !errors.Is(err, ntfs_ads.ErrNoADS) {
+		t.Errorf("ListStreams of directory: got %v, want %v", err, ntfs_ads.ErrNoADS)
+	}
+	if _, err = img.Lookup("/missing"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Lookup: got %v, want %v", err, fs.ErrNotExist)
+	}
+	if _, err = img.OpenStream("/file.txt", "Zone.Identifier", os.O_RDWR); !errors.Is(err, fs.ErrPermission) {
+		t.Errorf("OpenStream for writing: got %v, want %v", err, fs.ErrPermission)
+	}
+}
+
+func TestOpenCorrupted(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func([]byte) []byte
+		want   error
+	}{
+		{"magic", func(b []byte) []byte {
+			b[0] = 'X'
+			return b
+		}, ErrNotWIM},
+		{"header size", func(b []byte) []byte {
+			binary.LittleEndian.PutUint32(b[8:], 200)
+			return b
+		}, ErrNotWIM},
+		{"compression", func(b []byte) []byte {
+			binary.LittleEndian.PutUint32(b[16:], FlagCompressed)
+			return b
+		}, ErrUnsupported},
+		{"lookup table too large", func(b []byte) []byte {
+			binary.LittleEndian.PutUint64(b[64:], maxTableSize+1)
+			return b
+		}, ErrCorrupted},
+		{"truncated", func(b []byte) []byte {
+			return b[:headerSize-1]
+		}, io.EOF},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := tt.modify(readTestdata(t, "lzx.wim"))
+
+			_, err := Open(bytes.NewReader(b))
+			if !errors.Is(err, tt.want) {
+				t.Errorf("got %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestImageCorrupted(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(t *testing.T, b []byte)
+	}{
+		{"dentry length", func(t *testing.T, b []byte) {
+			// root dentry after 8 bytes of security data
+			binary.LittleEndian.PutUint64(b[resourceOffset(t, b, resMetadata)+8:], dentrySize-1)
+		}},
+		{"directory loop", func(t *testing.T, b []byte) {
+			// children of root is root itself
+			binary.LittleEndian.PutUint64(b[resourceOffset(t, b, resMetadata)+8+16:], 8)
+		}},
+		{"security data", func(t *testing.T, b []byte) {
+			binary.LittleEndian.PutUint32(b[resourceOffset(t, b, resMetadata):], 1<<20)
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := readTestdata(t, "solid.wim")
+			tt.modify(t, b)
+
+			w, err := Open(bytes.NewReader(b))
+			if err != nil {
+				t.Fatalf("Open: %v", err)
+			}
+
+			if _, err = w.Image(1); !errors.Is(err, ErrCorrupted) {
+				t.Errorf("got %v, want %v", err, ErrCorrupted)
+			}
+		})
+	}
+}
+
+func TestSolidCorrupted(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(b []byte, res int)
+	}{
+		{"chunk size", func(b []byte, res int) {
+			// compressed size of the first chunk after the header
+			binary.LittleEndian.PutUint32(b[res+solidHeaderSize:], 1<<20)
+		}},
+		{"chunk of zero size", func(b []byte, res int) {
+			binary.LittleEndian.PutUint32(b[res+solidHeaderSize:], 0)
+		}},
+		{"chunk table", func(b []byte, res int) {
+			binary.LittleEndian.PutUint64(b[res:], 1<<40)
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := readTestdata(t, "solid.wim")
+			tt.modify(b, resourceOffset(t, b, resSolid|resCompressed))
+
+			img := openImage(t, b)
+
+			// the solid resource is opened on the first read
+			strm, err := img.OpenStream("/solid.txt", "notes", os.O_RDONLY)
+			if err == nil {
+				_, err = io.ReadAll(strm)
+				strm.Close()
+			}
+			if !errors.Is(err, ErrCorrupted) {
+				t.Errorf("got %v, want %v", err, ErrCorrupted)
+			}
+		})
+	}
+}
@@ -0,0 +1,42 @@
+package wof
+
+import (
+	"io"
+)
+
+// File is decompressed content of a WOF compressed file on a mounted volume,
+// should be closed with Close() after use.
+type File struct {
+	*Reader
+	strm io.Closer // opened WofCompressedData stream
+}
+
+// Close closes WofCompressedData stream of the file.
+func (f *File) Close() error {
+	return f.strm.Close()
+}
+
+// stream is WofCompressedData stream opened with OpenFileADS.
+type stream interface {
+	io.ReaderAt
+	io.Seeker
+	io.Closer
+}
+
+// newFile returns File reading strm with algorithm from reparse point, closes
+// strm on failure.
+func newFile(reparse []byte, strm stream, size int64) (*File, error) {
+	compressedSize, err := strm.Seek(0, io.SeekEnd)
+	if err != nil {
+		strm.Close()
+		return nil, err
+	}
+
+	r, err := newFileReader(reparse, strm, compressedSize, size)
+	if err != nil {
+		strm.Close()
+		return nil, err
+	}
+
+	return &File{Reader: r, strm: strm}, nil
+}
@@ -0,0 +1,46 @@
+//go:build linux
+// +build linux
+
+package wof
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+
+	"golang.org/x/sys/unix"
+
+	"github.com/Snshadow/ntfs-ads"
+)
+
+// reparse point of the file in ntfs-3g, whose value is REPARSE_DATA_BUFFER
+const ntfs3gReparseData = "system.ntfs_reparse_data"
+
+// OpenFile opens decompressed content of the WOF compressed file in NTFS
+// mounted with ntfs-3g, whose reparse point is read from ntfs-3g xattr and
+// WofCompressedData stream with DefaultFS.
+func OpenFile(path string) (*File, error) {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	size, err := unix.Getxattr(path, ntfs3gReparseData, nil)
+	if err == unix.ENODATA {
+		return nil, fmt.Errorf("%w: \"%s\" has no reparse point", ErrNotWOF, path)
+	} else if err != nil {
+		return nil, &fs.PathError{Op: "getxattr", Path: path, Err: err}
+	}
+
+	reparse := make([]byte, size)
+	if size, err = unix.Getxattr(path, ntfs3gReparseData, reparse); err != nil {
+		return nil, &fs.PathError{Op: "getxattr", Path: path, Err: err}
+	}
+
+	strm, err := ntfs_ads.OpenFileADS(path, StreamName, os.O_RDONLY)
+	if err != nil {
+		return nil, err
+	}
+
+	return newFile(reparse[:size], strm, info.Size())
+}
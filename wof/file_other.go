@@ -0,0 +1,9 @@
+//go:build !windows && !linux
+// +build !windows,!linux
+
+package wof
+
+// OpenFile is not supported on this platform, use OpenImageFile for NTFS image.
+func OpenFile(path string) (*File, error) {
+	return nil, ErrUnsupported
+}
@@ -0,0 +1,65 @@
+//go:build windows
+// +build windows
+
+package wof
+
+import (
+	"fmt"
+	"os"
+
+	"golang.org/x/sys/windows"
+
+	"github.com/Snshadow/ntfs-ads"
+)
+
+// getReparsePoint returns REPARSE_DATA_BUFFER of the file.
+func getReparsePoint(path string) ([]byte, error) {
+	u16Path, err := windows.UTF16PtrFromString(path)
+	if err != nil {
+		return nil, err
+	}
+
+	hnd, err := windows.CreateFile(u16Path, windows.FILE_READ_ATTRIBUTES,
+		windows.FILE_SHARE_READ|windows.FILE_SHARE_WRITE|windows.FILE_SHARE_DELETE, nil,
+		windows.OPEN_EXISTING, windows.FILE_FLAG_OPEN_REPARSE_POINT|windows.FILE_FLAG_BACKUP_SEMANTICS, 0)
+	if err != nil {
+		return nil, &os.PathError{Op: "open", Path: path, Err: err}
+	}
+	defer windows.CloseHandle(hnd)
+
+	buf := make([]byte, windows.MAXIMUM_REPARSE_DATA_BUFFER_SIZE)
+
+	var returned uint32
+	err = windows.DeviceIoControl(hnd, windows.FSCTL_GET_REPARSE_POINT, nil, 0,
+		&buf[0], uint32(len(buf)), &returned, nil)
+	if err == windows.ERROR_NOT_A_REPARSE_POINT {
+		return nil, fmt.Errorf("%w: \"%s\" has no reparse point", ErrNotWOF, path)
+	} else if err != nil {
+		return nil, &os.PathError{Op: "DeviceIoControl", Path: path, Err: err}
+	}
+
+	return buf[:returned], nil
+}
+
+// OpenFile opens decompressed content of the WOF compressed file, whose
+// reparse point is read with FSCTL_GET_REPARSE_POINT. WofCompressedData
+// stream is hidden while the WOF driver is attached to the volume, in which
+// case the file can be read as is.
+func OpenFile(path string) (*File, error) {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	reparse, err := getReparsePoint(path)
+	if err != nil {
+		return nil, err
+	}
+
+	strm, err := ntfs_ads.OpenFileADS(path, StreamName, os.O_RDONLY)
+	if err != nil {
+		return nil, err
+	}
+
+	return newFile(reparse, strm, info.Size())
+}
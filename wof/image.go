@@ -0,0 +1,63 @@
+package wof
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+
+	"github.com/Snshadow/ntfs-ads/ntfsimage"
+)
+
+// OpenImageFile opens decompressed content of the WOF compressed file of the
+// record in NTFS image, with algorithm from its $REPARSE_POINT attribute.
+func OpenImageFile(vol *ntfsimage.Volume, num uint64) (*Reader, error) {
+	rec, err := vol.ReadRecord(num)
+	if err != nil {
+		return nil, err
+	}
+
+	attrs, err := vol.Attributes(rec)
+	if err != nil {
+		return nil, err
+	}
+
+	rp, err := vol.OpenAttribute(attrs, ntfsimage.AttrReparsePoint, "")
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("%w: record %d has no reparse point", ErrNotWOF, num)
+	} else if err != nil {
+		return nil, err
+	}
+
+	reparse := make([]byte, rp.Size())
+	if _, err = rp.ReadAt(reparse, 0); err != nil && err != io.EOF {
+		return nil, fmt.Errorf("could not read reparse point: %w", err)
+	}
+
+	data, err := vol.OpenAttribute(attrs, ntfsimage.AttrData, "")
+	if err != nil {
+		return nil, err
+	}
+
+	strm, err := vol.OpenAttribute(attrs, ntfsimage.AttrData, StreamName)
+	if err != nil {
+		return nil, err
+	}
+
+	return newFileReader(reparse, strm, strm.Size(), data.Size())
+}
+
+// newFileReader returns Reader for the stream with algorithm from reparse
+// point, which is REPARSE_DATA_BUFFER.
+func newFileReader(reparse []byte, strm io.ReaderAt, compressedSize, size int64) (*Reader, error) {
+	info, err := ParseReparsePoint(reparse)
+	if err != nil {
+		return nil, err
+	}
+
+	if info.Provider != ProviderFile {
+		return nil, fmt.Errorf("%w: file is backed by provider %d, not in %s", ErrUnsupported, info.Provider, StreamName)
+	}
+
+	return NewReader(strm, compressedSize, size, info.Algorithm)
+}
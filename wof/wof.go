@@ -0,0 +1,167 @@
+// Package wof decompresses files compressed by Windows Overlay Filter, e.g.
+// with "compact /c /exe", whose content is stored in WofCompressedData stream
+// as chunks compressed with XPRESS or LZX, while the unnamed data stream is
+// left sparse.
+//
+// Windows decompresses these files transparently while the WOF driver is
+// attached, so this is useful for offline images and for volumes mounted
+// elsewhere, e.g. with ntfs-3g.
+package wof
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/Snshadow/ntfs-ads/internal/compress"
+)
+
+const (
+	StreamName    = "WofCompressedData"
+	ReparseTagWOF = 0x80000017
+
+	ProviderWIM  = 1 // file is backed by a WIM file
+	ProviderFile = 2 // file is compressed in WofCompressedData stream
+
+	reparseHeaderSize = 8
+	wofInfoSize       = 8
+	fileInfoSize      = 8
+)
+
+var (
+	ErrNotWOF      = errors.New("not a WOF compressed file")
+	ErrUnsupported = errors.New("unsupported WOF compression")
+	ErrCorrupted   = compress.ErrCorrupted
+)
+
+// Algorithm is compression format of FILE_PROVIDER_EXTERNAL_INFO_V1.
+type Algorithm uint32
+
+const (
+	XPRESS4K  Algorithm = 0
+	LZX       Algorithm = 1
+	XPRESS8K  Algorithm = 2
+	XPRESS16K Algorithm = 3
+)
+
+func (a Algorithm) String() string {
+	switch a {
+	case XPRESS4K:
+		return "XPRESS4K"
+	case LZX:
+		return "LZX"
+	case XPRESS8K:
+		return "XPRESS8K"
+	case XPRESS16K:
+		return "XPRESS16K"
+	}
+
+	return fmt.Sprintf("Algorithm(%d)", uint32(a))
+}
+
+// ChunkSize returns size of decompressed chunks of the algorithm, 0 if unknown.
+func (a Algorithm) ChunkSize() int64 {
+	switch a {
+	case XPRESS4K:
+		return 4096
+	case LZX:
+		return 32768
+	case XPRESS8K:
+		return 8192
+	case XPRESS16K:
+		return 16384
+	}
+
+	return 0
+}
+
+// ReparseInfo is WOF_EXTERNAL_INFO and FILE_PROVIDER_EXTERNAL_INFO_V1 stored
+// in reparse point of a compressed file.
+type ReparseInfo struct {
+	Version         uint32
+	Provider        uint32
+	ProviderVersion uint32
+	Algorithm       Algorithm // only for ProviderFile
+}
+
+// ParseReparsePoint parses REPARSE_DATA_BUFFER with tag, length and data, as
+// in $REPARSE_POINT attribute or returned by FSCTL_GET_REPARSE_POINT.
+func ParseReparsePoint(b []byte) (*ReparseInfo, error) {
+	if len(b) < reparseHeaderSize {
+		return nil, fmt.Errorf("%w: reparse point is too short", ErrNotWOF)
+	}
+
+	if tag := binary.LittleEndian.Uint32(b); tag != ReparseTagWOF {
+		return nil, fmt.Errorf("%w: reparse tag 0x%08X", ErrNotWOF, tag)
+	}
+
+	dataLen := int(binary.LittleEndian.Uint16(b[4:]))
+	if reparseHeaderSize+dataLen > len(b) {
+		return nil, fmt.Errorf("%w: reparse data is truncated", ErrNotWOF)
+	}
+
+	return ParseReparseData(b[reparseHeaderSize : reparseHeaderSize+dataLen])
+}
+
+// ParseReparseData parses data of WOF reparse point, without header of
+// REPARSE_DATA_BUFFER.
+func ParseReparseData(b []byte) (*ReparseInfo, error) {
+	if len(b) < wofInfoSize {
+		return nil, fmt.Errorf("%w: WOF_EXTERNAL_INFO is too short", ErrNotWOF)
+	}
+
+	info := &ReparseInfo{
+		Version:  binary.LittleEndian.Uint32(b),
+		Provider: binary.LittleEndian.Uint32(b[4:]),
+	}
+
+	if info.Provider != ProviderFile {
+		return info, nil
+	}
+
+	if len(b) < wofInfoSize+fileInfoSize {
+		return nil, fmt.Errorf("%w: FILE_PROVIDER_EXTERNAL_INFO is too short", ErrNotWOF)
+	}
+
+	info.ProviderVersion = binary.LittleEndian.Uint32(b[wofInfoSize:])
+	info.Algorithm = Algorithm(binary.LittleEndian.Uint32(b[wofInfoSize+4:]))
+
+	return info, nil
+}
+
+// Reader reads decompressed content of WofCompressedData stream.
+type Reader struct {
+	*compress.ChunkReader
+	algorithm Algorithm
+}
+
+// NewReader returns Reader for the stream r of compressedSize, which holds
+// content of size bytes compressed with algorithm. Size is the size of the
+// unnamed data stream of the file.
+func NewReader(r io.ReaderAt, compressedSize, size int64, algorithm Algorithm) (*Reader, error) {
+	chunkSize := algorithm.ChunkSize()
+	if chunkSize == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrUnsupported, algorithm)
+	}
+
+	offsets, err := compress.ReadChunkTable(r, compressedSize, size, chunkSize)
+	if err != nil {
+		return nil, err
+	}
+
+	decompress := compress.Xpress
+	if algorithm == LZX {
+		decompress = compress.LZX(int(chunkSize))
+	}
+
+	return &Reader{
+		ChunkReader: compress.NewChunkReader(r, offsets, size, chunkSize, decompress),
+		algorithm:   algorithm,
+	}, nil
+}
+
+// Algorithm returns compression format of the stream.
+func (r *Reader) Algorithm() Algorithm {
+	return r.algorithm
+}
@@ -0,0 +1,121 @@
+package wof
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// samples in testdata are written by internal/compress/testdata/gen.go
+func readTestdata(t *testing.T, name string) []byte {
+	t.Helper()
+
+	b, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return b
+}
+
+func TestReader(t *testing.T) {
+	plain := readTestdata(t, "plain.bin")
+
+	tests := []struct {
+		name      string
+		algorithm Algorithm
+	}{
+		{"xpress4k", XPRESS4K},
+		{"xpress8k", XPRESS8K},
+		{"xpress16k", XPRESS16K},
+		{"lzx", LZX},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reparse := readTestdata(t, tt.name+".reparse")
+			strm := readTestdata(t, tt.name+".wof")
+
+			info, err := ParseReparsePoint(reparse)
+			if err != nil {
+				t.Fatalf("ParseReparsePoint: %v", err)
+			}
+			want := ReparseInfo{Version: 1, Provider: ProviderFile, ProviderVersion: 1, Algorithm: tt.algorithm}
+			if *info != want {
+				t.Errorf("got %+v, want %+v", *info, want)
+			}
+
+			r, err := newFileReader(reparse, bytes.NewReader(strm), int64(len(strm)), int64(len(plain)))
+			if err != nil {
+				t.Fatalf("newFileReader: %v", err)
+			}
+
+			got, err := io.ReadAll(io.NewSectionReader(r, 0, r.Size()))
+			if err != nil {
+				t.Fatalf("read: %v", err)
+			}
+			if !bytes.Equal(got, plain) {
+				t.Errorf("decompressed data differs from plaintext")
+			}
+
+			// read across chunks at an offset
+			off := tt.algorithm.ChunkSize() - 10
+			b := make([]byte, 20)
+			if _, err := r.ReadAt(b, off); err != nil {
+				t.Fatalf("ReadAt: %v", err)
+			}
+			if !bytes.Equal(b, plain[off:off+20]) {
+				t.Errorf("ReadAt(%d) = %q, want %q", off, b, plain[off:off+20])
+			}
+		})
+	}
+}
+
+func TestParseReparsePoint(t *testing.T) {
+	reparse := func(tag uint32, dataLen uint16, provider uint32) []byte {
+		b := make([]byte, 8+16)
+		binary.LittleEndian.PutUint32(b, tag)
+		binary.LittleEndian.PutUint16(b[4:], dataLen)
+		binary.LittleEndian.PutUint32(b[8:], 1)
+		binary.LittleEndian.PutUint32(b[12:], provider)
+		binary.LittleEndian.PutUint32(b[16:], 1)
+		binary.LittleEndian.PutUint32(b[20:], uint32(XPRESS8K))
+		return b
+	}
+
+	tests := []struct {
+		name    string
+		b       []byte
+		want    *ReparseInfo
+		wantErr error
+	}{
+		{"file", reparse(ReparseTagWOF, 16, ProviderFile), &ReparseInfo{1, ProviderFile, 1, XPRESS8K}, nil},
+		{"wim", reparse(ReparseTagWOF, 16, ProviderWIM), &ReparseInfo{Version: 1, Provider: ProviderWIM}, nil},
+		{"symlink", reparse(0xA000000C, 16, ProviderFile), nil, ErrNotWOF},
+		{"truncated", reparse(ReparseTagWOF, 32, ProviderFile), nil, ErrNotWOF},
+		{"short provider info", reparse(ReparseTagWOF, 12, ProviderFile), nil, ErrNotWOF},
+		{"short header", []byte{0x17, 0x00, 0x00}, nil, ErrNotWOF},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			info, err := ParseReparsePoint(tt.b)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got error %v, want %v", err, tt.wantErr)
+			}
+			if tt.want != nil && *info != *tt.want {
+				t.Errorf("got %+v, want %+v", *info, *tt.want)
+			}
+		})
+	}
+}
+
+func TestNewReaderUnsupported(t *testing.T) {
+	if _, err := NewReader(bytes.NewReader(nil), 0, 0, Algorithm(4)); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("got %v, want %v", err, ErrUnsupported)
+	}
+}
@@ -0,0 +1,560 @@
+//go:build linux
+// +build linux
+
+package ntfs_ads
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+const (
+	DefaultXattrPrefix = "user." // namespace of extended attributes writable by file owner
+
+	xattrNameMax = 255   // XATTR_NAME_MAX, maximum length of xattr name in bytes
+	xattrSizeMax = 65536 // XATTR_SIZE_MAX, maximum size of xattr value allowed by kernel
+)
+
+var (
+	ErrStreamTooLarge = errors.New("stream exceeds xattr size limit of file system")
+)
+
+// DefaultFS is the backend used by GetFileADS and OpenFileADS, which stores
+// each stream in an extended attribute of the file, or uses the streams
+// interface of ntfs-3g for files in NTFS mounted with it.
+var DefaultFS StreamFS = DetectFS{Default: XattrFS{Prefix: DefaultXattrPrefix}}
+
+// SambaXattrFS stores streams the same way as vfs_streams_xattr module of Samba
+// with its default options, so streams of files in a share match what Windows
+// clients see.
+var SambaXattrFS = XattrFS{
+	Prefix:        "user.DosStream.",
+	Suffix:        ":$DATA",
+	NULTerminated: true,
+	FoldCase:      true,
+}
+
+// XattrFS is a StreamFS which stores each stream of a file in an extended
+// attribute named with Prefix followed by the stream name and Suffix.
+type XattrFS struct {
+	Prefix string
+	Suffix string
+
+	NULTerminated bool // value of the xattr has a trailing NUL after stream data
+	FoldCase      bool // stream names are matched case-insensitively
+}
+
+// attrName returns name of the xattr holding the stream.
+func (x XattrFS) attrName(name string) (string, error) {
+	if x.Suffix != "" && len(name) > len(x.Suffix) && strings.EqualFold(name[len(name)-len(x.Suffix):], x.Suffix) {
+		// stream type is given with the name, e.g. "name:$DATA"
+		name = name[:len(name)-len(x.Suffix)]
+	}
+
+	if name == "" {
+		return "", fs.ErrInvalid
+	}
+
+	attr := x.Prefix + name + x.Suffix
+	if len(attr) > xattrNameMax {
+		return "", unix.ERANGE
+	}
+
+	return attr, nil
+}
+
+// lookupAttr returns name of the xattr holding the stream and whether it exists,
+// existing xattr is found case-insensitively if FoldCase is set.
+func (x XattrFS) lookupAttr(path, name string) (string, bool, error) {
+	attr, err := x.attrName(name)
+	if err != nil {
+		return "", false, err
+	}
+
+	if !x.FoldCase {
+		_, err = unix.Getxattr(path, attr, nil)
+		if err == unix.ENODATA {
+			return attr, false, nil
+		}
+
+		return attr, err == nil, err
+	}
+
+	attrs, err := listxattr(path)
+	if err != nil {
+		return "", false, err
+	}
+
+	for _, stored := range attrs {
+		if strings.EqualFold(stored, attr) {
+			return stored, true, nil
+		}
+	}
+
+	return attr, false, nil
+}
+
+// streamName returns stream name of the xattr, or empty string if the xattr does not hold a stream.
+func (x XattrFS) streamName(attr string) string {
+	if !strings.HasPrefix(attr, x.Prefix) || !strings.HasSuffix(attr, x.Suffix) {
+		return ""
+	}
+
+	if len(attr) <= len(x.Prefix)+len(x.Suffix) {
+		return ""
+	}
+
+	return attr[len(x.Prefix) : len(attr)-len(x.Suffix)]
+}
+
+// sizeLimit returns maximum size of stream data which fits in a xattr.
+func (x XattrFS) sizeLimit() int64 {
+	if x.NULTerminated {
+		return xattrSizeMax - 1
+	}
+
+	return xattrSizeMax
+}
+
+// encode returns value of the xattr storing the stream data.
+func (x XattrFS) encode(data []byte) []byte {
+	if x.NULTerminated {
+		return append(bytes.Clone(data), 0)
+	}
+
+	return bytes.Clone(data)
+}
+
+// decode returns stream data stored in the value of the xattr.
+func (x XattrFS) decode(value []byte) []byte {
+	if x.NULTerminated && len(value) > 0 {
+		return value[:len(value)-1]
+	}
+
+	return value
+}
+
+// xattrErr converts errno from xattr syscalls into errors of this package.
+func xattrErr(op, path string, err error) error {
+	switch err {
+	case unix.ENOTSUP:
+		return ErrUnsupported
+	case unix.ENODATA:
+		err = fs.ErrNotExist
+	}
+
+	return &fs.PathError{Op: op, Path: path, Err: err}
+}
+
+func listxattr(path string) ([]string, error) {
+	size, err := unix.Listxattr(path, nil)
+	for err == nil {
+		if size == 0 {
+			return nil, nil
+		}
+
+		buf := make([]byte, size)
+
+		size, err = unix.Listxattr(path, buf)
+		if err == unix.ERANGE {
+			// attributes were added in between, retry with new size
+			size, err = unix.Listxattr(path, nil)
+			continue
+		} else if err != nil {
+			break
+		}
+
+		return strings.Split(strings.TrimSuffix(string(buf[:size]), "\x00"), "\x00"), nil
+	}
+
+	return nil, err
+}
+
+func getxattr(path, attr string) ([]byte, error) {
+	size, err := unix.Getxattr(path, attr, nil)
+	for err == nil {
+		buf := make([]byte, size)
+		if size == 0 {
+			return buf, nil
+		}
+
+		size, err = unix.Getxattr(path, attr, buf)
+		if err == unix.ERANGE {
+			size, err = unix.Getxattr(path, attr, nil)
+			continue
+		} else if err != nil {
+			break
+		}
+
+		return buf[:size], nil
+	}
+
+	return nil, err
+}
+
+// setxattr sets value of the xattr, reporting values over the size limit with ErrStreamTooLarge.
+func setxattr(path, attr string, data []byte, flags int) error {
+	if len(data) > xattrSizeMax {
+		return fmt.Errorf("%w: %d bytes for \"%s\", limit is %d bytes", ErrStreamTooLarge, len(data), attr, xattrSizeMax)
+	}
+
+	err := unix.Setxattr(path, attr, data, flags)
+	if err == unix.E2BIG || err == unix.ERANGE {
+		// ENOSPC is not mapped, as it is also returned when the file system is full
+		return fmt.Errorf("%w: %d bytes for \"%s\": %v", ErrStreamTooLarge, len(data), attr, err)
+	}
+
+	return err
+}
+
+// ListStreams returns name and size of streams stored in xattrs of the file.
+func (x XattrFS) ListStreams(path string) (map[string]int64, error) {
+	attrs, err := listxattr(path)
+	if err != nil {
+		return nil, xattrErr("listxattr", path, err)
+	}
+
+	streamInfoMap := make(map[string]int64)
+
+	for _, attr := range attrs {
+		name := x.streamName(attr)
+		if name == "" {
+			continue
+		}
+
+		size, err := unix.Getxattr(path, attr, nil)
+		if err == unix.ENODATA {
+			// removed in between
+			continue
+		} else if err != nil {
+			return nil, xattrErr("getxattr", path, err)
+		}
+
+		if x.NULTerminated && size > 0 {
+			size--
+		}
+
+		streamInfoMap[name] = int64(size)
+	}
+
+	return streamInfoMap, nil
+}
+
+// OpenStream opens the stream stored in xattr of the file with flag used in os.OpenFile().
+// Value of the xattr is read on open, written data are stored on Close or Sync.
+func (x XattrFS) OpenStream(path, name string, flag int) (Stream, error) {
+	strmPath := path + ":" + name
+
+	attr, exists, err := x.lookupAttr(path, name)
+	if err != nil {
+		return nil, xattrErr("open", strmPath, err)
+	}
+
+	var data []byte
+	if exists {
+		value, err := getxattr(path, attr)
+		if err == unix.ENODATA {
+			// removed in between
+			exists = false
+		} else if err != nil {
+			return nil, xattrErr("open", strmPath, err)
+		}
+		data = x.decode(value)
+	}
+
+	switch {
+	case exists && flag&(os.O_CREATE|os.O_EXCL) == os.O_CREATE|os.O_EXCL:
+		return nil, &fs.PathError{Op: "open", Path: strmPath, Err: fs.ErrExist}
+	case !exists && flag&os.O_CREATE == 0:
+		return nil, &fs.PathError{Op: "open", Path: strmPath, Err: fs.ErrNotExist}
+	case !exists || flag&os.O_TRUNC != 0:
+		data = nil
+		if err = setxattr(path, attr, x.encode(nil), 0); err != nil {
+			return nil, xattrErr("open", strmPath, err)
+		}
+	}
+
+	strm := &bufStream{
+		path:  strmPath,
+		flag:  flag,
+		buf:   data,
+		limit: x.sizeLimit(),
+		flush: func(b []byte) error {
+			return setxattr(path, attr, x.encode(b), unix.XATTR_REPLACE)
+		},
+	}
+
+	return strm, nil
+}
+
+// RenameStream renames the stream by copying value of the xattr into a new one.
+func (x XattrFS) RenameStream(path, oldName, newName string, overwrite bool) error {
+	oldPath, newPath := path+":"+oldName, path+":"+newName
+
+	oldAttr, exists, err := x.lookupAttr(path, oldName)
+	if err != nil {
+		return &os.LinkError{Op: "rename", Old: oldPath, New: newPath, Err: err}
+	} else if !exists {
+		return &os.LinkError{Op: "rename", Old: oldPath, New: newPath, Err: fs.ErrNotExist}
+	}
+
+	newAttr, exists, err := x.lookupAttr(path, newName)
+	if err != nil {
+		return &os.LinkError{Op: "rename", Old: oldPath, New: newPath, Err: err}
+	}
+
+	if exists && newAttr != oldAttr && !overwrite {
+		return &os.LinkError{Op: "rename", Old: oldPath, New: newPath, Err: fs.ErrExist}
+	}
+
+	// attribute of the new name, which differs from an existing one only in case with FoldCase
+	dstAttr := newAttr
+	if x.FoldCase {
+		if dstAttr, err = x.attrName(newName); err != nil {
+			return &os.LinkError{Op: "rename", Old: oldPath, New: newPath, Err: err}
+		}
+	}
+	if dstAttr == oldAttr {
+		return nil
+	}
+
+	// the existing stream is only replaced after its value is copied
+	data, err := getxattr(path, oldAttr)
+	if err == unix.ENODATA {
+		return &os.LinkError{Op: "rename", Old: oldPath, New: newPath, Err: fs.ErrNotExist}
+	} else if err != nil {
+		return &os.LinkError{Op: "rename", Old: oldPath, New: newPath, Err: err}
+	}
+
+	setFlag := unix.XATTR_CREATE
+	if overwrite {
+		setFlag = 0
+	}
+
+	err = setxattr(path, dstAttr, data, setFlag)
+	if err == unix.EEXIST {
+		return &os.LinkError{Op: "rename", Old: oldPath, New: newPath, Err: fs.ErrExist}
+	} else if err != nil {
+		return &os.LinkError{Op: "rename", Old: oldPath, New: newPath, Err: err}
+	}
+
+	if exists && newAttr != oldAttr && newAttr != dstAttr {
+		// replaced stream whose name differs in case
+		if err = unix.Removexattr(path, newAttr); err != nil && err != unix.ENODATA {
+			return &os.LinkError{Op: "rename", Old: oldPath, New: newPath, Err: err}
+		}
+	}
+
+	if err = unix.Removexattr(path, oldAttr); err != nil {
+		return &os.LinkError{Op: "rename", Old: oldPath, New: newPath, Err: err}
+	}
+
+	return nil
+}
+
+// RemoveStream removes xattr of the stream from the file.
+func (x XattrFS) RemoveStream(path, name string) error {
+	strmPath := path + ":" + name
+
+	attr, exists, err := x.lookupAttr(path, name)
+	if err != nil {
+		return xattrErr("remove", strmPath, err)
+	} else if !exists {
+		return &fs.PathError{Op: "remove", Path: strmPath, Err: fs.ErrNotExist}
+	}
+
+	if err = unix.Removexattr(path, attr); err != nil {
+		return xattrErr("remove", strmPath, err)
+	}
+
+	return nil
+}
+
+// OpenFileADS opens stream of the name from the given file in DefaultFS with
+// specified flag(used in os.OpenFile()), should be closed with Close() after use.
+func OpenFileADS(path string, name string, openFlag int) (Stream, error) {
+	return DefaultFS.OpenStream(path, name, openFlag)
+}
+
+// GetFileADS returns ADS handler with a map of streams from the specified
+// file, which are stored in DefaultFS.
+func GetFileADS(path string) (FileADS, error) {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return FileADS{}, err
+	}
+
+	return NewFileADS(DefaultFS, absPath)
+}
+
+// bufStream is a stream whose whole content is kept in memory while opened,
+// used for backends which can only get or set the value at once.
+type bufStream struct {
+	path   string
+	flag   int
+	buf    []byte
+	off    int64
+	limit  int64 // maximum size of the stream
+	dirty  bool
+	closed bool
+
+	flush func([]byte) error // stores content of the stream
+}
+
+func (s *bufStream) Name() string {
+	return s.path
+}
+
+func (s *bufStream) check(op string, write bool) error {
+	if s.closed {
+		return &fs.PathError{Op: op, Path: s.path, Err: fs.ErrClosed}
+	}
+
+	access := s.flag & (os.O_RDONLY | os.O_WRONLY | os.O_RDWR)
+	if (write && access == os.O_RDONLY) || (!write && access == os.O_WRONLY) {
+		return &fs.PathError{Op: op, Path: s.path, Err: unix.EBADF}
+	}
+
+	return nil
+}
+
+func (s *bufStream) Read(b []byte) (int, error) {
+	if err := s.check("read", false); err != nil {
+		return 0, err
+	}
+
+	n, err := s.ReadAt(b, s.off)
+	s.off += int64(n)
+	if n > 0 && err == io.EOF {
+		err = nil
+	}
+
+	return n, err
+}
+
+func (s *bufStream) ReadAt(b []byte, off int64) (int, error) {
+	if err := s.check("read", false); err != nil {
+		return 0, err
+	}
+	if off < 0 {
+		return 0, &fs.PathError{Op: "readat", Path: s.path, Err: fs.ErrInvalid}
+	}
+
+	if off >= int64(len(s.buf)) {
+		if len(b) == 0 {
+			return 0, nil
+		}
+		return 0, io.EOF
+	}
+
+	n := copy(b, s.buf[off:])
+	if n < len(b) {
+		return n, io.EOF
+	}
+
+	return n, nil
+}
+
+func (s *bufStream) Write(b []byte) (int, error) {
+	if err := s.check("write", true); err != nil {
+		return 0, err
+	}
+
+	if s.flag&os.O_APPEND != 0 {
+		s.off = int64(len(s.buf))
+	}
+
+	n, err := s.writeAt(b, s.off)
+	s.off += int64(n)
+
+	return n, err
+}
+
+func (s *bufStream) WriteAt(b []byte, off int64) (int, error) {
+	if err := s.check("write", true); err != nil {
+		return 0, err
+	}
+	if s.flag&os.O_APPEND != 0 || off < 0 {
+		return 0, &fs.PathError{Op: "writeat", Path: s.path, Err: fs.ErrInvalid}
+	}
+
+	return s.writeAt(b, off)
+}
+
+func (s *bufStream) writeAt(b []byte, off int64) (int, error) {
+	end := off + int64(len(b))
+	if end > s.limit {
+		return 0, &fs.PathError{Op: "write", Path: s.path, Err: fmt.Errorf("%w: %d bytes, limit is %d bytes", ErrStreamTooLarge, end, s.limit)}
+	}
+
+	if end > int64(len(s.buf)) {
+		s.buf = append(s.buf, make([]byte, end-int64(len(s.buf)))...)
+	}
+
+	copy(s.buf[off:], b)
+	s.dirty = true
+
+	return len(b), nil
+}
+
+func (s *bufStream) Seek(offset int64, whence int) (int64, error) {
+	if s.closed {
+		return 0, &fs.PathError{Op: "seek", Path: s.path, Err: fs.ErrClosed}
+	}
+
+	var abs int64
+	switch whence {
+	case io.SeekStart:
+		abs = offset
+	case io.SeekCurrent:
+		abs = s.off + offset
+	case io.SeekEnd:
+		abs = int64(len(s.buf)) + offset
+	default:
+		return 0, &fs.PathError{Op: "seek", Path: s.path, Err: fs.ErrInvalid}
+	}
+
+	if abs < 0 {
+		return 0, &fs.PathError{Op: "seek", Path: s.path, Err: fs.ErrInvalid}
+	}
+
+	s.off = abs
+
+	return abs, nil
+}
+
+// Sync stores written data of the stream.
+func (s *bufStream) Sync() error {
+	if s.closed {
+		return &fs.PathError{Op: "sync", Path: s.path, Err: fs.ErrClosed}
+	}
+
+	if !s.dirty {
+		return nil
+	}
+
+	if err := s.flush(s.buf); err != nil {
+		return &fs.PathError{Op: "sync", Path: s.path, Err: err}
+	}
+
+	s.dirty = false
+
+	return nil
+}
+
+// Close stores written data and closes the stream.
+func (s *bufStream) Close() error {
+	err := s.Sync()
+
+	s.closed = true
+
+	return err
+}
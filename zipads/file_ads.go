@@ -0,0 +1,70 @@
+//go:build windows || linux
+// +build windows linux
+
+package zipads
+
+import (
+	"archive/zip"
+	"errors"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/Snshadow/ntfs-ads"
+)
+
+// AddFile writes the file or directory at path as an entry of the name,
+// followed by entries of its named streams from GetFileADS.
+func AddFile(zw *zip.Writer, path, name string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+
+	fh, err := zip.FileInfoHeader(info)
+	if err != nil {
+		return err
+	}
+	fh.Name = name
+	if info.IsDir() {
+		fh.Name = strings.TrimSuffix(name, "/") + "/"
+	} else {
+		fh.Method = zip.Deflate
+	}
+
+	w, err := zw.CreateHeader(fh)
+	if err != nil {
+		return err
+	}
+
+	if !info.IsDir() {
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		if _, err = io.Copy(w, f); err != nil {
+			return err
+		}
+	}
+
+	ads, err := ntfs_ads.GetFileADS(path)
+	if err != nil {
+		if errors.Is(err, ntfs_ads.ErrNoADS) || errors.Is(err, ntfs_ads.ErrUnsupported) {
+			return nil
+		}
+
+		return err
+	}
+
+	return CreateStreams(zw, &ads, fh)
+}
+
+// Restore writes entries of named streams in the archive into files extracted
+// under dir with OpenFileADS, see RestoreFS.
+func Restore(zr *zip.Reader, dir string, opts *Options) error {
+	return restore(zr, dir, opts, func(path, name string) (io.WriteCloser, error) {
+		return ntfs_ads.OpenFileADS(path, name, restoreFlag)
+	})
+}
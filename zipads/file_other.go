@@ -0,0 +1,20 @@
+//go:build !windows && !linux
+// +build !windows,!linux
+
+package zipads
+
+import (
+	"archive/zip"
+
+	"github.com/Snshadow/ntfs-ads"
+)
+
+// AddFile is not supported on this platform, use CreateStreams with a StreamFS.
+func AddFile(zw *zip.Writer, path, name string) error {
+	return ntfs_ads.ErrUnsupported
+}
+
+// Restore is not supported on this platform, use RestoreFS with a StreamFS.
+func Restore(zr *zip.Reader, dir string, opts *Options) error {
+	return ntfs_ads.ErrUnsupported
+}
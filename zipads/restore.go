@@ -0,0 +1,132 @@
+package zipads
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/Snshadow/ntfs-ads"
+	"github.com/Snshadow/ntfs-ads/internal/streamentry"
+)
+
+const (
+	DefaultMaxStreamSize = 16 << 20  // default limit of size of each stream
+	DefaultMaxTotalSize  = 256 << 20 // default limit of total size of streams
+)
+
+// Options limits streams restored from an archive, which may be malicious.
+type Options struct {
+	MaxStreamSize int64                    // limit of size of each stream, DefaultMaxStreamSize if zero
+	MaxTotalSize  int64                    // limit of total size of streams, DefaultMaxTotalSize if zero
+	Allow         func(stream string) bool // streams not allowed are skipped, all streams are allowed if nil
+}
+
+func (o *Options) maxStreamSize() int64 {
+	if o == nil || o.MaxStreamSize == 0 {
+		return DefaultMaxStreamSize
+	}
+
+	return o.MaxStreamSize
+}
+
+func (o *Options) maxTotalSize() int64 {
+	if o == nil || o.MaxTotalSize == 0 {
+		return DefaultMaxTotalSize
+	}
+
+	return o.MaxTotalSize
+}
+
+func (o *Options) allow(stream string) bool {
+	return o == nil || o.Allow == nil || o.Allow(stream)
+}
+
+// RestoreFS writes entries of named streams in the archive into files in fsys
+// extracted under dir, which should be extracted before by the caller with
+// other entries. Streams are only restored into files which have their own
+// entries in the archive, replacing streams with the same name.
+func RestoreFS(zr *zip.Reader, fsys ntfs_ads.StreamFS, dir string, opts *Options) error {
+	return restore(zr, dir, opts, func(path, name string) (io.WriteCloser, error) {
+		return fsys.OpenStream(path, name, restoreFlag)
+	})
+}
+
+func restore(zr *zip.Reader, dir string, opts *Options, open func(path, name string) (io.WriteCloser, error)) error {
+	// names of entries other than streams
+	files := make(map[string]bool)
+	for _, f := range zr.File {
+		if _, _, ok := ParseStreamHeader(&f.FileHeader); !ok {
+			files[strings.TrimSuffix(f.Name, "/")] = true
+		}
+	}
+
+	var total int64
+	for _, f := range zr.File {
+		name, stream, ok := ParseStreamHeader(&f.FileHeader)
+		if !ok {
+			continue
+		}
+
+		if !ntfs_ads.ValidStreamName(stream) {
+			return fmt.Errorf("%w: name of stream \"%s\" is invalid", ErrInvalidStream, f.Name)
+		}
+
+		name = strings.TrimSuffix(name, "/")
+		if !filepath.IsLocal(filepath.FromSlash(name)) {
+			return fmt.Errorf("%w: file \"%s\" of stream \"%s\" is outside of the directory", ErrInvalidStream, name, stream)
+		}
+		if !files[name] {
+			return fmt.Errorf("%w: file \"%s\" of stream \"%s\" is not in the archive", ErrInvalidStream, name, stream)
+		}
+
+		link, err := streamentry.Symlink(dir, name)
+		if err != nil {
+			return err
+		}
+		if link != "" {
+			return fmt.Errorf("%w: \"%s\" of stream \"%s\" is a symbolic link", ErrInvalidStream, link, stream)
+		}
+
+		if !opts.allow(stream) {
+			continue
+		}
+
+		size := int64(f.UncompressedSize64)
+		if size < 0 || size > opts.maxStreamSize() {
+			return fmt.Errorf("%w: stream \"%s\" has %d bytes", ErrTooLarge, f.Name, f.UncompressedSize64)
+		}
+		if total += size; total > opts.maxTotalSize() {
+			return fmt.Errorf("%w: total size of streams exceeds %d bytes", ErrTooLarge, opts.maxTotalSize())
+		}
+
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := restoreStream(f, size, open, path, stream); err != nil {
+			return fmt.Errorf("could not restore stream \"%s\" of \"%s\": %w", stream, path, err)
+		}
+	}
+
+	return nil
+}
+
+func restoreStream(f *zip.File, size int64, open func(path, name string) (io.WriteCloser, error), path, name string) error {
+	r, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	w, err := open(path, name)
+	if err != nil {
+		return err
+	}
+
+	// size in the header is checked by zip.File, but never write more than it
+	if _, err = io.Copy(w, io.LimitReader(r, size)); err != nil {
+		w.Close()
+		return err
+	}
+
+	return w.Close()
+}
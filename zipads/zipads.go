@@ -0,0 +1,130 @@
+// Package zipads keeps named data streams of files in zip archives.
+//
+// Each named stream of a file is stored as a companion entry following the
+// entry of the file, named "<file>:<stream>" and marked with the extra field
+// of ExtraID, whose data is a version byte followed by the name of the stream
+// in UTF-8. Tools which do not know the extra field extract the entry as a
+// sidecar file next to the file.
+package zipads
+
+import (
+	"archive/zip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+
+	"github.com/Snshadow/ntfs-ads"
+	"github.com/Snshadow/ntfs-ads/internal/streamentry"
+)
+
+const (
+	// ExtraID is the header ID of the extra field marking entries of streams.
+	ExtraID = 0x5341 // "AS"
+
+	extraVersion = 1
+	extraHdrSize = 4 // header ID and data size
+)
+
+// restoreFlag opens streams of the file for restoring.
+const restoreFlag = os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+
+var (
+	ErrInvalidStream = errors.New("invalid stream entry")
+	ErrTooLarge      = errors.New("stream exceeds size limit")
+)
+
+// streamExtra returns the extra field marking the entry of the stream.
+func streamExtra(stream string) []byte {
+	b := make([]byte, extraHdrSize, extraHdrSize+1+len(stream))
+	binary.LittleEndian.PutUint16(b, ExtraID)
+	binary.LittleEndian.PutUint16(b[2:], uint16(1+len(stream)))
+	b = append(b, extraVersion)
+
+	return append(b, stream...)
+}
+
+// parseExtra returns name of the stream from extra fields, or false if the
+// extra field of ExtraID is not found.
+func parseExtra(extra []byte) (string, bool) {
+	for len(extra) >= extraHdrSize {
+		id := binary.LittleEndian.Uint16(extra)
+		size := int(binary.LittleEndian.Uint16(extra[2:]))
+		extra = extra[extraHdrSize:]
+		if size > len(extra) {
+			break
+		}
+
+		if id == ExtraID && size > 1 && extra[0] == extraVersion {
+			return string(extra[1:size]), true
+		}
+
+		extra = extra[size:]
+	}
+
+	return "", false
+}
+
+// StreamHeader returns header of the entry for the stream, modified time is
+// copied from fh of the file.
+func StreamHeader(fh *zip.FileHeader, stream string) *zip.FileHeader {
+	return &zip.FileHeader{
+		Name:     streamentry.Name(fh.Name, stream),
+		Method:   zip.Deflate,
+		Modified: fh.Modified,
+		Extra:    streamExtra(stream),
+	}
+}
+
+// ParseStreamHeader returns entry name of the file and name of the stream if
+// fh is an entry of a named stream. The name of the stream is not validated.
+func ParseStreamHeader(fh *zip.FileHeader) (name, stream string, ok bool) {
+	stream, ok = parseExtra(fh.Extra)
+	if !ok || stream == "" {
+		return "", "", false
+	}
+
+	name, ok = streamentry.FileName(fh.Name, stream)
+	if !ok {
+		return "", "", false
+	}
+
+	return name, stream, true
+}
+
+// CreateStreams writes all named streams of ads as entries following the
+// entry of the file, which should be created with fh before.
+func CreateStreams(zw *zip.Writer, ads *ntfs_ads.FileADS, fh *zip.FileHeader) error {
+	names := make([]string, 0, len(ads.StreamInfoMap))
+	for name := range ads.StreamInfoMap {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if err := createStream(zw, ads, fh, name); err != nil {
+			return fmt.Errorf("could not write stream \"%s\" of \"%s\": %w", name, ads.Path, err)
+		}
+	}
+
+	return nil
+}
+
+func createStream(zw *zip.Writer, ads *ntfs_ads.FileADS, fh *zip.FileHeader, name string) error {
+	strm, err := ads.OpenADS(name, os.O_RDONLY)
+	if err != nil {
+		return err
+	}
+	defer strm.Close()
+
+	w, err := zw.CreateHeader(StreamHeader(fh, name))
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(w, strm)
+
+	return err
+}